@@ -0,0 +1,146 @@
+// Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
+// Данный пакет предоставляет возможность сменить мастер-пароль, сменить ключ шифрования, удалить аккаунт
+// и изменить глубину истории записей.
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
+)
+
+// account - настройки аккаунта: смена мастер-пароля, смена ключа шифрования, удаление аккаунта и глубина истории.
+func (a *App) account(reader *bufio.Reader) {
+	fmt.Printf("\n\nSelect what do you want to do?\n\n")
+	data :=
+		`1. Change master password.
+2. Rotate encryption key.
+3. Delete account.
+4. Item history depth.
+5. Return.`
+	fmt.Printf(data + "\n")
+	dataSelect, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatalf("Error in reading input: %v", err)
+	}
+	switch strings.TrimSpace(dataSelect) {
+	case "1":
+		fmt.Printf("\nCurrent password:\n")
+		password, err := reader.ReadString('\n')
+		a.checkError(err)
+		fmt.Printf("\nNew password:\n")
+		newPassword, err := reader.ReadString('\n')
+		a.checkError(err)
+		fmt.Printf("\nRepeat new password:\n")
+		repeat, err := reader.ReadString('\n')
+		a.checkError(err)
+		newPassword = strings.TrimSpace(newPassword)
+		if newPassword != strings.TrimSpace(repeat) {
+			fmt.Printf("\npasswords do not match")
+			return
+		}
+		err = a.manager.ChangePassword(strings.TrimSpace(password), newPassword)
+		if errors.Is(err, manager.ErrVaultNotUploaded) {
+			fmt.Printf("\nPassword is changed, but the vault is not uploaded to the server yet." +
+				"\nLog in again on this device before using the new password on other devices")
+			return
+		}
+		if err != nil {
+			printAuthError(err)
+			return
+		}
+		fmt.Printf("\nPassword is changed, other devices are logged out")
+	case "2":
+		if !a.confirmRotation(reader) {
+			return
+		}
+		fmt.Printf("\nAll your data will be re-encrypted with a new key, other devices are logged out. Enter your password to confirm:\n")
+		password, err := reader.ReadString('\n')
+		a.checkError(err)
+		a.rotateKey(strings.TrimSpace(password))
+	case "3":
+		fmt.Printf("\nAll your data will be deleted from the server. Enter your password to confirm:\n")
+		password, err := reader.ReadString('\n')
+		a.checkError(err)
+		if err = a.manager.DeleteAccount(strings.TrimSpace(password)); err != nil {
+			printAuthError(err)
+			return
+		}
+		fmt.Printf("\nAccount is deleted")
+	case "4":
+		a.historyDepth(reader)
+	case "5":
+	default:
+		fmt.Println("Please enter a valid option in the given list!")
+	}
+}
+
+// rotateKey - смена ключа шифрования. Прерванную смену можно повторить, она продолжится с тем же новым ключом.
+func (a *App) rotateKey(password string) {
+	if err := a.manager.RotateKey(password); err != nil {
+		a.logger.LogErr(err, "failed to rotate key")
+		fmt.Printf("\nfailed to rotate the key, try again: %v", err)
+		return
+	}
+	fmt.Printf("\nEncryption key is rotated")
+}
+
+// confirmRotation - подтверждение смены ключа: корзина и прежние версии записей зашифрованы старым ключом
+// и удаляются с сервера вместе с ним.
+func (a *App) confirmRotation(reader *bufio.Reader) bool {
+	trash, depth, err := a.manager.RotationLoss()
+	if err != nil {
+		a.logger.LogErr(err, "failed to get trash and history")
+		fmt.Printf("\nfailed to check the trash and history, try again: %v", err)
+		return false
+	}
+	if trash == 0 && depth == 0 {
+		return true
+	}
+	fmt.Printf("\nThe old key stops opening anything, so the server deletes data that is not re-encrypted:")
+	if trash > 0 {
+		fmt.Printf("\n- %d items in the trash", trash)
+	}
+	if depth > 0 {
+		fmt.Printf("\n- previous versions of all items")
+	}
+	fmt.Printf("\nRotate the key anyway? y/n\n")
+	answer, err := reader.ReadString('\n')
+	a.checkError(err)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// historyDepth - глубина истории записей: сколько прежних версий каждой записи хранит сервер.
+func (a *App) historyDepth(reader *bufio.Reader) {
+	depth, err := a.manager.HistoryDepth()
+	if err != nil {
+		fmt.Printf("\nsomething wrong, try again")
+		return
+	}
+	fmt.Printf("\nThe server keeps %d previous versions of each item. Enter a new number, 0 to keep none, or press Enter to return:\n", depth)
+	depthText, err := reader.ReadString('\n')
+	a.checkError(err)
+	depthText = strings.TrimSpace(depthText)
+	if depthText == "" {
+		return
+	}
+	depth, err = strconv.Atoi(depthText)
+	if err != nil {
+		fmt.Printf("\nwrong number")
+		return
+	}
+	if err = a.manager.SetHistoryDepth(depth); err != nil {
+		fmt.Printf("\nfailed to change history depth: %v", err)
+		return
+	}
+	fmt.Printf("\nHistory depth is changed")
+}
@@ -43,6 +43,7 @@ loop:
 			fmt.Printf("\nPlease enter password:\n")
 			p.Pass, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			p.ItemMeta = a.readMeta(reader, model.ItemMeta{}, false)
 			if err := a.manager.AddPassword(&p); err != nil {
 				fmt.Printf("\nsomething wrong, try again")
 			}
@@ -58,6 +59,7 @@ loop:
 			fmt.Printf("\nCVC number:\n")
 			c.CVC, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			c.ItemMeta = a.readMeta(reader, model.ItemMeta{}, false)
 			if err := a.manager.AddCard(&c); err != nil {
 				fmt.Printf("\nsomething wrong, try again")
 			}
@@ -66,6 +68,7 @@ loop:
 			fmt.Printf("\nPlease enter a text:\n")
 			t.Text, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			t.ItemMeta = a.readMeta(reader, model.ItemMeta{}, false)
 			if err := a.manager.AddText(&t); err != nil {
 				fmt.Printf("\nsomething wrong, try again")
 			}
@@ -74,6 +77,7 @@ loop:
 			fmt.Printf("\nPlease enter a binary:\n")
 			b.Data, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			b.ItemMeta = a.readMeta(reader, model.ItemMeta{}, false)
 			if err := a.manager.AddBinary(&b); err != nil {
 				fmt.Printf("\nsomething wrong, try again")
 			}
@@ -3,11 +3,14 @@ package app
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
@@ -21,10 +24,14 @@ type App struct {
 	client  http.Client
 	logger  *loggers.Logger
 	cfg     *config.Config
+	//mu - меню держит его, пока выполняет выбранное действие; idle ждет его, чтобы не блокировать посреди действия
+	mu        sync.Mutex
+	idleTimer *time.Timer
 }
 
 func NewApp() *App {
 	cfg := config.ConfigInit()
+	flag.Parse()
 	logger := loggers.NewLogger()
 	c := crypto.NewRSA(*cfg, logger)
 	client := &http.Client{}
@@ -38,8 +45,19 @@ func NewApp() *App {
 	}
 }
 
-// Run - функция запуска клиента.
+// Run - функция запуска клиента. Меню работает под a.mu и отпускает его, пока ждет ввода (см. stdin),
+// поэтому блокировка по бездействию не ждет, пока пользователь ответит на вопрос меню.
 func (a *App) Run() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	//при бездействии хранилище блокируется, а сессия завершается
+	if a.cfg.IdleTimeout > 0 {
+		a.idleTimer = time.AfterFunc(a.cfg.IdleTimeout, a.idle)
+		defer a.idleTimer.Stop()
+	}
+	reader := bufio.NewReader(stdin{a})
+	a.resume(reader)
+	a.resolveConflicts(reader)
 	for {
 		fmt.Printf("\n\nWhat do you want to do?\n\n")
 		options :=
@@ -49,11 +67,14 @@ func (a *App) Run() {
 4. Update data.
 5. Remove data.
 6. View data on server.
-7. Exit program.
+7. My devices.
+8. Two-factor authentication.
+9. Account settings.
+10. Logout from PASSMANAGER.
+11. Exit program.
 		
 `
 		fmt.Printf(options)
-		reader := bufio.NewReader(os.Stdin)
 
 		option, err := reader.ReadString('\n')
 		if err != nil {
@@ -74,14 +95,52 @@ func (a *App) Run() {
 			a.deleteData(reader)
 		case "6":
 			a.getData(reader)
+		case "7":
+			a.devices(reader)
+		case "8":
+			a.twoFactor(reader)
+		case "9":
+			a.account(reader)
+		case "10":
+			a.logout()
 		default:
 			fmt.Println("Please enter a valid option in the given list!")
-		case "7":
-			break
+		case "11":
+			a.manager.Lock()
 		}
-		if option == "7" {
+		//конфликты появляются при любой отправке изменений, в том числе из очереди
+		a.resolveConflicts(reader)
+		if option == "11" {
 			fmt.Println("Exiting PASSMANAGER.")
 			break
 		}
 	}
 }
+
+// stdin - ввод меню. На время ожидания ввода a.mu отпускается, а каждый ввод откладывает блокировку
+// по бездействию.
+type stdin struct {
+	a *App
+}
+
+// Read - чтение os.Stdin без a.mu. Вызывается только из меню, которое держит a.mu.
+func (s stdin) Read(p []byte) (int, error) {
+	s.a.mu.Unlock()
+	n, err := os.Stdin.Read(p)
+	s.a.mu.Lock()
+	if s.a.idleTimer != nil {
+		s.a.idleTimer.Reset(s.a.cfg.IdleTimeout)
+	}
+	return n, err
+}
+
+// idle - блокировка хранилища и выход после бездействия. Ключ стирается сразу, не дожидаясь меню,
+// а токены и кэш - когда меню отпустит a.mu: при ожидании ввода это происходит сразу, при запросе к серверу -
+// после его завершения.
+func (a *App) idle() {
+	a.manager.LockKey()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.manager.Lock()
+	fmt.Printf("\nVault locked after inactivity, please auth again.\n")
+}
@@ -0,0 +1,917 @@
+// Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
+// Данный пакет выполняет команды без диалога, для скриптов и CI: passmanager [флаги] команда [аргументы].
+// Результат печатается в stdout (с флагом --json в формате JSON), ошибки - в stderr, итог - кодом завершения.
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// Коды завершения команд.
+const (
+	ExitOK       = 0 // Команда выполнена.
+	ExitError    = 1 // Ошибка сервера, сети или данных.
+	ExitUsage    = 2 // Неверные аргументы.
+	ExitAuth     = 3 // Вход не выполнен: неверный логин, пароль или код второго фактора.
+	ExitNotFound = 4 // Запись не найдена.
+	ExitConflict = 5 // Запись изменили на другом устройстве.
+)
+
+// Переменные окружения, которые заменяют флаги, чтобы пароль не попадал в историю команд.
+const (
+	envUser     = "PASSMANAGER_USER"
+	envPassword = "PASSMANAGER_PASSWORD"
+	envCode     = "PASSMANAGER_CODE"
+)
+
+const usage = `Usage: passmanager [flags] <command> [arguments]
+
+Commands:
+  register --user LOGIN [--stdin-password]       create an account
+  login    --user LOGIN [--stdin-password]       log in, unlock the vault and save the session
+  list     cards|passwords|texts|binaries        print all items of the type
+  get      card|password|text|binary ID          print one item
+  add      card --number N --name NAME --cvc C
+  add      password --login LOGIN --stdin-password
+  add      text (--text TEXT | --stdin)
+  add      binary (--file PATH | --stdin)
+  update   TYPE ID <same flags as add>
+           add and update also take [--title T] [--url U] [--notes N] [--tags a,b] [--favorite[=false]]
+  delete   TYPE ID
+  kinds                                          print the item types the server stores
+  logout                                         end the saved session and remove it
+
+login and register save the session of the profile, the next commands reuse it until it expires,
+so --user and the two-factor code are needed only to log in.
+The account login is taken from --user or ` + envUser + `, the master password from ` + envPassword + `.
+For register and login --stdin-password reads the master password from stdin,
+for add and update password it reads the stored password.
+The two-factor code is taken from --code or ` + envCode + `.
+update keeps the title, URL, notes, tags and favorite mark that are not given.
+TYPE can also be a type added on the server (see kinds), its items take (--text TEXT | --stdin).
+update and delete apply only to the version of the item this device has seen. If the item was changed
+on another device, the change is kept and passmanager without a command asks which version to keep.
+--json prints the result as JSON.
+Exit codes: 0 ok, 1 error, 2 usage, 3 auth failed, 4 not found, 5 changed on another device.
+`
+
+// cliError - ошибка команды с кодом завершения.
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string {
+	return e.err.Error()
+}
+
+func (e *cliError) Unwrap() error {
+	return e.err
+}
+
+// usageError - ошибка в аргументах команды.
+func usageError(format string, a ...interface{}) error {
+	return &cliError{code: ExitUsage, err: fmt.Errorf(format, a...)}
+}
+
+// cliOptions - флаги команд.
+type cliOptions struct {
+	user          string
+	code          string
+	json          bool
+	stdinPassword bool
+	stdin         bool
+	number        string
+	name          string
+	cvc           string
+	login         string
+	text          string
+	file          string
+	title         string
+	url           string
+	notes         string
+	tags          string
+	favorite      bool
+	//флаги, заданные в команде, чтобы изменение не стирало незаданные общие поля записи
+	set map[string]bool
+}
+
+// Виды записей.
+const (
+	kindCard     = "card"
+	kindPassword = "password"
+	kindText     = "text"
+	kindBinary   = "binary"
+)
+
+// metaView - общие поля записи в выводе команд.
+type metaView struct {
+	Title     string    `json:"title,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Favorite  bool      `json:"favorite"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newMetaView - общие поля расшифрованной записи для вывода.
+func newMetaView(m model.ItemMeta) metaView {
+	return metaView{Title: string(m.Title), URL: string(m.URL), Notes: string(m.Notes), Tags: manager.SplitTags(m.Tags),
+		Favorite: m.Favorite, CreatedAt: m.CreatedAt, UpdatedAt: m.UpdatedAt}
+}
+
+// cardView - карта в выводе команд.
+type cardView struct {
+	ID     int    `json:"id"`
+	Number string `json:"number"`
+	Name   string `json:"name"`
+	CVC    string `json:"cvc"`
+	metaView
+}
+
+// passwordView - пара логин/пароль в выводе команд.
+type passwordView struct {
+	ID       int    `json:"id"`
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	metaView
+}
+
+// textView - текстовые данные в выводе команд.
+type textView struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+	metaView
+}
+
+// binaryView - бинарные данные в выводе команд, в JSON кодируются base64.
+type binaryView struct {
+	ID   int    `json:"id"`
+	Data []byte `json:"data"`
+	metaView
+}
+
+// itemView - запись вида, добавленного на сервере, в выводе команд.
+type itemView struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+	metaView
+}
+
+// Exec - выполнение команды args без диалога. Возвращает код завершения.
+func (a *App) Exec(args []string) int {
+	//менеджер печатает сообщения в stdout, в выводе команды должен остаться только результат
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	err := a.exec(stdout, args)
+	a.manager.Lock()
+	if err == nil {
+		return ExitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	fmt.Fprintf(os.Stderr, "passmanager: %v\n", err)
+	var ce *cliError
+	if errors.As(err, &ce) {
+		if ce.code == ExitUsage {
+			fmt.Fprint(os.Stderr, "\n"+usage)
+		}
+		return ce.code
+	}
+	return ExitError
+}
+
+// exec - разбор и выполнение команды, результат печатается в w.
+func (a *App) exec(w io.Writer, args []string) error {
+	var o cliOptions
+	fs := flag.NewFlagSet("passmanager "+args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&o.user, "user", os.Getenv(envUser), "account login")
+	fs.StringVar(&o.code, "code", os.Getenv(envCode), "two-factor code")
+	fs.BoolVar(&o.json, "json", false, "print result as JSON")
+	fs.BoolVar(&o.stdinPassword, "stdin-password", false, "read password from stdin")
+	fs.BoolVar(&o.stdin, "stdin", false, "read text or binary data from stdin")
+	fs.StringVar(&o.number, "number", "", "card number")
+	fs.StringVar(&o.name, "name", "", "card holder")
+	fs.StringVar(&o.cvc, "cvc", "", "card CVC")
+	fs.StringVar(&o.login, "login", "", "stored login")
+	fs.StringVar(&o.text, "text", "", "text data")
+	fs.StringVar(&o.file, "file", "", "file with binary data")
+	fs.StringVar(&o.title, "title", "", "item title")
+	fs.StringVar(&o.url, "url", "", "website of the item")
+	fs.StringVar(&o.notes, "notes", "", "notes for the item")
+	fs.StringVar(&o.tags, "tags", "", "comma separated tags")
+	fs.BoolVar(&o.favorite, "favorite", false, "mark the item as favorite")
+	pos, err := parseArgs(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(os.Stderr, usage)
+			return err
+		}
+		return usageError("%v", err)
+	}
+	o.set = make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { o.set[f.Name] = true })
+
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Fprint(w, usage)
+		return nil
+	case "register":
+		return a.cliRegister(&o)
+	case "login":
+		password, err := masterPassword(&o)
+		if err != nil {
+			return err
+		}
+		return a.signIn(&o, password)
+	case "list":
+		if len(pos) != 1 {
+			return usageError("list needs one item type")
+		}
+		return a.cliList(w, &o, pos[0])
+	case "get":
+		if len(pos) != 2 {
+			return usageError("get needs item type and id")
+		}
+		return a.cliGet(w, &o, pos[0], pos[1])
+	case "add":
+		if len(pos) != 1 {
+			return usageError("add needs one item type")
+		}
+		return a.cliSave(w, &o, pos[0], 0)
+	case "update":
+		if len(pos) != 2 {
+			return usageError("update needs item type and id")
+		}
+		id, err := parseID(pos[1])
+		if err != nil {
+			return err
+		}
+		return a.cliSave(w, &o, pos[0], id)
+	case "delete":
+		if len(pos) != 2 {
+			return usageError("delete needs item type and id")
+		}
+		return a.cliDelete(w, &o, pos[0], pos[1])
+	case "kinds":
+		return a.cliKinds(w, &o)
+	case "logout":
+		return a.cliLogout(&o)
+	default:
+		return usageError("unknown command %s", args[0])
+	}
+}
+
+// parseArgs - разбор флагов, которые могут стоять и до, и после аргументов команды.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return pos, nil
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+}
+
+// parseKind - вид записи по имени в единственном или множественном числе. Другие имена - виды, добавленные
+// на сервере, они проверяются после входа (см. checkKind).
+func parseKind(s string) (string, error) {
+	switch kind := strings.ToLower(s); kind {
+	case "card", "cards":
+		return kindCard, nil
+	case "password", "passwords":
+		return kindPassword, nil
+	case "text", "texts":
+		return kindText, nil
+	case "binary", "binaries":
+		return kindBinary, nil
+	case "":
+		return "", usageError("item type is required")
+	default:
+		return kind, nil
+	}
+}
+
+// isBuiltinKind - вид kind встроенный, для него есть свои флаги и методы.
+func isBuiltinKind(kind string) bool {
+	switch kind {
+	case kindCard, kindPassword, kindText, kindBinary:
+		return true
+	}
+	return false
+}
+
+// checkKind - проверка, что вид kind встроенный или есть на сервере.
+func (a *App) checkKind(kind string) error {
+	if isBuiltinKind(kind) {
+		return nil
+	}
+	kinds, err := a.manager.ItemKinds()
+	if err != nil {
+		return err
+	}
+	names := []string{kindCard, kindPassword, kindText, kindBinary}
+	for _, k := range kinds {
+		if k.Builtin {
+			continue
+		}
+		if k.Name == kind {
+			return nil
+		}
+		names = append(names, k.Name)
+	}
+	return usageError("unknown item type %s, expected %s", kind, strings.Join(names, ", "))
+}
+
+// parseID - идентификатор записи.
+func parseID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, usageError("wrong id %s", s)
+	}
+	return id, nil
+}
+
+// readStdinLine - чтение одной строки из stdin без перевода строки.
+func readStdinLine() (string, error) {
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// masterPassword - мастер-пароль из stdin (для register и login с --stdin-password) или из переменной окружения.
+func masterPassword(o *cliOptions) (string, error) {
+	if o.stdinPassword {
+		return readStdinLine()
+	}
+	if password := os.Getenv(envPassword); password != "" {
+		return password, nil
+	}
+	return "", usageError("master password is required: set %s or use --stdin-password", envPassword)
+}
+
+// cliRegister - регистрация и открытие хранилища.
+func (a *App) cliRegister(o *cliOptions) error {
+	if o.user == "" {
+		return usageError("--user or %s is required", envUser)
+	}
+	password, err := masterPassword(o)
+	if err != nil {
+		return err
+	}
+	if err = a.manager.Register(o.user, password); err != nil {
+		return &cliError{code: ExitAuth, err: err}
+	}
+	return a.openVault(password)
+}
+
+// signIn - вход, второй фактор и открытие хранилища мастер-паролем.
+func (a *App) signIn(o *cliOptions, password string) error {
+	if o.user == "" {
+		return usageError("--user or %s is required", envUser)
+	}
+	err := a.manager.Auth(o.user, password)
+	if errors.Is(err, manager.ErrLegacyLogin) {
+		//без диалога пароль не отправляется, подтвердить отправку можно только в меню
+		return &cliError{code: ExitAuth, err: fmt.Errorf("%w: run passmanager without a command to confirm", err)}
+	}
+	if errors.Is(err, manager.ErrSecondFactor) {
+		if o.code == "" {
+			return &cliError{code: ExitAuth, err: fmt.Errorf("two-factor code required: use --code or %s", envCode)}
+		}
+		err = a.manager.AuthCode(o.code)
+	}
+	if err != nil {
+		return &cliError{code: ExitAuth, err: err}
+	}
+	return a.openVault(password)
+}
+
+// openVault - открытие хранилища и продолжение прерванной смены ключа.
+func (a *App) openVault(password string) error {
+	err := a.manager.Unlock(password)
+	if errors.Is(err, crypto.ErrWrongPassword) {
+		return &cliError{code: ExitAuth, err: fmt.Errorf("the vault on this device is encrypted with another password, run passmanager without a command to re-encrypt it")}
+	}
+	if err != nil {
+		return &cliError{code: ExitAuth, err: err}
+	}
+	if a.manager.RotationPending() {
+		return a.manager.RotateKey(password)
+	}
+	return nil
+}
+
+// authorize - продолжение сохраненной сессии или вход перед командой с данными.
+func (a *App) authorize(o *cliOptions) error {
+	password := os.Getenv(envPassword)
+	if password == "" {
+		return usageError("master password is required: set %s", envPassword)
+	}
+	err := a.manager.Resume(o.user, password)
+	switch {
+	case err == nil:
+		return nil
+	case !errors.Is(err, manager.ErrNoSession) && !errors.Is(err, crypto.ErrWrongPassword):
+		return err
+	case o.user == "" && errors.Is(err, crypto.ErrWrongPassword):
+		return &cliError{code: ExitAuth, err: err}
+	case o.user == "":
+		return usageError("no saved session: run passmanager login or use --user")
+	}
+	return a.signIn(o, password)
+}
+
+// cliLogout - выход с сервера и удаление файла сессии. Без мастер-пароля токены не расшифровать,
+// тогда файл сессии только удаляется, а сессия на сервере истекает сама.
+func (a *App) cliLogout(o *cliOptions) error {
+	resumed := false
+	if password := os.Getenv(envPassword); password != "" {
+		resumed = a.manager.Resume(o.user, password) == nil
+	}
+	err := a.manager.Logout()
+	if !resumed {
+		return nil
+	}
+	return err
+}
+
+// cliKinds - вывод видов записей, которые хранит сервер.
+func (a *App) cliKinds(w io.Writer, o *cliOptions) error {
+	if err := a.authorize(o); err != nil {
+		return err
+	}
+	kinds, err := a.manager.ItemKinds()
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return writeJSON(w, kinds)
+	}
+	for _, k := range kinds {
+		if k.Builtin {
+			fmt.Fprintf(w, "%s\tbuiltin\n", k.Name)
+		} else {
+			fmt.Fprintln(w, k.Name)
+		}
+	}
+	return nil
+}
+
+// cliList - вывод всех записей одного вида.
+func (a *App) cliList(w io.Writer, o *cliOptions, kindName string) error {
+	kind, err := parseKind(kindName)
+	if err != nil {
+		return err
+	}
+	if err = a.authorize(o); err != nil {
+		return err
+	}
+	if err = a.checkKind(kind); err != nil {
+		return err
+	}
+	items, err := a.items(kind)
+	if err != nil {
+		return err
+	}
+	if o.json {
+		return writeJSON(w, items)
+	}
+	switch v := items.(type) {
+	case []cardView:
+		for _, c := range v {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.ID, c.Number, c.Name, c.CVC, c.Title)
+		}
+	case []passwordView:
+		for _, p := range v {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", p.ID, p.Login, p.Password, p.Title)
+		}
+	case []textView:
+		for _, t := range v {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", t.ID, strconv.Quote(t.Text), t.Title)
+		}
+	case []binaryView:
+		for _, b := range v {
+			fmt.Fprintf(w, "%d\t%d bytes\t%s\n", b.ID, len(b.Data), b.Title)
+		}
+	case []itemView:
+		for _, it := range v {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", it.ID, strconv.Quote(it.Data), it.Title)
+		}
+	}
+	return nil
+}
+
+// cliGet - вывод одной записи. Без --json пароль, текст и бинарные данные печатаются как есть, без оформления,
+// чтобы результат можно было сразу передать другой программе.
+func (a *App) cliGet(w io.Writer, o *cliOptions, kindName, idText string) error {
+	kind, err := parseKind(kindName)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(idText)
+	if err != nil {
+		return err
+	}
+	if err = a.authorize(o); err != nil {
+		return err
+	}
+	if err = a.checkKind(kind); err != nil {
+		return err
+	}
+	items, err := a.items(kind)
+	if err != nil {
+		return err
+	}
+	var item interface{}
+	switch v := items.(type) {
+	case []cardView:
+		for _, c := range v {
+			if c.ID == id {
+				item = c
+				if !o.json {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", c.Number, c.Name, c.CVC)
+				}
+			}
+		}
+	case []passwordView:
+		for _, p := range v {
+			if p.ID == id {
+				item = p
+				if !o.json {
+					fmt.Fprintln(w, p.Password)
+				}
+			}
+		}
+	case []textView:
+		for _, t := range v {
+			if t.ID == id {
+				item = t
+				if !o.json {
+					fmt.Fprint(w, t.Text)
+				}
+			}
+		}
+	case []binaryView:
+		for _, b := range v {
+			if b.ID == id {
+				item = b
+				if !o.json {
+					w.Write(b.Data)
+				}
+			}
+		}
+	case []itemView:
+		for _, it := range v {
+			if it.ID == id {
+				item = it
+				if !o.json {
+					fmt.Fprint(w, it.Data)
+				}
+			}
+		}
+	}
+	if item == nil {
+		return &cliError{code: ExitNotFound, err: fmt.Errorf("%s %d not found", kind, id)}
+	}
+	if o.json {
+		return writeJSON(w, item)
+	}
+	return nil
+}
+
+// items - все записи вида kind для вывода. Поля карт и паролей, сохраненные меню вместе с переводом строки,
+// выводятся без него.
+func (a *App) items(kind string) (interface{}, error) {
+	switch kind {
+	case kindCard:
+		d, err := a.manager.ListCards()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]cardView, 0, len(d))
+		for _, c := range d {
+			items = append(items, cardView{ID: c.UID, Number: field(c.Number), Name: field(c.Name), CVC: field(c.CVC),
+				metaView: newMetaView(c.ItemMeta)})
+		}
+		return items, nil
+	case kindPassword:
+		d, err := a.manager.ListPasswords()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]passwordView, 0, len(d))
+		for _, p := range d {
+			items = append(items, passwordView{ID: p.UID, Login: field(p.Login), Password: field(p.Pass),
+				metaView: newMetaView(p.ItemMeta)})
+		}
+		return items, nil
+	case kindText:
+		d, err := a.manager.ListTexts()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]textView, 0, len(d))
+		for _, t := range d {
+			items = append(items, textView{ID: t.UID, Text: string(t.Text), metaView: newMetaView(t.ItemMeta)})
+		}
+		return items, nil
+	case kindBinary:
+		d, err := a.manager.ListBinaries()
+		if err != nil {
+			return nil, err
+		}
+		items := make([]binaryView, 0, len(d))
+		for _, b := range d {
+			items = append(items, binaryView{ID: b.UID, Data: b.Data, metaView: newMetaView(b.ItemMeta)})
+		}
+		return items, nil
+	default:
+		d, err := a.manager.ListItems(kind)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]itemView, 0, len(d))
+		for _, it := range d {
+			items = append(items, itemView{ID: it.UID, Type: it.Type, Data: string(it.Payload), metaView: newMetaView(it.ItemMeta)})
+		}
+		return items, nil
+	}
+}
+
+// field - однострочное поле записи без перевода строки.
+func field(b []byte) string {
+	return strings.TrimRight(string(b), "\r\n")
+}
+
+// cliSave - добавление записи или, если id не 0, ее изменение.
+func (a *App) cliSave(w io.Writer, o *cliOptions, kindName string, id int) error {
+	kind, err := parseKind(kindName)
+	if err != nil {
+		return err
+	}
+	//данные проверяются до входа, чтобы ошибка в аргументах не стоила лишнего входа
+	var save func(meta model.ItemMeta) error
+	switch kind {
+	case kindCard:
+		if o.number == "" || o.name == "" || o.cvc == "" {
+			return usageError("card needs --number, --name and --cvc")
+		}
+		c := model.CryptoCard{UID: id, Number: []byte(o.number), Name: []byte(o.name), CVC: []byte(o.cvc)}
+		save = func(meta model.ItemMeta) error {
+			c.ItemMeta = meta
+			if id != 0 {
+				return a.manager.UpdateCard(&c)
+			}
+			return a.manager.AddCard(&c)
+		}
+	case kindPassword:
+		if o.login == "" || !o.stdinPassword {
+			return usageError("password needs --login and --stdin-password")
+		}
+		pass, err := readStdinLine()
+		if err != nil {
+			return err
+		}
+		p := model.CryptoPassword{UID: id, Login: []byte(o.login), Pass: []byte(pass)}
+		save = func(meta model.ItemMeta) error {
+			p.ItemMeta = meta
+			if id != 0 {
+				return a.manager.UpdatePassword(&p)
+			}
+			return a.manager.AddPassword(&p)
+		}
+	case kindText:
+		text, err := readData(o, o.text != "", func() ([]byte, error) { return []byte(o.text), nil })
+		if err != nil {
+			return err
+		}
+		t := model.CryptoTextData{UID: id, Text: text}
+		save = func(meta model.ItemMeta) error {
+			t.ItemMeta = meta
+			if id != 0 {
+				return a.manager.UpdateText(&t)
+			}
+			return a.manager.AddText(&t)
+		}
+	case kindBinary:
+		data, err := readData(o, o.file != "", func() ([]byte, error) { return os.ReadFile(o.file) })
+		if err != nil {
+			return err
+		}
+		b := model.CryptoBinaryData{UID: id, Data: data}
+		save = func(meta model.ItemMeta) error {
+			b.ItemMeta = meta
+			if id != 0 {
+				return a.manager.UpdateBinary(&b)
+			}
+			return a.manager.AddBinary(&b)
+		}
+	default:
+		data, err := readData(o, o.text != "", func() ([]byte, error) { return []byte(o.text), nil })
+		if err != nil {
+			return err
+		}
+		it := model.Item{Type: kind, UID: id, Payload: data}
+		save = func(meta model.ItemMeta) error {
+			it.ItemMeta = meta
+			if id != 0 {
+				return a.manager.UpdateItem(&it)
+			}
+			return a.manager.AddItem(&it)
+		}
+	}
+
+	if err = a.authorize(o); err != nil {
+		return err
+	}
+	if err = a.checkKind(kind); err != nil {
+		return err
+	}
+	var meta model.ItemMeta
+	if id != 0 {
+		if meta, err = a.itemMeta(kind, id); err != nil {
+			return err
+		}
+	}
+	if err = save(o.meta(meta)); err != nil {
+		return changeError(err)
+	}
+	return writeStatus(w, o)
+}
+
+// meta - общие поля записи: заданные флагами заменяют поля current.
+func (o *cliOptions) meta(current model.ItemMeta) model.ItemMeta {
+	if o.set["title"] {
+		current.Title = optional(o.title)
+	}
+	if o.set["url"] {
+		current.URL = optional(o.url)
+	}
+	if o.set["notes"] {
+		current.Notes = optional(o.notes)
+	}
+	if o.set["tags"] {
+		current.Tags = manager.JoinTags(o.tags)
+	}
+	if o.set["favorite"] {
+		current.Favorite = o.favorite
+	}
+	return current
+}
+
+// optional - необязательное поле записи, пустое поле не шифруется.
+func optional(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
+
+// itemMeta - общие поля записи id вида kind, расшифрованные, чтобы изменение их сохранило. Если записи нет,
+// поля пустые, а об ошибке сообщит само изменение.
+func (a *App) itemMeta(kind string, id int) (model.ItemMeta, error) {
+	switch kind {
+	case kindCard:
+		d, err := a.manager.ListCards()
+		for _, c := range d {
+			if c.UID == id {
+				return c.ItemMeta, nil
+			}
+		}
+		return model.ItemMeta{}, err
+	case kindPassword:
+		d, err := a.manager.ListPasswords()
+		for _, p := range d {
+			if p.UID == id {
+				return p.ItemMeta, nil
+			}
+		}
+		return model.ItemMeta{}, err
+	case kindText:
+		d, err := a.manager.ListTexts()
+		for _, t := range d {
+			if t.UID == id {
+				return t.ItemMeta, nil
+			}
+		}
+		return model.ItemMeta{}, err
+	case kindBinary:
+		d, err := a.manager.ListBinaries()
+		for _, b := range d {
+			if b.UID == id {
+				return b.ItemMeta, nil
+			}
+		}
+		return model.ItemMeta{}, err
+	default:
+		d, err := a.manager.ListItems(kind)
+		for _, it := range d {
+			if it.UID == id {
+				return it.ItemMeta, nil
+			}
+		}
+		return model.ItemMeta{}, err
+	}
+}
+
+// readData - данные записи из флага или из stdin с флагом --stdin, но не из обоих сразу.
+func readData(o *cliOptions, fromFlag bool, read func() ([]byte, error)) ([]byte, error) {
+	switch {
+	case fromFlag && o.stdin, !fromFlag && !o.stdin:
+		return nil, usageError("data is required: use --text or --file, or --stdin")
+	case o.stdin:
+		return io.ReadAll(os.Stdin)
+	default:
+		return read()
+	}
+}
+
+// cliDelete - удаление записи.
+func (a *App) cliDelete(w io.Writer, o *cliOptions, kindName, idText string) error {
+	kind, err := parseKind(kindName)
+	if err != nil {
+		return err
+	}
+	id, err := parseID(idText)
+	if err != nil {
+		return err
+	}
+	if err = a.authorize(o); err != nil {
+		return err
+	}
+	if err = a.checkKind(kind); err != nil {
+		return err
+	}
+	switch kind {
+	case kindCard:
+		err = a.manager.DeleteCard(id)
+	case kindPassword:
+		err = a.manager.DeletePassword(id)
+	case kindText:
+		err = a.manager.DeleteText(id)
+	case kindBinary:
+		err = a.manager.DeleteBinary(id)
+	default:
+		err = a.manager.DeleteItem(kind, id)
+	}
+	if err != nil {
+		return changeError(err)
+	}
+	return writeStatus(w, o)
+}
+
+// changeError - код завершения для ошибки изменения или удаления записи.
+func changeError(err error) error {
+	switch {
+	case errors.Is(err, manager.ErrConflict):
+		return &cliError{code: ExitConflict, err: fmt.Errorf("%w, run passmanager without a command to choose the version", err)}
+	case errors.Is(err, manager.ErrNotFound):
+		return &cliError{code: ExitNotFound, err: err}
+	default:
+		return err
+	}
+}
+
+// writeStatus - вывод об успешном изменении. Без --json ничего не печатается.
+func writeStatus(w io.Writer, o *cliOptions) error {
+	if !o.json {
+		return nil
+	}
+	return writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// writeJSON - вывод результата в формате JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// fakeManager - менеджер без сервера. Методы, которые команды не должны вызывать, не реализованы,
+// их вызов завершает тест паникой.
+type fakeManager struct {
+	manager.Managers
+	resumeErr error
+	authErr   error
+	codeErr   error
+	deleteErr error
+	cards     []model.CryptoCard
+	kinds     []model.ItemKind
+	code      string
+	deleted   []int
+}
+
+func (m *fakeManager) Lock()                                  {}
+func (m *fakeManager) Resume(login, password string) error    { return m.resumeErr }
+func (m *fakeManager) Auth(login, password string) error      { return m.authErr }
+func (m *fakeManager) Unlock(password string) error           { return nil }
+func (m *fakeManager) RotationPending() bool                  { return false }
+func (m *fakeManager) ListCards() ([]model.CryptoCard, error) { return m.cards, nil }
+func (m *fakeManager) ItemKinds() ([]model.ItemKind, error)   { return m.kinds, nil }
+
+func (m *fakeManager) AuthCode(code string) error {
+	m.code = code
+	return m.codeErr
+}
+
+func (m *fakeManager) DeleteCard(id int) error {
+	m.deleted = append(m.deleted, id)
+	return m.deleteErr
+}
+
+// newTestApp - клиент с менеджером m и паролем из окружения, без сохраненного логина.
+func newTestApp(t *testing.T, m *fakeManager) *App {
+	t.Setenv(envUser, "")
+	t.Setenv(envCode, "")
+	t.Setenv(envPassword, "pass")
+	return &App{manager: m, logger: loggers.NewLogger()}
+}
+
+func TestApp_Exec_Codes(t *testing.T) {
+	card := model.CryptoCard{UID: 1, Number: []byte("4111"), Name: []byte("name"), CVC: []byte("123")}
+	tests := []struct {
+		name    string
+		args    []string
+		manager fakeManager
+		code    int
+	}{
+		{name: "help", args: []string{"help"}, code: ExitOK},
+		{name: "flag help", args: []string{"list", "-h"}, code: ExitOK},
+		{name: "unknown command", args: []string{"copy"}, code: ExitUsage},
+		{name: "unknown flag", args: []string{"list", "cards", "--color"}, code: ExitUsage},
+		{name: "list without type", args: []string{"list"}, code: ExitUsage},
+		{name: "get without id", args: []string{"get", "card"}, code: ExitUsage},
+		{name: "wrong id", args: []string{"get", "card", "first"}, code: ExitUsage},
+		{name: "zero id", args: []string{"update", "card", "0", "--number", "1", "--name", "n", "--cvc", "1"}, code: ExitUsage},
+		{name: "card without cvc", args: []string{"add", "card", "--number", "1", "--name", "n"}, code: ExitUsage},
+		{name: "text from flag and stdin", args: []string{"add", "text", "--text", "t", "--stdin"}, code: ExitUsage},
+		{name: "login without user", args: []string{"login"}, code: ExitUsage},
+		{name: "no saved session", args: []string{"list", "cards"}, manager: fakeManager{resumeErr: manager.ErrNoSession}, code: ExitUsage},
+		{name: "unknown type", args: []string{"list", "notes"}, manager: fakeManager{kinds: []model.ItemKind{{Name: "wifi"}}}, code: ExitUsage},
+		{name: "wrong session password", args: []string{"list", "cards"}, manager: fakeManager{resumeErr: crypto.ErrWrongPassword}, code: ExitAuth},
+		{name: "wrong password", args: []string{"login", "--user", "u"}, manager: fakeManager{authErr: errors.New("wrong login or password")}, code: ExitAuth},
+		{name: "legacy login", args: []string{"login", "--user", "u"}, manager: fakeManager{authErr: manager.ErrLegacyLogin}, code: ExitAuth},
+		{name: "two-factor without code", args: []string{"login", "--user", "u"}, manager: fakeManager{authErr: manager.ErrSecondFactor}, code: ExitAuth},
+		{name: "wrong two-factor code", args: []string{"login", "--user", "u", "--code", "1"}, manager: fakeManager{authErr: manager.ErrSecondFactor, codeErr: errors.New("wrong code")}, code: ExitAuth},
+		{name: "two-factor", args: []string{"login", "--user", "u", "--code", "123456"}, manager: fakeManager{authErr: manager.ErrSecondFactor}, code: ExitOK},
+		{name: "list", args: []string{"list", "cards"}, manager: fakeManager{cards: []model.CryptoCard{card}}, code: ExitOK},
+		{name: "get", args: []string{"get", "card", "1"}, manager: fakeManager{cards: []model.CryptoCard{card}}, code: ExitOK},
+		{name: "get missing", args: []string{"get", "card", "2"}, manager: fakeManager{cards: []model.CryptoCard{card}}, code: ExitNotFound},
+		{name: "delete", args: []string{"delete", "card", "1"}, code: ExitOK},
+		{name: "delete missing", args: []string{"delete", "card", "2"}, manager: fakeManager{deleteErr: manager.ErrNotFound}, code: ExitNotFound},
+		{name: "delete changed", args: []string{"delete", "card", "1"}, manager: fakeManager{deleteErr: manager.ErrConflict}, code: ExitConflict},
+		{name: "server error", args: []string{"delete", "card", "1"}, manager: fakeManager{deleteErr: errors.New("server error")}, code: ExitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.manager
+			assert.Equal(t, tt.code, newTestApp(t, &m).Exec(tt.args))
+		})
+	}
+}
+
+func TestApp_Exec_Args(t *testing.T) {
+	card := model.CryptoCard{UID: 1, Number: []byte("4111\n"), Name: []byte("name"), CVC: []byte("123"),
+		ItemMeta: model.ItemMeta{Title: []byte("visa")}}
+	m := &fakeManager{cards: []model.CryptoCard{card}}
+	a := newTestApp(t, m)
+
+	//флаги можно задавать и до, и после аргументов команды
+	var out bytes.Buffer
+	require.NoError(t, a.exec(&out, []string{"get", "--json", "cards", "1"}))
+	var view cardView
+	require.NoError(t, json.Unmarshal(out.Bytes(), &view))
+	assert.Equal(t, 1, view.ID)
+	assert.Equal(t, "4111", view.Number)
+	assert.Equal(t, "visa", view.Title)
+
+	out.Reset()
+	require.NoError(t, a.exec(&out, []string{"list", "card"}))
+	assert.Equal(t, "1\t4111\tname\t123\tvisa\n", out.String())
+
+	out.Reset()
+	require.NoError(t, a.exec(&out, []string{"delete", "card", "1", "--json"}))
+	assert.JSONEq(t, `{"status":"ok"}`, out.String())
+	assert.Equal(t, []int{1}, m.deleted)
+
+	//код второго фактора берется из окружения, если флага нет
+	t.Setenv(envCode, "654321")
+	m.authErr = manager.ErrSecondFactor
+	require.NoError(t, a.exec(&out, []string{"login", "--user", "u"}))
+	assert.Equal(t, "654321", m.code)
+}
+
+func TestCliOptions_Meta(t *testing.T) {
+	current := model.ItemMeta{Title: []byte("title"), URL: []byte("url"), Notes: []byte("notes"), Favorite: true}
+	o := cliOptions{title: "new", notes: "", favorite: false, set: map[string]bool{"title": true, "notes": true, "favorite": true}}
+
+	//незаданные флаги не стирают поля записи, пустой флаг стирает
+	meta := o.meta(current)
+	assert.Equal(t, []byte("new"), meta.Title)
+	assert.Equal(t, []byte("url"), meta.URL)
+	assert.Nil(t, meta.Notes)
+	assert.False(t, meta.Favorite)
+}
@@ -33,7 +33,7 @@ LoopDelete:
 			fmt.Printf("\nPlease enter password id:\n")
 			fmt.Fscan(reader, &id)
 			if err := a.manager.DeletePassword(id); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 				break LoopDelete
 			}
 			break LoopDelete
@@ -41,7 +41,7 @@ LoopDelete:
 			fmt.Printf("\nPlease enter card id:\n")
 			fmt.Fscan(reader, &id)
 			if err = a.manager.DeleteCard(id); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 				break LoopDelete
 			}
 			break LoopDelete
@@ -49,7 +49,7 @@ LoopDelete:
 			fmt.Printf("\nPlease enter text id:\n")
 			fmt.Fscan(reader, &id)
 			if err := a.manager.DeleteText(id); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 				break LoopDelete
 			}
 			break LoopDelete
@@ -57,7 +57,7 @@ LoopDelete:
 			fmt.Printf("\nPlease enter binary id:\n")
 			fmt.Fscan(reader, &id)
 			if err := a.manager.DeleteBinary(id); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 				break LoopDelete
 			}
 			break LoopDelete
@@ -0,0 +1,45 @@
+// Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
+// Данный пакет предоставляет возможность просмотра устройств, с которых выполнен вход, и выхода на них.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// devices - список устройств пользователя с возможностью отозвать сессию.
+func (a *App) devices(reader *bufio.Reader) {
+	sessions, err := a.manager.GetSessions()
+	if err != nil {
+		fmt.Printf("\nsomething wrong, try again")
+		return
+	}
+	fmt.Printf("\nyou are logged in on these devices:\n")
+	for i, s := range sessions {
+		current := ""
+		if s.Current {
+			current = " (this device)"
+		}
+		fmt.Printf("%d. %s%s, %s, ip %s, last seen %s\n", i+1, s.Device, current, s.UserAgent, s.IP,
+			s.LastSeen.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("\nEnter device number to log it out or press Enter to return:\n")
+	option, err := reader.ReadString('\n')
+	a.checkError(err)
+	option = strings.TrimSpace(option)
+	if option == "" {
+		return
+	}
+	n, err := strconv.Atoi(option)
+	if err != nil || n < 1 || n > len(sessions) {
+		fmt.Println("Please enter a valid option in the given list!")
+		return
+	}
+	if err = a.manager.RevokeSession(sessions[n-1].ID); err != nil {
+		fmt.Printf("\nsomething wrong, try again")
+		return
+	}
+	fmt.Printf("\n%s is logged out", sessions[n-1].Device)
+}
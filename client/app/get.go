@@ -1,12 +1,16 @@
 // Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
-// Данный пакет предоставляет возможность получения сохраненных данных из сервера.
+// Данный пакет предоставляет возможность получения сохраненных данных из сервера
+// и прежних версий записей с восстановлением.
 package app
 
 import (
 	"bufio"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
 )
 
 func (a *App) getData(reader *bufio.Reader) {
@@ -17,7 +21,8 @@ func (a *App) getData(reader *bufio.Reader) {
 2. Card.
 3. Text data.
 4. Binary data.
-5. Return.`
+5. Item history.
+6. Return.`
 
 	fmt.Printf(data + "\n")
 	dataSelect, err := reader.ReadString('\n')
@@ -57,7 +62,66 @@ LoopSecond:
 			fmt.Printf(d + "\n")
 			break LoopSecond
 		case "5":
+			a.history(reader)
+			break LoopSecond
+		case "6":
 			break LoopSecond
 		}
 	}
 }
+
+// history - прежние версии записи и восстановление одной из них. Восстановленная запись становится новой версией,
+// а текущая остается в истории.
+func (a *App) history(reader *bufio.Reader) {
+	fmt.Printf("\nSelect the item type:\n1. Password.\n2. Card.\n3. Text data.\n4. Binary data.\n")
+	kindSelect, err := reader.ReadString('\n')
+	a.checkError(err)
+	kind, ok := map[string]string{
+		"1": manager.KindPasswords,
+		"2": manager.KindCards,
+		"3": manager.KindTexts,
+		"4": manager.KindBinaries,
+	}[strings.TrimSpace(kindSelect)]
+	if !ok {
+		fmt.Println("Please enter a valid option in the given list!")
+		return
+	}
+	fmt.Printf("\nPlease enter item's id:\n")
+	idText, err := reader.ReadString('\n')
+	a.checkError(err)
+	uid, err := strconv.Atoi(strings.TrimSpace(idText))
+	if err != nil {
+		fmt.Printf("\nwrong id")
+		return
+	}
+	revisions, err := a.manager.History(kind, uid)
+	if err != nil {
+		printChangeError(err)
+		return
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("\nthe item has no previous versions")
+		return
+	}
+	for _, r := range revisions {
+		fmt.Printf("\nversion %d, changed %s: %s", r.Version, r.ChangedAt.Local().Format("2006-01-02 15:04"),
+			strings.TrimSpace(r.Content))
+	}
+	fmt.Printf("\n\nEnter a version to restore or press Enter to return:\n")
+	versionText, err := reader.ReadString('\n')
+	a.checkError(err)
+	versionText = strings.TrimSpace(versionText)
+	if versionText == "" {
+		return
+	}
+	version, err := strconv.ParseInt(versionText, 10, 64)
+	if err != nil {
+		fmt.Printf("\nwrong version")
+		return
+	}
+	if err = a.manager.Restore(kind, uid, version); err != nil {
+		printChangeError(err)
+		return
+	}
+	fmt.Printf("\nVersion %d is restored", version)
+}
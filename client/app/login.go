@@ -4,8 +4,12 @@ package app
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
 )
 
 func (a *App) login(reader *bufio.Reader) {
@@ -18,7 +22,122 @@ func (a *App) login(reader *bufio.Reader) {
 	a.checkError(err)
 	login = strings.TrimSpace(login)
 	password = strings.TrimSpace(password)
-	if err = a.manager.Auth(login, password); err != nil {
+	//сохраненная сессия этого пользователя продолжается без входа и второго фактора
+	if a.manager.SessionLogin() == login && a.manager.Resume(login, password) == nil {
+		a.resumeRotation(password)
+		return
+	}
+	err = a.manager.Auth(login, password)
+	if errors.Is(err, manager.ErrLegacyLogin) && a.confirmLegacyLogin(reader) {
+		err = a.manager.AuthLegacy(login, password)
+	}
+	if errors.Is(err, manager.ErrSecondFactor) {
+		fmt.Printf("\nCode from authenticator app or recovery code:\n")
+		code, readErr := reader.ReadString('\n')
+		a.checkError(readErr)
+		err = a.manager.AuthCode(strings.TrimSpace(code))
+	}
+	printAuthError(err)
+	if err == nil {
+		a.unlock(reader, password)
+	}
+}
+
+// confirmLegacyLogin - подтверждение отправки мастер-пароля серверу для перевода аккаунта старых версий
+// на ключ аутентификации.
+func (a *App) confirmLegacyLogin(reader *bufio.Reader) bool {
+	fmt.Printf("\nThe server asks for your master password once to upgrade an account created by an old version." +
+		"\nSend it only if this account really was created before the upgrade and you trust this server. Send? y/n\n")
+	answer, err := reader.ReadString('\n')
+	a.checkError(err)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// unlock - открытие хранилища закрытого ключа мастер-паролем после входа. Если пароль сменили на другом устройстве,
+// хранилище открывается прежним паролем и перешифровывается новым. Без открытого хранилища вход отменяется.
+func (a *App) unlock(reader *bufio.Reader, password string) {
+	err := a.manager.Unlock(password)
+	if errors.Is(err, crypto.ErrWrongPassword) {
+		fmt.Printf("\nThe vault on this device is encrypted with your previous password.\nPrevious password:\n")
+		old, readErr := reader.ReadString('\n')
+		a.checkError(readErr)
+		err = a.manager.ReencryptVault(strings.TrimSpace(old), password)
+	}
+	if err != nil {
+		a.logger.LogErr(err, "failed to unlock vault")
+		fmt.Printf("\nfailed to unlock the vault, try again")
+		a.manager.Lock()
+		return
+	}
+	a.resumeRotation(password)
+}
+
+// resumeRotation - продолжение смены ключа, прерванной при прошлом запуске.
+func (a *App) resumeRotation(password string) {
+	if a.manager.RotationPending() {
+		fmt.Printf("\nKey rotation was interrupted, resuming")
+		a.rotateKey(password)
+	}
+}
+
+// resume - продолжение сохраненной сессии при запуске: нужен только мастер-пароль.
+func (a *App) resume(reader *bufio.Reader) {
+	login := a.manager.SessionLogin()
+	if login == "" {
+		return
+	}
+	fmt.Printf("\nSaved session of %s. Master password (empty to skip):\n", login)
+	password, err := reader.ReadString('\n')
+	a.checkError(err)
+	password = strings.TrimSpace(password)
+	if password == "" {
+		return
+	}
+	err = a.manager.Resume(login, password)
+	switch {
+	case err == nil:
+		fmt.Printf("\nWelcome back, %s", login)
+		if n := a.manager.Pending(); n > 0 {
+			fmt.Printf("\n%d offline changes are waiting for the server", n)
+		}
+		a.resumeRotation(password)
+		return
+	case errors.Is(err, manager.ErrNoSession):
+		fmt.Printf("\nSession expired, please auth again")
+	case errors.Is(err, crypto.ErrWrongPassword):
+		fmt.Printf("\nWrong password, please auth again")
+	default:
+		a.logger.LogErr(err, "failed to resume session")
+		fmt.Printf("\nFailed to restore the session, please auth again")
+	}
+	a.manager.Lock()
+}
+
+// printAuthError - сообщение об ошибке входа или регистрации. При ограничении попыток показывает, сколько ждать.
+func printAuthError(err error) {
+	var limit *manager.TooManyRequestsError
+	switch {
+	case err == nil:
+	case errors.As(err, &limit):
+		fmt.Printf("\nToo many attempts, try again in %s", limit.Wait)
+	case errors.Is(err, manager.ErrLegacyLogin):
+		fmt.Printf("\nThe master password was not sent, login cancelled")
+	case errors.Is(err, manager.ErrDowngrade):
+		fmt.Printf("\nThe server asks for the master password of an account that already uses an auth key." +
+			"\nThe password was not sent: this server may not be the one you registered with")
+	default:
+		fmt.Printf("\nsomething wrong, try again")
+	}
+}
+
+func (a *App) logout() {
+	if err := a.manager.Logout(); err != nil {
 		fmt.Printf("\nsomething wrong, try again")
+		return
 	}
+	fmt.Printf("\nYou are logged out")
 }
@@ -0,0 +1,49 @@
+// Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
+// Данный пакет предоставляет возможность вводить общие поля записей: название, адрес сайта, заметку, метки и избранное.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// readMeta - ввод общих полей записи. Все поля необязательные: при изменении записи (update) пустой ввод
+// оставляет поле из current, а "-" стирает его.
+func (a *App) readMeta(reader *bufio.Reader, current model.ItemMeta, update bool) model.ItemMeta {
+	hint := "optional"
+	if update {
+		hint = "empty keeps it, - clears it"
+	}
+	read := func(prompt string, value []byte) []byte {
+		fmt.Printf("\n%s (%s):\n", prompt, hint)
+		line, err := reader.ReadString('\n')
+		a.checkError(err)
+		switch line = strings.TrimSpace(line); line {
+		case "":
+			return value
+		case "-":
+			return nil
+		default:
+			return []byte(line)
+		}
+	}
+	current.Title = read("Title", current.Title)
+	current.URL = read("Website", current.URL)
+	current.Notes = read("Notes", current.Notes)
+	current.Tags = manager.JoinTags(string(read("Tags, comma separated", current.Tags)))
+
+	fmt.Printf("\nFavorite? y/n (%s):\n", hint)
+	answer, err := reader.ReadString('\n')
+	a.checkError(err)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		current.Favorite = true
+	case "n", "no", "-":
+		current.Favorite = false
+	}
+	return current
+}
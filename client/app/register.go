@@ -18,7 +18,9 @@ func (a *App) register(reader *bufio.Reader) {
 	a.checkError(err)
 	login = strings.TrimSpace(login)
 	password = strings.TrimSpace(password)
-	if err := a.manager.Register(login, password); err != nil {
-		fmt.Printf("\nsomething wrong, try again")
+	err = a.manager.Register(login, password)
+	printAuthError(err)
+	if err == nil {
+		a.unlock(reader, password)
 	}
 }
@@ -0,0 +1,55 @@
+// Package app пакет для вызова бесконечного цикла с выбором возможных действий с сервером.
+// Данный пакет предоставляет возможность подключения и отключения двухфакторной аутентификации.
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// twoFactor - подключение или отключение второго фактора.
+func (a *App) twoFactor(reader *bufio.Reader) {
+	fmt.Printf("\n\nSelect what do you want to do?\n\n")
+	data :=
+		`1. Enable two-factor authentication.
+2. Disable two-factor authentication.
+3. Return.`
+	fmt.Printf(data + "\n")
+	dataSelect, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatalf("Error in reading input: %v", err)
+	}
+	switch strings.TrimSpace(dataSelect) {
+	case "1":
+		setup, err := a.manager.EnrollTwoFactor()
+		if err != nil {
+			fmt.Printf("\nsomething wrong, try again")
+			return
+		}
+		fmt.Printf("\nAdd this account to your authenticator app:\n%s\n\nor enter the key manually: %s\n", setup.URI, setup.Secret)
+		fmt.Printf("\nSave these recovery codes, each of them can be used once instead of a code:\n%s\n",
+			strings.Join(setup.RecoveryCodes, "\n"))
+		fmt.Printf("\nEnter the code from the app to confirm:\n")
+		code, err := reader.ReadString('\n')
+		a.checkError(err)
+		if err = a.manager.ConfirmTwoFactor(strings.TrimSpace(code)); err != nil {
+			fmt.Printf("\nsomething wrong, try again")
+			return
+		}
+		fmt.Printf("\nTwo-factor authentication is enabled")
+	case "2":
+		fmt.Printf("\nEnter the code from the app or a recovery code:\n")
+		code, err := reader.ReadString('\n')
+		a.checkError(err)
+		if err = a.manager.DisableTwoFactor(strings.TrimSpace(code)); err != nil {
+			fmt.Printf("\nsomething wrong, try again")
+			return
+		}
+		fmt.Printf("\nTwo-factor authentication is disabled")
+	case "3":
+	default:
+		fmt.Println("Please enter a valid option in the given list!")
+	}
+}
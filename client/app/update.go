@@ -5,10 +5,12 @@ package app
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
+	"github.com/CyrilSbrodov/passManager.git/client/manager"
 	"github.com/CyrilSbrodov/passManager.git/client/model"
 )
 
@@ -44,8 +46,9 @@ LoopUpdate:
 			fmt.Printf("\nPlease enter password:\n")
 			p.Pass, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			p.ItemMeta = a.updatedMeta(reader, kindPassword, p.UID)
 			if err := a.manager.UpdatePassword(&p); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 			}
 			break LoopUpdate
 		case "2":
@@ -61,8 +64,9 @@ LoopUpdate:
 			fmt.Printf("\nCVC number:\n")
 			c.CVC, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			c.ItemMeta = a.updatedMeta(reader, kindCard, c.UID)
 			if err := a.manager.UpdateCard(&c); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 			}
 			break LoopUpdate
 		case "3":
@@ -71,8 +75,9 @@ LoopUpdate:
 			fmt.Printf("\nPlease enter a text:\n")
 			t.Text, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			t.ItemMeta = a.updatedMeta(reader, kindText, t.UID)
 			if err := a.manager.UpdateText(&t); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 			}
 			break LoopUpdate
 		case "4":
@@ -81,8 +86,9 @@ LoopUpdate:
 			fmt.Printf("\nPlease enter a binary:\n")
 			b.Data, err = reader.ReadBytes('\n')
 			a.checkError(err)
+			b.ItemMeta = a.updatedMeta(reader, kindBinary, b.UID)
 			if err := a.manager.UpdateBinary(&b); err != nil {
-				fmt.Printf("\nsomething wrong, try again")
+				printChangeError(err)
 			}
 			break LoopUpdate
 		case "5":
@@ -90,3 +96,56 @@ LoopUpdate:
 		}
 	}
 }
+
+// updatedMeta - ввод общих полей изменяемой записи id вида kind, незаполненные поля остаются прежними.
+func (a *App) updatedMeta(reader *bufio.Reader, kind string, id int) model.ItemMeta {
+	current, err := a.itemMeta(kind, id)
+	a.checkError(err)
+	return a.readMeta(reader, current, true)
+}
+
+// printChangeError - сообщение об ошибке изменения или удаления записи.
+func printChangeError(err error) {
+	switch {
+	case errors.Is(err, manager.ErrConflict):
+		fmt.Printf("\nthe item was changed on another device")
+	case errors.Is(err, manager.ErrVersionNotFound):
+		fmt.Printf("\nthe item has no such version in its history")
+	case errors.Is(err, manager.ErrNotFound):
+		fmt.Printf("\nthe item is not found, it may have been deleted on another device")
+	default:
+		fmt.Printf("\nsomething wrong, try again")
+	}
+}
+
+// resolveConflicts - выбор версии для записей, которые изменили одновременно на этом и на другом устройстве.
+// Показывает обе версии, выбор можно отложить до следующего раза.
+func (a *App) resolveConflicts(reader *bufio.Reader) {
+	for {
+		conflicts := a.manager.Conflicts()
+		if len(conflicts) == 0 {
+			return
+		}
+		c := conflicts[0]
+		fmt.Printf("\n\n%s %d was changed on another device.\nThis device: %s\nOther device: %s\n",
+			c.Kind, c.UID, strings.TrimSpace(c.Mine), strings.TrimSpace(c.Theirs))
+		fmt.Printf("\n1. Keep this device's version.\n2. Keep the other device's version.\n3. Decide later.\n")
+		option, err := reader.ReadString('\n')
+		a.checkError(err)
+		switch strings.TrimSpace(option) {
+		case "1":
+			err = a.manager.ResolveConflict(0, true)
+		case "2":
+			err = a.manager.ResolveConflict(0, false)
+		default:
+			return
+		}
+		//при новом конфликте цикл покажет его снова
+		if err != nil && !errors.Is(err, manager.ErrConflict) {
+			printChangeError(err)
+			if !errors.Is(err, manager.ErrNotFound) {
+				return
+			}
+		}
+	}
+}
@@ -1,20 +1,35 @@
 // Package config - это пакет с конфигом, который позволяет гибко запускать приложение.
 package config
 
-import "flag"
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+)
 
 // Config - структура конфига.
 type Config struct {
-	Addr             string `json:"address" env:"ADDRESS"`
-	CryptoPROKey     string `json:"crypto_key" env:"CRYPTO_KEY"`
-	CryptoPROKeyPath string `json:"crypto_key_path" env:"CRYPTO_KEY_PATH"`
+	Addr             string        `json:"address" env:"ADDRESS"`
+	CryptoPROKey     string        `json:"crypto_key" env:"CRYPTO_KEY"`
+	CryptoPROKeyPath string        `json:"crypto_key_path" env:"CRYPTO_KEY_PATH"`
+	IdleTimeout      time.Duration `json:"idle_timeout" env:"IDLE_TIMEOUT"`
+	ConfigDir        string        `json:"config_dir" env:"CONFIG_DIR"`
+	Profile          string        `json:"profile" env:"PROFILE"`
 }
 
 // ConfigInit - инициализация конфига.
 func ConfigInit() *Config {
 	cfg := &Config{}
 	flag.StringVar(&cfg.Addr, "a", "localhost:8080", "server address")
-	flag.StringVar(&cfg.CryptoPROKey, "crypto-key", "private.pem", "path to file")
+	flag.StringVar(&cfg.CryptoPROKey, "crypto-key", "", "legacy unencrypted private key in the key folder to move into the vault on first login, by default a new key is generated")
 	flag.StringVar(&cfg.CryptoPROKeyPath, "crypto-key-path", "./client/crypto/", "path to folder")
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	flag.StringVar(&cfg.ConfigDir, "config-dir", filepath.Join(dir, "passmanager"), "folder with profiles")
+	flag.StringVar(&cfg.Profile, "profile", "default", "profile name, each profile keeps its own session")
+	flag.DurationVar(&cfg.IdleTimeout, "idle-timeout", 10*time.Minute, "lock the vault and logout after this inactivity, 0 disables")
 	return cfg
 }
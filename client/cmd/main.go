@@ -1,9 +1,18 @@
 package main
 
-import "github.com/CyrilSbrodov/passManager.git/client/app"
+import (
+	"flag"
+	"os"
 
-// Main - функция сборки и запуска клиента.
+	"github.com/CyrilSbrodov/passManager.git/client/app"
+)
+
+// Main - функция сборки и запуска клиента. Без подкоманды запускается меню,
+// с подкомандой (passmanager [флаги] list cards) команда выполняется без диалога (см. app.Exec).
 func main() {
 	client := app.NewApp()
+	if args := flag.Args(); len(args) > 0 {
+		os.Exit(client.Exec(args))
+	}
 	client.Run()
 }
@@ -0,0 +1,29 @@
+// Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
+// Данный модуль получает из мастер-пароля ключ аутентификации, который отправляется на сервер вместо пароля.
+
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры argon2id для ключа аутентификации. Ключ должен получаться одинаковым на всех устройствах,
+// поэтому параметры нельзя менять без перевода аккаунтов на новый ключ.
+const (
+	authKeyTime    = 3
+	authKeyMemory  = 64 * 1024
+	authKeyThreads = 2
+	authKeySize    = 32
+)
+
+// AuthKey - ключ аутентификации пользователя login. Соль получается из логина, чтобы ключ не зависел от устройства.
+// Хранилище закрытого ключа шифруется ключом со случайной солью, поэтому ключ аутентификации не открывает хранилище.
+func AuthKey(login, password string) string {
+	salt := sha256.Sum256([]byte("passManager auth key " + login))
+	key := argon2.IDKey([]byte(password), salt[:], authKeyTime, authKeyMemory, authKeyThreads, authKeySize)
+	defer zeroBytes(key)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
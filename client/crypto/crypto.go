@@ -1,21 +1,13 @@
 // Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
 // Сервер получает все данные в зашифрованном виде, кроме логина, пароля и уид.
+// Каждая запись шифруется конвертом (см. envelope.go), записи старого формата только RSA по-прежнему расшифровываются.
+// Закрытый ключ хранится на диске зашифрованным мастер-паролем (см. vault.go).
 
 package crypto
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
-	"math/big"
-	"net"
-	"os"
-	"time"
+	"sync"
 
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
@@ -26,338 +18,174 @@ import (
 type Crypto interface {
 	DecryptedData(b []byte, privateKey *rsa.PrivateKey) ([]byte, error) // Расшифровка.
 	EncryptedData(b []byte, publicKey *rsa.PublicKey) ([]byte, error)   // Шифрование.
-	EncryptedCard(d *model.CryptoCard)                                  // Шифрование структуры CryptoCard.
-	EncryptedPassword(d *model.CryptoPassword)                          // Шифрование структуры CryptoPassword.
-	EncryptedTextData(d *model.CryptoTextData)                          // Шифрование структуры CryptoTextData.
-	EncryptedBinaryData(d *model.CryptoBinaryData)                      // Шифрование структуры CryptoBinaryData.
-	DecryptedCard(d *model.CryptoCard)                                  // Расшифровка структуры CryptoCard.
-	DecryptedPassword(d *model.CryptoPassword)                          // Расшифровка структуры CryptoPassword.
-	DecryptedTextData(d *model.CryptoTextData)                          // Расшифровка структуры CryptoTextData.
-	DecryptedBinaryData(d *model.CryptoBinaryData)                      // Расшифровка структуры CryptoBinaryData.
-}
-
-// RSA структура шифрования.
+	EncryptedCard(d *model.CryptoCard) error                            // Шифрование структуры CryptoCard.
+	EncryptedPassword(d *model.CryptoPassword) error                    // Шифрование структуры CryptoPassword.
+	EncryptedTextData(d *model.CryptoTextData) error                    // Шифрование структуры CryptoTextData.
+	EncryptedBinaryData(d *model.CryptoBinaryData) error                // Шифрование структуры CryptoBinaryData.
+	DecryptedCard(d *model.CryptoCard) error                            // Расшифровка структуры CryptoCard.
+	DecryptedPassword(d *model.CryptoPassword) error                    // Расшифровка структуры CryptoPassword.
+	DecryptedTextData(d *model.CryptoTextData) error                    // Расшифровка структуры CryptoTextData.
+	DecryptedBinaryData(d *model.CryptoBinaryData) error                // Расшифровка структуры CryptoBinaryData.
+	EncryptedItem(d *model.Item) error                                  // Шифрование структуры Item.
+	DecryptedItem(d *model.Item) error                                  // Расшифровка структуры Item.
+	IsLegacy(b []byte) bool                                             // Поле зашифровано старым способом, только RSA.
+	Unlock(login, password string) error                                // Расшифровка закрытого ключа мастер-паролем.
+	SetPassword(login, password string) error                           // Перешифровка закрытого ключа новым мастер-паролем.
+	Lock()                                                              // Стирание закрытого ключа из памяти.
+	Vault(login string) ([]byte, error)                                 // Зашифрованное хранилище для отправки на сервер.
+	ImportVault(login, password string, content []byte) error           // Открытие хранилища, полученного с сервера.
+	BeginRotation(login, password string) error                         // Создание нового ключа для смены.
+	RotationPending(login string) bool                                  // Смена ключа начиналась и не завершилась.
+	PendingVault(login string) ([]byte, error)                          // Хранилище нового ключа для отправки на сервер.
+	CommitRotation(login string) error                                  // Замена старого ключа новым.
+	ReencryptCard(d *model.CryptoCard) error                            // Перешифровка структуры CryptoCard новым ключом.
+	ReencryptPassword(d *model.CryptoPassword) error                    // Перешифровка структуры CryptoPassword новым ключом.
+	ReencryptTextData(d *model.CryptoTextData) error                    // Перешифровка структуры CryptoTextData новым ключом.
+	ReencryptBinaryData(d *model.CryptoBinaryData) error                // Перешифровка структуры CryptoBinaryData новым ключом.
+	ReencryptItem(d *model.Item) error                                  // Перешифровка структуры Item новым ключом.
+}
+
+// RSA структура шифрования. Закрытый ключ доступен только после Unlock и до Lock.
 type RSA struct {
-	logger  *loggers.Logger
-	Private *rsa.PrivateKey
-	Public  *rsa.PublicKey
+	mu         sync.Mutex
+	logger     *loggers.Logger
+	path       string
+	legacyFile string
+	Private    *rsa.PrivateKey
+	Public     *rsa.PublicKey
+	//новый ключ незавершенной смены ключа (см. rotate.go)
+	next *rsa.PrivateKey
 }
 
-// NewRSA - функция создания крипто.
+// NewRSA - функция создания крипто. Ключи загружаются из хранилища при входе (см. Unlock).
 func NewRSA(cfg config.Config, logger *loggers.Logger) *RSA {
-	var private *rsa.PrivateKey
-	var public *rsa.PublicKey
-	var err error
-	//если нет ранее сохраненных ключей, то программа создаст новые.
-	private, public, err = LoadPrivateAndPublicPEMKey(cfg.CryptoPROKey, "public.pem", cfg.CryptoPROKeyPath, logger)
-
-	if err != nil {
-		private, public, err = addCryptoKey("public.pem", cfg.CryptoPROKey, cfg.CryptoPROKeyPath, logger)
-		if err != nil {
-			logger.LogErr(err, "")
-			os.Exit(1)
-		}
-	}
 	return &RSA{
-		logger:  logger,
-		Private: private,
-		Public:  public,
+		logger:     logger,
+		path:       cfg.CryptoPROKeyPath,
+		legacyFile: cfg.CryptoPROKey,
 	}
 }
 
-// addCryptoKey - создание новых ключей шифрования.
-func addCryptoKey(filenamePublicKey, filenamePrivateKey, path string, logger *loggers.Logger) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	// создаём шаблон сертификата
-	cert := &x509.Certificate{
-		// указываем уникальный номер сертификата
-		SerialNumber: big.NewInt(1658),
-		// заполняем базовую информацию о владельце сертификата
-		Subject: pkix.Name{
-			Organization: []string{"passManager"},
-			Country:      []string{"RU"},
-		},
-		// разрешаем использование сертификата для 127.0.0.1 и ::1
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		// сертификат верен, начиная со времени создания
-		NotBefore: time.Now(),
-		// время жизни сертификата — 10 лет
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		// устанавливаем использование ключа для цифровой подписи,
-		// а также клиентской и серверной авторизации
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
-	}
-
-	// создаём новый приватный RSA-ключ длиной 4096 бит
-	// обратите внимание, что для генерации ключа и сертификата
-	// используется rand.Reader в качестве источника случайных данных
-	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err != nil {
-		logger.LogErr(err, "")
-	}
-
-	// создаём сертификат x.509
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, &privateKey.PublicKey, privateKey)
-	if err != nil {
-		logger.LogErr(err, "")
-	}
-
-	// кодируем сертификат и ключ в формате PEM, который
-	// используется для хранения и обмена криптографическими ключами
-	var certPEM bytes.Buffer
-	pem.Encode(&certPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certBytes,
-	})
-
-	var privateKeyPEM bytes.Buffer
-	pem.Encode(&privateKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	})
-
-	var publicKeyPEM bytes.Buffer
-	pem.Encode(&publicKeyPEM, &pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey),
-	})
-	publicKey := privateKey.PublicKey
-	if err = createNewCryptoFile(certPEM, "cert.pem", path, logger); err != nil {
-		logger.LogErr(err, "filed to create new file")
-		return nil, nil, err
-	}
-	if err = createNewCryptoFile(privateKeyPEM, filenamePrivateKey, path, logger); err != nil {
-		logger.LogErr(err, "filed to create new file")
-		return nil, nil, err
+// DecryptedData - расшифровка одного поля, зашифрованного EncryptedData или старым способом (только RSA).
+func (r *RSA) DecryptedData(msg []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	if privateKey == nil {
+		return nil, ErrLocked
 	}
-	if err = createNewCryptoFile(publicKeyPEM, filenamePublicKey, path, logger); err != nil {
-		logger.LogErr(err, "filed to create new file")
-		return nil, nil, err
+	if err := openRecord([]recordField{{value: &msg}}, privateKey); err != nil {
+		return nil, err
 	}
-	return privateKey, &publicKey, nil
+	return msg, nil
 }
 
-func createNewCryptoFile(PEM bytes.Buffer, filename, path string, logger *loggers.Logger) error {
-	file, err := os.OpenFile(path+filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
-	if err != nil {
-		logger.LogErr(err, "failed to open/create file")
-		return err
+// EncryptedData - шифрование одного поля конвертом со своим ключом данных.
+func (r *RSA) EncryptedData(b []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	if publicKey == nil {
+		return nil, ErrLocked
 	}
-	writer := bufio.NewWriter(file)
-	if _, err := writer.Write(PEM.Bytes()); err != nil {
-		logger.LogErr(err, "failed to write buffer")
-		return err
+	if err := sealRecord([]recordField{{value: &b}}, publicKey); err != nil {
+		return nil, err
 	}
-	writer.Flush()
-	defer file.Close()
-	return nil
+	return b, nil
 }
 
-func (r *RSA) DecryptedData(msg []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
-	label := []byte("OAEP Encrypted")
-	rng := rand.Reader
-	msgLen := len(msg)
-	step := privateKey.PublicKey.Size()
-	var decryptedBytes []byte
-
-	for start := 0; start < msgLen; start += step {
-		finish := start + step
-		if finish > msgLen {
-			finish = msgLen
-		}
-
-		decryptedBlockBytes, err := rsa.DecryptOAEP(sha256.New(), rng, privateKey, msg[start:finish], label)
-		if err != nil {
-			return nil, err
+// metaFields - непустые общие поля записи вида kind. Пустые поля не шифруются и остаются пустыми, поэтому
+// записи, сохраненные до появления общих полей, расшифровываются как раньше. Какие поля зашифрованы,
+// проверяется при расшифровке (см. dataKey.bind), поэтому стереть поле из записи незаметно нельзя.
+func metaFields(kind string, m *model.ItemMeta) []recordField {
+	all := []recordField{{kind + ".title", &m.Title}, {kind + ".url", &m.URL}, {kind + ".notes", &m.Notes}, {kind + ".tags", &m.Tags}}
+	var fields []recordField
+	for _, f := range all {
+		if len(*f.value) > 0 {
+			fields = append(fields, f)
 		}
-
-		decryptedBytes = append(decryptedBytes, decryptedBlockBytes...)
 	}
-
-	return decryptedBytes, nil
+	return fields
 }
 
-func (r *RSA) EncryptedData(b []byte, publicKey *rsa.PublicKey) ([]byte, error) {
-	label := []byte("OAEP Encrypted")
-	msgLen := len(b)
-	step := publicKey.Size() - 2*sha256.New().Size() - 2
-	rng := rand.Reader
-	var encryptedBytes []byte
-	for start := 0; start < msgLen; start += step {
-		finish := start + step
-		if finish > msgLen {
-			finish = msgLen
-		}
-
-		encryptedBlockBytes, err := rsa.EncryptOAEP(sha256.New(), rng, publicKey, b[start:finish], label)
-		if err != nil {
-			return nil, err
-		}
-
-		encryptedBytes = append(encryptedBytes, encryptedBlockBytes...)
-	}
-
-	return encryptedBytes, nil
+// cardFields - поля карты под именами, которые проверяются при расшифровке.
+func cardFields(d *model.CryptoCard) []recordField {
+	fields := []recordField{{"card.number", &d.Number}, {"card.name", &d.Name}, {"card.cvc", &d.CVC}}
+	return append(fields, metaFields("card", &d.ItemMeta)...)
 }
 
-func LoadPrivateAndPublicPEMKey(private, public, path string, logger *loggers.Logger) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	privateKeyFile, err := os.Open(path + private)
-	if err != nil {
-		logger.LogErr(err, "filed to open file")
-		return nil, nil, err
-	}
-	defer privateKeyFile.Close()
-
-	pemFileInfo, err := privateKeyFile.Stat()
-	if err != nil {
-		logger.LogErr(err, "filed to read stat from file")
-	}
-	size := pemFileInfo.Size()
-	pemBytes := make([]byte, size)
-	buffer := bufio.NewReader(privateKeyFile)
-	_, err = buffer.Read(pemBytes)
-
-	if err != nil {
-		logger.LogErr(err, "filed to read bytes from file")
-		return nil, nil, err
-	}
+// passwordFields - поля пары логин/пароль под именами, которые проверяются при расшифровке.
+func passwordFields(d *model.CryptoPassword) []recordField {
+	fields := []recordField{{"password.login", &d.Login}, {"password.pass", &d.Pass}}
+	return append(fields, metaFields("password", &d.ItemMeta)...)
+}
 
-	data, _ := pem.Decode(pemBytes)
+// textFields - поля текстовых данных под именами, которые проверяются при расшифровке.
+func textFields(d *model.CryptoTextData) []recordField {
+	return append([]recordField{{"text.text", &d.Text}}, metaFields("text", &d.ItemMeta)...)
+}
 
-	privateKeyImported, err := x509.ParsePKCS1PrivateKey(data.Bytes)
-	if err != nil {
-		logger.LogErr(err, "filed to import key")
-		return nil, nil, err
-	}
+// binaryFields - поля бинарных данных под именами, которые проверяются при расшифровке.
+func binaryFields(d *model.CryptoBinaryData) []recordField {
+	return append([]recordField{{"binary.data", &d.Data}}, metaFields("binary", &d.ItemMeta)...)
+}
 
-	publicKeyFile, err := os.Open(path + public)
-	if err != nil {
-		logger.LogErr(err, "filed to open file")
-		return nil, nil, err
-	}
-	defer publicKeyFile.Close()
+// itemFields - поля записи вида d.Type под именами, которые проверяются при расшифровке. Имя включает вид,
+// поэтому запись не расшифруется как запись другого вида.
+func itemFields(d *model.Item) []recordField {
+	return append([]recordField{{d.Type + ".payload", &d.Payload}}, metaFields(d.Type, &d.ItemMeta)...)
+}
 
-	pemFileInfo, err = publicKeyFile.Stat()
-	if err != nil {
-		logger.LogErr(err, "filed to read stat from file")
+// sealFields - шифрование полей записи открытым ключом пользователя.
+func (r *RSA) sealFields(fields []recordField) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Public == nil {
+		return ErrLocked
 	}
-	size = pemFileInfo.Size()
-	pemBytes = make([]byte, size)
-	buffer = bufio.NewReader(publicKeyFile)
-	_, err = buffer.Read(pemBytes)
+	return sealRecord(fields, r.Public)
+}
 
-	if err != nil {
-		logger.LogErr(err, "filed to read bytes from file")
-		return nil, nil, err
+// openFields - расшифровка полей записи закрытым ключом пользователя. Если запись не открылась, поля не меняются.
+func (r *RSA) openFields(fields []recordField) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Private == nil {
+		return ErrLocked
 	}
+	return openRecord(fields, r.Private)
+}
 
-	data, _ = pem.Decode(pemBytes)
-
-	publicKeyImported, err := x509.ParsePKCS1PublicKey(data.Bytes)
-	if err != nil {
-		logger.LogErr(err, "filed to import key")
-		return nil, nil, err
-	}
+func (r *RSA) EncryptedCard(d *model.CryptoCard) error {
+	return r.sealFields(cardFields(d))
+}
 
-	return privateKeyImported, publicKeyImported, nil
+func (r *RSA) EncryptedPassword(d *model.CryptoPassword) error {
+	return r.sealFields(passwordFields(d))
 }
 
-func (r *RSA) EncryptedCard(d *model.CryptoCard) {
-	var err error
-	d.Number, err = r.EncryptedData(d.Number, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.Name, err = r.EncryptedData(d.Name, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.CVC, err = r.EncryptedData(d.CVC, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+func (r *RSA) EncryptedTextData(d *model.CryptoTextData) error {
+	return r.sealFields(textFields(d))
 }
-func (r *RSA) EncryptedPassword(d *model.CryptoPassword) {
-	var err error
-	d.Login, err = r.EncryptedData(d.Login, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.Pass, err = r.EncryptedData(d.Pass, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+
+func (r *RSA) EncryptedBinaryData(d *model.CryptoBinaryData) error {
+	return r.sealFields(binaryFields(d))
 }
-func (r *RSA) EncryptedTextData(d *model.CryptoTextData) {
-	var err error
-	d.Text, err = r.EncryptedData(d.Text, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+
+func (r *RSA) EncryptedItem(d *model.Item) error {
+	return r.sealFields(itemFields(d))
 }
-func (r *RSA) EncryptedBinaryData(d *model.CryptoBinaryData) {
-	var err error
-	d.Data, err = r.EncryptedData(d.Data, r.Public)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+
+func (r *RSA) DecryptedCard(d *model.CryptoCard) error {
+	return r.openFields(cardFields(d))
 }
 
-func (r *RSA) DecryptedCard(d *model.CryptoCard) {
-	var err error
-	d.Number, err = r.DecryptedData(d.Number, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.Name, err = r.DecryptedData(d.Name, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.CVC, err = r.DecryptedData(d.CVC, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+func (r *RSA) DecryptedPassword(d *model.CryptoPassword) error {
+	return r.openFields(passwordFields(d))
 }
 
-func (r *RSA) DecryptedPassword(d *model.CryptoPassword) {
-	var err error
-	d.Login, err = r.DecryptedData(d.Login, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
-	d.Pass, err = r.DecryptedData(d.Pass, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+func (r *RSA) DecryptedTextData(d *model.CryptoTextData) error {
+	return r.openFields(textFields(d))
 }
 
-func (r *RSA) DecryptedTextData(d *model.CryptoTextData) {
-	var err error
-	d.Text, err = r.DecryptedData(d.Text, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+func (r *RSA) DecryptedBinaryData(d *model.CryptoBinaryData) error {
+	return r.openFields(binaryFields(d))
 }
 
-func (r *RSA) DecryptedBinaryData(d *model.CryptoBinaryData) {
-	var err error
-	d.Data, err = r.DecryptedData(d.Data, r.Private)
-	if err != nil {
-		r.logger.LogErr(err, "")
-		os.Exit(1)
-	}
+func (r *RSA) DecryptedItem(d *model.Item) error {
+	return r.openFields(itemFields(d))
 }
@@ -0,0 +1,271 @@
+// Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
+// Данный модуль шифрует записи конвертом: случайный ключ данных на каждую запись шифрует поля AES-256-GCM,
+// а сам ключ данных шифруется ключом пользователя (RSA-OAEP).
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Формат поля в конверте (версия 3):
+//
+//	"PM" | версия (1 байт) | длина ключа данных (2 байта, big endian) | ключ данных, зашифрованный RSA-OAEP |
+//	nonce (12 байт) | поле, зашифрованное AES-256-GCM, с тегом (16 байт)
+//
+// В версии 3 вместе с полем проверяется список имен всех зашифрованных полей записи, в версии 2 - только
+// имя самого поля. Поля версии 2 и поля, зашифрованные до появления конверта, - блоки RSA-OAEP без заголовка, -
+// по-прежнему расшифровываются.
+const (
+	envelopeMagic   = "PM"
+	envelopeVersion = 3
+	envelopeV2      = 2
+	dataKeySize     = 32
+	nonceSize       = 12
+	tagSize         = 16
+	headerSize      = len(envelopeMagic) + 1 + 2
+)
+
+var (
+	labelOAEP    = []byte("OAEP Encrypted")
+	labelDataKey = []byte("passManager data key")
+	// errNotEnvelope - данные не в формате конверта, скорее всего зашифрованы только RSA.
+	errNotEnvelope = errors.New("not an envelope")
+)
+
+// envelope - разобранное поле в формате конверта.
+type envelope struct {
+	version    byte
+	wrappedKey []byte
+	nonce      []byte
+	sealed     []byte
+}
+
+// parseEnvelope - разбор поля в формате конверта.
+func parseEnvelope(b []byte) (*envelope, error) {
+	if len(b) < headerSize || string(b[:len(envelopeMagic)]) != envelopeMagic {
+		return nil, errNotEnvelope
+	}
+	version := b[len(envelopeMagic)]
+	if version != envelopeVersion && version != envelopeV2 {
+		return nil, errNotEnvelope
+	}
+	n := int(binary.BigEndian.Uint16(b[len(envelopeMagic)+1 : headerSize]))
+	rest := b[headerSize:]
+	if len(rest) < n+nonceSize+tagSize {
+		return nil, errNotEnvelope
+	}
+	return &envelope{
+		version:    version,
+		wrappedKey: rest[:n],
+		nonce:      rest[n : n+nonceSize],
+		sealed:     rest[n+nonceSize:],
+	}, nil
+}
+
+// IsLegacy - проверка, что поле зашифровано старым способом (только RSA или конвертом версии 2, где набор полей
+// записи не проверяется) и запись стоит перешифровать.
+func (r *RSA) IsLegacy(b []byte) bool {
+	e, err := parseEnvelope(b)
+	return err != nil || e.version != envelopeVersion
+}
+
+// dataKey - ключ данных одной записи в открытом и зашифрованном ключом пользователя виде.
+// names - имена всех зашифрованных полей записи, проверяются вместе с каждым полем (с версии 3).
+type dataKey struct {
+	aead    cipher.AEAD
+	version byte
+	wrapped []byte
+	names   []byte
+}
+
+// newDataKey - создание случайного ключа данных, зашифрованного открытым ключом пользователя.
+func newDataKey(publicKey *rsa.PublicKey) (*dataKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, labelDataKey)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key, envelopeVersion, wrapped)
+}
+
+// openDataKey - расшифровка ключа данных конверта e закрытым ключом пользователя.
+func openDataKey(e *envelope, privateKey *rsa.PrivateKey) (*dataKey, error) {
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, e.wrappedKey, labelDataKey)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(key, e.version, e.wrappedKey)
+}
+
+func newAEAD(key []byte, version byte, wrapped []byte) (*dataKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &dataKey{aead: aead, version: version, wrapped: wrapped}, nil
+}
+
+// bind - привязка ключа данных к набору полей записи. Пустые общие поля не шифруются, и без списка имен
+// их можно было бы стереть из записи незаметно. Каждое имя пишется с длиной, поэтому списки не склеиваются.
+func (k *dataKey) bind(fields []recordField) {
+	k.names = nil
+	if k.version == envelopeV2 {
+		return
+	}
+	for _, f := range fields {
+		k.names = binary.BigEndian.AppendUint16(k.names, uint16(len(f.name)))
+		k.names = append(k.names, f.name...)
+	}
+}
+
+// additionalData - данные, которые проверяются вместе с полем: заголовок конверта, имена полей записи и имя поля.
+// Поэтому поле нельзя подменить полем с другим именем или из записи с другим ключом данных, а из записи нельзя
+// убрать поле.
+func (k *dataKey) additionalData(field string) []byte {
+	ad := make([]byte, 0, headerSize+len(k.wrapped)+len(k.names)+len(field))
+	ad = append(ad, k.header()...)
+	ad = append(ad, k.names...)
+	return append(ad, field...)
+}
+
+// header - заголовок конверта с зашифрованным ключом данных.
+func (k *dataKey) header() []byte {
+	h := make([]byte, headerSize, headerSize+len(k.wrapped))
+	copy(h, envelopeMagic)
+	h[len(envelopeMagic)] = k.version
+	binary.BigEndian.PutUint16(h[len(envelopeMagic)+1:], uint16(len(k.wrapped)))
+	return append(h, k.wrapped...)
+}
+
+// seal - шифрование поля field ключом данных.
+func (k *dataKey) seal(field string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(k.header(), nonce...)
+	return k.aead.Seal(out, nonce, plaintext, k.additionalData(field)), nil
+}
+
+// open - расшифровка поля field ключом данных.
+func (k *dataKey) open(field string, e *envelope) ([]byte, error) {
+	plaintext, err := k.aead.Open(nil, e.nonce, e.sealed, k.additionalData(field))
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", field, err)
+	}
+	return plaintext, nil
+}
+
+// recordField - поле записи и его имя, под которым оно шифруется.
+type recordField struct {
+	name  string
+	value *[]byte
+}
+
+// sealRecord - шифрование всех полей одной записи общим случайным ключом данных.
+func sealRecord(fields []recordField, publicKey *rsa.PublicKey) error {
+	k, err := newDataKey(publicKey)
+	if err != nil {
+		return err
+	}
+	k.bind(fields)
+	for _, f := range fields {
+		sealed, err := k.seal(f.name, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = sealed
+	}
+	return nil
+}
+
+// openRecord - расшифровка всех полей одной записи. Все поля должны быть зашифрованы одним ключом данных,
+// поэтому запись нельзя собрать из полей разных записей. Записи конверта версии 3 расшифровываются, только если
+// набор их полей не изменился. Записи без заголовка конверта расшифровываются только RSA.
+func openRecord(fields []recordField, privateKey *rsa.PrivateKey) error {
+	envelopes := make([]*envelope, len(fields))
+	for i, f := range fields {
+		e, err := parseEnvelope(*f.value)
+		if err != nil {
+			return openLegacyRecord(fields, privateKey, err)
+		}
+		if i > 0 && (e.version != envelopes[0].version || !bytes.Equal(e.wrappedKey, envelopes[0].wrappedKey)) {
+			return fmt.Errorf("field %s: record fields are encrypted with different keys", f.name)
+		}
+		envelopes[i] = e
+	}
+	k, err := openDataKey(envelopes[0], privateKey)
+	if err != nil {
+		return openLegacyRecord(fields, privateKey, err)
+	}
+	k.bind(fields)
+	plaintexts := make([][]byte, len(fields))
+	for i, f := range fields {
+		if plaintexts[i], err = k.open(f.name, envelopes[i]); err != nil {
+			return err
+		}
+	}
+	for i, f := range fields {
+		*f.value = plaintexts[i]
+	}
+	return nil
+}
+
+// openLegacyRecord - расшифровка записи старого формата. Если и она не удалась, возвращается ошибка конверта envErr,
+// ведь данные, похожие на конверт, скорее всего конвертом и были.
+func openLegacyRecord(fields []recordField, privateKey *rsa.PrivateKey, envErr error) error {
+	plaintexts := make([][]byte, len(fields))
+	for i, f := range fields {
+		var err error
+		if plaintexts[i], err = decryptLegacy(*f.value, privateKey); err != nil {
+			if errors.Is(envErr, errNotEnvelope) {
+				return err
+			}
+			return envErr
+		}
+	}
+	for i, f := range fields {
+		*f.value = plaintexts[i]
+	}
+	return nil
+}
+
+// decryptLegacy - расшифровка поля старого формата: блоков RSA-OAEP размером с ключ.
+func decryptLegacy(msg []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
+	msgLen := len(msg)
+	step := privateKey.PublicKey.Size()
+	var decryptedBytes []byte
+
+	for start := 0; start < msgLen; start += step {
+		finish := start + step
+		if finish > msgLen {
+			finish = msgLen
+		}
+
+		decryptedBlockBytes, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, msg[start:finish], labelOAEP)
+		if err != nil {
+			return nil, err
+		}
+
+		decryptedBytes = append(decryptedBytes, decryptedBlockBytes...)
+	}
+
+	return decryptedBytes, nil
+}
@@ -0,0 +1,275 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+var (
+	keyOnce sync.Once
+	keys    [2]*rsa.PrivateKey
+)
+
+// testKeys - два ключа пользователя, общие для тестов пакета: создание ключа RSA медленное.
+func testKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	keyOnce.Do(func() {
+		for i := range keys {
+			k, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			keys[i] = k
+		}
+	})
+	return keys[0], keys[1]
+}
+
+// sealTestRecord - запись из полей name=value, зашифрованная ключом private.
+func sealTestRecord(t *testing.T, private *rsa.PrivateKey, values map[string]string, names ...string) []recordField {
+	fields := make([]recordField, len(names))
+	for i, name := range names {
+		v := []byte(values[name])
+		fields[i] = recordField{name, &v}
+	}
+	require.NoError(t, sealRecord(fields, &private.PublicKey))
+	return fields
+}
+
+// copyFields - копия полей записи, чтобы открывать одну запись несколько раз.
+func copyFields(fields []recordField) []recordField {
+	out := make([]recordField, len(fields))
+	for i, f := range fields {
+		v := append([]byte(nil), *f.value...)
+		out[i] = recordField{f.name, &v}
+	}
+	return out
+}
+
+func TestSealRecord_RoundTrip(t *testing.T) {
+	private, _ := testKeys(t)
+	values := map[string]string{"card.number": "4111", "card.name": "", "card.title": "visa"}
+	fields := sealTestRecord(t, private, values, "card.number", "card.name", "card.title")
+	for _, f := range fields {
+		assert.NotEqual(t, values[f.name], string(*f.value))
+		assert.False(t, (&RSA{}).IsLegacy(*f.value))
+	}
+
+	opened := copyFields(fields)
+	require.NoError(t, openRecord(opened, private))
+	for _, f := range opened {
+		assert.Equal(t, values[f.name], string(*f.value))
+	}
+}
+
+func TestOpenRecord_Tampered(t *testing.T) {
+	private, other := testKeys(t)
+	values := map[string]string{"text.text": "secret", "text.title": "title", "text.notes": "notes"}
+	names := []string{"text.text", "text.title", "text.notes"}
+
+	tests := []struct {
+		name   string
+		tamper func(fields []recordField) []recordField
+	}{
+		{
+			name: "header version",
+			tamper: func(fields []recordField) []recordField {
+				//в версии 2 набор полей не проверялся, но заголовок проверяется вместе с полем
+				for _, f := range fields {
+					(*f.value)[len(envelopeMagic)] = envelopeV2
+				}
+				return fields
+			},
+		},
+		{
+			name: "wrapped key",
+			tamper: func(fields []recordField) []recordField {
+				for _, f := range fields {
+					(*f.value)[headerSize] ^= 1
+				}
+				return fields
+			},
+		},
+		{
+			name: "nonce",
+			tamper: func(fields []recordField) []recordField {
+				e, _ := parseEnvelope(*fields[1].value)
+				e.nonce[0] ^= 1
+				return fields
+			},
+		},
+		{
+			name: "ciphertext",
+			tamper: func(fields []recordField) []recordField {
+				v := *fields[2].value
+				v[len(v)-1] ^= 1
+				return fields
+			},
+		},
+		{
+			name: "field name",
+			tamper: func(fields []recordField) []recordField {
+				fields[1].name, fields[2].name = fields[2].name, fields[1].name
+				return fields
+			},
+		},
+		{
+			name: "stripped field",
+			tamper: func(fields []recordField) []recordField {
+				return fields[:2]
+			},
+		},
+		{
+			name: "mixed wrapped keys",
+			tamper: func(fields []recordField) []recordField {
+				//поле с тем же именем из другой записи того же пользователя
+				foreign := sealTestRecord(t, private, values, names...)
+				fields[0] = foreign[0]
+				return fields
+			},
+		},
+		{
+			name: "other user key",
+			tamper: func(fields []recordField) []recordField {
+				return sealTestRecord(t, other, values, names...)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := tt.tamper(sealTestRecord(t, private, values, names...))
+			assert.Error(t, openRecord(fields, private))
+		})
+	}
+}
+
+func TestOpenRecord_Legacy(t *testing.T) {
+	private, _ := testKeys(t)
+
+	//поле старого формата - блоки RSA-OAEP без заголовка
+	plain := make([]byte, 300)
+	_, err := rand.Read(plain)
+	require.NoError(t, err)
+	step := private.PublicKey.Size() - 2*sha256.Size - 2
+	var legacy []byte
+	for start := 0; start < len(plain); start += step {
+		finish := start + step
+		if finish > len(plain) {
+			finish = len(plain)
+		}
+		block, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &private.PublicKey, plain[start:finish], labelOAEP)
+		require.NoError(t, err)
+		legacy = append(legacy, block...)
+	}
+	assert.True(t, (&RSA{}).IsLegacy(legacy))
+	value := append([]byte(nil), legacy...)
+	require.NoError(t, openRecord([]recordField{{"binary.data", &value}}, private))
+	assert.Equal(t, plain, value)
+
+	//конверт версии 2 открывается, но набор полей в нем не проверяется, поэтому запись стоит перешифровать
+	k, err := newDataKey(&private.PublicKey)
+	require.NoError(t, err)
+	k.version = envelopeV2
+	sealed, err := k.seal("binary.data", []byte("data"))
+	require.NoError(t, err)
+	assert.True(t, (&RSA{}).IsLegacy(sealed))
+	require.NoError(t, openRecord([]recordField{{"binary.data", &sealed}}, private))
+	assert.Equal(t, []byte("data"), sealed)
+}
+
+func TestRSA_IsLegacy(t *testing.T) {
+	private, _ := testKeys(t)
+	current, err := (&RSA{}).EncryptedData([]byte("data"), &private.PublicKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		legacy bool
+	}{
+		{name: "envelope", data: current, legacy: false},
+		{name: "empty", data: nil, legacy: true},
+		{name: "short", data: []byte("PM"), legacy: true},
+		{name: "no magic", data: append([]byte("XX"), current[2:]...), legacy: true},
+		{name: "unknown version", data: append([]byte{'P', 'M', 9}, current[3:]...), legacy: true},
+		{name: "truncated", data: current[:headerSize+4], legacy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.legacy, (&RSA{}).IsLegacy(tt.data))
+		})
+	}
+}
+
+func TestRSA_EncryptedData(t *testing.T) {
+	private, _ := testKeys(t)
+	r := &RSA{}
+
+	_, err := r.EncryptedData([]byte("data"), nil)
+	assert.ErrorIs(t, err, ErrLocked)
+	encrypted, err := r.EncryptedData([]byte("data"), &private.PublicKey)
+	require.NoError(t, err)
+	_, err = r.DecryptedData(encrypted, nil)
+	assert.ErrorIs(t, err, ErrLocked)
+	decrypted, err := r.DecryptedData(encrypted, private)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+}
+
+func TestRSA_EncryptedRecords(t *testing.T) {
+	private, _ := testKeys(t)
+	r := &RSA{Private: private, Public: &private.PublicKey}
+	meta := model.ItemMeta{Title: []byte("title"), Tags: []byte("a,b")}
+
+	card := model.CryptoCard{Number: []byte("4111"), Name: []byte("name"), CVC: []byte("123"), ItemMeta: meta}
+	require.NoError(t, r.EncryptedCard(&card))
+	assert.NotEqual(t, []byte("4111"), card.Number)
+	assert.NotEqual(t, []byte("title"), card.Title)
+	//пустые общие поля остаются пустыми
+	assert.Empty(t, card.URL)
+	require.NoError(t, r.DecryptedCard(&card))
+	assert.Equal(t, model.CryptoCard{Number: []byte("4111"), Name: []byte("name"), CVC: []byte("123"), ItemMeta: meta}, card)
+
+	item := model.Item{Type: "note", Payload: []byte("payload"), ItemMeta: meta}
+	require.NoError(t, r.EncryptedItem(&item))
+	//запись не открывается как запись другого вида
+	other := item
+	other.Type = "wifi"
+	assert.Error(t, r.DecryptedItem(&other))
+	require.NoError(t, r.DecryptedItem(&item))
+	assert.Equal(t, []byte("payload"), item.Payload)
+	assert.Equal(t, meta, item.ItemMeta)
+}
+
+func TestRSA_DecryptedRecords_Errors(t *testing.T) {
+	private, other := testKeys(t)
+	r := &RSA{Private: private, Public: &private.PublicKey}
+
+	text := model.CryptoTextData{Text: []byte("secret"), ItemMeta: model.ItemMeta{Notes: []byte("notes")}}
+	require.NoError(t, r.EncryptedTextData(&text))
+	sealed := text
+
+	//подмененная запись и запись с другим ключом - ошибка, а не завершение программы, поля не меняются
+	tampered := model.CryptoTextData{Text: append([]byte(nil), sealed.Text...), ItemMeta: sealed.ItemMeta}
+	tampered.Text[len(tampered.Text)-1] ^= 1
+	assert.Error(t, r.DecryptedTextData(&tampered))
+	assert.NotEqual(t, []byte("secret"), tampered.Text)
+	stripped := model.CryptoTextData{Text: append([]byte(nil), sealed.Text...)}
+	assert.Error(t, r.DecryptedTextData(&stripped))
+	assert.Error(t, (&RSA{Private: other}).DecryptedTextData(&text))
+	assert.Equal(t, sealed, text)
+
+	//хранилище заблокировали между проверкой и шифрованием
+	locked := &RSA{}
+	assert.ErrorIs(t, locked.EncryptedTextData(&model.CryptoTextData{Text: []byte("secret")}), ErrLocked)
+	assert.ErrorIs(t, locked.DecryptedTextData(&text), ErrLocked)
+	assert.ErrorIs(t, locked.EncryptedCard(&model.CryptoCard{}), ErrLocked)
+	assert.ErrorIs(t, locked.DecryptedItem(&model.Item{Type: "note"}), ErrLocked)
+}
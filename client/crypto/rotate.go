@@ -0,0 +1,146 @@
+// Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
+// Данный модуль меняет ключ пользователя: создает новый ключ, перешифровывает им записи и заменяет старый ключ.
+// Новый ключ сразу сохраняется в отдельном хранилище, поэтому прерванную смену можно продолжить.
+
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// errNoRotation - смена ключа не начата.
+var errNoRotation = errors.New("key rotation is not started")
+
+// pendingPath - путь к хранилищу нового ключа незавершенной смены.
+func (r *RSA) pendingPath(login string) string {
+	return r.vaultPath(login) + ".next"
+}
+
+// BeginRotation - начало смены ключа пользователя login. Новый ключ сохраняется в хранилище, зашифрованном
+// мастер-паролем. Если смена уже начиналась и прервалась, продолжается с тем же новым ключом.
+func (r *RSA) BeginRotation(login, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Private == nil {
+		return ErrLocked
+	}
+	file := r.pendingPath(login)
+	content, err := os.ReadFile(file)
+	if err == nil {
+		var sealed sealedKey
+		if err = json.Unmarshal(content, &sealed); err != nil {
+			return fmt.Errorf("vault %s: %w", file, err)
+		}
+		next, err := sealed.open(login, password)
+		if err != nil {
+			return err
+		}
+		r.setNext(next)
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	next, err := rsa.GenerateKey(rand.Reader, vaultKeySize)
+	if err != nil {
+		return err
+	}
+	if err = r.seal(file, login, password, next); err != nil {
+		return err
+	}
+	r.setNext(next)
+	return nil
+}
+
+// RotationPending - проверка, что смена ключа пользователя login начиналась и не завершилась.
+func (r *RSA) RotationPending(login string) bool {
+	_, err := os.Stat(r.pendingPath(login))
+	return err == nil
+}
+
+// PendingVault - хранилище нового ключа для отправки на сервер вместе с перешифрованными записями.
+func (r *RSA) PendingVault(login string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return os.ReadFile(r.pendingPath(login))
+}
+
+// CommitRotation - завершение смены ключа после того, как сервер принял перешифрованные записи:
+// хранилище нового ключа заменяет старое, старый ключ стирается из памяти.
+func (r *RSA) CommitRotation(login string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next == nil {
+		return errNoRotation
+	}
+	if err := os.Rename(r.pendingPath(login), r.vaultPath(login)); err != nil {
+		return err
+	}
+	next := r.next
+	r.next = nil
+	r.setKey(next)
+	return nil
+}
+
+// ReencryptCard - перешифровка карты новым ключом.
+func (r *RSA) ReencryptCard(d *model.CryptoCard) error {
+	return r.reencrypt(cardFields(d))
+}
+
+// ReencryptPassword - перешифровка пары логин/пароль новым ключом.
+func (r *RSA) ReencryptPassword(d *model.CryptoPassword) error {
+	return r.reencrypt(passwordFields(d))
+}
+
+// ReencryptTextData - перешифровка текстовых данных новым ключом.
+func (r *RSA) ReencryptTextData(d *model.CryptoTextData) error {
+	return r.reencrypt(textFields(d))
+}
+
+// ReencryptBinaryData - перешифровка бинарных данных новым ключом.
+func (r *RSA) ReencryptBinaryData(d *model.CryptoBinaryData) error {
+	return r.reencrypt(binaryFields(d))
+}
+
+// ReencryptItem - перешифровка записи Item новым ключом.
+func (r *RSA) ReencryptItem(d *model.Item) error {
+	return r.reencrypt(itemFields(d))
+}
+
+// reencrypt - расшифровка записи текущим ключом и шифрование новым. Запись, которую прерванная смена
+// уже перешифровала, расшифровывается новым ключом.
+func (r *RSA) reencrypt(fields []recordField) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Private == nil {
+		return ErrLocked
+	}
+	if r.next == nil {
+		return errNoRotation
+	}
+	if err := openRecord(fields, r.Private); err != nil {
+		if errNext := openRecord(fields, r.next); errNext != nil {
+			return err
+		}
+	}
+	return sealRecord(fields, &r.next.PublicKey)
+}
+
+// setNext - установка нового ключа смены. Вызывается под блокировкой.
+func (r *RSA) setNext(next *rsa.PrivateKey) {
+	if r.next != nil && r.next != next {
+		zeroKey(r.next)
+	}
+	r.next = next
+}
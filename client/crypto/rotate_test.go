@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// rotatingRSA - открытое хранилище со сменой ключа, прерванной после сохранения нового ключа next.
+func rotatingRSA(t *testing.T) *RSA {
+	private, next := testKeys(t)
+	r := withLegacyKey(t, newTestRSA(t), private)
+	require.NoError(t, r.Unlock("user", "pass"))
+	require.NoError(t, os.WriteFile(r.pendingPath("user"), sealedVault(t, next, "user", "pass"), 0600))
+	return r
+}
+
+func TestRSA_BeginRotation(t *testing.T) {
+	private, _ := testKeys(t)
+	r := withLegacyKey(t, newTestRSA(t), private)
+
+	assert.ErrorIs(t, r.BeginRotation("user", "pass"), ErrLocked)
+	require.NoError(t, r.Unlock("user", "pass"))
+	assert.False(t, r.RotationPending("user"))
+	require.NoError(t, r.BeginRotation("user", "pass"))
+	assert.True(t, r.RotationPending("user"))
+	require.NotNil(t, r.next)
+	assert.False(t, private.Equal(r.next))
+	next := r.next.PublicKey
+	pending, err := r.PendingVault("user")
+	require.NoError(t, err)
+
+	//после перезапуска смена продолжается с тем же новым ключом
+	resumed := &RSA{logger: r.logger, path: r.path}
+	require.NoError(t, resumed.Unlock("user", "pass"))
+	assert.ErrorIs(t, resumed.BeginRotation("user", "wrong"), ErrWrongPassword)
+	require.NoError(t, resumed.BeginRotation("user", "pass"))
+	assert.True(t, next.Equal(&resumed.next.PublicKey))
+	resumedPending, err := resumed.PendingVault("user")
+	require.NoError(t, err)
+	assert.Equal(t, pending, resumedPending)
+}
+
+func TestRSA_Reencrypt(t *testing.T) {
+	private, next := testKeys(t)
+	r := rotatingRSA(t)
+	card := model.CryptoCard{Number: []byte("4111"), Name: []byte("name"), CVC: []byte("123"), ItemMeta: model.ItemMeta{Title: []byte("title")}}
+	require.NoError(t, r.EncryptedCard(&card))
+
+	assert.ErrorIs(t, r.ReencryptCard(&card), errNoRotation)
+	require.NoError(t, r.BeginRotation("user", "pass"))
+	require.NoError(t, r.ReencryptCard(&card))
+	assert.Error(t, openRecord(copyFields(cardFields(&card)), private))
+	require.NoError(t, openRecord(copyFields(cardFields(&card)), next))
+
+	//запись, которую прерванная смена уже перешифровала, открывается новым ключом
+	require.NoError(t, r.ReencryptCard(&card))
+	fields := copyFields(cardFields(&card))
+	require.NoError(t, openRecord(fields, next))
+	assert.Equal(t, "4111", string(*fields[0].value))
+	assert.Equal(t, "title", string(*fields[3].value))
+
+	//запись, которую не открывает ни один ключ, не перешифровывается
+	stranger, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	foreign := []byte("foreign")
+	require.NoError(t, sealRecord([]recordField{{"text.text", &foreign}}, &stranger.PublicKey))
+	text := model.CryptoTextData{Text: foreign}
+	assert.Error(t, r.ReencryptTextData(&text))
+
+	r.Lock()
+	assert.ErrorIs(t, r.ReencryptCard(&card), ErrLocked)
+}
+
+func TestRSA_CommitRotation(t *testing.T) {
+	_, next := testKeys(t)
+	r := rotatingRSA(t)
+
+	assert.ErrorIs(t, r.CommitRotation("user"), errNoRotation)
+	require.NoError(t, r.BeginRotation("user", "pass"))
+	require.NoError(t, r.CommitRotation("user"))
+	assert.False(t, r.RotationPending("user"))
+	assert.Nil(t, r.next)
+	assert.True(t, next.Equal(r.Private))
+
+	//хранилище теперь открывает новый ключ
+	r.Lock()
+	require.NoError(t, r.Unlock("user", "pass"))
+	assert.True(t, next.Equal(r.Private))
+}
@@ -0,0 +1,179 @@
+// Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
+// Данный модуль шифрует файл сессии: токены хранятся на диске зашифрованными ключом из мастер-пароля,
+// как и закрытый ключ, поэтому файл сессии без мастер-пароля бесполезен.
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const sessionVersion = 1
+
+// sealedSession - файл сессии. Логин и адрес сервера хранятся открыто, чтобы предложить вход без ввода логина.
+// В файле локальной копии их нет (см. SealCache).
+type sealedSession struct {
+	Version int    `json:"version"`
+	Login   string `json:"login,omitempty"`
+	Server  string `json:"server,omitempty"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// SessionSealer - шифрование файла сессии. Ключ из мастер-пароля получается один раз при входе,
+// после этого файл перезаписывается при каждом обновлении токенов без пароля.
+type SessionSealer struct {
+	file sealedSession
+	aead cipher.AEAD
+}
+
+// NewSessionSealer - шифрование сессии пользователя login на сервере server ключом из мастер-пароля с новой солью.
+func NewSessionSealer(login, server, password string) (*SessionSealer, error) {
+	s := sealedSession{
+		Version: sessionVersion,
+		Login:   login,
+		Server:  server,
+		KDF:     vaultKDF,
+		Salt:    make([]byte, vaultSaltSize),
+		Time:    vaultArgonTime,
+		Memory:  vaultArgonMemory,
+		Threads: vaultArgonThreads,
+	}
+	if _, err := io.ReadFull(rand.Reader, s.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := kekCipher(password, s.Salt, s.Time, s.Memory, s.Threads)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionSealer{file: s, aead: aead}, nil
+}
+
+// SessionLogin - логин и сервер сохраненной сессии, без расшифровки.
+func SessionLogin(content []byte) (login, server string, err error) {
+	var s sealedSession
+	if err = json.Unmarshal(content, &s); err != nil {
+		return "", "", fmt.Errorf("session: %w", err)
+	}
+	return s.Login, s.Server, nil
+}
+
+// OpenSession - расшифровка файла сессии мастер-паролем. Возвращает данные сессии и шифрование
+// для следующих записей. Если пароль не подходит, возвращает ErrWrongPassword.
+func OpenSession(content []byte, password string) (*SessionSealer, []byte, error) {
+	var s sealedSession
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, nil, fmt.Errorf("session: %w", err)
+	}
+	return s.open(password)
+}
+
+// OpenCache - расшифровка файла, зашифрованного SealCache, мастер-паролем пользователя login на сервере server.
+// Возвращает данные и шифрование, которым файл был зашифрован. Если пароль, логин или сервер не подходят,
+// возвращает ErrWrongPassword.
+func OpenCache(content []byte, login, server, password string) (*SessionSealer, []byte, error) {
+	var s sealedSession
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, nil, fmt.Errorf("cache: %w", err)
+	}
+	s.Login, s.Server = login, server
+	return s.open(password)
+}
+
+// open - расшифровка файла s ключом из мастер-пароля.
+func (s sealedSession) open(password string) (*SessionSealer, []byte, error) {
+	if s.Version != sessionVersion || s.KDF != vaultKDF {
+		return nil, nil, fmt.Errorf("unsupported session version %d %s", s.Version, s.KDF)
+	}
+	aead, err := kekCipher(password, s.Salt, s.Time, s.Memory, s.Threads)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, nil, fmt.Errorf("wrong session nonce")
+	}
+	data, err := aead.Open(nil, s.Nonce, s.Data, s.additionalData())
+	if err != nil {
+		return nil, nil, ErrWrongPassword
+	}
+	return &SessionSealer{file: s, aead: aead}, data, nil
+}
+
+// Login - логин пользователя сессии.
+func (s *SessionSealer) Login() string {
+	return s.file.Login
+}
+
+// Server - адрес сервера сессии.
+func (s *SessionSealer) Server() string {
+	return s.file.Server
+}
+
+// Seal - шифрование данных сессии. Каждый раз используется новый nonce.
+func (s *SessionSealer) Seal(data []byte) ([]byte, error) {
+	f, err := s.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(f)
+}
+
+// SealCache - шифрование файла локальной копии ключом сессии. Логин и сервер в файл не записываются,
+// а только проверяются вместе с данными, поэтому файл не раскрывает, чей он.
+func (s *SessionSealer) SealCache(data []byte) ([]byte, error) {
+	f, err := s.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	f.Login, f.Server = "", ""
+	return json.Marshal(f)
+}
+
+// OpenCache - расшифровка файла, зашифрованного SealCache этим же ключом, без мастер-пароля. Если файл
+// зашифрован другим ключом, например до нового входа, возвращает ErrWrongPassword: его открывает OpenCache
+// с мастер-паролем.
+func (s *SessionSealer) OpenCache(content []byte) ([]byte, error) {
+	var f sealedSession
+	if err := json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("cache: %w", err)
+	}
+	if f.Version != s.file.Version || f.KDF != s.file.KDF || !bytes.Equal(f.Salt, s.file.Salt) ||
+		f.Time != s.file.Time || f.Memory != s.file.Memory || f.Threads != s.file.Threads {
+		return nil, ErrWrongPassword
+	}
+	if len(f.Nonce) != s.aead.NonceSize() {
+		return nil, fmt.Errorf("wrong cache nonce")
+	}
+	f.Login, f.Server = s.file.Login, s.file.Server
+	data, err := s.aead.Open(nil, f.Nonce, f.Data, f.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return data, nil
+}
+
+// seal - шифрование данных с новым nonce.
+func (s *SessionSealer) seal(data []byte) (sealedSession, error) {
+	f := s.file
+	f.Nonce = make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, f.Nonce); err != nil {
+		return f, err
+	}
+	f.Data = s.aead.Seal(nil, f.Nonce, data, f.additionalData())
+	return f, nil
+}
+
+// additionalData - параметры, логин и сервер, которые проверяются вместе с данными сессии.
+func (s *sealedSession) additionalData() []byte {
+	return []byte(fmt.Sprintf("passManager session v%d %s %d %d %d %s %s", s.Version, s.KDF, s.Time, s.Memory, s.Threads, s.Login, s.Server))
+}
@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenSession(t *testing.T) {
+	sealer, err := NewSessionSealer("user", "localhost:8080", "pass")
+	require.NoError(t, err)
+	content, err := sealer.Seal([]byte(`{"token":"t"}`))
+	require.NoError(t, err)
+
+	//логин и сервер читаются без пароля
+	login, server, err := SessionLogin(content)
+	require.NoError(t, err)
+	assert.Equal(t, "user", login)
+	assert.Equal(t, "localhost:8080", server)
+
+	// edit - файл сессии с измененным полем.
+	edit := func(change func(s *sealedSession)) []byte {
+		var s sealedSession
+		require.NoError(t, json.Unmarshal(content, &s))
+		change(&s)
+		b, err := json.Marshal(s)
+		require.NoError(t, err)
+		return b
+	}
+	tests := []struct {
+		name     string
+		content  []byte
+		password string
+		ok       bool
+		err      error
+	}{
+		{name: "ok", content: content, password: "pass", ok: true},
+		{name: "wrong password", content: content, password: "wrong", err: ErrWrongPassword},
+		//токены нельзя отправить на другой сервер, подменив адрес в файле
+		{name: "other server", content: edit(func(s *sealedSession) { s.Server = "evil:8080" }), password: "pass", err: ErrWrongPassword},
+		{name: "other login", content: edit(func(s *sealedSession) { s.Login = "other" }), password: "pass", err: ErrWrongPassword},
+		{name: "weaker kdf", content: edit(func(s *sealedSession) { s.Time = 1 }), password: "pass", err: ErrWrongPassword},
+		{name: "tampered data", content: edit(func(s *sealedSession) { s.Data[0] ^= 1 }), password: "pass", err: ErrWrongPassword},
+		{name: "unknown version", content: edit(func(s *sealedSession) { s.Version = 2 }), password: "pass"},
+		{name: "wrong nonce", content: edit(func(s *sealedSession) { s.Nonce = s.Nonce[:4] }), password: "pass"},
+		{name: "not a session", content: []byte("session"), password: "pass"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, data, err := OpenSession(tt.content, tt.password)
+			switch {
+			case tt.ok:
+				require.NoError(t, err)
+				assert.Equal(t, `{"token":"t"}`, string(data))
+				assert.Equal(t, "user", opened.Login())
+				assert.Equal(t, "localhost:8080", opened.Server())
+			case tt.err != nil:
+				assert.ErrorIs(t, err, tt.err)
+			default:
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, ErrWrongPassword)
+			}
+		})
+	}
+}
+
+func TestSessionSealer_Reseal(t *testing.T) {
+	sealer, err := NewSessionSealer("user", "localhost:8080", "pass")
+	require.NoError(t, err)
+	first, err := sealer.Seal([]byte("first"))
+	require.NoError(t, err)
+
+	//продолженная сессия перезаписывается без пароля тем же ключом, но с новым nonce
+	opened, _, err := OpenSession(first, "pass")
+	require.NoError(t, err)
+	second, err := opened.Seal([]byte("second"))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	_, data, err := OpenSession(second, "pass")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), data)
+}
+
+func TestSessionSealer_Cache(t *testing.T) {
+	sealer, err := NewSessionSealer("user", "localhost:8080", "pass")
+	require.NoError(t, err)
+	content, err := sealer.SealCache([]byte("cache"))
+	require.NoError(t, err)
+
+	//файл копии не раскрывает логин и сервер
+	assert.NotContains(t, string(content), "user")
+	assert.NotContains(t, string(content), "localhost")
+
+	//тот же ключ открывает копию без пароля
+	data, err := sealer.OpenCache(content)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cache"), data)
+
+	//ключ нового входа - другой, копию открывает мастер-пароль
+	other, err := NewSessionSealer("user", "localhost:8080", "pass")
+	require.NoError(t, err)
+	_, err = other.OpenCache(content)
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	opened, data, err := OpenCache(content, "user", "localhost:8080", "pass")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cache"), data)
+	data, err = opened.OpenCache(content)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("cache"), data)
+
+	//копия другого пользователя или сервера не открывается
+	_, _, err = OpenCache(content, "other", "localhost:8080", "pass")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, _, err = OpenCache(content, "user", "evil:8080", "pass")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	_, _, err = OpenCache(content, "user", "localhost:8080", "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+}
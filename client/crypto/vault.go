@@ -0,0 +1,383 @@
+// Пакет crypto предоставляет возможность шифрования данных и обратной расшифровке на стороне клиента.
+// Данный модуль хранит закрытый ключ на диске только в зашифрованном виде. Ключ шифрования ключа (KEK)
+// получается из мастер-пароля argon2id, закрытый ключ расшифровывается при входе и стирается из памяти при блокировке.
+// Файл хранилища можно передать на другое устройство через сервер: без мастер-пароля он бесполезен.
+
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Параметры argon2id для новых хранилищ. Параметры записываются в файл хранилища, поэтому их можно менять.
+const (
+	vaultVersion      = 1
+	vaultKDF          = "argon2id"
+	vaultArgonTime    = 3
+	vaultArgonMemory  = 64 * 1024
+	vaultArgonThreads = 2
+	vaultSaltSize     = 16
+	vaultKeySize      = 4096
+)
+
+var (
+	// ErrLocked - хранилище заблокировано, нужно войти с мастер-паролем.
+	ErrLocked = errors.New("vault is locked")
+	// ErrWrongPassword - хранилище зашифровано другим паролем.
+	ErrWrongPassword = errors.New("wrong vault password")
+	// ErrKeyMismatch - в хранилище с сервера другой ключ, чем на этом устройстве, и пароль к нему не подошел.
+	ErrKeyMismatch = errors.New("vault key differs from the key on this device")
+)
+
+// sealedKey - файл хранилища: закрытый ключ в PKCS#8, зашифрованный AES-256-GCM ключом из мастер-пароля.
+// Открытый ключ хранится открыто, чтобы сравнивать хранилища без пароля.
+type sealedKey struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Nonce   []byte `json:"nonce"`
+	Key     []byte `json:"key"`
+	Public  []byte `json:"public,omitempty"`
+}
+
+// vaultPath - путь к файлу хранилища пользователя login. Имя файла не раскрывает логин.
+func (r *RSA) vaultPath(login string) string {
+	sum := sha256.Sum256([]byte(login))
+	return r.path + "vault-" + hex.EncodeToString(sum[:8]) + ".key"
+}
+
+// Unlock - расшифровка закрытого ключа пользователя login мастер-паролем. Если хранилища еще нет, создается
+// новый ключ. Незашифрованный ключ старых версий переносится в хранилище, только если он задан флагом -crypto-key.
+func (r *RSA) Unlock(login, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file := r.vaultPath(login)
+	content, err := os.ReadFile(file)
+	if err == nil {
+		var sealed sealedKey
+		if err = json.Unmarshal(content, &sealed); err != nil {
+			return fmt.Errorf("vault %s: %w", file, err)
+		}
+		private, err := sealed.open(login, password)
+		if err != nil {
+			return err
+		}
+		r.setKey(private)
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	private, legacy, err := r.legacyKey()
+	switch {
+	case err == nil:
+	case r.legacyFile != "":
+		//заданный явно ключ не заменяется новым молча, иначе записи старых версий не расшифровались бы
+		return fmt.Errorf("legacy key: %w", err)
+	default:
+		if private, err = rsa.GenerateKey(rand.Reader, vaultKeySize); err != nil {
+			return err
+		}
+	}
+	if err = r.seal(file, login, password, private); err != nil {
+		return err
+	}
+	//незашифрованный ключ больше не нужен, он уже в хранилище
+	if legacy != "" {
+		if err = os.Remove(legacy); err != nil {
+			r.logger.LogErr(err, "failed to remove unencrypted private key")
+		}
+	}
+	r.setKey(private)
+	return nil
+}
+
+// SetPassword - перешифровка открытого хранилища новым мастер-паролем после его смены.
+func (r *RSA) SetPassword(login, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Private == nil {
+		return ErrLocked
+	}
+	return r.seal(r.vaultPath(login), login, password, r.Private)
+}
+
+// Vault - содержимое файла хранилища пользователя login для отправки на сервер.
+func (r *RSA) Vault(login string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return os.ReadFile(r.vaultPath(login))
+}
+
+// ImportVault - открытие хранилища content, полученного с сервера, мастер-паролем. Ключ на сервере главный:
+// после смены ключа на другом устройстве записи на сервере зашифрованы уже им. Поэтому хранилище с сервера
+// заменяет файл на устройстве, а файл с другим ключом сохраняется рядом с суффиксом .old. Если на устройстве
+// хранилища нет, content сохраняется даже при неверном пароле, чтобы вместо ключа с сервера не создался новый.
+func (r *RSA) ImportVault(login, password string, content []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var remote sealedKey
+	if err := json.Unmarshal(content, &remote); err != nil {
+		return fmt.Errorf("remote vault: %w", err)
+	}
+	file := r.vaultPath(login)
+	local, err := os.ReadFile(file)
+	sameKey := false
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if err = writeVault(file, content); err != nil {
+			return err
+		}
+		local, sameKey = content, true
+	case err != nil:
+		return err
+	default:
+		var sealed sealedKey
+		if err = json.Unmarshal(local, &sealed); err != nil {
+			return fmt.Errorf("vault %s: %w", file, err)
+		}
+		sameKey = len(sealed.Public) > 0 && bytes.Equal(sealed.Public, remote.Public)
+	}
+	private, err := remote.open(login, password)
+	if err != nil {
+		if !sameKey && errors.Is(err, ErrWrongPassword) {
+			return ErrKeyMismatch
+		}
+		return err
+	}
+	if !sameKey {
+		if err = os.Rename(file, fmt.Sprintf("%s.%d.old", file, time.Now().Unix())); err != nil {
+			zeroKey(private)
+			return err
+		}
+	}
+	if !bytes.Equal(local, content) {
+		if err = writeVault(file, content); err != nil {
+			zeroKey(private)
+			return err
+		}
+	}
+	r.setKey(private)
+	r.dropPending(login, remote.Public)
+	return nil
+}
+
+// dropPending - удаление хранилища незавершенной смены ключа, если сервер уже принял новый ключ public.
+// Вызывается под блокировкой.
+func (r *RSA) dropPending(login string, public []byte) {
+	file := r.pendingPath(login)
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	var pending sealedKey
+	if json.Unmarshal(content, &pending) != nil || !bytes.Equal(pending.Public, public) {
+		return
+	}
+	if err = os.Remove(file); err != nil {
+		r.logger.LogErr(err, "failed to remove pending vault")
+	}
+	if r.next != nil {
+		zeroKey(r.next)
+		r.next = nil
+	}
+}
+
+// Lock - блокировка хранилища: закрытый ключ стирается из памяти. Открытый ключ остается, он не секретный.
+func (r *RSA) Lock() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next != nil {
+		zeroKey(r.next)
+		r.next = nil
+	}
+	if r.Private == nil {
+		return
+	}
+	zeroKey(r.Private)
+	r.Private = nil
+}
+
+// setKey - установка расшифрованного ключа. Вызывается под блокировкой.
+func (r *RSA) setKey(private *rsa.PrivateKey) {
+	if r.Private != nil && r.Private != private {
+		zeroKey(r.Private)
+	}
+	r.Private = private
+	r.Public = &private.PublicKey
+}
+
+// legacyKey - незашифрованный ключ, который сохраняли старые версии клиента, и путь к нему. Ключ берется только
+// из файла, заданного флагом -crypto-key: файл по умолчанию мог оказаться общим для всех ключом из репозитория.
+func (r *RSA) legacyKey() (*rsa.PrivateKey, string, error) {
+	if r.legacyFile == "" {
+		return nil, "", os.ErrNotExist
+	}
+	file := r.path + r.legacyFile
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, "", fmt.Errorf("%s: no PEM data", file)
+	}
+	private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, "", err
+	}
+	return private, file, nil
+}
+
+// seal - запись закрытого ключа в файл хранилища, зашифрованного мастер-паролем. Вызывается под блокировкой.
+func (r *RSA) seal(file, login, password string, private *rsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	defer zeroBytes(der)
+	public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return err
+	}
+	sealed := sealedKey{
+		Public:  public,
+		Version: vaultVersion,
+		KDF:     vaultKDF,
+		Salt:    make([]byte, vaultSaltSize),
+		Time:    vaultArgonTime,
+		Memory:  vaultArgonMemory,
+		Threads: vaultArgonThreads,
+	}
+	if _, err = io.ReadFull(rand.Reader, sealed.Salt); err != nil {
+		return err
+	}
+	aead, err := sealed.aead(password)
+	if err != nil {
+		return err
+	}
+	sealed.Nonce = make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, sealed.Nonce); err != nil {
+		return err
+	}
+	sealed.Key = aead.Seal(nil, sealed.Nonce, der, sealed.additionalData(login))
+	content, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	return writeVault(file, content)
+}
+
+// writeVault - запись файла хранилища. Сначала пишется временный файл, чтобы сбой записи не испортил хранилище.
+func writeVault(file string, content []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// open - расшифровка закрытого ключа мастер-паролем.
+func (s *sealedKey) open(login, password string) (*rsa.PrivateKey, error) {
+	if s.Version != vaultVersion || s.KDF != vaultKDF {
+		return nil, fmt.Errorf("unsupported vault version %d %s", s.Version, s.KDF)
+	}
+	aead, err := s.aead(password)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("wrong vault nonce")
+	}
+	der, err := aead.Open(nil, s.Nonce, s.Key, s.additionalData(login))
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	defer zeroBytes(der)
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("vault key is not RSA")
+	}
+	//открытый ключ не зашифрован, поэтому сверяется с закрытым
+	if len(s.Public) > 0 {
+		public, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		if err != nil || !bytes.Equal(public, s.Public) {
+			zeroKey(private)
+			return nil, fmt.Errorf("vault public key does not match private key")
+		}
+	}
+	return private, nil
+}
+
+// aead - шифр с ключом из мастер-пароля.
+func (s *sealedKey) aead(password string) (cipher.AEAD, error) {
+	return kekCipher(password, s.Salt, s.Time, s.Memory, s.Threads)
+}
+
+// kekCipher - шифр AES-256-GCM с ключом из мастер-пароля argon2id. Ключ стирается сразу после создания шифра.
+func kekCipher(password string, salt []byte, time, memory uint32, threads uint8) (cipher.AEAD, error) {
+	kek := argon2.IDKey([]byte(password), salt, time, memory, threads, 32)
+	defer zeroBytes(kek)
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData - параметры хранилища и логин, которые проверяются вместе с ключом.
+func (s *sealedKey) additionalData(login string) []byte {
+	return []byte(fmt.Sprintf("passManager vault v%d %s %d %d %d %s", s.Version, s.KDF, s.Time, s.Memory, s.Threads, login))
+}
+
+// zeroKey - затирание секретных частей закрытого ключа в памяти.
+func zeroKey(k *rsa.PrivateKey) {
+	values := append([]*big.Int{k.D, k.Precomputed.Dp, k.Precomputed.Dq, k.Precomputed.Qinv}, k.Primes...)
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		words := v.Bits()
+		for i := range words {
+			words[i] = 0
+		}
+		v.SetInt64(0)
+	}
+}
+
+// zeroBytes - затирание секретных данных в памяти.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
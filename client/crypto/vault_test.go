@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
+)
+
+// newTestRSA - шифрование с хранилищами во временной папке.
+func newTestRSA(t *testing.T) *RSA {
+	return &RSA{logger: loggers.NewLogger(), path: t.TempDir() + "/"}
+}
+
+// withLegacyKey - незашифрованный ключ старых версий, заданный флагом -crypto-key. Перенос готового ключа
+// в хранилище быстрее создания нового ключа RSA.
+func withLegacyKey(t *testing.T, r *RSA, private *rsa.PrivateKey) *RSA {
+	r.legacyFile = "private.pem"
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	require.NoError(t, os.WriteFile(r.path+r.legacyFile, content, 0600))
+	return r
+}
+
+func TestRSA_Unlock(t *testing.T) {
+	private, _ := testKeys(t)
+	r := withLegacyKey(t, newTestRSA(t), private)
+
+	require.NoError(t, r.Unlock("user", "pass"))
+	assert.True(t, private.Equal(r.Private))
+	//незашифрованный ключ перенесен в хранилище и удален
+	_, err := os.Stat(r.path + r.legacyFile)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	info, err := os.Stat(r.vaultPath("user"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	r.Lock()
+	assert.Nil(t, r.Private)
+	assert.True(t, private.PublicKey.Equal(r.Public))
+	assert.ErrorIs(t, r.Unlock("user", "wrong"), ErrWrongPassword)
+	assert.Nil(t, r.Private)
+	require.NoError(t, r.Unlock("user", "pass"))
+	assert.True(t, private.Equal(r.Private))
+
+	//хранилище привязано к логину
+	content, err := os.ReadFile(r.vaultPath("user"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(r.vaultPath("other"), content, 0600))
+	assert.ErrorIs(t, r.Unlock("other", "pass"), ErrWrongPassword)
+}
+
+func TestRSA_Unlock_MissingLegacyKey(t *testing.T) {
+	r := newTestRSA(t)
+	r.legacyFile = "private.pem"
+
+	//заданный явно ключ не заменяется новым молча
+	assert.ErrorIs(t, r.Unlock("user", "pass"), os.ErrNotExist)
+	assert.Nil(t, r.Private)
+	_, err := os.Stat(r.vaultPath("user"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRSA_Unlock_NewKey(t *testing.T) {
+	private, _ := testKeys(t)
+	//ключ из папки без флага -crypto-key не берется
+	r := withLegacyKey(t, newTestRSA(t), private)
+	r.legacyFile = ""
+
+	require.NoError(t, r.Unlock("user", "pass"))
+	require.NotNil(t, r.Private)
+	assert.False(t, private.Equal(r.Private))
+	assert.Equal(t, vaultKeySize, r.Private.N.BitLen())
+	created := r.Private.PublicKey
+
+	r.Lock()
+	require.NoError(t, r.Unlock("user", "pass"))
+	assert.True(t, created.Equal(r.Public))
+}
+
+func TestRSA_SetPassword(t *testing.T) {
+	private, _ := testKeys(t)
+	r := withLegacyKey(t, newTestRSA(t), private)
+
+	assert.ErrorIs(t, r.SetPassword("user", "new"), ErrLocked)
+	require.NoError(t, r.Unlock("user", "pass"))
+	require.NoError(t, r.SetPassword("user", "new"))
+
+	r.Lock()
+	assert.ErrorIs(t, r.Unlock("user", "pass"), ErrWrongPassword)
+	require.NoError(t, r.Unlock("user", "new"))
+	assert.True(t, private.Equal(r.Private))
+	vault, err := r.Vault("user")
+	require.NoError(t, err)
+	assert.NotContains(t, string(vault), "PRIVATE KEY")
+}
+
+// sealedVault - хранилище ключа private, зашифрованное паролем password, как его отдает сервер.
+func sealedVault(t *testing.T, private *rsa.PrivateKey, login, password string) []byte {
+	r := withLegacyKey(t, newTestRSA(t), private)
+	require.NoError(t, r.Unlock(login, password))
+	content, err := r.Vault(login)
+	require.NoError(t, err)
+	return content
+}
+
+func TestRSA_ImportVault(t *testing.T) {
+	private, other := testKeys(t)
+	remote := sealedVault(t, private, "user", "pass")
+
+	tests := []struct {
+		name     string
+		local    []byte
+		password string
+		err      error
+		key      *rsa.PrivateKey
+		old      bool
+	}{
+		{name: "new device", password: "pass", key: private},
+		{name: "new device, wrong password", password: "wrong", err: ErrWrongPassword},
+		{name: "same key", local: sealedVault(t, private, "user", "previous"), password: "pass", key: private},
+		{name: "same key, wrong password", local: sealedVault(t, private, "user", "previous"), password: "previous", err: ErrWrongPassword},
+		{name: "key rotated on another device", local: sealedVault(t, other, "user", "pass"), password: "pass", key: private, old: true},
+		{name: "key mismatch", local: sealedVault(t, other, "user", "pass"), password: "wrong", err: ErrKeyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRSA(t)
+			if tt.local != nil {
+				require.NoError(t, os.WriteFile(r.vaultPath("user"), tt.local, 0600))
+			}
+			err := r.ImportVault("user", tt.password, remote)
+			saved, readErr := os.ReadFile(r.vaultPath("user"))
+			require.NoError(t, readErr)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, r.Private)
+				//хранилище на устройстве не меняется, а без него сохраняется хранилище с сервера
+				if tt.local != nil {
+					assert.Equal(t, tt.local, saved)
+				} else {
+					assert.Equal(t, remote, saved)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.key.Equal(r.Private))
+			assert.Equal(t, remote, saved)
+			old, _ := filepath.Glob(r.vaultPath("user") + ".*.old")
+			if tt.old {
+				assert.Len(t, old, 1)
+			} else {
+				assert.Empty(t, old)
+			}
+		})
+	}
+
+	assert.Error(t, newTestRSA(t).ImportVault("user", "pass", []byte("not a vault")))
+}
+
+func TestRSA_ImportVault_DropsPendingRotation(t *testing.T) {
+	private, _ := testKeys(t)
+	r := newTestRSA(t)
+	//смена ключа прервалась после того, как сервер принял новый ключ
+	remote := sealedVault(t, private, "user", "pass")
+	require.NoError(t, os.WriteFile(r.pendingPath("user"), remote, 0600))
+
+	require.NoError(t, r.ImportVault("user", "pass", remote))
+	assert.False(t, r.RotationPending("user"))
+	assert.True(t, private.Equal(r.Private))
+}
@@ -0,0 +1,116 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль меняет мастер-пароль и удаляет аккаунт.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// ErrVaultNotUploaded - мастер-пароль сменен, но хранилище, перешифрованное новым паролем, не отправлено на сервер.
+// Оно отправится при следующем входе с этого устройства, до тех пор новые устройства его не откроют.
+var ErrVaultNotUploaded = errors.New("password is changed, but the vault is not uploaded yet")
+
+// Попытки отправки хранилища после смены пароля.
+const (
+	uploadAttempts = 3
+	uploadRetry    = time.Second
+)
+
+// ChangePassword - смена мастер-пароля. На остальных устройствах потребуется войти заново. Хранилище
+// перешифровывается новым паролем до смены пароля на сервере, а если сервер пароль не сменил, - снова прежним.
+func (m *Manager) ChangePassword(password, newPassword string) error {
+	uByte, err := json.Marshal(model.ChangePassword{
+		Password:    crypto.AuthKey(m.login, password),
+		NewPassword: crypto.AuthKey(m.login, newPassword),
+	})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/account/password", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err = m.crypto.SetPassword(m.login, newPassword); err != nil {
+		return err
+	}
+	if err = m.account(req); err != nil {
+		if resealErr := m.crypto.SetPassword(m.login, password); resealErr != nil {
+			m.logger.LogErr(resealErr, "failed to reseal vault with the current password")
+		}
+		return err
+	}
+	m.session = nil
+	m.startSession(newPassword)
+	//копия на сервере заменяется, иначе новое устройство не откроет хранилище новым паролем
+	for attempt := 1; ; attempt++ {
+		if err = m.uploadKey(); err == nil {
+			return nil
+		}
+		if attempt == uploadAttempts {
+			m.logger.LogErr(err, "failed to upload vault")
+			return fmt.Errorf("%w: %v", ErrVaultNotUploaded, err)
+		}
+		time.Sleep(uploadRetry)
+	}
+}
+
+// DeleteAccount - удаление аккаунта вместе со всеми данными на сервере.
+func (m *Manager) DeleteAccount(password string) error {
+	uByte, err := json.Marshal(model.User{AuthKey: crypto.AuthKey(m.login, password)})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, m.url+m.config.Addr+"/api/account", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err = m.account(req); err != nil {
+		return err
+	}
+	m.jwt, m.refreshToken = "", ""
+	m.dropSession()
+	m.dropCache()
+	m.crypto.Lock()
+	return nil
+}
+
+// account - отправка запроса изменения аккаунта и разбор ответа.
+func (m *Manager) account(req *http.Request) error {
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		fmt.Printf("password is empty")
+		return fmt.Errorf("password is empty")
+	case http.StatusForbidden:
+		fmt.Printf("wrong password")
+		return fmt.Errorf("wrong password")
+	case http.StatusTooManyRequests:
+		return tooManyRequests(resp)
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
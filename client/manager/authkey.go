@@ -0,0 +1,46 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль помнит аккаунты, которые уже входят по ключу аутентификации. Мастер-пароль отправляется серверу
+// только один раз, при переходе аккаунта старых версий на ключ, и только после подтверждения пользователем.
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrLegacyLogin - сервер просит мастер-пароль, чтобы перевести аккаунт старых версий на ключ аутентификации.
+// Пароль отправляется только после подтверждения пользователем (см. AuthLegacy).
+var ErrLegacyLogin = errors.New("server asks for the master password to upgrade an old account")
+
+// ErrDowngrade - сервер просит мастер-пароль аккаунта, который уже входит по ключу аутентификации.
+// Настоящий сервер так не делает, пароль не отправляется.
+var ErrDowngrade = errors.New("server asks for the master password of an account that already uses an auth key")
+
+// authKeyPath - путь к отметке, что аккаунт login на текущем сервере входит по ключу аутентификации.
+// Отметка общая для всех профилей, имя файла не раскрывает логин.
+func (m *Manager) authKeyPath(login string) string {
+	sum := sha256.Sum256([]byte(m.config.Addr + "\x00" + login))
+	return filepath.Join(m.config.ConfigDir, "authkey-"+hex.EncodeToString(sum[:8]))
+}
+
+// usesAuthKey - аккаунт login уже входил по ключу аутентификации с этого устройства.
+func (m *Manager) usesAuthKey(login string) bool {
+	_, err := os.Stat(m.authKeyPath(login))
+	return err == nil
+}
+
+// markAuthKey - отметка, что аккаунт login входит по ключу аутентификации. Ошибка записи не мешает входу,
+// тогда при следующей просьбе пароля пользователь снова подтвердит отправку.
+func (m *Manager) markAuthKey(login string) {
+	file := m.authKeyPath(login)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		m.logger.LogErr(err, "failed to create config folder")
+		return
+	}
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		m.logger.LogErr(err, "failed to save auth key mark")
+	}
+}
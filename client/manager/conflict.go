@@ -0,0 +1,164 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль хранит конфликты: изменения записей, которые за это время изменили или удалили на другом устройстве.
+// Сервер такие изменения не применяет, пользователь выбирает, чья версия останется.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// Conflict - конфликт для показа пользователю: обе версии записи расшифрованы.
+type Conflict struct {
+	Kind   string `json:"kind"`
+	UID    int    `json:"uid"`
+	Op     string `json:"op"`
+	Mine   string `json:"mine"`
+	Theirs string `json:"theirs"`
+}
+
+// addConflict - сохранение конфликта. Для записи хранится один конфликт с последним изменением этого устройства,
+// иначе каждое изменение записи из очереди пришлось бы разбирать отдельно.
+func (m *Manager) addConflict(op pendingOp, current json.RawMessage) {
+	c := m.loadCache()
+	conflict := pendingConflict{pendingOp: op, Current: current}
+	uid := itemUID(op)
+	for i := range c.Conflicts {
+		if c.Conflicts[i].Kind == op.Kind && bytes.Equal(itemUID(c.Conflicts[i].pendingOp), uid) {
+			c.Conflicts[i] = conflict
+			return
+		}
+	}
+	c.Conflicts = append(c.Conflicts, conflict)
+}
+
+// dropConflicts - удаление конфликтов записи, которой больше нет на сервере.
+func (m *Manager) dropConflicts(op pendingOp) {
+	c := m.loadCache()
+	uid := itemUID(op)
+	kept := c.Conflicts[:0]
+	for _, conflict := range c.Conflicts {
+		if conflict.Kind != op.Kind || !bytes.Equal(itemUID(conflict.pendingOp), uid) {
+			kept = append(kept, conflict)
+		}
+	}
+	c.Conflicts = kept
+}
+
+// itemUID - идентификатор записи изменения в JSON.
+func itemUID(op pendingOp) json.RawMessage {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(op.Item, &item); err != nil {
+		return nil
+	}
+	return item[uidField(op.Kind)]
+}
+
+// Conflicts - конфликты, которые ждут выбора версии. Без открытого хранилища записи не расшифровать,
+// поэтому список пустой.
+func (m *Manager) Conflicts() []Conflict {
+	if m.login == "" || m.jwt == "" {
+		return nil
+	}
+	var result []Conflict
+	for _, c := range m.loadCache().Conflicts {
+		conflict := Conflict{Kind: c.Kind, Op: c.Op, Mine: "deleted"}
+		if c.Op != opDelete {
+			_, conflict.Mine = m.describe(c.Kind, c.Item)
+		}
+		conflict.UID, conflict.Theirs = m.describe(c.Kind, c.Current)
+		result = append(result, conflict)
+	}
+	return result
+}
+
+// ResolveConflict - выбор версии записи для конфликта с номером i из Conflicts. Если keepMine, изменение этого
+// устройства отправляется поверх версии сервера, иначе остается версия сервера, которая уже в локальной копии.
+func (m *Manager) ResolveConflict(i int, keepMine bool) error {
+	c := m.loadCache()
+	if i < 0 || i >= len(c.Conflicts) {
+		return fmt.Errorf("no conflict %d", i)
+	}
+	conflict := c.Conflicts[i]
+	c.Conflicts = append(c.Conflicts[:i:i], c.Conflicts[i+1:]...)
+	m.saveCache()
+	if !keepMine {
+		return nil
+	}
+	var item, current map[string]json.RawMessage
+	if err := json.Unmarshal(conflict.Item, &item); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(conflict.Current, &current); err != nil {
+		return err
+	}
+	item["version"] = current["version"]
+	err := m.send(conflict.Op, conflict.Kind, item)
+	//при новом конфликте он уже сохранен вместо прежнего, а удаленную запись сохранять уже нечем
+	if err != nil && !errors.Is(err, ErrConflict) && !errors.Is(err, ErrNotFound) {
+		c = m.loadCache()
+		c.Conflicts = append(c.Conflicts, conflict)
+		m.saveCache()
+	}
+	return err
+}
+
+// undecrypted - описание записи, которая не расшифровалась, вместо ее содержимого.
+func undecrypted(err error) string {
+	return fmt.Sprintf("cannot be decrypted: %v", err)
+}
+
+// describe - идентификатор и расшифрованное содержимое зашифрованной записи вида kind.
+func (m *Manager) describe(kind string, raw json.RawMessage) (int, string) {
+	switch kind {
+	case KindCards:
+		var d model.CryptoCard
+		if json.Unmarshal(raw, &d) != nil {
+			return 0, ""
+		}
+		if err := m.crypto.DecryptedCard(&d); err != nil {
+			return d.UID, undecrypted(err)
+		}
+		return d.UID, fmt.Sprintf("Number: %s Name: %s CVC: %s%s", d.Number, d.Name, d.CVC, describeMeta(d.ItemMeta))
+	case KindPasswords:
+		var d model.CryptoPassword
+		if json.Unmarshal(raw, &d) != nil {
+			return 0, ""
+		}
+		if err := m.crypto.DecryptedPassword(&d); err != nil {
+			return d.UID, undecrypted(err)
+		}
+		return d.UID, fmt.Sprintf("Login: %s Password: %s%s", d.Login, d.Pass, describeMeta(d.ItemMeta))
+	case KindTexts:
+		var d model.CryptoTextData
+		if json.Unmarshal(raw, &d) != nil {
+			return 0, ""
+		}
+		if err := m.crypto.DecryptedTextData(&d); err != nil {
+			return d.UID, undecrypted(err)
+		}
+		return d.UID, fmt.Sprintf("Text: %s%s", d.Text, describeMeta(d.ItemMeta))
+	case KindBinaries:
+		var d model.CryptoBinaryData
+		if json.Unmarshal(raw, &d) != nil {
+			return 0, ""
+		}
+		if err := m.crypto.DecryptedBinaryData(&d); err != nil {
+			return d.UID, undecrypted(err)
+		}
+		return d.UID, fmt.Sprintf("Binary: %s%s", d.Data, describeMeta(d.ItemMeta))
+	default:
+		var d model.Item
+		if json.Unmarshal(raw, &d) != nil {
+			return 0, ""
+		}
+		if err := m.crypto.DecryptedItem(&d); err != nil {
+			return d.UID, undecrypted(err)
+		}
+		return d.UID, fmt.Sprintf("Data: %s%s", d.Payload, describeMeta(d.ItemMeta))
+	}
+}
@@ -0,0 +1,171 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль получает прежние версии записей, восстанавливает запись из истории и меняет глубину истории.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// Revision - прежняя версия записи для показа пользователю, расшифрованная.
+type Revision struct {
+	Version   int64     `json:"version"`
+	ChangedAt time.Time `json:"changed_at"`
+	Content   string    `json:"content"`
+}
+
+// errPendingChanges - восстановление по версии из локальной копии, пока в очереди есть изменения, почти наверняка
+// закончилось бы конфликтом.
+var errPendingChanges = errors.New("changes are waiting to be sent to the server, try again when they are sent")
+
+// ErrVersionNotFound - запись есть, но такой версии в ее истории нет.
+var ErrVersionNotFound = errors.New("version not found in item history")
+
+// historyPath - путь API истории записи uid вида kind.
+func historyPath(kind string, uid int) string {
+	return kindPath(kind) + "/" + strconv.Itoa(uid) + "/"
+}
+
+// History - прежние версии записи uid вида kind, новые первыми. История хранится только на сервере.
+func (m *Manager) History(kind string, uid int) ([]Revision, error) {
+	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+historyPath(kind, uid)+"history", nil)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return nil, errUnauthorized
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return nil, fmt.Errorf("server error")
+	default:
+		return nil, fmt.Errorf("server error: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to read body")
+		return nil, err
+	}
+	var entries []model.HistoryEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		m.logger.LogErr(err, "Failed to unmarshal body")
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(entries))
+	for _, e := range entries {
+		_, content := m.describe(kind, e.Item)
+		revisions = append(revisions, Revision{Version: e.Version, ChangedAt: e.ChangedAt, Content: content})
+	}
+	return revisions, nil
+}
+
+// Restore - восстановление записи uid вида kind из прежней версии from. Сервер сверяет версию записи из локальной
+// копии со своей: если запись изменили на другом устройстве, возвращается ErrConflict, а в копию попадает запись
+// сервера, чтобы пользователь мог посмотреть ее и повторить восстановление.
+func (m *Manager) Restore(kind string, uid int, from int64) error {
+	m.flush()
+	if m.Pending() > 0 {
+		return errPendingChanges
+	}
+	ref, err := json.Marshal(map[string]int{uidField(kind): uid})
+	if err != nil {
+		return err
+	}
+	withVersion, err := m.withVersion(kind, ref)
+	if err != nil {
+		return err
+	}
+	var current struct {
+		Version int64 `json:"version"`
+	}
+	if err = json.Unmarshal(withVersion, &current); err != nil {
+		return err
+	}
+	body, err := json.Marshal(model.RestoreRequest{From: from, Version: current.Version})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	resp, err := m.post(http.MethodPost, historyPath(kind, uid)+"restore", body)
+	switch {
+	case err == nil, errors.Is(err, ErrConflict):
+		m.settle(pendingOp{Op: opUpdate, Kind: kind, Item: resp}, resp, nil)
+	case errors.Is(err, ErrNotFound):
+		//сервер не различает удаленную запись и версию, которой нет в истории, записи проверяются заново
+		var raw json.RawMessage
+		if _, loadErr := m.load(kind, &raw); loadErr != nil {
+			return err
+		}
+		if _, loadErr := m.loadCache().version(kind, json.RawMessage(strconv.Itoa(uid))); loadErr == nil {
+			return ErrVersionNotFound
+		}
+	}
+	return err
+}
+
+// HistoryDepth - сколько прежних версий каждой записи хранит сервер.
+func (m *Manager) HistoryDepth() (int, error) {
+	var settings model.HistorySettings
+	if err := m.fetch("/api/account/history", &settings); err != nil {
+		return 0, err
+	}
+	return settings.Depth, nil
+}
+
+// SetHistoryDepth - изменение глубины истории записей. Версии сверх новой глубины сервер удаляет сразу.
+func (m *Manager) SetHistoryDepth(depth int) error {
+	uByte, err := json.Marshal(model.HistorySettings{Depth: depth})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, m.url+m.config.Addr+"/api/account/history", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest:
+		message, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", message)
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return errUnauthorized
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	default:
+		return fmt.Errorf("server error: %s", resp.Status)
+	}
+}
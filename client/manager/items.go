@@ -0,0 +1,102 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль работает с записями видов, добавленных на сервере: новый вид секретов не требует
+// своих структур и методов, записи любого такого вида шифруются и хранятся одинаково.
+package manager
+
+import (
+	"fmt"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// ItemKinds - виды записей, которые хранит сервер, вместе со встроенными.
+func (m *Manager) ItemKinds() ([]model.ItemKind, error) {
+	if err := m.authorized(); err != nil {
+		return nil, err
+	}
+	var kinds []model.ItemKind
+	if err := m.fetch("/api/items", &kinds); err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+// ListItems - все записи вида kind, расшифрованные. Записи встроенных видов получаются методами вида
+// (ListCards и другие).
+func (m *Manager) ListItems(kind string) ([]model.Item, error) {
+	if err := checkItemKind(kind); err != nil {
+		return nil, err
+	}
+	var d []model.Item
+	offline, err := m.load(kind, &d)
+	if err != nil {
+		return nil, err
+	}
+	var migrate []model.Item
+	opened := d[:0]
+	for i := range d {
+		legacy := m.crypto.IsLegacy(d[i].Payload)
+		if err = m.crypto.DecryptedItem(&d[i]); err != nil {
+			if err = m.skipDamaged(kind, d[i].UID, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		opened = append(opened, d[i])
+		if legacy {
+			migrate = append(migrate, d[i])
+		}
+	}
+	d = opened
+	//без связи перешифрованные записи только копились бы в очереди
+	if !offline {
+		m.migrateItems(migrate)
+	}
+	return d, nil
+}
+
+// AddItem - добавление записи вида data.Type на сервер.
+func (m *Manager) AddItem(data *model.Item) error {
+	if err := checkItemKind(data.Type); err != nil {
+		return err
+	}
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
+		return err
+	}
+	if err := m.crypto.EncryptedItem(data); err != nil {
+		return err
+	}
+	return m.send(opAdd, data.Type, data)
+}
+
+// UpdateItem - изменение выбранной записи вида data.Type на сервере.
+func (m *Manager) UpdateItem(data *model.Item) error {
+	if err := checkItemKind(data.Type); err != nil {
+		return err
+	}
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
+		return err
+	}
+	if err := m.crypto.EncryptedItem(data); err != nil {
+		return err
+	}
+	return m.send(opUpdate, data.Type, data)
+}
+
+// DeleteItem - удаление выбранной записи вида kind с сервера.
+func (m *Manager) DeleteItem(kind string, id int) error {
+	if err := checkItemKind(kind); err != nil {
+		return err
+	}
+	return m.send(opDelete, kind, model.Item{Type: kind, UID: id})
+}
+
+// checkItemKind - проверка, что записи вида kind хранятся в Item, а не в структурах встроенного вида.
+func checkItemKind(kind string) error {
+	if kind == "" || isBuiltin(kind) {
+		return fmt.Errorf("%q is not an item kind added on the server", kind)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль получает расшифрованные записи списком, для вывода в командах и скриптах.
+// Без связи с сервером записи берутся из локальной копии (см. offline.go). Запись, которая не расшифровалась,
+// пропускается, остальные записи доступны.
+package manager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// ListCards - все карты пользователя, расшифрованные. Если карт нет, возвращает пустой список.
+func (m *Manager) ListCards() ([]model.CryptoCard, error) {
+	var d []model.CryptoCard
+	offline, err := m.load(KindCards, &d)
+	if err != nil {
+		return nil, err
+	}
+	var migrate []model.CryptoCard
+	opened := d[:0]
+	for i := range d {
+		legacy := m.crypto.IsLegacy(d[i].Number)
+		if err = m.crypto.DecryptedCard(&d[i]); err != nil {
+			if err = m.skipDamaged(KindCards, d[i].UID, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		opened = append(opened, d[i])
+		if legacy {
+			migrate = append(migrate, d[i])
+		}
+	}
+	d = opened
+	//без связи перешифрованные записи только копились бы в очереди
+	if !offline {
+		m.migrateCards(migrate)
+	}
+	return d, nil
+}
+
+// ListPasswords - все пары логин/пароль пользователя, расшифрованные.
+func (m *Manager) ListPasswords() ([]model.CryptoPassword, error) {
+	var d []model.CryptoPassword
+	offline, err := m.load(KindPasswords, &d)
+	if err != nil {
+		return nil, err
+	}
+	var migrate []model.CryptoPassword
+	opened := d[:0]
+	for i := range d {
+		legacy := m.crypto.IsLegacy(d[i].Login)
+		if err = m.crypto.DecryptedPassword(&d[i]); err != nil {
+			if err = m.skipDamaged(KindPasswords, d[i].UID, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		opened = append(opened, d[i])
+		if legacy {
+			migrate = append(migrate, d[i])
+		}
+	}
+	d = opened
+	if !offline {
+		m.migratePasswords(migrate)
+	}
+	return d, nil
+}
+
+// ListTexts - все текстовые данные пользователя, расшифрованные.
+func (m *Manager) ListTexts() ([]model.CryptoTextData, error) {
+	var d []model.CryptoTextData
+	offline, err := m.load(KindTexts, &d)
+	if err != nil {
+		return nil, err
+	}
+	var migrate []model.CryptoTextData
+	opened := d[:0]
+	for i := range d {
+		legacy := m.crypto.IsLegacy(d[i].Text)
+		if err = m.crypto.DecryptedTextData(&d[i]); err != nil {
+			if err = m.skipDamaged(KindTexts, d[i].UID, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		opened = append(opened, d[i])
+		if legacy {
+			migrate = append(migrate, d[i])
+		}
+	}
+	d = opened
+	if !offline {
+		m.migrateText(migrate)
+	}
+	return d, nil
+}
+
+// ListBinaries - все бинарные данные пользователя, расшифрованные.
+func (m *Manager) ListBinaries() ([]model.CryptoBinaryData, error) {
+	var d []model.CryptoBinaryData
+	offline, err := m.load(KindBinaries, &d)
+	if err != nil {
+		return nil, err
+	}
+	var migrate []model.CryptoBinaryData
+	opened := d[:0]
+	for i := range d {
+		legacy := m.crypto.IsLegacy(d[i].Data)
+		if err = m.crypto.DecryptedBinaryData(&d[i]); err != nil {
+			if err = m.skipDamaged(KindBinaries, d[i].UID, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		opened = append(opened, d[i])
+		if legacy {
+			migrate = append(migrate, d[i])
+		}
+	}
+	d = opened
+	if !offline {
+		m.migrateBinary(migrate)
+	}
+	return d, nil
+}
+
+// skipDamaged - учет записи uid вида kind, которая не расшифровалась: ее подменили на сервере, стерли часть полей
+// или зашифровали чужим ключом. Запись пропускается, чтобы одна испорченная запись не закрывала доступ к остальным.
+// Если хранилище заблокировано, не откроется ни одна запись, тогда возвращается ошибка.
+func (m *Manager) skipDamaged(kind string, uid int, err error) error {
+	if errors.Is(err, crypto.ErrLocked) {
+		return err
+	}
+	m.logger.LogErr(err, fmt.Sprintf("%s item %d cannot be decrypted, it is skipped", kind, uid))
+	return nil
+}
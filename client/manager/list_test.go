@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// newUnlockedManager - менеджер вошедшего пользователя с открытым хранилищем. Ключ переносится в хранилище
+// из незашифрованного файла: это быстрее создания нового ключа.
+func newUnlockedManager(t *testing.T, addr string) *Manager {
+	m := newTestManager(t, addr)
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m.config.CryptoPROKey = "private.pem"
+	content := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	require.NoError(t, os.WriteFile(m.config.CryptoPROKeyPath+m.config.CryptoPROKey, content, 0600))
+	m.crypto = crypto.NewRSA(*m.config, m.logger)
+	require.NoError(t, m.crypto.Unlock("user", "pass"))
+	m.login = "user"
+	m.jwt = "token"
+	return m
+}
+
+func TestManager_ListCards_Damaged(t *testing.T) {
+	var cards []model.CryptoCard
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(cards)
+	}))
+	defer srv.Close()
+	m := newUnlockedManager(t, strings.TrimPrefix(srv.URL, "http://"))
+
+	for uid := 1; uid <= 3; uid++ {
+		card := model.CryptoCard{UID: uid, Number: []byte("4111"), Name: []byte("name"), CVC: []byte("123"),
+			ItemMeta: model.ItemMeta{Title: []byte("title")}}
+		require.NoError(t, m.crypto.EncryptedCard(&card))
+		cards = append(cards, card)
+	}
+	//запись подменили на сервере, у другой стерли название
+	cards[1].Number[len(cards[1].Number)-1] ^= 1
+	cards[2].Title = nil
+
+	//испорченные записи пропускаются, остальные показываются
+	list, err := m.ListCards()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 1, list[0].UID)
+	assert.Equal(t, []byte("4111"), list[0].Number)
+
+	//заблокированное хранилище не открывает ни одной записи
+	m.crypto.Lock()
+	_, err = m.ListCards()
+	assert.ErrorIs(t, err, crypto.ErrLocked)
+}
@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
@@ -21,17 +24,26 @@ type Manager struct {
 	config              *config.Config
 	crypto              crypto.Crypto
 	logger              *loggers.Logger
-	privateKey          *rsa.PrivateKey
-	publicKey           *rsa.PublicKey
 	publicKeyFromServer *rsa.PublicKey
 	url                 string
 	jwt                 string
+	refreshToken        string
+	login               string
+	device              string
+	challenge           string
+	//ключ на сервере другой и не открылся паролем, ключ устройства не отправляется на сервер
+	keyMismatch bool
+	//шифрование файла сессии, nil пока хранилище не открыто (см. session.go)
+	session *crypto.SessionSealer
+	//локальная копия записей и очередь изменений без связи (см. offline.go)
+	cache *offlineCache
 }
 
 // Managers - интерфейс обработчика.
 type Managers interface {
 	Register(login, password string) error
 	Auth(login, password string) error
+	AuthLegacy(login, password string) error
 	AddCard(d *model.CryptoCard) error
 	AddPassword(d *model.CryptoPassword) error
 	AddText(d *model.CryptoTextData) error
@@ -48,21 +60,79 @@ type Managers interface {
 	UpdatePassword(d *model.CryptoPassword) error
 	UpdateText(d *model.CryptoTextData) error
 	UpdateBinary(d *model.CryptoBinaryData) error
+	Logout() error
+	GetSessions() ([]model.Session, error)
+	RevokeSession(id string) error
+	AuthCode(code string) error
+	EnrollTwoFactor() (*model.TwoFactorSetup, error)
+	ConfirmTwoFactor(code string) error
+	DisableTwoFactor(code string) error
+	ChangePassword(password, newPassword string) error
+	DeleteAccount(password string) error
+	Unlock(password string) error
+	ReencryptVault(oldPassword, password string) error
+	Lock()
+	LockKey()
+	RotateKey(password string) error
+	RotationLoss() (trash int, depth int, err error)
+	RotationPending() bool
+	ListCards() ([]model.CryptoCard, error)
+	ListPasswords() ([]model.CryptoPassword, error)
+	ListTexts() ([]model.CryptoTextData, error)
+	ListBinaries() ([]model.CryptoBinaryData, error)
+	ItemKinds() ([]model.ItemKind, error)
+	ListItems(kind string) ([]model.Item, error)
+	AddItem(d *model.Item) error
+	UpdateItem(d *model.Item) error
+	DeleteItem(kind string, id int) error
+	SessionLogin() string
+	Resume(login, password string) error
+	Pending() int
+	Conflicts() []Conflict
+	ResolveConflict(i int, keepMine bool) error
+	History(kind string, uid int) ([]Revision, error)
+	Restore(kind string, uid int, from int64) error
+	HistoryDepth() (int, error)
+	SetHistoryDepth(depth int) error
+}
+
+// TooManyRequestsError - сервер ограничил попытки входа, повторить можно через Wait.
+type TooManyRequestsError struct {
+	Wait time.Duration
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return fmt.Sprintf("too many attempts, try again in %s", e.Wait)
+}
+
+// tooManyRequests - ошибка по ответу http.StatusTooManyRequests со временем ожидания из заголовка Retry-After.
+func tooManyRequests(resp *http.Response) error {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 1 {
+		seconds = 1
+	}
+	return &TooManyRequestsError{Wait: time.Duration(seconds) * time.Second}
 }
 
 // NewManager - функция создания нового обработчика.
 func NewManager(logger *loggers.Logger, cfg *config.Config, client http.Client) *Manager {
 	c := crypto.NewRSA(*cfg, logger)
+	//имя устройства видно пользователю в списке сессий
+	device, err := os.Hostname()
+	if err != nil {
+		device = "unknown"
+	}
+	//все ответы сервера проверяются по ключу, запомненному при первом подключении
+	client.Transport = newSignedTransport(client.Transport, cfg.CryptoPROKeyPath, cfg.Addr, logger)
 	return &Manager{
 		client:              client,
 		config:              cfg,
 		logger:              logger,
-		privateKey:          c.Private,
-		publicKey:           c.Public,
 		publicKeyFromServer: nil,
 		url:                 "http://",
 		jwt:                 "",
 		crypto:              c,
+		device:              device,
 	}
 }
 
@@ -70,24 +140,11 @@ func NewManager(logger *loggers.Logger, cfg *config.Config, client http.Client)
 func (m *Manager) Register(login, password string) error {
 	var u model.User
 	u.Login = login
-	u.Password = password
-	uByte, err := json.Marshal(u)
-	if err != nil {
-		m.logger.LogErr(err, "failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/register", bytes.NewBuffer(uByte))
-	if err != nil {
-		m.logger.LogErr(err, "failed to request")
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
+	//сервер получает только ключ аутентификации, мастер-пароль не покидает клиент
+	u.AuthKey = crypto.AuthKey(login, password)
+	u.Device = m.device
+	resp, err := m.postUser("/api/register", &u)
 	if err != nil {
-		m.logger.LogErr(err, "failed to do request")
 		return err
 	}
 
@@ -101,6 +158,8 @@ func (m *Manager) Register(login, password string) error {
 	case http.StatusUnauthorized:
 		fmt.Printf("Unauthorized")
 		return fmt.Errorf("unauthorized")
+	case http.StatusTooManyRequests:
+		return tooManyRequests(resp)
 	case http.StatusInternalServerError:
 		fmt.Printf("server error")
 		return fmt.Errorf("server error")
@@ -119,42 +178,75 @@ func (m *Manager) Register(login, password string) error {
 
 	m.publicKeyFromServer = accept.Key
 	m.jwt = accept.Token
+	m.refreshToken = accept.RefreshToken
+	m.login = login
+	m.markAuthKey(login)
+	//новый вход сохраняется в новый файл сессии при открытии хранилища
+	m.session = nil
 
 	resp.Body.Close()
 
 	return nil
 }
 
-// Auth - Аутентификация пользователя.
+// Auth - Аутентификация пользователя. Серверу отправляется только ключ аутентификации. Если сервер просит
+// мастер-пароль, возвращается ErrLegacyLogin, а для аккаунта, который уже входил по ключу, - ErrDowngrade.
 func (m *Manager) Auth(login, password string) error {
+	return m.auth(login, password, false)
+}
+
+// AuthLegacy - вход аккаунта, созданного до ключей аутентификации: мастер-пароль отправляется последний раз,
+// чтобы сервер перешел на ключ. Вызывается только после подтверждения пользователем на ErrLegacyLogin.
+func (m *Manager) AuthLegacy(login, password string) error {
+	return m.auth(login, password, true)
+}
+
+// auth - вход с ключом аутентификации, а если sendPassword - вместе с мастер-паролем.
+func (m *Manager) auth(login, password string, sendPassword bool) error {
 	var u model.User
 	u.Login = login
-	u.Password = password
-	uByte, err := json.Marshal(u)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
+	u.AuthKey = crypto.AuthKey(login, password)
+	u.Device = m.device
+	if sendPassword {
+		if m.usesAuthKey(login) {
+			m.logger.LogErr(ErrDowngrade, "master password is not sent")
+			return ErrDowngrade
+		}
+		m.logger.LogInfo("login", login, "master password is sent to upgrade the account to an auth key")
+		u.Password = password
 	}
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/login", bytes.NewBuffer(uByte))
+	resp, err := m.postUser("/api/login", &u)
 	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
+	if resp.StatusCode == http.StatusUpgradeRequired {
+		resp.Body.Close()
+		if m.usesAuthKey(login) {
+			m.logger.LogErr(ErrDowngrade, "master password is not sent")
+			return ErrDowngrade
+		}
+		m.logger.LogInfo("login", login, "server asks for the master password to upgrade the account")
+		return ErrLegacyLogin
 	}
 	switch resp.StatusCode {
 	case http.StatusBadRequest:
 		fmt.Printf("login or password is empty")
 		return fmt.Errorf("login or password is empty")
 	case http.StatusUnauthorized:
+		//пароль верный, но сервер ждет код второго фактора
+		var challenge model.Challenge
+		if resp.Header.Get("Content-Type") == "application/json" &&
+			json.NewDecoder(resp.Body).Decode(&challenge) == nil && challenge.Challenge != "" {
+			m.challenge = challenge.Challenge
+			m.login = login
+			//сервер проверил пароль или ключ и перевел аккаунт на ключ до второго фактора
+			m.markAuthKey(login)
+			return ErrSecondFactor
+		}
 		fmt.Printf("wrong login or password")
 		return fmt.Errorf("wrong login or password")
+	case http.StatusTooManyRequests:
+		return tooManyRequests(resp)
 	case http.StatusInternalServerError:
 		fmt.Printf("server error")
 		return fmt.Errorf("server error")
@@ -174,768 +266,221 @@ func (m *Manager) Auth(login, password string) error {
 
 	m.publicKeyFromServer = accept.Key
 	m.jwt = accept.Token
+	m.refreshToken = accept.RefreshToken
+	m.login = login
+	m.markAuthKey(login)
+	//новый вход сохраняется в новый файл сессии при открытии хранилища
+	m.session = nil
 
 	resp.Body.Close()
 
 	return nil
 }
 
-// AddCard - добавление новых карт на сервер.
-func (m *Manager) AddCard(data *model.CryptoCard) error {
-	m.crypto.EncryptedCard(data)
-	uByte, err := json.Marshal(data)
+// postUser - отправка данных пользователя на эндпоинт входа или регистрации.
+func (m *Manager) postUser(path string, u *model.User) (*http.Response, error) {
+	uByte, err := json.Marshal(u)
 	if err != nil {
 		m.logger.LogErr(err, "Failed to marshal")
-		return err
+		return nil, err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/cards", bytes.NewBuffer(uByte))
-
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+path, bytes.NewBuffer(uByte))
 	if err != nil {
 		m.logger.LogErr(err, "Failed to request")
-		return err
+		return nil, err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 
 	resp, err := m.client.Do(req)
 	if err != nil {
 		m.logger.LogErr(err, "Failed to do request")
-		return err
+		return nil, err
 	}
+	return resp, nil
+}
 
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
+// AddCard - добавление новых карт на сервер.
+func (m *Manager) AddCard(data *model.CryptoCard) error {
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
+		return err
 	}
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
+	if err := m.crypto.EncryptedCard(data); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opAdd, KindCards, data)
 }
 
 // AddPassword - добавление новых пар логин/пароль на сервер.
 func (m *Manager) AddPassword(data *model.CryptoPassword) error {
-	m.crypto.EncryptedPassword(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/password", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
+	if err := m.crypto.EncryptedPassword(data); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opAdd, KindPasswords, data)
 }
 
 // AddText - добавление новых текстовых данных на сервер.
 func (m *Manager) AddText(data *model.CryptoTextData) error {
-	m.crypto.EncryptedTextData(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/text", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
+	if err := m.crypto.EncryptedTextData(data); err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opAdd, KindTexts, data)
 }
 
 // AddBinary - добавление новых бинарных данных на сервер.
 func (m *Manager) AddBinary(data *model.CryptoBinaryData) error {
-	m.crypto.EncryptedBinaryData(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/binary", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
+	if err := m.crypto.EncryptedBinaryData(data); err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opAdd, KindBinaries, data)
 }
 
 // GetCards - получение всех карт с сервера, что загрузил пользователь.
 func (m *Manager) GetCards() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/data/cards", nil)
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return "", err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
+	cards, err := m.ListCards()
 	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
 		return "", err
 	}
-	switch resp.StatusCode {
-	case http.StatusNoContent:
+	if len(cards) == 0 {
 		fmt.Printf("No cards")
 		return "", fmt.Errorf("no cards")
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return "", fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return "", fmt.Errorf("unauthorized")
-	}
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return "", err
-	}
-	defer resp.Body.Close()
-	var d []model.CryptoCard
-	var cards []model.CryptoCard
-	if err = json.Unmarshal(data, &d); err != nil {
-		m.logger.LogErr(err, "Failed to unmarshal body")
-		return "", err
-	}
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to decrypted data")
-		return "", err
-	}
-	for i := 0; i < len(d); i++ {
-		var card model.CryptoCard
-		m.crypto.DecryptedCard(&d[i])
-		card = d[i]
-		cards = append(cards, card)
 	}
 	result := "\nyou have these cards:\n"
 	for _, card := range cards {
-		result += fmt.Sprintf("%v. Number: %s Name: %s CVC: %s\n", card.UID, string(card.Number), string(card.Name), string(card.CVC))
+		result += fmt.Sprintf("%v. Number: %s Name: %s CVC: %s%s\n", card.UID, string(card.Number), string(card.Name), string(card.CVC),
+			describeMeta(card.ItemMeta))
 	}
 	return result, nil
 }
 
 // GetPasswords - получение всех пар логин/пароль с сервера, что загрузил пользователь.
 func (m *Manager) GetPasswords() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/data/password", nil)
-
+	passwords, err := m.ListPasswords()
 	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
 		return "", err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return "", err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusNoContent:
-		fmt.Printf("No cards")
-		return "", fmt.Errorf("no cards")
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return "", fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return "", fmt.Errorf("unauthorized")
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return "", err
-	}
-	defer resp.Body.Close()
-	var d []model.CryptoPassword
-	var passwords []model.CryptoPassword
-	if err = json.Unmarshal(data, &d); err != nil {
-		m.logger.LogErr(err, "Failed to unmarshal body")
-		return "", err
-	}
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to decrypted data")
-		return "", err
-	}
-	for i := 0; i < len(d); i++ {
-		var p model.CryptoPassword
-		m.crypto.DecryptedPassword(&d[i])
-		p = d[i]
-		passwords = append(passwords, p)
+	if len(passwords) == 0 {
+		fmt.Printf("No passwords")
+		return "", fmt.Errorf("no passwords")
 	}
 	result := "\nyou have these passwords:\n"
 	for _, pass := range passwords {
-		result += fmt.Sprintf("%v. Login: %v Password: %v \n", pass.UID, string(pass.Login), string(pass.Pass))
+		result += fmt.Sprintf("%v. Login: %v Password: %v%s \n", pass.UID, string(pass.Login), string(pass.Pass), describeMeta(pass.ItemMeta))
 	}
 	return result, nil
 }
 
 // GetText - получение всех текстовых данных с сервера, что загрузил пользователь.
 func (m *Manager) GetText() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/data/text", nil)
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return "", err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return "", err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusNoContent:
-		fmt.Printf("No cards")
-		return "", fmt.Errorf("no cards")
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return "", fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return "", fmt.Errorf("unauthorized")
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return "", err
-	}
-	defer resp.Body.Close()
-	var d []model.CryptoTextData
-	var texts []model.CryptoTextData
-	if err = json.Unmarshal(data, &d); err != nil {
-		m.logger.LogErr(err, "Failed to unmarshal body")
-		return "", err
-	}
-
+	texts, err := m.ListTexts()
 	if err != nil {
-		m.logger.LogErr(err, "Failed to decrypted data")
 		return "", err
 	}
-	for i := 0; i < len(d); i++ {
-		var t model.CryptoTextData
-		m.crypto.DecryptedTextData(&d[i])
-		t = d[i]
-		texts = append(texts, t)
+	if len(texts) == 0 {
+		fmt.Printf("No text data")
+		return "", fmt.Errorf("no text data")
 	}
-	result := "\nyou have these text information:\n"
+	result := "\nyou have these text data:\n"
 	for _, text := range texts {
-		result += fmt.Sprintf("%v. Text: %v \n", text.UID, string(text.Text))
+		result += fmt.Sprintf("%v. Text: %v%s \n", text.UID, string(text.Text), describeMeta(text.ItemMeta))
 	}
 	return result, nil
 }
 
 // GetBinary - получение всех бинарных данных с сервера, что загрузил пользователь.
 func (m *Manager) GetBinary() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/data/binary", nil)
-
+	binaries, err := m.ListBinaries()
 	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
 		return "", err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return "", err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusNoContent:
-		fmt.Printf("No cards")
-		return "", fmt.Errorf("no cards")
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return "", fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return "", fmt.Errorf("unauthorized")
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return "", err
-	}
-	defer resp.Body.Close()
-	var d []model.CryptoBinaryData
-	var binarys []model.CryptoBinaryData
-	if err = json.Unmarshal(data, &d); err != nil {
-		m.logger.LogErr(err, "Failed to unmarshal body")
-		return "", err
-	}
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to decrypted data")
-		return "", err
-	}
-	for i := 0; i < len(d); i++ {
-		var b model.CryptoBinaryData
-		m.crypto.DecryptedBinaryData(&d[i])
-		b = d[i]
-		binarys = append(binarys, b)
+	if len(binaries) == 0 {
+		fmt.Printf("No binary data")
+		return "", fmt.Errorf("no binary data")
 	}
 	result := "\nyou have these binary data:\n"
-	for _, binary := range binarys {
-		result += fmt.Sprintf("%v. Binary: %v \n", binary.UID, string(binary.Data))
+	for _, binary := range binaries {
+		result += fmt.Sprintf("%v. Binary: %v%s \n", binary.UID, string(binary.Data), describeMeta(binary.ItemMeta))
 	}
 	return result, nil
 }
 
 // DeleteCard - удаление выбранной карты с сервера.
 func (m *Manager) DeleteCard(id int) error {
-	var data model.CryptoCard
-	data.UID = id
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/delete/cards", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opDelete, KindCards, model.CryptoCard{UID: id})
 }
 
 // DeleteText - удаление выбранных текстовых данных с сервера.
 func (m *Manager) DeleteText(id int) error {
-	var data model.CryptoTextData
-	data.UID = id
-
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/delete/text", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opDelete, KindTexts, model.CryptoTextData{UID: id})
 }
 
 // DeletePassword - удаление выбранной пары логин/пароль с сервера.
 func (m *Manager) DeletePassword(id int) error {
-	var data model.CryptoPassword
-	data.UID = id
-
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/delete/password", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opDelete, KindPasswords, model.CryptoPassword{UID: id})
 }
 
 // DeleteBinary - удаление выбранных бинарных данных с сервера.
 func (m *Manager) DeleteBinary(id int) error {
-	var data model.CryptoBinaryData
-	data.UID = id
-
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/delete/binary", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opDelete, KindBinaries, model.CryptoBinaryData{UID: id})
 }
 
 // UpdateCard - изменение выбранной карты на сервере.
 func (m *Manager) UpdateCard(data *model.CryptoCard) error {
-	m.crypto.EncryptedCard(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/update/cards", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
+	if err := m.crypto.EncryptedCard(data); err != nil {
 		return err
 	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opUpdate, KindCards, data)
 }
 
 // UpdatePassword - изменение выбранных пар логин/пароль данных на сервере.
 func (m *Manager) UpdatePassword(data *model.CryptoPassword) error {
-	m.crypto.EncryptedPassword(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/update/password", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
+	if err := m.crypto.EncryptedPassword(data); err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opUpdate, KindPasswords, data)
 }
 
 // UpdateText - изменение выбранных текстовых данных на сервере.
 func (m *Manager) UpdateText(data *model.CryptoTextData) error {
-	m.crypto.EncryptedTextData(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/update/text", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
-		return err
-	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
+	if err := m.crypto.EncryptedTextData(data); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opUpdate, KindTexts, data)
 }
 
 // UpdateBinary - изменение выбранных бинарных данных на сервере.
 func (m *Manager) UpdateBinary(data *model.CryptoBinaryData) error {
-	m.crypto.EncryptedBinaryData(data)
-	uByte, err := json.Marshal(data)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to marshal")
+	//без входа хранилище заблокировано и шифровать нечем
+	if err := m.authorized(); err != nil {
 		return err
 	}
-
-	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/data/update/binary", bytes.NewBuffer(uByte))
-
-	if err != nil {
-		m.logger.LogErr(err, "Failed to request")
+	if err := m.crypto.EncryptedBinaryData(data); err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", "Bearer "+m.jwt)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := m.client.Do(req)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to do request")
-		return err
-	}
-
-	switch resp.StatusCode {
-	case http.StatusInternalServerError:
-		fmt.Printf("server error")
-		return fmt.Errorf("server error")
-	case http.StatusUnauthorized:
-		fmt.Printf("Unauthorized")
-		return fmt.Errorf("unauthorized")
-	}
-
-	_, err = io.ReadAll(resp.Body)
-	if err != nil {
-		m.logger.LogErr(err, "Failed to read body")
-		return err
-	}
-	defer resp.Body.Close()
-	return nil
+	return m.send(opUpdate, KindBinaries, data)
 }
@@ -0,0 +1,59 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль готовит общие поля записей (название, адрес сайта, заметку, метки и избранное) для вывода и отправки.
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// timeLayout - формат времени создания и изменения записи в выводе.
+const timeLayout = "2006-01-02 15:04"
+
+// SplitTags - метки из поля Tags расшифрованной записи списком.
+func SplitTags(tags []byte) []string {
+	var list []string
+	for _, tag := range strings.Split(string(tags), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			list = append(list, tag)
+		}
+	}
+	return list
+}
+
+// JoinTags - метки, введенные через запятую, для поля Tags: без пробелов по краям и пустых меток.
+// Если меток нет, возвращает nil, и поле не шифруется.
+func JoinTags(tags string) []byte {
+	list := SplitTags([]byte(tags))
+	if len(list) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(list, ","))
+}
+
+// describeMeta - непустые общие поля расшифрованной записи для вывода после ее содержимого.
+// Время записи, которую еще не получил сервер, не выводится.
+func describeMeta(m model.ItemMeta) string {
+	var b strings.Builder
+	if m.Favorite {
+		b.WriteString(" Favorite")
+	}
+	if len(m.Title) > 0 {
+		fmt.Fprintf(&b, " Title: %s", m.Title)
+	}
+	if len(m.URL) > 0 {
+		fmt.Fprintf(&b, " URL: %s", m.URL)
+	}
+	if len(m.Notes) > 0 {
+		fmt.Fprintf(&b, " Notes: %s", m.Notes)
+	}
+	if tags := SplitTags(m.Tags); len(tags) > 0 {
+		fmt.Fprintf(&b, " Tags: %s", strings.Join(tags, ", "))
+	}
+	if !m.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, " Created: %s Updated: %s", m.CreatedAt.Local().Format(timeLayout), m.UpdatedAt.Local().Format(timeLayout))
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль перешифровывает конвертом записи, зашифрованные старым способом (только RSA), после их получения.
+package manager
+
+import (
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// migrateCards - сохранение расшифрованных карт старого формата в новом формате.
+// Ошибка не мешает просмотру, запись перешифруется при следующем получении.
+func (m *Manager) migrateCards(data []model.CryptoCard) {
+	for i := range data {
+		if err := m.UpdateCard(&data[i]); err != nil {
+			m.logger.LogErr(err, "failed to migrate card")
+		}
+	}
+}
+
+// migratePasswords - сохранение расшифрованных пар логин/пароль старого формата в новом формате.
+func (m *Manager) migratePasswords(data []model.CryptoPassword) {
+	for i := range data {
+		if err := m.UpdatePassword(&data[i]); err != nil {
+			m.logger.LogErr(err, "failed to migrate password")
+		}
+	}
+}
+
+// migrateText - сохранение расшифрованных текстовых данных старого формата в новом формате.
+func (m *Manager) migrateText(data []model.CryptoTextData) {
+	for i := range data {
+		if err := m.UpdateText(&data[i]); err != nil {
+			m.logger.LogErr(err, "failed to migrate text")
+		}
+	}
+}
+
+// migrateBinary - сохранение расшифрованных бинарных данных старого формата в новом формате.
+func (m *Manager) migrateBinary(data []model.CryptoBinaryData) {
+	for i := range data {
+		if err := m.UpdateBinary(&data[i]); err != nil {
+			m.logger.LogErr(err, "failed to migrate binary data")
+		}
+	}
+}
+
+// migrateItems - сохранение расшифрованных записей видов, добавленных на сервере, в новом формате.
+func (m *Manager) migrateItems(data []model.Item) {
+	for i := range data {
+		if err := m.UpdateItem(&data[i]); err != nil {
+			m.logger.LogErr(err, "failed to migrate item")
+		}
+	}
+}
@@ -0,0 +1,572 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль хранит локальную копию записей, чтобы работать без связи с сервером. Записи хранятся в том виде,
+// в каком их отдает сервер, то есть зашифрованными. Без связи записи читаются из копии, а изменения ставятся
+// в очередь и отправляются на сервер по порядку, когда связь появится.
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+)
+
+// Встроенные виды записей, совпадают с последней частью пути API. Записи остальных видов, добавленных
+// на сервере, хранятся и отправляются так же, но по эндпоинтам /api/items/{type} (см. items.go).
+const (
+	KindCards     = "cards"
+	KindPasswords = "password"
+	KindTexts     = "text"
+	KindBinaries  = "binary"
+)
+
+// Операции с записями.
+const (
+	opAdd    = "add"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// uidFields - поле идентификатора записи в JSON для каждого встроенного вида.
+var uidFields = map[string]string{
+	KindCards:     "UID",
+	KindPasswords: "uid_pass",
+	KindTexts:     "uid_text",
+	KindBinaries:  "uid_binary",
+}
+
+// uidField - поле идентификатора записи вида kind в JSON, у записей не встроенных видов - uid.
+func uidField(kind string) string {
+	if field, ok := uidFields[kind]; ok {
+		return field
+	}
+	return "uid"
+}
+
+// isBuiltin - вид kind встроенный, его записи хранятся в своих структурах и меняются по эндпоинтам /api/data.
+func isBuiltin(kind string) bool {
+	_, ok := uidFields[kind]
+	return ok
+}
+
+// errUnauthorized - сервер не принял токены, изменения из очереди ждут нового входа.
+var errUnauthorized = errors.New("unauthorized")
+
+// ErrConflict - запись изменили на другом устройстве после того, как ее получило это устройство.
+// Изменение не применяется, а сохраняется вместе с копией сервера до выбора версии (см. conflict.go).
+var ErrConflict = errors.New("item was changed on another device")
+
+// ErrNotFound - записи нет на сервере: ее удалили на другом устройстве или она другого пользователя.
+var ErrNotFound = errors.New("item not found")
+
+// errUnavailable - сервер временно не принял изменение: ошибка сервера, ограничение запросов или неизвестный ответ,
+// например от прокси. Такое изменение не отклонено, оно остается в очереди до следующей отправки.
+var errUnavailable = errors.New("server is temporarily unavailable")
+
+// errRejected - сервер окончательно отклонил изменение как неверное.
+var errRejected = errors.New("server rejected the change")
+
+// pendingOp - изменение, сделанное без связи с сервером. Запись уже зашифрована.
+type pendingOp struct {
+	Op   string          `json:"op"`
+	Kind string          `json:"kind"`
+	Item json.RawMessage `json:"item"`
+}
+
+// pendingConflict - изменение, которое сервер не применил из-за конфликта, и копия записи на сервере.
+type pendingConflict struct {
+	pendingOp
+	Current json.RawMessage `json:"current"`
+}
+
+// offlineCache - файл локальной копии пользователя: записи по видам, очередь изменений и конфликты. Файл зашифрован
+// ключом сессии, логин и сервер в нем не хранятся, а проверяются при расшифровке (см. crypto.SealCache).
+type offlineCache struct {
+	Login       string                     `json:"-"`
+	Items       map[string]json.RawMessage `json:"items"`
+	Outbox      []pendingOp                `json:"outbox"`
+	Conflicts   []pendingConflict          `json:"conflicts,omitempty"`
+	LastLocalID int                        `json:"last_local_id,omitempty"`
+	//копия прочитана из файла, а не создана в памяти до входа
+	opened bool
+}
+
+// kindPath - путь API записей вида kind.
+func kindPath(kind string) string {
+	if isBuiltin(kind) {
+		return "/api/data/" + kind
+	}
+	return "/api/items/" + kind
+}
+
+// request - метод и путь API изменения. Записи встроенных видов меняются запросами POST, записи остальных видов -
+// запросами PUT и DELETE с идентификатором в пути.
+func (op pendingOp) request() (string, string) {
+	switch {
+	case op.Op == opAdd:
+		return http.MethodPost, kindPath(op.Kind)
+	case isBuiltin(op.Kind):
+		return http.MethodPost, "/api/data/" + op.Op + "/" + op.Kind
+	case op.Op == opUpdate:
+		return http.MethodPut, kindPath(op.Kind) + "/" + string(itemUID(op))
+	default:
+		return http.MethodDelete, kindPath(op.Kind) + "/" + string(itemUID(op))
+	}
+}
+
+// isOffline - ошибка связи с сервером. Ответ с неверной подписью или другим ключом сервера - не отсутствие связи,
+// такие ответы не заменяются локальной копией.
+func isOffline(err error) bool {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return false
+	}
+	var changed *ServerKeyChangedError
+	return !errors.Is(err, ErrBadSignature) && !errors.As(err, &changed)
+}
+
+// cachePath - путь к файлу локальной копии пользователя в папке профиля. Имя файла не раскрывает логин.
+func (m *Manager) cachePath() string {
+	sum := sha256.Sum256([]byte(m.login))
+	return filepath.Join(m.config.ConfigDir, m.config.Profile, "cache-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// cacheOpened - локальная копия текущего пользователя прочитана из файла.
+func (m *Manager) cacheOpened() bool {
+	return m.cache != nil && m.cache.Login == m.login && m.cache.opened
+}
+
+// loadCache - локальная копия текущего пользователя. Если файла нет, копия пустая. Без ключа сессии файл
+// не открыть, поэтому до входа копия хранится только в памяти.
+func (m *Manager) loadCache() *offlineCache {
+	if m.cacheOpened() || (m.session == nil && m.cache != nil && m.cache.Login == m.login) {
+		return m.cache
+	}
+	if m.session == nil {
+		m.cache = &offlineCache{Login: m.login, Items: make(map[string]json.RawMessage)}
+		return m.cache
+	}
+	m.cache = m.readCache("")
+	return m.cache
+}
+
+// openCache - открытие локальной копии при входе, пока мастер-пароль известен, и запись ключом сессии. Так
+// открывается и файл, зашифрованный другим ключом, например сохраненный до нового входа или смены пароля.
+func (m *Manager) openCache(password string) {
+	if !m.cacheOpened() {
+		m.cache = m.readCache(password)
+	}
+	m.saveCache()
+}
+
+// readCache - чтение файла локальной копии ключом сессии. Файл, зашифрованный другим ключом, открывается
+// мастер-паролем password, если он известен. Если файла нет или он не открывается, копия пустая.
+func (m *Manager) readCache(password string) *offlineCache {
+	c := &offlineCache{}
+	content, err := os.ReadFile(m.cachePath())
+	if err == nil {
+		var data []byte
+		data, err = m.session.OpenCache(content)
+		if errors.Is(err, crypto.ErrWrongPassword) && password != "" {
+			_, data, err = crypto.OpenCache(content, m.login, m.config.Addr, password)
+		}
+		if err == nil {
+			err = json.Unmarshal(data, c)
+		}
+		if err != nil {
+			m.logger.LogErr(err, "local copy cannot be opened, starting a new one")
+			c = &offlineCache{}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		m.logger.LogErr(err, "failed to read local copy")
+	}
+	c.Login, c.opened = m.login, true
+	if c.Items == nil {
+		c.Items = make(map[string]json.RawMessage)
+	}
+	//изменения, сделанные до входа, отправляются после изменений из файла
+	if m.cache != nil && m.cache.Login == m.login && !m.cache.opened {
+		c.Outbox = append(c.Outbox, m.cache.Outbox...)
+		c.Conflicts = append(c.Conflicts, m.cache.Conflicts...)
+	}
+	return c
+}
+
+// saveCache - запись локальной копии, зашифрованной ключом сессии. Без сессии копия остается в памяти до входа.
+// Ошибка записи не мешает работе с сервером.
+func (m *Manager) saveCache() {
+	c := m.loadCache()
+	if m.session == nil {
+		return
+	}
+	content, err := json.Marshal(c)
+	if err != nil {
+		m.logger.LogErr(err, "failed to marshal local copy")
+		return
+	}
+	if content, err = m.session.SealCache(content); err != nil {
+		m.logger.LogErr(err, "failed to seal local copy")
+		return
+	}
+	file := m.cachePath()
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		m.logger.LogErr(err, "failed to create profile folder")
+		return
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, content, 0600); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		m.logger.LogErr(err, "failed to save local copy")
+	}
+}
+
+// dropCache - удаление локальной копии вместе с очередью.
+func (m *Manager) dropCache() {
+	if m.login == "" {
+		return
+	}
+	if err := os.Remove(m.cachePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logger.LogErr(err, "failed to remove local copy")
+	}
+	m.cache = nil
+}
+
+// Pending - число изменений, которые еще не отправлены на сервер.
+func (m *Manager) Pending() int {
+	if m.login == "" {
+		return 0
+	}
+	return len(m.loadCache().Outbox)
+}
+
+// send - отправка изменения записи. Если связи нет или в очереди уже есть изменения, изменение ставится
+// в очередь, чтобы сервер получил изменения в том порядке, в каком они сделаны.
+func (m *Manager) send(op, kind string, item interface{}) error {
+	body, err := json.Marshal(item)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	m.flush()
+	if op != opAdd {
+		if body, err = m.withVersion(kind, body); err != nil {
+			return err
+		}
+	}
+	pending := pendingOp{Op: op, Kind: kind, Item: body}
+	if len(m.loadCache().Outbox) > 0 {
+		return m.enqueue(pending)
+	}
+	method, path := pending.request()
+	resp, err := m.post(method, path, body)
+	if retryable(err) {
+		return m.enqueue(pending)
+	}
+	m.settle(pending, resp, err)
+	return err
+}
+
+// withVersion - добавление к изменению версии записи, которую видел пользователь: версии из локальной копии
+// с изменениями из очереди. Если записи в копии нет, записи вида kind получаются с сервера.
+func (m *Manager) withVersion(kind string, body []byte) ([]byte, error) {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, err
+	}
+	if _, ok := item["version"]; ok {
+		return body, nil
+	}
+	version, err := m.loadCache().version(kind, item[uidField(kind)])
+	if err != nil {
+		var raw json.RawMessage
+		if _, err = m.load(kind, &raw); err != nil {
+			return nil, err
+		}
+		if version, err = m.loadCache().version(kind, item[uidField(kind)]); err != nil {
+			return nil, err
+		}
+	}
+	item["version"] = version
+	return json.Marshal(item)
+}
+
+// version - версия записи uid вида kind в копии. Записи из копии без версии считаются неизвестными,
+// их версию нужно получить с сервера.
+func (c *offlineCache) version(kind string, uid json.RawMessage) (json.RawMessage, error) {
+	raw, err := applyOps(c.Items[kind], kind, c.Outbox)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if bytes.Equal(item[uidField(kind)], uid) && item["version"] != nil {
+			return item["version"], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// settle - учет ответа сервера на изменение в локальной копии. Принятое изменение применяется к копии, а новая
+// или измененная запись берется из ответа сервера, с идентификатором и новой версией. При конфликте запись в копии заменяется копией сервера,
+// а изменение сохраняется до выбора версии. Запись, которой нет на сервере, удаляется из копии.
+func (m *Manager) settle(op pendingOp, resp json.RawMessage, err error) {
+	c := m.loadCache()
+	switch {
+	case err == nil && op.Op != opDelete && len(resp) > 0:
+		op.Item = resp
+	case err == nil:
+	case errors.Is(err, ErrConflict):
+		m.addConflict(op, resp)
+		op = pendingOp{Op: opUpdate, Kind: op.Kind, Item: resp}
+	case errors.Is(err, ErrNotFound):
+		op.Op = opDelete
+	default:
+		m.saveCache()
+		return
+	}
+	if op.Op == opDelete {
+		m.dropConflicts(op)
+	}
+	if raw, ok := c.Items[op.Kind]; ok {
+		if raw, err = applyOps(raw, op.Kind, []pendingOp{op}); err == nil {
+			c.Items[op.Kind] = raw
+		}
+	}
+	m.saveCache()
+}
+
+// enqueue - постановка изменения в очередь. Новая запись получает временный идентификатор, чтобы ее можно было
+// изменить и удалить до отправки.
+func (m *Manager) enqueue(op pendingOp) error {
+	c := m.loadCache()
+	if op.Op == opAdd {
+		var err error
+		if op.Item, err = c.withLocalID(op); err != nil {
+			return err
+		}
+	}
+	c.Outbox = append(c.Outbox, op)
+	m.saveCache()
+	fmt.Printf("\nserver is unavailable, the change is saved and will be sent later")
+	return nil
+}
+
+// withLocalID - запись новой записи op с временным идентификатором. Идентификатор отрицательный, чтобы
+// не совпасть с идентификаторами сервера, а версия 0 - записи еще нет на сервере. Сервер их не читает,
+// а после отправки rebase заменяет их в следующих изменениях идентификатором и версией из ответа.
+func (c *offlineCache) withLocalID(op pendingOp) (json.RawMessage, error) {
+	var item map[string]json.RawMessage
+	if err := json.Unmarshal(op.Item, &item); err != nil {
+		return nil, err
+	}
+	c.LastLocalID--
+	item[uidField(op.Kind)] = json.RawMessage(strconv.Itoa(c.LastLocalID))
+	item["version"] = json.RawMessage("0")
+	return json.Marshal(item)
+}
+
+// flush - отправка изменений из очереди по порядку. Останавливается, если связи нет, сервер временно недоступен
+// или нужен новый вход. Изменение, которое сервер окончательно отклонил (400, 404), удаляется из очереди,
+// иначе оно задержало бы все следующие, а при конфликте (409) сохраняется до выбора версии.
+func (m *Manager) flush() {
+	if m.jwt == "" {
+		return
+	}
+	c := m.loadCache()
+	for len(c.Outbox) > 0 {
+		op := c.Outbox[0]
+		method, path := op.request()
+		resp, err := m.post(method, path, op.Item)
+		if retryable(err) || errors.Is(err, errUnauthorized) {
+			return
+		}
+		if err != nil && !errors.Is(err, ErrConflict) {
+			m.logger.LogErr(err, "server rejected a queued change, it is dropped")
+		}
+		c.Outbox = c.Outbox[1:]
+		if err == nil && op.Op != opDelete {
+			rebase(c.Outbox, op, resp)
+		}
+		m.settle(op, resp, err)
+	}
+}
+
+// rebase - перенос следующих изменений той же записи из очереди на версию, которую сервер присвоил принятому
+// изменению. Иначе второе изменение записи, сделанное без связи, конфликтовало бы с первым. Изменения записи,
+// добавленной без связи, получают и идентификатор, который сервер присвоил записи вместо временного.
+func rebase(ops []pendingOp, sent pendingOp, accepted json.RawMessage) {
+	var before, after map[string]json.RawMessage
+	if json.Unmarshal(sent.Item, &before) != nil || json.Unmarshal(accepted, &after) != nil {
+		return
+	}
+	uid := uidField(sent.Kind)
+	for i := range ops {
+		var item map[string]json.RawMessage
+		if ops[i].Kind != sent.Kind || json.Unmarshal(ops[i].Item, &item) != nil {
+			continue
+		}
+		if !bytes.Equal(item[uid], before[uid]) || !bytes.Equal(item["version"], before["version"]) {
+			continue
+		}
+		item["version"] = after["version"]
+		if after[uid] != nil {
+			item[uid] = after[uid]
+		}
+		if raw, err := json.Marshal(item); err == nil {
+			ops[i].Item = raw
+		}
+	}
+}
+
+// replicate - получение в локальную копию записей тех видов, которых в ней нет, чтобы без связи были доступны
+// все виды записей, а не только те, что уже открывались. Виды, которые уже есть в копии, обновляются только
+// при просмотре: версии в копии - это версии, которые видел пользователь, по ним сервер находит конфликты.
+func (m *Manager) replicate() {
+	c := m.loadCache()
+	for _, kind := range []string{KindCards, KindPasswords, KindTexts, KindBinaries} {
+		if _, ok := c.Items[kind]; ok {
+			continue
+		}
+		var raw json.RawMessage
+		if err := m.fetch("/api/data/"+kind, &raw); err != nil {
+			return
+		}
+		if raw == nil {
+			raw = json.RawMessage("[]")
+		}
+		c.Items[kind] = raw
+	}
+	m.saveCache()
+}
+
+// post - отправка изменения записи на сервер запросом method. Возвращает ответ сервера: измененную запись,
+// а при конфликте вместе с ErrConflict - копию записи на сервере.
+func (m *Manager) post(method, path string, body []byte) (json.RawMessage, error) {
+	req, err := http.NewRequest(method, m.url+m.config.Addr+path, bytes.NewBuffer(body))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return content, nil
+	case http.StatusConflict:
+		return content, ErrConflict
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return nil, errUnauthorized
+	case http.StatusBadRequest:
+		return nil, fmt.Errorf("%w: %s", errRejected, content)
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnavailable, resp.Status)
+	}
+}
+
+// retryable - изменение не дошло до сервера или сервер временно его не принял, его нужно отправить позже.
+func retryable(err error) bool {
+	return isOffline(err) || errors.Is(err, errUnavailable)
+}
+
+// load - получение записей вида kind в v. Ответ сервера сохраняется в локальную копию, без связи записи
+// читаются из копии с изменениями из очереди. Возвращает true, если записи из копии.
+func (m *Manager) load(kind string, v interface{}) (bool, error) {
+	m.flush()
+	var raw json.RawMessage
+	err := m.fetch(kindPath(kind), &raw)
+	c := m.loadCache()
+	offline := isOffline(err)
+	switch {
+	case err == nil:
+		if raw == nil {
+			raw = json.RawMessage("[]")
+		}
+		c.Items[kind] = raw
+		m.saveCache()
+	case offline:
+		if _, ok := c.Items[kind]; !ok && len(c.Outbox) == 0 {
+			return false, err
+		}
+		fmt.Printf("\nserver is unreachable, showing the local copy")
+		raw = c.Items[kind]
+	default:
+		return false, err
+	}
+	//изменения, которые еще не дошли до сервера, видны сразу
+	if raw, err = applyOps(raw, kind, c.Outbox); err != nil {
+		return false, err
+	}
+	return offline, json.Unmarshal(raw, v)
+}
+
+// applyOps - применение изменений вида kind к списку записей raw.
+func applyOps(raw json.RawMessage, kind string, ops []pendingOp) (json.RawMessage, error) {
+	var items []map[string]json.RawMessage
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+	}
+	uid := uidField(kind)
+	for _, op := range ops {
+		if op.Kind != kind {
+			continue
+		}
+		var item map[string]json.RawMessage
+		if err := json.Unmarshal(op.Item, &item); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case opAdd:
+			items = append(items, item)
+		case opUpdate:
+			for i := range items {
+				if bytes.Equal(items[i][uid], item[uid]) {
+					items[i] = item
+				}
+			}
+		case opDelete:
+			kept := items[:0]
+			for _, it := range items {
+				if !bytes.Equal(it[uid], item[uid]) {
+					kept = append(kept, it)
+				}
+			}
+			items = kept
+		}
+	}
+	if items == nil {
+		items = []map[string]json.RawMessage{}
+	}
+	return json.Marshal(items)
+}
@@ -0,0 +1,247 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+)
+
+// testServer - сервер записей. Первый ответ - status, следующие изменения принимаются: в ответе запись
+// с версией на единицу больше, а новая запись - с идентификатором сервера. Сервер запоминает запросы по порядку.
+// Пока unavailable, сервер отвечает 503 и запросы не запоминает.
+type testServer struct {
+	mu          sync.Mutex
+	status      int
+	unavailable bool
+	current     string
+	requests    []string
+	bodies      []map[string]interface{}
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	content, _ := io.ReadAll(r.Body)
+	var item map[string]interface{}
+	_ = json.Unmarshal(content, &item)
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	s.bodies = append(s.bodies, item)
+
+	status := http.StatusOK
+	if len(s.requests) == 1 && s.status != 0 {
+		status = s.status
+	}
+	w.WriteHeader(status)
+	switch status {
+	case http.StatusOK:
+		var accepted map[string]interface{}
+		_ = json.Unmarshal(content, &accepted)
+		if version, ok := accepted["version"].(float64); ok {
+			accepted["version"] = version + 1
+		}
+		if r.Method == http.MethodPost && !strings.Contains(r.URL.Path, "/update/") && !strings.Contains(r.URL.Path, "/delete/") {
+			for _, field := range []string{"UID", "uid_pass", "uid_text", "uid_binary", "uid"} {
+				if _, ok := accepted[field]; ok {
+					accepted[field] = float64(100 + len(s.requests))
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(accepted)
+	case http.StatusConflict:
+		_, _ = w.Write([]byte(s.current))
+	}
+}
+
+// newOfflineManager - менеджер вошедшего пользователя с очередью ops и сервером s.
+func newOfflineManager(t *testing.T, s *testServer, ops ...pendingOp) *Manager {
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	m := newTestManager(t, strings.TrimPrefix(srv.URL, "http://"))
+	m.login = "user"
+	m.jwt = "token"
+	m.loadCache().Outbox = ops
+	return m
+}
+
+// testOp - изменение записи вида kind с телом item.
+func testOp(op, kind, item string) pendingOp {
+	return pendingOp{Op: op, Kind: kind, Item: json.RawMessage(item)}
+}
+
+func TestManager_Flush(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		kept      bool
+		conflicts int
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "server error", status: http.StatusInternalServerError, kept: true},
+		{name: "bad gateway", status: http.StatusBadGateway, kept: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, kept: true},
+		{name: "too many requests", status: http.StatusTooManyRequests, kept: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, kept: true},
+		{name: "rejected", status: http.StatusBadRequest},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "conflict", status: http.StatusConflict, conflicts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &testServer{status: tt.status, current: `{"UID":1,"version":5,"card_number":"theirs"}`}
+			m := newOfflineManager(t, s,
+				testOp(opUpdate, KindCards, `{"UID":1,"version":1,"card_number":"mine"}`),
+				testOp(opDelete, KindPasswords, `{"uid_pass":2,"version":3}`))
+
+			m.flush()
+			if tt.kept {
+				//изменения остаются в очереди по порядку, следующие не отправляются
+				assert.Len(t, s.requests, 1)
+				assert.Equal(t, 2, m.Pending())
+				assert.Equal(t, KindCards, m.loadCache().Outbox[0].Kind)
+			} else {
+				//изменение, которое сервер принял или окончательно отклонил, не задерживает следующие
+				assert.Equal(t, []string{"POST /api/data/update/cards", "POST /api/data/delete/password"}, s.requests)
+				assert.Zero(t, m.Pending())
+			}
+			assert.Len(t, m.loadCache().Conflicts, tt.conflicts)
+		})
+	}
+}
+
+func TestManager_Flush_Offline(t *testing.T) {
+	s := &testServer{}
+	srv := httptest.NewServer(s)
+	m := newTestManager(t, strings.TrimPrefix(srv.URL, "http://"))
+	srv.Close()
+	m.login = "user"
+	m.jwt = "token"
+	m.loadCache().Outbox = []pendingOp{testOp(opDelete, KindTexts, `{"uid_text":1,"version":1}`)}
+
+	m.flush()
+	assert.Equal(t, 1, m.Pending())
+
+	//без входа очередь не отправляется
+	m.jwt = ""
+	m.flush()
+	assert.Equal(t, 1, m.Pending())
+}
+
+func TestManager_Flush_Rebase(t *testing.T) {
+	s := &testServer{}
+	m := newOfflineManager(t, s,
+		testOp(opUpdate, KindCards, `{"UID":1,"version":1,"card_number":"first"}`),
+		testOp(opUpdate, KindCards, `{"UID":1,"version":1,"card_number":"second"}`),
+		testOp(opUpdate, KindCards, `{"UID":2,"version":1,"card_number":"other"}`),
+		testOp(opUpdate, "wifi", `{"uid":1,"version":1}`))
+
+	m.flush()
+	require.Len(t, s.bodies, 4)
+	assert.Zero(t, m.Pending())
+	assert.Equal(t, "PUT /api/items/wifi/1", s.requests[3])
+	//второе изменение записи отправлено с версией, которую сервер присвоил первому
+	assert.Equal(t, "second", s.bodies[1]["card_number"])
+	assert.EqualValues(t, 2, s.bodies[1]["version"])
+	assert.EqualValues(t, 1, s.bodies[2]["version"])
+	assert.EqualValues(t, 1, s.bodies[3]["version"])
+}
+
+func TestRebase(t *testing.T) {
+	sent := testOp(opUpdate, KindPasswords, `{"uid_pass":1,"version":1}`)
+	ops := []pendingOp{
+		testOp(opUpdate, KindPasswords, `{"uid_pass":1,"version":1,"login":"next"}`),
+		testOp(opDelete, KindPasswords, `{"uid_pass":1,"version":1}`),
+		testOp(opUpdate, KindPasswords, `{"uid_pass":1,"version":7}`),
+		testOp(opUpdate, KindPasswords, `{"uid_pass":2,"version":1}`),
+		testOp(opUpdate, KindTexts, `{"uid_text":1,"version":1}`),
+	}
+
+	rebase(ops, sent, json.RawMessage(`{"uid_pass":1,"version":2}`))
+	assert.JSONEq(t, `{"uid_pass":1,"version":2,"login":"next"}`, string(ops[0].Item))
+	assert.JSONEq(t, `{"uid_pass":1,"version":2}`, string(ops[1].Item))
+	//изменения других версий, записей и видов не меняются
+	assert.JSONEq(t, `{"uid_pass":1,"version":7}`, string(ops[2].Item))
+	assert.JSONEq(t, `{"uid_pass":2,"version":1}`, string(ops[3].Item))
+	assert.JSONEq(t, `{"uid_text":1,"version":1}`, string(ops[4].Item))
+
+	//ответ сервера без записи очередь не меняет
+	rebase(ops, sent, json.RawMessage("not json"))
+	assert.JSONEq(t, `{"uid_pass":1,"version":2,"login":"next"}`, string(ops[0].Item))
+}
+
+func TestManager_Send_Queue(t *testing.T) {
+	s := &testServer{status: http.StatusServiceUnavailable}
+	m := newOfflineManager(t, s)
+
+	//временно недоступный сервер не отклоняет изменение, оно ставится в очередь
+	require.NoError(t, m.send(opDelete, KindTexts, map[string]int{"uid_text": 1, "version": 1}))
+	assert.Equal(t, 1, m.Pending())
+
+	//следующее изменение отправляется после изменений из очереди
+	require.NoError(t, m.send(opDelete, KindTexts, map[string]int{"uid_text": 2, "version": 1}))
+	assert.Zero(t, m.Pending())
+	require.Len(t, s.bodies, 3)
+	assert.EqualValues(t, 1, s.bodies[1]["uid_text"])
+	assert.EqualValues(t, 2, s.bodies[2]["uid_text"])
+}
+
+func TestManager_Flush_LocalID(t *testing.T) {
+	s := &testServer{unavailable: true}
+	m := newOfflineManager(t, s)
+	session, err := crypto.NewSessionSealer(m.login, m.config.Addr, "pass")
+	require.NoError(t, err)
+	m.session = session
+	m.loadCache().Items[KindCards] = json.RawMessage("[]")
+
+	//без связи запись добавляют, меняют и удаляют по временному идентификатору, вторую добавляют и меняют
+	require.NoError(t, m.send(opAdd, KindCards, map[string]interface{}{"card_number": "first"}))
+	require.NoError(t, m.send(opUpdate, KindCards, map[string]interface{}{"UID": -1, "card_number": "changed"}))
+	require.NoError(t, m.send(opDelete, KindCards, map[string]interface{}{"UID": -1}))
+	require.NoError(t, m.send(opAdd, KindCards, map[string]interface{}{"card_number": "second"}))
+	require.NoError(t, m.send(opUpdate, KindCards, map[string]interface{}{"UID": -2, "card_number": "kept"}))
+	raw, err := applyOps(m.loadCache().Items[KindCards], KindCards, m.loadCache().Outbox)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"UID":-2,"version":0,"card_number":"kept"}]`, string(raw))
+
+	//файл копии зашифрован и не раскрывает логин и сервер
+	content, err := os.ReadFile(m.cachePath())
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "kept")
+	assert.NotContains(t, string(content), `"user"`)
+	assert.NotContains(t, string(content), m.config.Addr)
+
+	//после нового входа копия открывается мастер-паролем
+	m.session, err = crypto.NewSessionSealer(m.login, m.config.Addr, "pass")
+	require.NoError(t, err)
+	m.cache = nil
+	m.openCache("pass")
+	require.Equal(t, 5, m.Pending())
+
+	s.unavailable = false
+	m.flush()
+	assert.Zero(t, m.Pending())
+	assert.Equal(t, []string{"POST /api/data/cards", "POST /api/data/update/cards", "POST /api/data/delete/cards",
+		"POST /api/data/cards", "POST /api/data/update/cards"}, s.requests)
+	//изменения отправлены с идентификатором и версией, которые сервер присвоил новой записи
+	assert.EqualValues(t, 101, s.bodies[1]["UID"])
+	assert.EqualValues(t, 1, s.bodies[1]["version"])
+	assert.EqualValues(t, 101, s.bodies[2]["UID"])
+	assert.EqualValues(t, 2, s.bodies[2]["version"])
+	assert.EqualValues(t, 104, s.bodies[4]["UID"])
+	assert.EqualValues(t, 1, s.bodies[4]["version"])
+	//в копии осталась только вторая запись с идентификатором сервера
+	assert.JSONEq(t, `[{"UID":104,"version":2,"card_number":"kept"}]`, string(m.loadCache().Items[KindCards]))
+}
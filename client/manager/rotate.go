@@ -0,0 +1,184 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль меняет ключ пользователя: все записи перешифровываются новым ключом и заменяются на сервере разом.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// RotateKey - смена ключа пользователя. Записи получаются с сервера, перешифровываются новым ключом и отправляются
+// вместе с новым ключом одним запросом, сервер заменяет их одной транзакцией. Если смена прервалась,
+// повторный вызов продолжает ее с тем же новым ключом.
+func (m *Manager) RotateKey(password string) error {
+	if err := m.authorized(); err != nil {
+		return err
+	}
+	//изменения из очереди зашифрованы прежним ключом и после смены ключа не расшифровались бы
+	if m.flush(); m.Pending() > 0 {
+		fmt.Printf("offline changes are not synced yet, connect to the server first")
+		return fmt.Errorf("offline changes are not synced yet")
+	}
+	if len(m.loadCache().Conflicts) > 0 {
+		fmt.Printf("some changes conflict with other devices, choose the versions first")
+		return ErrConflict
+	}
+	if err := m.crypto.BeginRotation(m.login, password); err != nil {
+		return err
+	}
+	var batch model.ItemBatch
+	for _, f := range []struct {
+		path string
+		v    interface{}
+	}{
+		{"/api/data/cards", &batch.Cards},
+		{"/api/data/password", &batch.Passwords},
+		{"/api/data/text", &batch.Texts},
+		{"/api/data/binary", &batch.Binaries},
+	} {
+		if err := m.fetch(f.path, f.v); err != nil {
+			return err
+		}
+	}
+	//сервер меняет ключ, только если перешифрованы записи всех видов
+	var kinds []model.ItemKind
+	if err := m.fetch("/api/items", &kinds); err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		if kind.Builtin {
+			continue
+		}
+		var items []model.Item
+		if err := m.fetch(kindPath(kind.Name), &items); err != nil {
+			return err
+		}
+		batch.Items = append(batch.Items, items...)
+	}
+	for i := range batch.Cards {
+		if err := m.crypto.ReencryptCard(&batch.Cards[i]); err != nil {
+			return fmt.Errorf("card %d: %w", batch.Cards[i].UID, err)
+		}
+	}
+	for i := range batch.Passwords {
+		if err := m.crypto.ReencryptPassword(&batch.Passwords[i]); err != nil {
+			return fmt.Errorf("password %d: %w", batch.Passwords[i].UID, err)
+		}
+	}
+	for i := range batch.Texts {
+		if err := m.crypto.ReencryptTextData(&batch.Texts[i]); err != nil {
+			return fmt.Errorf("text %d: %w", batch.Texts[i].UID, err)
+		}
+	}
+	for i := range batch.Binaries {
+		if err := m.crypto.ReencryptBinaryData(&batch.Binaries[i]); err != nil {
+			return fmt.Errorf("binary data %d: %w", batch.Binaries[i].UID, err)
+		}
+	}
+	for i := range batch.Items {
+		if err := m.crypto.ReencryptItem(&batch.Items[i]); err != nil {
+			return fmt.Errorf("%s %d: %w", batch.Items[i].Type, batch.Items[i].UID, err)
+		}
+	}
+	key, err := m.crypto.PendingVault(m.login)
+	if err != nil {
+		return err
+	}
+	batch.Key = key
+
+	uByte, err := json.Marshal(batch)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/keys/rotate", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		fmt.Printf("data changed during key rotation, run it again")
+		return fmt.Errorf("data changed during key rotation")
+	case http.StatusBadRequest:
+		fmt.Printf("bad request")
+		return fmt.Errorf("bad request")
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	}
+	//локальная копия зашифрована прежним ключом, она заполнится заново при следующем получении записей
+	c := m.loadCache()
+	c.Items = make(map[string]json.RawMessage)
+	m.saveCache()
+	return m.crypto.CommitRotation(m.login)
+}
+
+// RotationLoss - что сервер удалит при смене ключа: записей в корзине и глубина истории записей (0 - история
+// не хранится). Корзина и прежние версии зашифрованы старым ключом и при смене ключа не перешифровываются.
+func (m *Manager) RotationLoss() (trash int, depth int, err error) {
+	if err = m.authorized(); err != nil {
+		return 0, 0, err
+	}
+	var entries []model.TrashEntry
+	if err = m.fetch("/api/trash", &entries); err != nil {
+		return 0, 0, err
+	}
+	if depth, err = m.HistoryDepth(); err != nil {
+		return 0, 0, err
+	}
+	return len(entries), depth, nil
+}
+
+// RotationPending - проверка, что смена ключа прервалась и ее нужно продолжить.
+func (m *Manager) RotationPending() bool {
+	return m.login != "" && m.crypto.RotationPending(m.login)
+}
+
+// fetch - получение зашифрованных записей с эндпоинта path в v. Если записей нет, v не меняется.
+func (m *Manager) fetch(path string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+path, nil)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return fmt.Errorf("unauthorized")
+	default:
+		return fmt.Errorf("failed to get %s: %s", path, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to read body")
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
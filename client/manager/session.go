@@ -0,0 +1,146 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль сохраняет сессию в файле профиля, чтобы при следующем запуске не входить заново:
+// вместо логина, пароля и кода второго фактора нужен только мастер-пароль, которым зашифрован файл.
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// ErrNoSession - сохраненной сессии нет, она другого пользователя или сервера, истекла или отозвана.
+var ErrNoSession = errors.New("no saved session")
+
+// savedTokens - данные файла сессии.
+type savedTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionPath - путь к файлу сессии профиля.
+func (m *Manager) sessionPath() string {
+	return filepath.Join(m.config.ConfigDir, m.config.Profile, "session.json")
+}
+
+// SessionLogin - логин сохраненной сессии профиля. Если сессии для этого сервера нет, возвращает пустую строку.
+func (m *Manager) SessionLogin() string {
+	content, err := os.ReadFile(m.sessionPath())
+	if err != nil {
+		return ""
+	}
+	login, server, err := crypto.SessionLogin(content)
+	if err != nil || server != m.config.Addr {
+		return ""
+	}
+	return login
+}
+
+// Resume - продолжение сохраненной сессии пользователя login (любого, если login пустой) и открытие хранилища.
+// Если сессия истекла или отозвана, файл сессии удаляется и возвращается ErrNoSession.
+func (m *Manager) Resume(login, password string) error {
+	content, err := os.ReadFile(m.sessionPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNoSession
+	}
+	if err != nil {
+		return err
+	}
+	session, data, err := crypto.OpenSession(content, password)
+	if err != nil {
+		return err
+	}
+	if session.Server() != m.config.Addr || (login != "" && session.Login() != login) {
+		return ErrNoSession
+	}
+	var t savedTokens
+	if err = json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	m.login, m.jwt, m.refreshToken = session.Login(), t.Token, t.RefreshToken
+	m.session = session
+
+	//запрос проверяет, что сессия жива, а истекший токен доступа заодно обновляется
+	var sessions []model.Session
+	//без связи с сервером сессия остается, хранилище открывается по локальной копии ключа
+	if err = m.fetch("/api/sessions", &sessions); err != nil && !isOffline(err) {
+		if m.jwt == "" {
+			m.dropSession()
+			return ErrNoSession
+		}
+		m.jwt, m.refreshToken, m.session = "", "", nil
+		return err
+	}
+	return m.Unlock(password)
+}
+
+// startSession - сохранение сессии после открытия хранилища. Ключ файла сессии получается из мастер-пароля
+// только для новой сессии, продолженная сессия перезаписывается прежним ключом. Тем же ключом шифруется
+// локальная копия, поэтому она открывается здесь же, пока пароль известен.
+func (m *Manager) startSession(password string) {
+	if m.session == nil || m.session.Login() != m.login {
+		session, err := m.newSessionSealer(password)
+		if err != nil {
+			m.logger.LogErr(err, "failed to seal session")
+			return
+		}
+		m.session = session
+	}
+	m.saveSession()
+	m.openCache(password)
+}
+
+// newSessionSealer - шифрование новой сессии. Сессия и локальная копия шифруются одним ключом: если копия еще
+// не открыта, ключ берется из ее файла, иначе получается из мастер-пароля с новой солью.
+func (m *Manager) newSessionSealer(password string) (*crypto.SessionSealer, error) {
+	if !m.cacheOpened() {
+		if content, err := os.ReadFile(m.cachePath()); err == nil {
+			if session, _, err := crypto.OpenCache(content, m.login, m.config.Addr, password); err == nil {
+				return session, nil
+			}
+		}
+	}
+	return crypto.NewSessionSealer(m.login, m.config.Addr, password)
+}
+
+// saveSession - запись токенов в файл сессии. Вызывается при входе и после каждого обновления токенов,
+// иначе в файле остался бы уже использованный токен обновления. Ошибка записи не мешает работе.
+func (m *Manager) saveSession() {
+	if m.session == nil || m.jwt == "" {
+		return
+	}
+	data, err := json.Marshal(savedTokens{Token: m.jwt, RefreshToken: m.refreshToken})
+	if err != nil {
+		m.logger.LogErr(err, "failed to marshal session")
+		return
+	}
+	content, err := m.session.Seal(data)
+	if err != nil {
+		m.logger.LogErr(err, "failed to seal session")
+		return
+	}
+	file := m.sessionPath()
+	if err = os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		m.logger.LogErr(err, "failed to create profile folder")
+		return
+	}
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, content, 0600); err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		m.logger.LogErr(err, "failed to save session")
+	}
+}
+
+// dropSession - удаление файла сессии.
+func (m *Manager) dropSession() {
+	m.session = nil
+	if err := os.Remove(m.sessionPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		m.logger.LogErr(err, "failed to remove session")
+	}
+}
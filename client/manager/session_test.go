@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/CyrilSbrodov/passManager.git/client/cmd/config"
+	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+)
+
+// newTestManager - менеджер сервера addr с профилем и ключами во временных папках. Ответы сервера
+// не проверяются подписью.
+func newTestManager(t *testing.T, addr string) *Manager {
+	cfg := &config.Config{Addr: addr, ConfigDir: t.TempDir(), Profile: "default", CryptoPROKeyPath: t.TempDir() + "/"}
+	logger := loggers.NewLogger()
+	return &Manager{
+		client: http.Client{},
+		config: cfg,
+		logger: logger,
+		url:    "http://",
+		crypto: crypto.NewRSA(*cfg, logger),
+	}
+}
+
+// writeSession - файл сессии пользователя login на сервере server, зашифрованный паролем password.
+func writeSession(t *testing.T, m *Manager, login, server, password string) {
+	sealer, err := crypto.NewSessionSealer(login, server, password)
+	require.NoError(t, err)
+	content, err := sealer.Seal([]byte(`{"token":"token","refresh_token":"refresh"}`))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(m.sessionPath()), 0700))
+	require.NoError(t, os.WriteFile(m.sessionPath(), content, 0600))
+}
+
+func TestManager_Resume(t *testing.T) {
+	tests := []struct {
+		name     string
+		server   string
+		login    string
+		password string
+		err      error
+	}{
+		{name: "no session", err: ErrNoSession},
+		//токены сессии другого сервера не отправляются на этот
+		{name: "other server", server: "other:8080", login: "user", password: "pass", err: ErrNoSession},
+		{name: "other user", server: "localhost:8080", login: "other", password: "pass", err: ErrNoSession},
+		{name: "wrong password", server: "localhost:8080", login: "user", password: "wrong", err: crypto.ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(t, "localhost:8080")
+			if tt.server != "" {
+				writeSession(t, m, tt.login, tt.server, "pass")
+			}
+			assert.ErrorIs(t, m.Resume("user", tt.password), tt.err)
+			assert.Empty(t, m.jwt)
+			assert.Empty(t, m.refreshToken)
+			assert.Nil(t, m.session)
+		})
+	}
+}
+
+func TestManager_SessionLogin(t *testing.T) {
+	m := newTestManager(t, "localhost:8080")
+	assert.Empty(t, m.SessionLogin())
+	writeSession(t, m, "user", "other:8080", "pass")
+	assert.Empty(t, m.SessionLogin())
+	writeSession(t, m, "user", "localhost:8080", "pass")
+	assert.Equal(t, "user", m.SessionLogin())
+}
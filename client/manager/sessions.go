@@ -0,0 +1,77 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль получает и отзывает сессии пользователя на других устройствах.
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// GetSessions - получение активных сессий пользователя.
+func (m *Manager) GetSessions() ([]model.Session, error) {
+	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/sessions", nil)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return nil, fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return nil, fmt.Errorf("unauthorized")
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to read body")
+		return nil, err
+	}
+	var sessions []model.Session
+	if err = json.Unmarshal(data, &sessions); err != nil {
+		m.logger.LogErr(err, "Failed to unmarshal body")
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession - отзыв сессии на другом устройстве.
+func (m *Manager) RevokeSession(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, m.url+m.config.Addr+"/api/sessions/"+url.PathEscape(id), nil)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		fmt.Printf("session not found")
+		return fmt.Errorf("session not found")
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
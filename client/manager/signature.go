@@ -0,0 +1,189 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль проверяет подпись каждого ответа сервера. Открытый ключ сервера запоминается при первом
+// подключении, ответы, подписанные другим ключом или без подписи, не принимаются.
+package manager
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CyrilSbrodov/passManager.git/client/cmd/loggers"
+)
+
+// Заголовки подписи ответа, такие же как на сервере.
+const (
+	headerNonce     = "X-Request-Nonce"
+	headerSignature = "X-Signature"
+	headerServerKey = "X-Server-Key"
+)
+
+// ErrBadSignature - ответ сервера без подписи или подпись не совпадает: ответ мог быть подменен.
+var ErrBadSignature = errors.New("server response signature is missing or invalid")
+
+// ServerKeyChangedError - сервер подписывает ответы не тем ключом, который был запомнен при первом подключении.
+type ServerKeyChangedError struct {
+	File string
+}
+
+func (e *ServerKeyChangedError) Error() string {
+	return fmt.Sprintf("server key changed, responses are not trusted; if the server key was replaced on purpose, remove %s", e.File)
+}
+
+// signedTransport - транспорт, который добавляет в запрос случайное значение и проверяет подпись ответа.
+type signedTransport struct {
+	next   http.RoundTripper
+	file   string
+	logger *loggers.Logger
+	mu     sync.Mutex
+	key    *rsa.PublicKey
+}
+
+// newSignedTransport - транспорт проверки подписи для сервера addr. Ключ сервера хранится в папке path.
+func newSignedTransport(next http.RoundTripper, path, addr string, logger *loggers.Logger) *signedTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	sum := sha256.Sum256([]byte(addr))
+	return &signedTransport{
+		next:   next,
+		file:   path + "server-" + hex.EncodeToString(sum[:8]) + ".pem",
+		logger: logger,
+	}
+}
+
+// RoundTrip - отправка запроса и проверка подписи ответа. Тело ответа читается целиком.
+func (t *signedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(headerNonce, hex.EncodeToString(nonce))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.serverKey(resp.Header.Get(headerServerKey))
+	if err != nil {
+		return nil, err
+	}
+	sign, err := base64.StdEncoding.DecodeString(resp.Header.Get(headerSignature))
+	if err != nil || len(sign) == 0 {
+		return nil, ErrBadSignature
+	}
+	msg := responseMessage(req.Method, req.URL.RequestURI(), req.Header.Get(headerNonce), resp.StatusCode, body)
+	digest := sha256.Sum256(msg)
+	if err = rsa.VerifyPSS(key, crypto.SHA256, digest[:], sign, nil); err != nil {
+		return nil, ErrBadSignature
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// serverKey - запомненный ключ сервера. При первом подключении запоминается ключ из ответа.
+func (t *signedTransport) serverKey(encoded string) (*rsa.PublicKey, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var received *rsa.PublicKey
+	if encoded != "" {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+		if received, err = parsePublicKey(der); err != nil {
+			return nil, ErrBadSignature
+		}
+	}
+	if t.key == nil {
+		key, err := t.loadKey()
+		switch {
+		case err == nil:
+			t.key = key
+		case errors.Is(err, os.ErrNotExist) && received != nil:
+			if err = t.saveKey(received); err != nil {
+				return nil, err
+			}
+			t.logger.LogInfo("server key is pinned:", t.file, "")
+			t.key = received
+		case errors.Is(err, os.ErrNotExist):
+			return nil, ErrBadSignature
+		default:
+			return nil, err
+		}
+	}
+	if received != nil && !received.Equal(t.key) {
+		return nil, &ServerKeyChangedError{File: t.file}
+	}
+	return t.key, nil
+}
+
+// loadKey - чтение запомненного ключа сервера.
+func (t *signedTransport) loadKey() (*rsa.PublicKey, error) {
+	content, err := os.ReadFile(t.file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: no public key", t.file)
+	}
+	return parsePublicKey(block.Bytes)
+}
+
+// saveKey - сохранение ключа сервера при первом подключении.
+func (t *signedTransport) saveKey(key *rsa.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+}
+
+// parsePublicKey - разбор открытого ключа RSA в формате PKIX.
+func parsePublicKey(der []byte) (*rsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server key is not an RSA key")
+	}
+	return public, nil
+}
+
+// responseMessage - подписанное сервером сообщение: метод, путь запроса, случайное значение клиента,
+// статус и хеш тела ответа.
+func responseMessage(method, uri, nonce string, status int, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		"passManager response v1",
+		method,
+		uri,
+		nonce,
+		strconv.Itoa(status),
+		hex.EncodeToString(digest[:]),
+	}, "\n"))
+}
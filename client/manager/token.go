@@ -0,0 +1,123 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль добавляет токен авторизации к запросам, обновляет его и выходит из аккаунта.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// do - отправка запроса с токеном доступа. Если токен истек (http.StatusUnauthorized),
+// токены обновляются и запрос отправляется еще раз.
+func (m *Manager) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+m.jwt)
+	resp, err := m.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || m.refreshToken == "" {
+		return resp, err
+	}
+	if err = m.refresh(); err != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			m.logger.LogErr(err, "failed to copy body")
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+m.jwt)
+	return m.client.Do(retry)
+}
+
+// refresh - получение новой пары токенов по токену обновления.
+func (m *Manager) refresh() error {
+	uByte, err := json.Marshal(model.RefreshRequest{RefreshToken: m.refreshToken})
+	if err != nil {
+		m.logger.LogErr(err, "failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/token/refresh", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.logger.LogErr(err, "failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		//токен обновления истек или отозван, нужно войти заново
+		m.jwt, m.refreshToken = "", ""
+		return fmt.Errorf("session expired, please auth again")
+	case http.StatusBadRequest, http.StatusInternalServerError:
+		return fmt.Errorf("server error")
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "failed to read body")
+		return err
+	}
+	var accept model.KeyAndToken
+	if err = json.Unmarshal(data, &accept); err != nil {
+		m.logger.LogErr(err, "failed to unmarshal tokens")
+		return err
+	}
+	m.publicKeyFromServer = accept.Key
+	m.jwt = accept.Token
+	m.refreshToken = accept.RefreshToken
+	m.saveSession()
+	return nil
+}
+
+// Logout - выход из аккаунта. Сервер отзывает токен доступа и токены обновления этого входа,
+// закрытый ключ стирается из памяти, файл сессии удаляется.
+func (m *Manager) Logout() error {
+	m.crypto.Lock()
+	m.dropSession()
+	if m.jwt == "" {
+		return fmt.Errorf("unauthorized")
+	}
+	uByte, err := json.Marshal(model.RefreshRequest{RefreshToken: m.refreshToken})
+	if err != nil {
+		m.logger.LogErr(err, "failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/logout", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	m.jwt, m.refreshToken = "", ""
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль завершает вход кодом второго фактора, подключает и отключает двухфакторную аутентификацию.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// ErrSecondFactor - пароль верный, для входа нужен код из приложения-аутентификатора или код восстановления.
+var ErrSecondFactor = errors.New("two-factor code required")
+
+// AuthCode - второй шаг входа: код TOTP или код восстановления.
+func (m *Manager) AuthCode(code string) error {
+	if m.challenge == "" {
+		return fmt.Errorf("auth with login and password first")
+	}
+	uByte, err := json.Marshal(model.TwoFactorRequest{Challenge: m.challenge, Code: code, Device: m.device})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/login/2fa", bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadRequest:
+		fmt.Printf("code is empty")
+		return fmt.Errorf("code is empty")
+	case http.StatusUnauthorized:
+		fmt.Printf("wrong code")
+		return fmt.Errorf("wrong code")
+	case http.StatusTooManyRequests:
+		return tooManyRequests(resp)
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "failed to read body")
+		return err
+	}
+	var accept model.KeyAndToken
+	if err = json.Unmarshal(data, &accept); err != nil {
+		m.logger.LogErr(err, "failed to unmarshal publicKey")
+		return err
+	}
+	m.publicKeyFromServer = accept.Key
+	m.jwt = accept.Token
+	m.refreshToken = accept.RefreshToken
+	m.challenge = ""
+	m.session = nil
+	return nil
+}
+
+// EnrollTwoFactor - подключение второго фактора. Возвращает ссылку для приложения-аутентификатора и коды восстановления.
+func (m *Manager) EnrollTwoFactor() (*model.TwoFactorSetup, error) {
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+"/api/2fa/enroll", nil)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		fmt.Printf("two-factor authentication is already enabled")
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return nil, fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return nil, fmt.Errorf("unauthorized")
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to read body")
+		return nil, err
+	}
+	var setup model.TwoFactorSetup
+	if err = json.Unmarshal(data, &setup); err != nil {
+		m.logger.LogErr(err, "Failed to unmarshal body")
+		return nil, err
+	}
+	return &setup, nil
+}
+
+// ConfirmTwoFactor - включение второго фактора первым кодом из приложения-аутентификатора.
+func (m *Manager) ConfirmTwoFactor(code string) error {
+	return m.twoFactorChange("/api/2fa/confirm", code)
+}
+
+// DisableTwoFactor - отключение второго фактора кодом из приложения-аутентификатора или кодом восстановления.
+func (m *Manager) DisableTwoFactor(code string) error {
+	return m.twoFactorChange("/api/2fa/disable", code)
+}
+
+func (m *Manager) twoFactorChange(path, code string) error {
+	uByte, err := json.Marshal(model.TwoFactorRequest{Code: code})
+	if err != nil {
+		m.logger.LogErr(err, "Failed to marshal")
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, m.url+m.config.Addr+path, bytes.NewBuffer(uByte))
+	if err != nil {
+		m.logger.LogErr(err, "Failed to request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		m.logger.LogErr(err, "Failed to do request")
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusConflict:
+		data, _ := io.ReadAll(resp.Body)
+		fmt.Printf("%s", data)
+		return fmt.Errorf("%s", data)
+	case http.StatusForbidden:
+		fmt.Printf("wrong code")
+		return fmt.Errorf("wrong code")
+	case http.StatusInternalServerError:
+		fmt.Printf("server error")
+		return fmt.Errorf("server error")
+	case http.StatusUnauthorized:
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Package manager Модуль отправляет и получает все JSON запросы с сервера. Обрабатывает и отправляет в app.
+// Данный модуль открывает и блокирует хранилище закрытого ключа и хранит его зашифрованную копию на сервере,
+// чтобы тот же аккаунт открывался на других устройствах.
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/client/crypto"
+	"github.com/CyrilSbrodov/passManager.git/client/model"
+)
+
+// Unlock - расшифровка закрытого ключа мастер-паролем после входа или регистрации. Если на сервере есть
+// хранилище, оно открывается первым: так на новом устройстве появляется тот же ключ, а после смены ключа
+// на другом устройстве - новый ключ. Если на сервере хранилища нет или оно зашифровано прежним паролем,
+// туда отправляется хранилище с этого устройства. После открытия на сервер отправляются изменения,
+// сделанные без связи, и обновляется локальная копия записей.
+func (m *Manager) Unlock(password string) error {
+	if err := m.unlock(password); err != nil {
+		return err
+	}
+	if m.flush(); m.Pending() == 0 {
+		m.replicate()
+	}
+	return nil
+}
+
+// unlock - открытие хранилища, см. Unlock.
+func (m *Manager) unlock(password string) error {
+	if m.login == "" {
+		return fmt.Errorf("auth first")
+	}
+	remote, err := m.downloadKey()
+	if err != nil {
+		//без сервера хранилище открывается только на этом устройстве
+		m.logger.LogErr(err, "failed to download vault")
+		if err = m.crypto.Unlock(m.login, password); err != nil {
+			return err
+		}
+		m.startSession(password)
+		return nil
+	}
+	var importErr error
+	m.keyMismatch = false
+	if remote != nil {
+		importErr = m.crypto.ImportVault(m.login, password, remote)
+		switch {
+		case importErr == nil:
+			m.startSession(password)
+			return nil
+		case errors.Is(importErr, crypto.ErrKeyMismatch):
+			//ключ на сервере не открывается этим паролем, ключ устройства не заменяется и не отправляется
+			m.logger.LogErr(importErr, "vault on server has another key, keeping the key of this device")
+			m.keyMismatch = true
+		case !errors.Is(importErr, crypto.ErrWrongPassword):
+			return importErr
+		}
+	}
+	if err = m.crypto.Unlock(m.login, password); err != nil {
+		return err
+	}
+	if remote == nil || errors.Is(importErr, crypto.ErrWrongPassword) {
+		//ошибка не мешает работе, хранилище будет отправлено при следующем входе
+		if err = m.uploadKey(); err != nil {
+			m.logger.LogErr(err, "failed to upload vault")
+		}
+	}
+	m.startSession(password)
+	return nil
+}
+
+// ReencryptVault - открытие хранилища старым паролем и перешифровка новым. Нужно, если мастер-пароль
+// сменили на другом устройстве и хранилище на этом устройстве зашифровано прежним паролем.
+func (m *Manager) ReencryptVault(oldPassword, password string) error {
+	if err := m.Unlock(oldPassword); err != nil {
+		return err
+	}
+	if err := m.crypto.SetPassword(m.login, password); err != nil {
+		return err
+	}
+	if err := m.uploadKey(); err != nil {
+		m.logger.LogErr(err, "failed to upload vault")
+	}
+	//файл сессии тоже перешифровывается новым паролем
+	m.session = nil
+	m.startSession(password)
+	return nil
+}
+
+// Lock - блокировка: закрытый ключ и токены стираются из памяти. Сохраненная сессия остается в файле,
+// зашифрованном мастер-паролем, и продолжается после ввода пароля (см. Resume). Если сессия не сохранена,
+// выполняется выход с сервера.
+func (m *Manager) Lock() {
+	if m.jwt != "" && m.session == nil {
+		if err := m.Logout(); err != nil {
+			m.logger.LogErr(err, "failed to logout")
+		}
+	}
+	m.jwt, m.refreshToken, m.session, m.cache = "", "", nil, nil
+	m.crypto.Lock()
+}
+
+// LockKey - стирание закрытого ключа из памяти без выхода с сервера. Ключ защищен своей блокировкой,
+// поэтому метод можно вызывать из другой горутины, пока идет запрос; полная блокировка - Lock.
+func (m *Manager) LockKey() {
+	m.crypto.Lock()
+}
+
+// authorized - проверка, что вход выполнен и хранилище открыто.
+func (m *Manager) authorized() error {
+	if m.jwt == "" {
+		fmt.Printf("Unauthorized")
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
+
+// downloadKey - получение хранилища с сервера. Если на сервере хранилища нет, возвращает nil.
+func (m *Manager) downloadKey() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, m.url+m.config.Addr+"/api/keys", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to get vault: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var k model.SealedKey
+	if err = json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	return k.Key, nil
+}
+
+// uploadKey - отправка хранилища этого устройства на сервер. Если хранилище не отправилось, оно отправится
+// при следующем входе с этого устройства: хранилище на сервере не откроется паролем (см. unlock).
+// Ключ, который отличается от ключа на сервере, не отправляется.
+func (m *Manager) uploadKey() error {
+	if m.keyMismatch {
+		return nil
+	}
+	content, err := m.crypto.Vault(m.login)
+	if err != nil {
+		return fmt.Errorf("failed to read vault: %w", err)
+	}
+	kByte, err := json.Marshal(model.SealedKey{Key: content})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, m.url+m.config.Addr+"/api/keys", bytes.NewBuffer(kByte))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to save vault: %s", resp.Status)
+	}
+	return nil
+}
@@ -2,13 +2,19 @@
 //т.к. на сервере такие же структуры данных.
 package model
 
-import "crypto/rsa"
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"time"
+)
 
 // User - структура пользователя.
 type User struct {
 	UID      string `json:"uid"`
 	Login    string `json:"login"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	AuthKey  string `json:"auth_key,omitempty"`
+	Device   string `json:"device,omitempty"`
 }
 
 // Card - структура карты.
@@ -48,35 +54,132 @@ type Data struct {
 
 //KeyAndToken - структура получения ключа шифрования и токена авторизации от сервера.
 type KeyAndToken struct {
-	Key   *rsa.PublicKey `json:"key"`
-	Token string         `json:"token"`
+	Key          *rsa.PublicKey `json:"key"`
+	Token        string         `json:"token"`
+	RefreshToken string         `json:"refresh_token"`
 }
 
-//CryptoPassword - структура зашифрованной пары логина/пароля
+//Session - структура сессии, одного входа пользователя с устройства.
+type Session struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
+//TwoFactorSetup - структура ответа на подключение двухфакторной аутентификации.
+type TwoFactorSetup struct {
+	URI           string   `json:"uri"`
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+//TwoFactorRequest - структура кода второго фактора. Challenge и Device заполняются при входе.
+type TwoFactorRequest struct {
+	Challenge string `json:"challenge,omitempty"`
+	Code      string `json:"code"`
+	Device    string `json:"device,omitempty"`
+}
+
+//Challenge - структура ответа на вход, когда пароль верный, но нужен второй фактор.
+type Challenge struct {
+	Challenge string `json:"challenge"`
+}
+
+//ChangePassword - структура запроса смены мастер-пароля. В полях отправляются ключи аутентификации, а не пароли.
+type ChangePassword struct {
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+//SealedKey - закрытый ключ, зашифрованный ключом из мастер-пароля, для хранения на сервере.
+type SealedKey struct {
+	Key       []byte    `json:"key"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+//ItemBatch - все записи пользователя, перешифрованные новым ключом, вместе с новым зашифрованным ключом.
+//В Items записи видов, добавленных на сервере, кроме встроенных.
+type ItemBatch struct {
+	Cards     []CryptoCard       `json:"cards"`
+	Passwords []CryptoPassword   `json:"passwords"`
+	Texts     []CryptoTextData   `json:"texts"`
+	Binaries  []CryptoBinaryData `json:"binaries"`
+	Items     []Item             `json:"items,omitempty"`
+	Key       []byte             `json:"key"`
+}
+
+//RefreshRequest - структура запроса обновления токенов и выхода.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+//ItemMeta - общие поля всех записей. Title, URL, Notes и Tags шифруются вместе с записью, в Tags метки через запятую.
+//Favorite сервер хранит открыто, а время создания и изменения ставит сам.
+type ItemMeta struct {
+	Title     []byte    `json:"title,omitempty"`
+	URL       []byte    `json:"url,omitempty"`
+	Notes     []byte    `json:"notes,omitempty"`
+	Tags      []byte    `json:"tags,omitempty"`
+	Favorite  bool      `json:"favorite,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+//CryptoPassword - структура зашифрованной пары логина/пароля.
+//Version во всех записях - версия записи на сервере, при изменении и удалении сервер сверяет ее со своей.
 type CryptoPassword struct {
-	UID   int    `json:"uid_pass"`
-	Login []byte `json:"data_pass"`
-	Pass  []byte `json:"pass"`
+	UID     int    `json:"uid_pass"`
+	Login   []byte `json:"data_pass"`
+	Pass    []byte `json:"pass"`
+	Version int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 //CryptoBinaryData - структура зашифрованных бинарных данных.
 type CryptoBinaryData struct {
-	UID  int    `json:"uid_binary"`
-	Data []byte `json:"data"`
+	UID     int    `json:"uid_binary"`
+	Data    []byte `json:"data"`
+	Version int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 //CryptoTextData - структура зашифрованных текстовых данных.
 type CryptoTextData struct {
-	UID  int    `json:"uid_text"`
-	Text []byte `json:"text"`
+	UID     int    `json:"uid_text"`
+	Text    []byte `json:"text"`
+	Version int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 //CryptoCard - структура зашифрованных карт.
 type CryptoCard struct {
-	UID    int    `json:"UID"`
-	Name   []byte `json:"name"`
-	Number []byte `json:"number"`
-	CVC    []byte `json:"cvc"`
+	UID     int    `json:"UID"`
+	Name    []byte `json:"name"`
+	Number  []byte `json:"number"`
+	CVC     []byte `json:"cvc"`
+	Version int64  `json:"version,omitempty"`
+	ItemMeta
+}
+
+//Item - зашифрованная запись вида, добавленного на сервере (см. ItemKind). Payload шифруется целиком,
+//сервер его не разбирает.
+type Item struct {
+	Type     string `json:"type"`
+	UID      int    `json:"uid"`
+	Payload  []byte `json:"payload"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
+}
+
+//ItemKind - вид записей на сервере. Записи встроенных видов хранятся в своих структурах (CryptoCard и другие).
+type ItemKind struct {
+	Name    string `json:"name"`
+	Builtin bool   `json:"builtin"`
 }
 
 //CryptoData - общая структура всех зашифрованных данных.
@@ -86,3 +189,31 @@ type CryptoData struct {
 	TextData   []CryptoTextData   `json:"data_text"`
 	BinaryData []CryptoBinaryData `json:"data_binary"`
 }
+
+//HistoryEntry - прежняя версия записи. Item - запись в том виде, в каком она была сохранена, то есть зашифрованной.
+type HistoryEntry struct {
+	Type      string          `json:"type"`
+	UID       int             `json:"uid"`
+	Version   int64           `json:"version"`
+	ChangedAt time.Time       `json:"changed_at"`
+	Item      json.RawMessage `json:"item"`
+}
+
+//HistorySettings - глубина истории записей пользователя, 0 - история не хранится.
+type HistorySettings struct {
+	Depth int `json:"depth"`
+}
+
+//TrashEntry - удаленная запись в корзине на сервере. Item - запись, зашифрованная.
+type TrashEntry struct {
+	Type      string          `json:"type"`
+	UID       int             `json:"uid"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	Item      json.RawMessage `json:"item"`
+}
+
+//RestoreRequest - структура запроса восстановления записи из версии From. Version - текущая версия записи.
+type RestoreRequest struct {
+	From    int64 `json:"from"`
+	Version int64 `json:"version,omitempty"`
+}
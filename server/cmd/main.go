@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/CyrilSbrodov/passManager.git/server/internal/app"
 )
@@ -13,6 +15,7 @@ var (
 )
 
 // main функция сборки и запуска сервера.
+// Подкоманда migrate (srv [флаги] migrate up|down|version) управляет схемой базы и завершает работу.
 func main() {
 	if buildDate == "" {
 		buildDate = "N/A"
@@ -26,5 +29,12 @@ func main() {
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
 	srv := app.NewServerApp()
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := srv.Migrate(args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	srv.Run()
 }
@@ -3,20 +3,27 @@ package app
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/jwtauth"
 
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/crypto"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/handlers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/storage/repositories"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
 	"github.com/CyrilSbrodov/passManager.git/server/pkg/client/postgres"
 )
 
@@ -31,7 +38,16 @@ type ServerApp struct {
 // NewServerApp - функция создания нового сервера.
 func NewServerApp() *ServerApp {
 	cfg := config.ConfigInit()
+	flag.Parse()
 	logger := loggers.NewLogger()
+	if err := cfg.ParseEnv(); err != nil {
+		logger.LogErr(err, "failed to parse env")
+		os.Exit(1)
+	}
+	if err := registerItemKinds(cfg.ItemKinds); err != nil {
+		logger.LogErr(err, "failed to register item kinds")
+		os.Exit(1)
+	}
 	router := chi.NewRouter()
 	c := crypto.NewRSA(*cfg)
 
@@ -45,19 +61,17 @@ func NewServerApp() *ServerApp {
 
 // Run - функция запуска сервера.
 func (a *ServerApp) Run() {
-	client, err := postgres.NewClient(context.Background(), 5, a.cfg, a.logger)
+	store, err := a.newStorage()
 	if err != nil {
 		a.logger.LogErr(err, "")
 		os.Exit(1)
 	}
-	store, err := repositories.NewStore(client, a.cfg, a.logger)
+	tokens, err := auth.NewManager(a.cfg)
 	if err != nil {
-		a.logger.LogErr(err, "")
+		a.logger.LogErr(err, "failed to create token manager")
 		os.Exit(1)
 	}
-	var tokenAuth *jwtauth.JWTAuth
-	tokenAuth = jwtauth.New("HS256", []byte("secret"), nil)
-	handler := handlers.NewHandler(store, a.logger, a.crypto, tokenAuth)
+	handler := handlers.NewHandler(store, a.logger, a.crypto, tokens, a.cfg)
 
 	//регистрация хендлера
 	handler.Register(a.router)
@@ -69,6 +83,13 @@ func (a *ServerApp) Run() {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	purged := make(chan struct{})
+	go func() {
+		a.purgeTrash(purgeCtx, store)
+		close(purged)
+	}()
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			a.logger.LogErr(err, "server not started")
@@ -89,5 +110,90 @@ func (a *ServerApp) Run() {
 	if err = srv.Shutdown(ctx); err != nil {
 		a.logger.LogErr(err, "Server Shutdown Failed")
 	}
+	//хранилище закрывается только после того, как удаление из корзины остановилось
+	stopPurge()
+	<-purged
+	if closer, ok := store.(io.Closer); ok {
+		if err = closer.Close(); err != nil {
+			a.logger.LogErr(err, "failed to close storage")
+		}
+	}
 	a.logger.LogInfo("", "", "Server Exited Properly")
 }
+
+// registerItemKinds - регистрация видов записей из конфига, перечисленных через запятую, в дополнение к встроенным.
+func registerItemKinds(kinds string) error {
+	for _, name := range strings.Split(kinds, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := models.RegisterItemKind(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newStorage - функция создания хранилища по выбранному в конфиге драйверу.
+func (a *ServerApp) newStorage() (storage.Storage, error) {
+	switch a.cfg.StorageDriver {
+	case config.StoragePostgres:
+		client, err := postgres.NewClient(context.Background(), 5, a.cfg, a.logger)
+		if err != nil {
+			return nil, err
+		}
+		return repositories.NewStore(client, a.cfg, a.logger)
+	case config.StorageMemory:
+		return repositories.NewMemStore(a.cfg, a.logger), nil
+	case config.StorageFile:
+		return repositories.NewFileStore(a.cfg, a.logger)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %s", a.cfg.StorageDriver)
+	}
+}
+
+// Migrate - функция выполнения подкоманды migrate: up [версия], down [шагов], version.
+func (a *ServerApp) Migrate(args []string) error {
+	if a.cfg.StorageDriver != config.StoragePostgres {
+		return fmt.Errorf("migrations are supported only by %s storage driver", config.StoragePostgres)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up [version] | down [steps] | version")
+	}
+	n := 0
+	if len(args) > 1 {
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("wrong number %s: %w", args[1], err)
+		}
+	}
+	ctx := context.Background()
+	client, err := postgres.NewClient(ctx, 5, a.cfg, a.logger)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	migrator, err := repositories.NewMigrator(client, a.logger)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx, n)
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		return migrator.Down(ctx, n)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version: %d\nLatest version: %d\n", version, migrator.Latest())
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %s", args[0])
+	}
+}
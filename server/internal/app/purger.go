@@ -0,0 +1,34 @@
+// Package app пакет позволяет собрать сервер и запустить его.
+// Данный модуль периодически удаляет из корзины записи, которые лежат в ней дольше срока хранения.
+package app
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+)
+
+// purgeTrash - окончательное удаление записей, удаленных раньше, чем cfg.TrashRetention назад, сразу после запуска
+// и затем каждые cfg.TrashPurgeEvery до отмены ctx. Нулевой срок хранения или интервал отключают удаление.
+func (a *ServerApp) purgeTrash(ctx context.Context, store storage.Storage) {
+	if a.cfg.TrashRetention <= 0 || a.cfg.TrashPurgeEvery <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.cfg.TrashPurgeEvery)
+	defer ticker.Stop()
+	for {
+		n, err := store.PurgeTrash(time.Now().Add(-a.cfg.TrashRetention))
+		if err != nil {
+			a.logger.LogErr(err, "failed to purge trash")
+		} else if n > 0 {
+			a.logger.LogInfo("items removed from trash:", strconv.Itoa(n), "trash purged")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
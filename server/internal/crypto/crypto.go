@@ -1,3 +1,5 @@
+// Package crypto пакет ключа сервера. Ключ хранится в файле и не меняется между запусками,
+// им подписываются ответы сервера (см. signature.go), чтобы клиент мог проверить, что данные не подменены.
 package crypto
 
 import (
@@ -5,9 +7,12 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"math/big"
 	"net"
 	"os"
@@ -17,31 +22,39 @@ import (
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
 )
 
+// Crypto - интерфейс ключа сервера.
 type Crypto interface {
 	DecryptedData(b []byte, privateKey *rsa.PrivateKey) ([]byte, error)
 	EncryptedData(b []byte, publicKey *rsa.PublicKey) ([]byte, error)
 	LoadPrivatePEMKey(filename string) (*rsa.PrivateKey, error)
 	LoadPublicPEMKey(filename string) (*rsa.PublicKey, error)
+	Sign(b []byte) ([]byte, error)
 }
 
+// RSA - ключ сервера.
 type RSA struct {
 	logger  *loggers.Logger
 	Private *rsa.PrivateKey
 	Public  *rsa.PublicKey
 }
 
+// NewRSA - функция загрузки ключа сервера. Ключ создается только при первом запуске, если файла ключа еще нет:
+// клиенты запоминают открытый ключ и не примут ответы, подписанные другим ключом.
 func NewRSA(cfg config.Config) *RSA {
 	logger := loggers.NewLogger()
-	private, public, err := addCryptoKey("public.pem", cfg.CryptoPROKey, cfg.CryptoPROKeyPath, logger)
+	r := &RSA{logger: logger}
+	private, err := r.LoadPrivatePEMKey(cfg.CryptoPROKeyPath + cfg.CryptoPROKey)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.LogInfo("server key not found, generating new:", cfg.CryptoPROKeyPath+cfg.CryptoPROKey, "")
+		private, _, err = addCryptoKey("public.pem", cfg.CryptoPROKey, cfg.CryptoPROKeyPath, logger)
+	}
 	if err != nil {
-		logger.LogErr(err, "")
+		logger.LogErr(err, "failed to load server key")
 		os.Exit(1)
 	}
-	return &RSA{
-		logger:  logger,
-		Private: private,
-		Public:  public,
-	}
+	r.Private = private
+	r.Public = &private.PublicKey
+	return r
 }
 
 func addCryptoKey(filenamePublicKey, filenamePrivateKey, path string, logger *loggers.Logger) (*rsa.PrivateKey, *rsa.PublicKey, error) {
@@ -73,12 +86,14 @@ func addCryptoKey(filenamePublicKey, filenamePrivateKey, path string, logger *lo
 	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
 	if err != nil {
 		logger.LogErr(err, "")
+		return nil, nil, err
 	}
 
 	// создаём сертификат x.509
 	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, &privateKey.PublicKey, privateKey)
 	if err != nil {
 		logger.LogErr(err, "")
+		return nil, nil, err
 	}
 
 	// кодируем сертификат и ключ в формате PEM, который
@@ -117,7 +132,8 @@ func addCryptoKey(filenamePublicKey, filenamePrivateKey, path string, logger *lo
 }
 
 func createNewCryptoFile(PEM bytes.Buffer, filename, path string, logger *loggers.Logger) error {
-	file, err := os.OpenFile(path+filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	//закрытый ключ доступен только владельцу процесса
+	file, err := os.OpenFile(path+filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		logger.LogErr(err, "failed to open/create file")
 		return err
@@ -132,22 +148,79 @@ func createNewCryptoFile(PEM bytes.Buffer, filename, path string, logger *logger
 	return nil
 }
 
+// DecryptedData - расшифровка данных закрытым ключом (RSA-OAEP, SHA-256).
 func (r *RSA) DecryptedData(b []byte, privateKey *rsa.PrivateKey) ([]byte, error) {
-	//TODO implement me
-	panic("implement me")
+	if privateKey == nil {
+		return nil, ErrNoKey
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, b, nil)
 }
 
+// EncryptedData - шифрование данных открытым ключом (RSA-OAEP, SHA-256).
 func (r *RSA) EncryptedData(b []byte, publicKey *rsa.PublicKey) ([]byte, error) {
-	//TODO implement me
-	panic("implement me")
+	if publicKey == nil {
+		return nil, ErrNoKey
+	}
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, b, nil)
 }
 
+// LoadPrivatePEMKey - загрузка закрытого ключа RSA из PEM файла в формате PKCS #1 или PKCS #8.
 func (r *RSA) LoadPrivatePEMKey(filename string) (*rsa.PrivateKey, error) {
-	//TODO implement me
-	panic("implement me")
+	block, err := loadPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an RSA key", filename)
+		}
+		return private, nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %s", filename, block.Type)
+	}
 }
 
+// LoadPublicPEMKey - загрузка открытого ключа RSA из PEM файла в формате PKCS #1 или PKIX.
 func (r *RSA) LoadPublicPEMKey(filename string) (*rsa.PublicKey, error) {
-	//TODO implement me
-	panic("implement me")
+	block, err := loadPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: not an RSA key", filename)
+		}
+		return public, nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %s", filename, block.Type)
+	}
+}
+
+// loadPEM - чтение первого PEM блока из файла.
+func loadPEM(filename string) (*pem.Block, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", filename)
+	}
+	return block, nil
 }
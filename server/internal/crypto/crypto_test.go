@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+)
+
+func TestNewRSA_Persistent(t *testing.T) {
+	cfg := config.Config{CryptoPROKey: "private.pem", CryptoPROKeyPath: t.TempDir() + "/"}
+	first := NewRSA(cfg)
+	info, err := os.Stat(cfg.CryptoPROKeyPath + cfg.CryptoPROKey)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	//при следующем запуске ключ загружается, а не создается заново
+	second := NewRSA(cfg)
+	assert.True(t, first.Private.Equal(second.Private))
+	public, err := second.LoadPublicPEMKey(cfg.CryptoPROKeyPath + "public.pem")
+	assert.NoError(t, err)
+	assert.True(t, public.Equal(second.Public))
+}
+
+func TestRSA_LoadPEMKey(t *testing.T) {
+	dir := t.TempDir() + "/"
+	r := &RSA{}
+	_, err := r.LoadPrivatePEMKey(dir + "missing.pem")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	assert.NoError(t, os.WriteFile(dir+"bad.pem", []byte("not a key"), 0600))
+	_, err = r.LoadPrivatePEMKey(dir + "bad.pem")
+	assert.Error(t, err)
+	_, err = r.LoadPublicPEMKey(dir + "bad.pem")
+	assert.Error(t, err)
+}
+
+func TestRSA_EncryptSign(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	r := &RSA{Private: private, Public: &private.PublicKey}
+
+	encrypted, err := r.EncryptedData([]byte("data"), r.Public)
+	assert.NoError(t, err)
+	decrypted, err := r.DecryptedData(encrypted, r.Private)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), decrypted)
+
+	msg := ResponseMessage("GET", "/api/data/text", "nonce", 200, []byte("body"))
+	sign, err := r.Sign(msg)
+	assert.NoError(t, err)
+	digest := sha256.Sum256(msg)
+	assert.NoError(t, rsa.VerifyPSS(r.Public, crypto.SHA256, digest[:], sign, nil))
+	//подпись не подходит к другому запросу
+	other := sha256.Sum256(ResponseMessage("GET", "/api/data/text", "other", 200, []byte("body")))
+	assert.Error(t, rsa.VerifyPSS(r.Public, crypto.SHA256, other[:], sign, nil))
+
+	_, err = (&RSA{}).Sign(msg)
+	assert.ErrorIs(t, err, ErrNoKey)
+}
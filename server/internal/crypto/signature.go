@@ -0,0 +1,62 @@
+// Package crypto пакет ключа сервера.
+// Данный модуль подписывает ответы сервера. Подпись связывает тело ответа с запросом, на который он отправлен:
+// методом, путем, статусом и случайным значением клиента, поэтому прокси не может подменить данные
+// или отправить старый ответ на другой запрос.
+package crypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Заголовки подписи ответа.
+const (
+	HeaderNonce     = "X-Request-Nonce" // Случайное значение клиента, передается в запросе.
+	HeaderSignature = "X-Signature"     // Подпись ответа, base64.
+	HeaderServerKey = "X-Server-Key"    // Открытый ключ сервера в формате PKIX, base64.
+)
+
+// ErrNoKey - ключ сервера не загружен.
+var ErrNoKey = errors.New("server key is not loaded")
+
+// Sign - подпись данных закрытым ключом сервера (RSA-PSS, SHA-256).
+func (r *RSA) Sign(b []byte) ([]byte, error) {
+	if r.Private == nil {
+		return nil, ErrNoKey
+	}
+	digest := sha256.Sum256(b)
+	return rsa.SignPSS(rand.Reader, r.Private, crypto.SHA256, digest[:], nil)
+}
+
+// EncodedPublic - открытый ключ сервера для заголовка HeaderServerKey.
+func (r *RSA) EncodedPublic() (string, error) {
+	if r.Public == nil {
+		return "", ErrNoKey
+	}
+	der, err := x509.MarshalPKIXPublicKey(r.Public)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// ResponseMessage - подписываемое сообщение ответа. Клиент собирает такое же сообщение для проверки подписи.
+func ResponseMessage(method, uri, nonce string, status int, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		"passManager response v1",
+		method,
+		uri,
+		nonce,
+		strconv.Itoa(status),
+		hex.EncodeToString(digest[:]),
+	}, "\n"))
+}
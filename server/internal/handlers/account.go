@@ -0,0 +1,113 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль позволяет сменить мастер-пароль и удалить аккаунт.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+)
+
+// ChangePassword - эндпоинт смены мастер-пароля. Требует текущий пароль, остальные сессии пользователя отзываются.
+// Неверный пароль учитывается как неудачная попытка входа.
+func (h *Handler) ChangePassword() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		claims := r.Context().Value("claims").(*auth.Claims)
+		var req models.ChangePassword
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if req.Password == "" || req.NewPassword == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("password or new password is empty"))
+			return
+		}
+		login, ok := h.accountLogin(rw, userID)
+		if !ok {
+			return
+		}
+
+		statusCode, err := h.Storage.ChangePassword(userID, req.Password, req.NewPassword, claims.SessionID)
+		switch statusCode {
+		case http.StatusForbidden:
+			h.loginFailed(login)
+		case http.StatusOK:
+			h.loginSucceeded(login)
+		}
+		h.accountStatus(rw, statusCode, err)
+	}
+}
+
+// DeleteAccount - эндпоинт удаления аккаунта со всеми данными. Требует текущий пароль или ключ аутентификации.
+func (h *Handler) DeleteAccount() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var u models.User
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &u); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		//клиенты с ключом аутентификации подтверждают удаление ключом
+		secret := u.AuthKey
+		if secret == "" {
+			secret = u.Password
+		}
+		if secret == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("password is empty"))
+			return
+		}
+		login, ok := h.accountLogin(rw, userID)
+		if !ok {
+			return
+		}
+
+		statusCode, err := h.Storage.DeleteAccount(userID, secret)
+		if statusCode == http.StatusForbidden {
+			h.loginFailed(login)
+		}
+		h.accountStatus(rw, statusCode, err)
+	}
+}
+
+// accountStatus - ответ на изменение аккаунта по статусу репозитория.
+func (h *Handler) accountStatus(rw http.ResponseWriter, statusCode int, err error) {
+	switch statusCode {
+	case http.StatusForbidden:
+		rw.WriteHeader(http.StatusForbidden)
+		rw.Write([]byte(err.Error()))
+		return
+	case http.StatusNotFound:
+		//аккаунт уже удален, токен больше ничего не дает
+		rw.WriteHeader(http.StatusUnauthorized)
+		rw.Write([]byte(err.Error()))
+		return
+	case http.StatusInternalServerError:
+		h.logger.LogErr(err, "failed to change account")
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
 )
 
+// CollectCards - эндпоинт добавления карты. В ответе сохраненная запись с идентификатором и версией:
+// по идентификатору клиент находит запись, добавленную без связи с сервером.
 func (h *Handler) CollectCards() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		content, err := io.ReadAll(r.Body)
@@ -30,18 +32,7 @@ func (h *Handler) CollectCards() http.HandlerFunc {
 		userID := r.Context().Value("user_id").(string)
 
 		statusCode, err := h.Storage.CollectCard(&c, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusOK)
-			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
-			return
-		}
+		h.writeItem(rw, statusCode, err, &c, c.Version)
 	}
 }
 
@@ -95,19 +86,15 @@ func (h *Handler) DeleteCards() http.HandlerFunc {
 		defer r.Body.Close()
 		userID := r.Context().Value("user_id").(string)
 
+		if !checkVersion(rw, r, &data.Version) {
+			return
+		}
 		statusCode, err := h.Storage.DeleteCard(&data, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
+		if statusCode == http.StatusOK {
 			rw.WriteHeader(http.StatusOK)
 			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
-			return
 		}
+		h.writeItem(rw, statusCode, err, &data, data.Version)
 	}
 }
 
@@ -131,18 +118,10 @@ func (h *Handler) UpdateCards() http.HandlerFunc {
 		defer r.Body.Close()
 		userID := r.Context().Value("user_id").(string)
 
-		statusCode, err := h.Storage.UpdateCard(&c, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusOK)
-			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
+		if !checkVersion(rw, r, &c.Version) {
 			return
 		}
+		statusCode, err := h.Storage.UpdateCard(&c, userID)
+		h.writeItem(rw, statusCode, err, &c, c.Version)
 	}
 }
@@ -5,19 +5,21 @@ package handlers
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/jwtauth"
 
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/crypto"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
 	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/ratelimit"
 )
 
 // Handlers - интерфейс обработчика.
@@ -30,29 +32,74 @@ type Handler struct {
 	storage.Storage
 	crypto crypto.RSA
 	logger loggers.Logger
-	token  *jwtauth.JWTAuth
+	tokens *auth.Manager
+	cfg    *config.Config
+	//ограничители попыток входа, nil если ограничение выключено
+	ipLimiter    *ratelimit.Limiter
+	loginLimiter *ratelimit.Limiter
 }
 
 // NewHandler - функция создания нового обработчика.
-func NewHandler(storage storage.Storage, logger *loggers.Logger, c crypto.RSA, token *jwtauth.JWTAuth) Handlers {
-	return &Handler{
+func NewHandler(storage storage.Storage, logger *loggers.Logger, c crypto.RSA, tokens *auth.Manager, cfg *config.Config) Handlers {
+	h := &Handler{
 		Storage: storage,
 		crypto:  c,
 		logger:  *logger,
-		token:   token,
+		tokens:  tokens,
+		cfg:     cfg,
 	}
+	if cfg.LoginRatePerIP > 0 {
+		h.ipLimiter = ratelimit.PerMinute(cfg.LoginRatePerIP)
+	}
+	if cfg.LoginRatePerUser > 0 {
+		h.loginLimiter = ratelimit.PerMinute(cfg.LoginRatePerUser)
+	}
+	return h
 }
 
 // Register - функция регистрация различных эндпоинтов.
 func (h *Handler) Register(r *chi.Mux) {
 	compressor := middleware.NewCompressor(gzip.DefaultCompression)
 	r.Use(compressor.Handler)
+	//подпись считается по несжатому телу, поэтому перехватчик стоит после сжатия
+	r.Use(h.signResponse)
 	r.Group(func(r chi.Router) {
+		r.Use(h.rateLimit)
 		r.Post("/api/register", h.Registration())
 		r.Post("/api/login", h.Login())
+		r.Post("/api/login/2fa", h.LoginTwoFactor())
+	})
+	r.Group(func(r chi.Router) {
+		r.Get("/.well-known/jwks.json", h.JWKS())
+		r.Post("/api/token/refresh", h.RefreshToken())
 	})
 	r.Group(func(r chi.Router) {
 		r.Use(h.userIdentity)
+		r.Post("/api/logout", h.Logout())
+		r.Get("/api/sessions", h.GetSessions())
+		r.Delete("/api/sessions/{id}", h.RevokeSession())
+		r.Post("/api/2fa/enroll", h.TwoFactorEnroll())
+		r.Post("/api/2fa/confirm", h.TwoFactorConfirm())
+		r.Post("/api/2fa/disable", h.TwoFactorDisable())
+		//проверка текущего пароля ограничена так же, как вход
+		r.With(h.rateLimit).Post("/api/account/password", h.ChangePassword())
+		r.With(h.rateLimit).Delete("/api/account", h.DeleteAccount())
+		r.Get("/api/account/history", h.GetHistoryDepth())
+		r.Put("/api/account/history", h.SetHistoryDepth())
+		r.Get("/api/keys", h.GetKey())
+		r.Put("/api/keys", h.SaveKey())
+		r.Post("/api/keys/rotate", h.RotateItems())
+		r.Get("/api/sync", h.Sync())
+
+		r.Get("/api/items", h.ItemKinds())
+		r.Get("/api/items/{type}", h.GetItems())
+		r.Post("/api/items/{type}", h.CollectItem())
+		r.Put("/api/items/{type}/{id}", h.UpdateItem())
+		r.Delete("/api/items/{type}/{id}", h.DeleteItem())
+		r.Get("/api/items/{type}/{id}/history", h.GetHistory())
+		r.Post("/api/items/{type}/{id}/restore", h.RestoreItem())
+
+		//эндпоинты встроенных видов записей до /api/items, оставлены для совместимости со старыми клиентами
 		r.Post("/api/data/cards", h.CollectCards())
 		r.Post("/api/data/text", h.CollectText())
 		r.Post("/api/data/password", h.CollectPassword())
@@ -72,6 +119,13 @@ func (h *Handler) Register(r *chi.Mux) {
 		r.Post("/api/data/update/text", h.UpdateText())
 		r.Post("/api/data/update/password", h.UpdatePassword())
 		r.Post("/api/data/update/binary", h.UpdateBinary())
+
+		r.Get("/api/data/{type}/{id}/history", h.GetHistory())
+		r.Post("/api/data/{type}/{id}/restore", h.RestoreItem())
+
+		r.Get("/api/trash", h.GetTrash())
+		r.Post("/api/trash/restore", h.RestoreTrash())
+		r.Delete("/api/trash", h.EmptyTrash())
 	})
 }
 
@@ -91,7 +145,7 @@ func (h *Handler) Registration() http.HandlerFunc {
 			rw.Write([]byte(err.Error()))
 			return
 		}
-		if u.Login == "" || u.Password == "" {
+		if u.Login == "" || (u.Password == "" && u.AuthKey == "") {
 			rw.WriteHeader(http.StatusBadRequest)
 			err = fmt.Errorf("login or password is empty")
 			rw.Write([]byte(err.Error()))
@@ -105,16 +159,13 @@ func (h *Handler) Registration() http.HandlerFunc {
 			rw.Write([]byte(err.Error()))
 			return
 		}
-		token, err := auth.GenerateToken(id)
+		sender, err := h.newSession(id, u.Device, r)
 		if err != nil {
 			h.logger.LogErr(err, "error")
 			rw.WriteHeader(http.StatusUnauthorized)
 			rw.Write([]byte(err.Error()))
 			return
 		}
-		var sender models.KeyAndToken
-		sender.Key = h.crypto.Public
-		sender.Token = token
 
 		send, err := json.Marshal(sender)
 		if err != nil {
@@ -127,7 +178,8 @@ func (h *Handler) Registration() http.HandlerFunc {
 	}
 }
 
-// Login - эндпоинт аутентификации.
+// Login - эндпоинт аутентификации. Аккаунт, созданный до ключей аутентификации, получает статус
+// http.StatusUpgradeRequired, если клиент прислал только ключ: тогда клиент один раз отправляет пароль вместе с ключом.
 func (h *Handler) Login() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		var u models.User
@@ -145,21 +197,43 @@ func (h *Handler) Login() http.HandlerFunc {
 			return
 		}
 
-		if u.Login == "" || u.Password == "" {
+		if u.Login == "" || (u.Password == "" && u.AuthKey == "") {
 			rw.WriteHeader(http.StatusBadRequest)
 			err = fmt.Errorf("login or password is empty")
 			rw.Write([]byte(err.Error()))
 			return
 		}
 
+		if h.loginLocked(rw, u.Login) {
+			return
+		}
 		id, err := h.Storage.Login(&u)
+		if errors.Is(err, storage.ErrAuthUpgrade) {
+			//пароль еще не проверялся, поэтому попытка не считается неудачной
+			rw.WriteHeader(http.StatusUpgradeRequired)
+			rw.Write([]byte(err.Error()))
+			return
+		}
 		if err != nil {
 			h.logger.LogErr(err, "wrong password or login")
+			h.loginFailed(u.Login)
 			rw.WriteHeader(http.StatusUnauthorized)
 			rw.Write([]byte(err.Error()))
 			return
 		}
-		token, err := auth.GenerateToken(id)
+		//при включенном втором факторе вместо токенов выдается токен для ввода кода
+		t, err := h.Storage.GetTOTP(id)
+		if err != nil {
+			h.logger.LogErr(err, "failed to get two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if t.Enabled {
+			h.requireSecondFactor(rw, id)
+			return
+		}
+		h.loginSucceeded(u.Login)
+		sender, err := h.newSession(id, u.Device, r)
 		if err != nil {
 			h.logger.LogErr(err, "error")
 			rw.WriteHeader(http.StatusUnauthorized)
@@ -167,10 +241,6 @@ func (h *Handler) Login() http.HandlerFunc {
 			return
 		}
 
-		var sender models.KeyAndToken
-		sender.Key = h.crypto.Public
-		sender.Token = token
-
 		send, err := json.Marshal(sender)
 		if err != nil {
 			fmt.Println(err)
@@ -182,3 +252,20 @@ func (h *Handler) Login() http.HandlerFunc {
 		rw.Write(send)
 	}
 }
+
+// JWKS - эндпоинт открытых ключей проверки токенов, чтобы другие сервисы могли проверять токены сами.
+func (h *Handler) JWKS() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		send, err := json.Marshal(struct {
+			Keys []auth.JWK `json:"keys"`
+		}{Keys: h.tokens.PublicKeys()})
+		if err != nil {
+			h.logger.LogErr(err, "failed to marshal keys")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(send)
+	}
+}
@@ -3,39 +3,61 @@ package handlers
 import (
 	"bytes"
 	"context"
+	stdcrypto "crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/crypto"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/mocks"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/storage/repositories"
-	"github.com/CyrilSbrodov/passManager.git/server/pkg/client/postgres"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/totp"
 )
 
 var (
-	CFG config.Config
+	CFG    config.Config
+	TOKENS *auth.Manager
 )
 
 func TestMain(m *testing.M) {
 	cfg := config.ConfigInit()
 	CFG = *cfg
+	//дешевые параметры хэширования, чтобы тесты не тратили время и память на argon2id
+	CFG.Argon2Time = 1
+	CFG.Argon2Memory = 64
+	//ключа подписи по умолчанию нет, сервер без него не запускается
+	CFG.SessionKey = "handler-test-secret-0123456789abcdef"
+	tokens, err := auth.NewManager(&CFG)
+	if err != nil {
+		panic(err)
+	}
+	TOKENS = tokens
 	os.Exit(m.Run())
 }
 
-func newRepo() *repositories.Store {
+func newRepo() *repositories.MemStore {
 	logger := loggers.NewLogger()
-	client, _ := postgres.NewClient(context.Background(), 5, &CFG, logger)
-	repo, _ := repositories.NewStore(client, &CFG, logger)
-	return repo
+	return repositories.NewMemStore(&CFG, logger)
 }
 
 func TestHandler_Registration(t *testing.T) {
@@ -76,6 +98,7 @@ func TestHandler_Registration(t *testing.T) {
 			h := &Handler{
 				Storage: s,
 				logger:  *logger,
+				tokens:  TOKENS,
 			}
 
 			bodyJSON, err := json.Marshal(tt.body)
@@ -84,6 +107,8 @@ func TestHandler_Registration(t *testing.T) {
 			rec := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodPost, "/api/register", bytes.NewBuffer(bodyJSON))
 			s.EXPECT().Register(gomock.Any()).Return(tt.answerID, tt.answerError)
+			s.EXPECT().CreateSession(gomock.Any(), "1").Return(nil).AnyTimes()
+			s.EXPECT().SaveRefreshToken(gomock.Any()).Return(nil).AnyTimes()
 			h.Registration().ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -119,6 +144,26 @@ func TestHandler_Login(t *testing.T) {
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusUnauthorized,
 		},
+		{
+			name: "Test auth key ok",
+			body: models.User{
+				Login:   "test",
+				AuthKey: "key",
+			},
+			answerID:     "1",
+			answerError:  nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name: "Test 426",
+			body: models.User{
+				Login:   "test",
+				AuthKey: "key",
+			},
+			answerID:     "",
+			answerError:  storage.ErrAuthUpgrade,
+			expectedCode: http.StatusUpgradeRequired,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -129,6 +174,7 @@ func TestHandler_Login(t *testing.T) {
 			h := &Handler{
 				Storage: s,
 				logger:  *logger,
+				tokens:  TOKENS,
 			}
 
 			bodyJSON, err := json.Marshal(tt.body)
@@ -137,6 +183,9 @@ func TestHandler_Login(t *testing.T) {
 			rec := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodPost, "/api/login", bytes.NewBuffer(bodyJSON))
 			s.EXPECT().Login(gomock.Any()).Return(tt.answerID, tt.answerError)
+			s.EXPECT().GetTOTP("1").Return(&models.TOTP{}, nil).AnyTimes()
+			s.EXPECT().CreateSession(gomock.Any(), "1").Return(nil).AnyTimes()
+			s.EXPECT().SaveRefreshToken(gomock.Any()).Return(nil).AnyTimes()
 			h.Login().ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
@@ -192,10 +241,20 @@ func TestHandler_CollectCards(t *testing.T) {
 			rec := httptest.NewRecorder()
 			req, _ := http.NewRequest(http.MethodPost, "/api/data/cards", bytes.NewBuffer(bodyJSON))
 			req = req.WithContext(context.WithValue(context.Background(), "user_id", "1"))
-			s.EXPECT().CollectCard(gomock.Any(), gomock.Any()).Return(tt.answerCode, tt.answerError)
+			s.EXPECT().CollectCard(gomock.Any(), gomock.Any()).DoAndReturn(func(d *models.CryptoCard, id string) (int, error) {
+				d.UID, d.Version = 7, 1
+				return tt.answerCode, tt.answerError
+			})
 			h.CollectCards().ServeHTTP(rec, req)
 
 			assert.Equal(t, tt.expectedCode, rec.Code)
+			if tt.expectedCode == http.StatusOK {
+				//в ответе запись с идентификатором, который ей присвоил сервер
+				var saved models.CryptoCard
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+				assert.Equal(t, 7, saved.UID)
+				assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+			}
 		})
 	}
 }
@@ -263,9 +322,10 @@ func TestHandler_UpdateCards(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoCard{
-				Name:   []byte("test"),
-				Number: []byte("123456"),
-				CVC:    []byte("123"),
+				Name:    []byte("test"),
+				Number:  []byte("123456"),
+				CVC:     []byte("123"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -274,14 +334,29 @@ func TestHandler_UpdateCards(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoCard{
-				Name:   []byte("test"),
-				Number: []byte("1234256"),
-				CVC:    []byte("123"),
+				Name:    []byte("test"),
+				Number:  []byte("1234256"),
+				CVC:     []byte("123"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoCard{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoCard{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -319,10 +394,11 @@ func TestHandler_DeleteCards(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoCard{
-				UID:    1,
-				Name:   []byte("test"),
-				Number: []byte("123456"),
-				CVC:    []byte("123"),
+				UID:     1,
+				Name:    []byte("test"),
+				Number:  []byte("123456"),
+				CVC:     []byte("123"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -331,14 +407,29 @@ func TestHandler_DeleteCards(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoCard{
-				Name:   []byte("test"),
-				Number: []byte("1234256"),
-				CVC:    []byte("123"),
+				Name:    []byte("test"),
+				Number:  []byte("1234256"),
+				CVC:     []byte("123"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoCard{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoCard{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -481,8 +572,9 @@ func TestHandler_UpdatePassword(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoPassword{
-				Login: []byte("test"),
-				Pass:  []byte("123456"),
+				Login:   []byte("test"),
+				Pass:    []byte("123456"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -491,13 +583,28 @@ func TestHandler_UpdatePassword(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoPassword{
-				Login: []byte("test"),
-				Pass:  []byte("1234256"),
+				Login:   []byte("test"),
+				Pass:    []byte("1234256"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoPassword{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoPassword{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -535,9 +642,10 @@ func TestHandler_DeletePassword(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoPassword{
-				UID:   1,
-				Login: []byte("test"),
-				Pass:  []byte("123456"),
+				UID:     1,
+				Login:   []byte("test"),
+				Pass:    []byte("123456"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -546,13 +654,28 @@ func TestHandler_DeletePassword(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoPassword{
-				Login: []byte("test"),
-				Pass:  []byte("1234256"),
+				Login:   []byte("test"),
+				Pass:    []byte("1234256"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoPassword{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoPassword{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -692,7 +815,8 @@ func TestHandler_UpdateText(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoTextData{
-				Text: []byte("test"),
+				Text:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -701,12 +825,27 @@ func TestHandler_UpdateText(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoTextData{
-				Text: []byte("test"),
+				Text:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoTextData{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoTextData{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -744,8 +883,9 @@ func TestHandler_DeleteText(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoTextData{
-				UID:  1,
-				Text: []byte("test"),
+				UID:     1,
+				Text:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -754,12 +894,27 @@ func TestHandler_DeleteText(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoTextData{
-				Text: []byte("test"),
+				Text:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoTextData{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoTextData{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -899,7 +1054,8 @@ func TestHandler_UpdateBinary(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoBinaryData{
-				Data: []byte("test"),
+				Data:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -908,12 +1064,27 @@ func TestHandler_UpdateBinary(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoBinaryData{
-				Data: []byte("test"),
+				Data:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoBinaryData{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoBinaryData{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -951,8 +1122,9 @@ func TestHandler_DeleteBinary(t *testing.T) {
 		{
 			name: "Test ok",
 			body: models.CryptoBinaryData{
-				UID:  1,
-				Data: []byte("test"),
+				UID:     1,
+				Data:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   200,
 			answerError:  nil,
@@ -961,12 +1133,27 @@ func TestHandler_DeleteBinary(t *testing.T) {
 		{
 			name: "Test 500",
 			body: models.CryptoBinaryData{
-				Data: []byte("test"),
+				Data:    []byte("test"),
+				Version: 1,
 			},
 			answerCode:   500,
 			answerError:  errors.New("err"),
 			expectedCode: http.StatusInternalServerError,
 		},
+		{
+			name:         "Test 404",
+			body:         models.CryptoBinaryData{UID: 100, Version: 1},
+			answerCode:   404,
+			answerError:  storage.ErrItemNotFound,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "Test 409",
+			body:         models.CryptoBinaryData{UID: 1, Version: 1},
+			answerCode:   409,
+			answerError:  storage.ErrVersionConflict,
+			expectedCode: http.StatusConflict,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -992,3 +1179,972 @@ func TestHandler_DeleteBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_Storages(t *testing.T) {
+	fileStore, teardown := repositories.TestFileStore(t, CFG)
+	defer teardown()
+
+	tests := []struct {
+		name  string
+		store storage.Storage
+	}{
+		{
+			name:  "memory",
+			store: newRepo(),
+		},
+		{
+			name:  "file",
+			store: fileStore,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := loggers.NewLogger()
+			router := chi.NewRouter()
+			NewHandler(tt.store, logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+			srv := httptest.NewServer(router)
+			defer srv.Close()
+
+			bodyJSON, err := json.Marshal(models.User{Login: "test", Password: "123456"})
+			assert.NoError(t, err)
+			resp, err := http.Post(srv.URL+"/api/register", "application/json", bytes.NewBuffer(bodyJSON))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+
+			resp, err = http.Post(srv.URL+"/api/login", "application/json", bytes.NewBuffer(bodyJSON))
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var accept models.KeyAndToken
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&accept))
+			resp.Body.Close()
+
+			bodyJSON, err = json.Marshal(models.CryptoTextData{Text: []byte("text")})
+			assert.NoError(t, err)
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/data/text", bytes.NewBuffer(bodyJSON))
+			req.Header.Set("Authorization", "Bearer "+accept.Token)
+			resp, err = http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+
+			req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/data/text", nil)
+			req.Header.Set("Authorization", "Bearer "+accept.Token)
+			resp, err = http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			var texts []models.CryptoTextData
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&texts))
+			resp.Body.Close()
+			assert.Len(t, texts, 1)
+			assert.Equal(t, []byte("text"), texts[0].Text)
+		})
+	}
+}
+
+func TestHandler_RefreshToken(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         models.RefreshRequest
+		answerError  error
+		expectedCode int
+	}{
+		{
+			name:         "Test ok",
+			body:         models.RefreshRequest{RefreshToken: "token"},
+			answerError:  nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Test reused",
+			body:         models.RefreshRequest{RefreshToken: "token"},
+			answerError:  storage.ErrTokenReused,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Test expired",
+			body:         models.RefreshRequest{RefreshToken: "token"},
+			answerError:  storage.ErrTokenExpired,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "Test 500",
+			body:         models.RefreshRequest{RefreshToken: "token"},
+			answerError:  errors.New("err"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			s := mocks.NewMockStorage(ctrl)
+			logger := loggers.NewLogger()
+			h := &Handler{
+				Storage: s,
+				logger:  *logger,
+				tokens:  TOKENS,
+			}
+
+			bodyJSON, err := json.Marshal(tt.body)
+			assert.NoError(t, err)
+
+			rec := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/api/token/refresh", bytes.NewBuffer(bodyJSON))
+			s.EXPECT().RotateRefreshToken(auth.HashRefreshToken(tt.body.RefreshToken), gomock.Any()).
+				DoAndReturn(func(hash string, next *models.RefreshToken) error {
+					next.UserID = "1"
+					return tt.answerError
+				})
+			h.RefreshToken().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestHandler_Tokens(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	post := func(path, token string, body interface{}) (int, models.KeyAndToken) {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		var accept models.KeyAndToken
+		content, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		if resp.StatusCode == http.StatusOK && len(content) > 0 {
+			assert.NoError(t, json.Unmarshal(content, &accept))
+		}
+		return resp.StatusCode, accept
+	}
+	text := models.CryptoTextData{Text: []byte("text")}
+
+	status, first := post("/api/register", "", models.User{Login: "test", Password: "123456"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, first.RefreshToken)
+
+	//обновление выдает новую пару, старый токен обновления становится одноразово использованным
+	status, second := post("/api/token/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	status, _ = post("/api/data/text", second.Token, text)
+	assert.Equal(t, http.StatusOK, status)
+
+	//повторное использование отзывает все семейство, в том числе выданный взамен токен
+	status, _ = post("/api/token/refresh", "", models.RefreshRequest{RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = post("/api/token/refresh", "", models.RefreshRequest{RefreshToken: second.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	//выход отзывает токен доступа и токен обновления
+	status, login := post("/api/login", "", models.User{Login: "test", Password: "123456"})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = post("/api/logout", login.Token, models.RefreshRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = post("/api/data/text", login.Token, text)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = post("/api/token/refresh", "", models.RefreshRequest{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestHandler_Sessions(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}) (int, []byte) {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		req.Header.Set("User-Agent", "test-agent")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		content, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, content
+	}
+	var laptop, phone models.KeyAndToken
+	status, content := do(http.MethodPost, "/api/register", "", models.User{Login: "test", Password: "123456", Device: "laptop"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(content, &laptop))
+	status, content = do(http.MethodPost, "/api/login", "", models.User{Login: "test", Password: "123456", Device: "phone"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(content, &phone))
+
+	status, content = do(http.MethodGet, "/api/sessions", laptop.Token, nil)
+	assert.Equal(t, http.StatusOK, status)
+	var sessions []models.Session
+	assert.NoError(t, json.Unmarshal(content, &sessions))
+	assert.Len(t, sessions, 2)
+	var current, other models.Session
+	for _, s := range sessions {
+		if s.Current {
+			current = s
+		} else {
+			other = s
+		}
+	}
+	assert.Equal(t, "laptop", current.Device)
+	assert.Equal(t, "phone", other.Device)
+	assert.Equal(t, "test-agent", other.UserAgent)
+	assert.Equal(t, "127.0.0.1", other.IP)
+
+	//отзыв сессии телефона сразу запрещает его токены
+	status, _ = do(http.MethodDelete, "/api/sessions/"+other.ID, laptop.Token, nil)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodGet, "/api/sessions", phone.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodPost, "/api/token/refresh", "", models.RefreshRequest{RefreshToken: phone.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodDelete, "/api/sessions/"+other.ID, laptop.Token, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	//обновленный токен принадлежит той же сессии
+	status, content = do(http.MethodPost, "/api/token/refresh", "", models.RefreshRequest{RefreshToken: laptop.RefreshToken})
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(content, &laptop))
+	status, content = do(http.MethodGet, "/api/sessions", laptop.Token, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(content, &sessions))
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, current.ID, sessions[0].ID)
+	assert.True(t, sessions[0].Current)
+}
+
+func TestHandler_TwoFactor(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	post := func(path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil && resp.Header.Get("Content-Type") == "application/json" {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	user := models.User{Login: "test", Password: "123456"}
+	var accept models.KeyAndToken
+	assert.Equal(t, http.StatusOK, post("/api/register", "", user, &accept))
+
+	//без подтверждения второй фактор не требуется
+	var setup models.TwoFactorSetup
+	assert.Equal(t, http.StatusOK, post("/api/2fa/enroll", accept.Token, nil, &setup))
+	assert.Contains(t, setup.URI, "otpauth://totp/")
+	assert.Len(t, setup.RecoveryCodes, totp.RecoveryCodes)
+	assert.Equal(t, http.StatusOK, post("/api/login", "", user, nil))
+
+	assert.Equal(t, http.StatusForbidden, post("/api/2fa/confirm", accept.Token, models.TwoFactorRequest{Code: "000000"}, nil))
+	code, err := totp.Code(setup.Secret, totp.Step(time.Now()))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, post("/api/2fa/confirm", accept.Token, models.TwoFactorRequest{Code: code}, nil))
+	assert.Equal(t, http.StatusConflict, post("/api/2fa/enroll", accept.Token, nil, nil))
+
+	//пароль без кода не дает токенов
+	var challenge models.Challenge
+	assert.Equal(t, http.StatusUnauthorized, post("/api/login", "", user, &challenge))
+	assert.NotEmpty(t, challenge.Challenge)
+	assert.Equal(t, http.StatusUnauthorized, post("/api/data/text", challenge.Challenge, models.CryptoTextData{}, nil))
+	//код уже использован при подтверждении
+	assert.Equal(t, http.StatusUnauthorized, post("/api/login/2fa", "", models.TwoFactorRequest{Challenge: challenge.Challenge, Code: code}, nil))
+	//код восстановления действует один раз
+	req := models.TwoFactorRequest{Challenge: challenge.Challenge, Code: setup.RecoveryCodes[0]}
+	accept = models.KeyAndToken{}
+	assert.Equal(t, http.StatusOK, post("/api/login/2fa", "", req, &accept))
+	assert.NotEmpty(t, accept.Token)
+	assert.Equal(t, http.StatusUnauthorized, post("/api/login/2fa", "", req, nil))
+
+	assert.Equal(t, http.StatusForbidden, post("/api/2fa/disable", accept.Token, models.TwoFactorRequest{Code: "000000"}, nil))
+	assert.Equal(t, http.StatusOK, post("/api/2fa/disable", accept.Token, models.TwoFactorRequest{Code: setup.RecoveryCodes[1]}, nil))
+	assert.Equal(t, http.StatusOK, post("/api/login", "", user, nil))
+}
+
+func TestHandler_LoginLimits(t *testing.T) {
+	post := func(srv *httptest.Server, path string, body interface{}) *http.Response {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewBuffer(bodyJSON))
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	user := models.User{Login: "test", Password: "123456"}
+	wrong := models.User{Login: "test", Password: "wrong"}
+
+	t.Run("lockout", func(t *testing.T) {
+		cfg := CFG
+		cfg.LoginRatePerIP, cfg.LoginRatePerUser = 0, 0
+		cfg.LoginMaxFailures, cfg.LoginDelay, cfg.LoginLockout = 3, time.Minute, time.Hour
+		router := chi.NewRouter()
+		NewHandler(newRepo(), loggers.NewLogger(), crypto.RSA{}, TOKENS, &cfg).Register(router)
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+
+		assert.Equal(t, http.StatusOK, post(srv, "/api/register", user).StatusCode)
+		//первая ошибка прощается
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", wrong).StatusCode)
+		assert.Equal(t, http.StatusOK, post(srv, "/api/login", user).StatusCode)
+		//успешный вход сбрасывает счетчик, вторая ошибка подряд дает задержку
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", wrong).StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", wrong).StatusCode)
+		resp := post(srv, "/api/login", user)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+		//блокируются и логины, которых нет
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", models.User{Login: "none", Password: "1"}).StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", models.User{Login: "none", Password: "1"}).StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, post(srv, "/api/login", models.User{Login: "none", Password: "1"}).StatusCode)
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		cfg := CFG
+		cfg.LoginRatePerIP, cfg.LoginRatePerUser, cfg.LoginMaxFailures = 4, 2, 0
+		router := chi.NewRouter()
+		NewHandler(newRepo(), loggers.NewLogger(), crypto.RSA{}, TOKENS, &cfg).Register(router)
+		srv := httptest.NewServer(router)
+		defer srv.Close()
+
+		assert.Equal(t, http.StatusOK, post(srv, "/api/register", user).StatusCode)
+		assert.Equal(t, http.StatusOK, post(srv, "/api/login", user).StatusCode)
+		resp := post(srv, "/api/login", user)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+		//другой логин, но тот же IP
+		assert.Equal(t, http.StatusUnauthorized, post(srv, "/api/login", models.User{Login: "other", Password: "1"}).StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, post(srv, "/api/login", models.User{Login: "another", Password: "1"}).StatusCode)
+	})
+}
+
+func TestHandler_Account(t *testing.T) {
+	//неверные пароли здесь проверяются по одному, блокировка после них - в TestHandler_AccountLockout
+	cfg := CFG
+	cfg.LoginMaxFailures = 0
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &cfg).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var laptop, phone models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", Password: "123456"}, &laptop))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/login", "", models.User{Login: "test", Password: "123456"}, &phone))
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/account/password", laptop.Token, models.ChangePassword{Password: "123456"}, nil))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/account/password", laptop.Token, models.ChangePassword{Password: "wrong", NewPassword: "654321"}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/account/password", laptop.Token, models.ChangePassword{Password: "123456", NewPassword: "654321"}, nil))
+	//другие сессии отозваны, текущая работает
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/data/text", phone.Token, nil, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", laptop.Token, nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/login", "", models.User{Login: "test", Password: "123456"}, nil))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/text", laptop.Token, models.CryptoTextData{Text: []byte("text")}, nil))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/account", laptop.Token, models.User{Password: "123456"}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/account", laptop.Token, models.User{Password: "654321"}, nil))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/data/text", laptop.Token, nil, nil))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/login", "", models.User{Login: "test", Password: "654321"}, nil))
+	//логин снова свободен, старые данные не видны
+	var fresh models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", Password: "123456"}, &fresh))
+	var texts []models.CryptoTextData
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", fresh.Token, nil, &texts))
+	assert.Empty(t, texts)
+}
+
+func TestHandler_AccountLockout(t *testing.T) {
+	cfg := CFG
+	cfg.LoginRatePerIP, cfg.LoginRatePerUser = 0, 0
+	cfg.LoginMaxFailures, cfg.LoginDelay, cfg.LoginLockout = 3, time.Minute, time.Hour
+	router := chi.NewRouter()
+	NewHandler(newRepo(), loggers.NewLogger(), crypto.RSA{}, TOKENS, &cfg).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var user models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", Password: "123456"}, &user))
+
+	//неверный пароль с украденным токеном учитывается как неудачный вход
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/account/password", user.Token, models.ChangePassword{Password: "wrong", NewPassword: "1"}, nil))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/account", user.Token, models.User{Password: "wrong"}, nil))
+	//блокировка проверяется до пароля, верный пароль тоже не принимается
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/api/account/password", user.Token, models.ChangePassword{Password: "123456", NewPassword: "1"}, nil))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodDelete, "/api/account", user.Token, models.User{Password: "123456"}, nil))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/api/login", "", models.User{Login: "test", Password: "123456"}, nil))
+}
+
+func TestHandler_Keys(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var laptop, phone, other models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &laptop))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "other", AuthKey: "key"}, &other))
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/keys", "", nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/keys", laptop.Token, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/keys", laptop.Token, models.SealedKey{}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys", laptop.Token, models.SealedKey{Key: []byte("sealed")}, nil))
+
+	//второе устройство получает тот же ключ, другой пользователь - нет
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/login", "", models.User{Login: "test", AuthKey: "key"}, &phone))
+	var k models.SealedKey
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys", phone.Token, nil, &k))
+	assert.Equal(t, []byte("sealed"), k.Key)
+	assert.False(t, k.UpdatedAt.IsZero())
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/keys", other.Token, nil, nil))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/keys", phone.Token, models.SealedKey{Key: []byte("resealed")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys", laptop.Token, nil, &k))
+	assert.Equal(t, []byte("resealed"), k.Key)
+}
+
+func TestHandler_RotateItems(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var laptop, phone models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &laptop))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/login", "", models.User{Login: "test", AuthKey: "key"}, &phone))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/text", laptop.Token, models.CryptoTextData{Text: []byte("old")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/password", laptop.Token, models.CryptoPassword{Login: []byte("l"), Pass: []byte("p")}, nil))
+	var texts []models.CryptoTextData
+	var passwords []models.CryptoPassword
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", laptop.Token, nil, &texts))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password", laptop.Token, nil, &passwords))
+
+	texts[0].Text = []byte("new")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/keys/rotate", laptop.Token, models.ItemBatch{Texts: texts, Passwords: passwords}, nil))
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/keys/rotate", laptop.Token, models.ItemBatch{Texts: texts, Key: []byte("sealed")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/keys/rotate", laptop.Token, models.ItemBatch{Texts: texts, Passwords: passwords, Key: []byte("sealed")}, nil))
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", laptop.Token, nil, &texts))
+	assert.Equal(t, []byte("new"), texts[0].Text)
+	var k models.SealedKey
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/keys", laptop.Token, nil, &k))
+	assert.Equal(t, []byte("sealed"), k.Key)
+	//другое устройство держит старый ключ и должно войти заново
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/data/text", phone.Token, nil, nil))
+}
+
+func TestHandler_Sync(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var laptop, phone models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &laptop))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/login", "", models.User{Login: "test", AuthKey: "key"}, &phone))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/sync", "", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/sync?since=abc", laptop.Token, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/sync?since=-1", laptop.Token, nil, nil))
+
+	var d models.SyncDelta
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/sync", phone.Token, nil, &d))
+	assert.True(t, d.Full)
+	assert.Equal(t, int64(0), d.Revision)
+	since := d.Revision
+
+	//изменения с одного устройства видны другому по его ревизии
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/text", laptop.Token, models.CryptoTextData{Text: []byte("text")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/cards", laptop.Token, models.CryptoCard{Number: []byte("1")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/sync?since="+strconv.FormatInt(since, 10), phone.Token, nil, &d))
+	assert.Equal(t, int64(2), d.Revision)
+	assert.Len(t, d.Texts, 1)
+	assert.Len(t, d.Cards, 1)
+	since = d.Revision
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/delete/cards", laptop.Token, d.Cards[0], nil))
+	d = models.SyncDelta{}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/sync?since="+strconv.FormatInt(since, 10), phone.Token, nil, &d))
+	assert.False(t, d.Full)
+	assert.Equal(t, int64(3), d.Revision)
+	assert.Empty(t, d.Texts)
+	assert.Empty(t, d.Cards)
+	assert.Equal(t, []models.Tombstone{{Type: models.ItemCards, UID: 1, Revision: 3}}, d.Deleted)
+
+	//ревизия записи видна и в полном списке
+	var texts []models.CryptoTextData
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", phone.Token, nil, &texts))
+	assert.Equal(t, int64(1), texts[0].Revision)
+}
+
+func TestHandler_Versions(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(path, token, ifMatch string, body interface{}, v interface{}) *http.Response {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp
+	}
+	var user, other models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do("/api/register", "", "", models.User{Login: "test", AuthKey: "key"}, &user).StatusCode)
+	assert.Equal(t, http.StatusOK, do("/api/register", "", "", models.User{Login: "other", AuthKey: "key"}, &other).StatusCode)
+	assert.Equal(t, http.StatusOK, do("/api/data/text", user.Token, "", models.CryptoTextData{Text: []byte("first")}, nil).StatusCode)
+
+	//без версии запись не меняется
+	assert.Equal(t, http.StatusPreconditionRequired, do("/api/data/update/text", user.Token, "", models.CryptoTextData{UID: 1, Text: []byte("x")}, nil).StatusCode)
+	assert.Equal(t, http.StatusPreconditionRequired, do("/api/data/delete/text", user.Token, "", models.CryptoTextData{UID: 1}, nil).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do("/api/data/update/text", user.Token, `"abc"`, models.CryptoTextData{UID: 1}, nil).StatusCode)
+
+	var laptop models.CryptoTextData
+	resp := do("/api/data/update/text", user.Token, `"1"`, models.CryptoTextData{UID: 1, Text: []byte("laptop")}, &laptop)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	assert.Equal(t, int64(2), laptop.Version)
+
+	//вторая правка той же версии получает копию сервера
+	var current models.CryptoTextData
+	resp = do("/api/data/update/text", user.Token, "", models.CryptoTextData{UID: 1, Text: []byte("phone"), Version: 1}, &current)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, `"2"`, resp.Header.Get("ETag"))
+	assert.Equal(t, []byte("laptop"), current.Text)
+	assert.Equal(t, int64(2), current.Version)
+	assert.Equal(t, http.StatusConflict, do("/api/data/delete/text", user.Token, `W/"1"`, models.CryptoTextData{UID: 1}, nil).StatusCode)
+
+	//чужая и несуществующая запись
+	assert.Equal(t, http.StatusNotFound, do("/api/data/update/text", other.Token, `"2"`, models.CryptoTextData{UID: 1, Text: []byte("x")}, nil).StatusCode)
+	assert.Equal(t, http.StatusNotFound, do("/api/data/delete/text", user.Token, "", models.CryptoTextData{UID: 100, Version: 1}, nil).StatusCode)
+
+	//If-Match: * меняет запись без проверки версии
+	assert.Equal(t, http.StatusOK, do("/api/data/update/text", user.Token, "*", models.CryptoTextData{UID: 1, Text: []byte("forced")}, nil).StatusCode)
+	assert.Equal(t, http.StatusOK, do("/api/data/delete/text", user.Token, `"3"`, models.CryptoTextData{UID: 1}, nil).StatusCode)
+	var texts []models.CryptoTextData
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/data/text", nil)
+	req.Header.Set("Authorization", "Bearer "+user.Token)
+	r, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer r.Body.Close()
+	assert.NoError(t, json.NewDecoder(r.Body).Decode(&texts))
+	assert.Empty(t, texts)
+}
+
+func TestHandler_History(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var user, other models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &user))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "other", AuthKey: "key"}, &other))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/password", user.Token, models.CryptoPassword{Login: []byte("site"), Pass: []byte("old")}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/update/password", user.Token, models.CryptoPassword{UID: 1, Login: []byte("site"), Pass: []byte("new"), Version: 1}, nil))
+
+	var history []models.HistoryEntry
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/data/password/1/history", "", nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/data/notes/1/history", user.Token, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/data/password/abc/history", user.Token, nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/data/password/1/history", other.Token, nil, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password/1/history", user.Token, nil, &history))
+	assert.Len(t, history, 1)
+	assert.Equal(t, int64(1), history[0].Version)
+	var old models.CryptoPassword
+	assert.NoError(t, json.Unmarshal(history[0].Item, &old))
+	assert.Equal(t, []byte("old"), old.Pass)
+
+	//восстановление требует версию из истории и текущую версию записи
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/data/password/1/restore", user.Token, models.RestoreRequest{Version: 2}, nil))
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodPost, "/api/data/password/1/restore", user.Token, models.RestoreRequest{From: 1}, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/data/password/1/restore", user.Token, models.RestoreRequest{From: 5, Version: 2}, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/data/password/1/restore", other.Token, models.RestoreRequest{From: 1, Version: 2}, nil))
+	var current models.CryptoPassword
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/data/password/1/restore", user.Token, models.RestoreRequest{From: 1, Version: 1}, &current))
+	assert.Equal(t, []byte("new"), current.Pass)
+	var restored models.CryptoPassword
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/password/1/restore", user.Token, models.RestoreRequest{From: 1, Version: 2}, &restored))
+	assert.Equal(t, []byte("old"), restored.Pass)
+	assert.Equal(t, int64(3), restored.Version)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password/1/history", user.Token, nil, &history))
+	assert.Len(t, history, 2)
+
+	//глубина истории
+	var settings models.HistorySettings
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/account/history", user.Token, nil, &settings))
+	assert.Equal(t, models.DefaultHistoryDepth, settings.Depth)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/account/history", user.Token, models.HistorySettings{Depth: -1}, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/account/history", user.Token, models.HistorySettings{Depth: models.MaxHistoryDepth + 1}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/account/history", user.Token, models.HistorySettings{Depth: 0}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password/1/history", user.Token, nil, &history))
+	assert.Empty(t, history)
+}
+
+func TestHandler_Trash(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var user, other models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &user))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "other", AuthKey: "key"}, &other))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/password", user.Token, models.CryptoPassword{Login: []byte("site"), Pass: []byte("pass")}, nil))
+
+	var trash []models.TrashEntry
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/trash", "", nil, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/trash", user.Token, nil, &trash))
+	assert.Empty(t, trash)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/delete/password", user.Token, models.CryptoPassword{UID: 1, Version: 1}, nil))
+	var passwords []models.CryptoPassword
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password", user.Token, nil, &passwords))
+	assert.Empty(t, passwords)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/trash", user.Token, nil, &trash))
+	assert.Len(t, trash, 1)
+	assert.Equal(t, models.ItemPasswords, trash[0].Type)
+	assert.Equal(t, 1, trash[0].UID)
+	assert.False(t, trash[0].DeletedAt.IsZero())
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/trash", other.Token, nil, &trash))
+	assert.Empty(t, trash)
+
+	//возврат из корзины
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: "notes", UID: 1}, nil))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: models.ItemPasswords}, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/trash/restore", other.Token, models.TrashRestore{Type: models.ItemPasswords, UID: 1}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: models.ItemPasswords, UID: 1}, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: models.ItemPasswords, UID: 1}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password", user.Token, nil, &passwords))
+	assert.Len(t, passwords, 1)
+
+	//очистка корзины
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/delete/password", user.Token, passwords[0], nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/trash", user.Token, nil, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/trash", user.Token, nil, &trash))
+	assert.Empty(t, trash)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: models.ItemPasswords, UID: 1}, nil))
+}
+
+func TestHandler_Signature(t *testing.T) {
+	logger := loggers.NewLogger()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{Private: private, Public: &private.PublicKey}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, nonce string, body interface{}) (*http.Response, []byte) {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		req.Header.Set(crypto.HeaderNonce, nonce)
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		content, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, content
+	}
+	verify := func(method, path, nonce string, resp *http.Response, body []byte) error {
+		sign, err := base64.StdEncoding.DecodeString(resp.Header.Get(crypto.HeaderSignature))
+		assert.NoError(t, err)
+		digest := sha256.Sum256(crypto.ResponseMessage(method, path, nonce, resp.StatusCode, body))
+		return rsa.VerifyPSS(&private.PublicKey, stdcrypto.SHA256, digest[:], sign, nil)
+	}
+
+	resp, body := do(http.MethodPost, "/api/register", "n1", models.User{Login: "test", AuthKey: "key"})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, verify(http.MethodPost, "/api/register", "n1", resp, body))
+	public, err := base64.StdEncoding.DecodeString(resp.Header.Get(crypto.HeaderServerKey))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, public)
+	var token models.KeyAndToken
+	assert.NoError(t, json.Unmarshal(body, &token))
+
+	//ответы с ошибкой тоже подписаны
+	resp, body = do(http.MethodGet, "/api/data/text", "n2", nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NoError(t, verify(http.MethodGet, "/api/data/text", "n2", resp, body))
+
+	//подпись не подходит к другому запросу или измененному телу
+	assert.Error(t, verify(http.MethodGet, "/api/data/text", "n3", resp, body))
+	assert.Error(t, verify(http.MethodGet, "/api/data/cards", "n2", resp, body))
+	assert.Error(t, verify(http.MethodGet, "/api/data/text", "n2", resp, append(body, '!')))
+}
+
+func TestHandler_Meta(t *testing.T) {
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var user models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &user))
+	sent := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	text := models.CryptoTextData{Text: []byte("note"), ItemMeta: models.ItemMeta{Title: []byte("title"),
+		Tags: []byte("work,home"), Favorite: true, CreatedAt: sent, UpdatedAt: sent}}
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/text", user.Token, text, nil))
+
+	var texts []models.CryptoTextData
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", user.Token, nil, &texts))
+	assert.Len(t, texts, 1)
+	assert.Equal(t, []byte("title"), texts[0].Title)
+	assert.Equal(t, []byte("work,home"), texts[0].Tags)
+	assert.True(t, texts[0].Favorite)
+	assert.True(t, texts[0].CreatedAt.After(sent))
+
+	changed := texts[0]
+	changed.Favorite, changed.Notes = false, []byte("notes")
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/data/update/text", user.Token, changed, nil))
+	texts = nil
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/text", user.Token, nil, &texts))
+	assert.False(t, texts[0].Favorite)
+	assert.Equal(t, []byte("notes"), texts[0].Notes)
+	assert.True(t, changed.CreatedAt.Equal(texts[0].CreatedAt))
+	assert.False(t, texts[0].UpdatedAt.Before(changed.UpdatedAt))
+}
+
+func TestHandler_Items(t *testing.T) {
+	assert.NoError(t, models.RegisterItemKind("note"))
+	logger := loggers.NewLogger()
+	router := chi.NewRouter()
+	NewHandler(newRepo(), logger, crypto.RSA{}, TOKENS, &CFG).Register(router)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	do := func(method, path, token string, body interface{}, v interface{}) int {
+		bodyJSON, err := json.Marshal(body)
+		assert.NoError(t, err)
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBuffer(bodyJSON))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if v != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+	var user models.KeyAndToken
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/register", "", models.User{Login: "test", AuthKey: "key"}, &user))
+
+	//зарегистрированные виды записей
+	var kinds []models.ItemKind
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/items", "", nil, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items", user.Token, nil, &kinds))
+	assert.Contains(t, kinds, models.ItemKind{Name: models.ItemPasswords, Builtin: true})
+	assert.Contains(t, kinds, models.ItemKind{Name: "note"})
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/items/unknown", user.Token, nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/items/unknown", user.Token, models.Item{}, nil))
+
+	//запись нового вида
+	var items []models.Item
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items/note", user.Token, nil, &items))
+	assert.Empty(t, items)
+	var note models.Item
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/items/note", user.Token, models.Item{Payload: []byte("text")}, &note))
+	assert.Equal(t, "note", note.Type)
+	assert.Equal(t, 1, note.UID)
+	assert.Equal(t, int64(1), note.Version)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items/note", user.Token, nil, &items))
+	assert.Equal(t, []models.Item{note}, items)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/items/note", user.Token, "wrong", nil))
+
+	//изменение с проверкой версии
+	var current models.Item
+	assert.Equal(t, http.StatusPreconditionRequired, do(http.MethodPut, "/api/items/note/1", user.Token, models.Item{Payload: []byte("new")}, nil))
+	assert.Equal(t, http.StatusConflict, do(http.MethodPut, "/api/items/note/1", user.Token, models.Item{Payload: []byte("new"), Version: 5}, &current))
+	assert.Equal(t, note, current)
+	assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/items/note/1", user.Token, models.Item{Payload: []byte("new"), Version: 1}, &current))
+	assert.Equal(t, []byte("new"), current.Payload)
+	assert.Equal(t, int64(2), current.Version)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/items/note/2", user.Token, models.Item{Version: 1}, nil))
+	var history []models.HistoryEntry
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items/note/1/history", user.Token, nil, &history))
+	assert.Len(t, history, 1)
+
+	//записи встроенных видов доступны и по старым эндпоинтам
+	p, _ := json.Marshal(models.PasswordPayload{Login: []byte("site"), Pass: []byte("pass")})
+	var password models.Item
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/items/password", user.Token, models.Item{Payload: p}, &password))
+	assert.Equal(t, models.ItemPasswords, password.Type)
+	var passwords []models.CryptoPassword
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/data/password", user.Token, nil, &passwords))
+	assert.Len(t, passwords, 1)
+	assert.Equal(t, []byte("pass"), passwords[0].Pass)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/items/text", user.Token, models.Item{Payload: []byte("{")}, nil))
+
+	//удаление в корзину
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/api/items/note/1", user.Token, models.Item{Version: 2}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items/note", user.Token, nil, &items))
+	assert.Empty(t, items)
+	var trash []models.TrashEntry
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/trash", user.Token, nil, &trash))
+	assert.Len(t, trash, 1)
+	assert.Equal(t, "note", trash[0].Type)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/trash/restore", user.Token, models.TrashRestore{Type: "note", UID: 1}, nil))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/items/note", user.Token, nil, &items))
+	assert.Len(t, items, 1)
+}
@@ -0,0 +1,159 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль отдает прежние версии записей, восстанавливает запись из истории и меняет глубину истории.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// itemParams - вид и идентификатор записи из пути запроса. Если вид неизвестен или идентификатор неверный,
+// отправляет http.StatusNotFound или http.StatusBadRequest и возвращает false.
+func itemParams(rw http.ResponseWriter, r *http.Request) (string, int, bool) {
+	itemType, ok := itemKindParam(rw, r)
+	if !ok {
+		return "", 0, false
+	}
+	uid, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || uid <= 0 {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("wrong item id"))
+		return "", 0, false
+	}
+	return itemType, uid, true
+}
+
+// GetHistory - эндпоинт прежних версий записи: GET /api/data/{type}/{id}/history, новые версии первыми.
+// Версии зашифрованы так же, как сама запись.
+func (h *Handler) GetHistory() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, uid, ok := itemParams(rw, r)
+		if !ok {
+			return
+		}
+
+		statusCode, data, err := h.Storage.GetHistory(userID, itemType, uid)
+		switch statusCode {
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if data == nil {
+			data = []models.HistoryEntry{}
+		}
+		dataJSON, err := json.Marshal(data)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dataJSON)
+	}
+}
+
+// RestoreItem - эндпоинт восстановления записи из истории: POST /api/data/{type}/{id}/restore с версией from.
+// Текущая версия записи проверяется, как при изменении, а сама она остается в истории, поэтому восстановление
+// тоже можно отменить.
+func (h *Handler) RestoreItem() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, uid, ok := itemParams(rw, r)
+		if !ok {
+			return
+		}
+		var req models.RestoreRequest
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if req.From <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("version to restore is required"))
+			return
+		}
+		if !checkVersion(rw, r, &req.Version) {
+			return
+		}
+
+		statusCode, entry, err := h.Storage.RestoreItem(userID, itemType, uid, req.From, req.Version)
+		var item json.RawMessage
+		var version int64
+		if entry != nil {
+			item, version = entry.Item, entry.Version
+		}
+		h.writeItem(rw, statusCode, err, item, version)
+	}
+}
+
+// GetHistoryDepth - эндпоинт глубины истории записей пользователя.
+func (h *Handler) GetHistoryDepth() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		statusCode, depth, err := h.Storage.GetHistoryDepth(userID)
+		if statusCode != http.StatusOK {
+			h.accountStatus(rw, statusCode, err)
+			return
+		}
+		dataJSON, err := json.Marshal(models.HistorySettings{Depth: depth})
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dataJSON)
+	}
+}
+
+// SetHistoryDepth - эндпоинт изменения глубины истории записей: от 0, история отключена, до models.MaxHistoryDepth.
+// Версии сверх новой глубины удаляются сразу.
+func (h *Handler) SetHistoryDepth() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var settings models.HistorySettings
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &settings); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if settings.Depth < 0 || settings.Depth > models.MaxHistoryDepth {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("history depth must be from 0 to " + strconv.Itoa(models.MaxHistoryDepth)))
+			return
+		}
+
+		statusCode, err := h.Storage.SetHistoryDepth(userID, settings.Depth)
+		h.accountStatus(rw, statusCode, err)
+	}
+}
@@ -0,0 +1,168 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль дает возможность обрабатывать записи любого вида по одному набору эндпоинтов /api/items/{type}.
+// Старые эндпоинты /api/data остаются для встроенных видов записей.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// itemKindParam - вид записи из пути запроса. Если такой вид не зарегистрирован, отправляет http.StatusNotFound
+// и возвращает false.
+func itemKindParam(rw http.ResponseWriter, r *http.Request) (string, bool) {
+	itemType := chi.URLParam(r, "type")
+	if _, ok := models.LookupItemKind(itemType); !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		rw.Write([]byte("unknown item type"))
+		return "", false
+	}
+	return itemType, true
+}
+
+// readItem - запись из тела запроса в d. Пустое тело допустимо, например при удалении с заголовком If-Match.
+// Если тело не разбирается, отправляет http.StatusBadRequest и возвращает false.
+func (h *Handler) readItem(rw http.ResponseWriter, r *http.Request, d *models.Item) bool {
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.logger.LogErr(err, "")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	defer r.Body.Close()
+	if len(content) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(content, d); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte(err.Error()))
+		return false
+	}
+	return true
+}
+
+// ItemKinds - эндпоинт зарегистрированных видов записей: GET /api/items.
+func (h *Handler) ItemKinds() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		dataJSON, err := json.Marshal(models.ItemKinds())
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dataJSON)
+	}
+}
+
+// GetItems - эндпоинт записей одного вида: GET /api/items/{type}.
+func (h *Handler) GetItems() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, ok := itemKindParam(rw, r)
+		if !ok {
+			return
+		}
+
+		statusCode, data, err := h.Storage.GetItems(userID, itemType)
+		switch statusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if data == nil {
+			data = []models.Item{}
+		}
+		dataJSON, err := json.Marshal(data)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dataJSON)
+	}
+}
+
+// CollectItem - эндпоинт добавления записи: POST /api/items/{type}. В ответе сохраненная запись
+// с идентификатором и версией.
+func (h *Handler) CollectItem() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, ok := itemKindParam(rw, r)
+		if !ok {
+			return
+		}
+		var d models.Item
+		if !h.readItem(rw, r, &d) {
+			return
+		}
+		d.Type = itemType
+
+		statusCode, err := h.Storage.CollectItem(&d, userID)
+		h.writeItem(rw, statusCode, err, &d, d.Version)
+	}
+}
+
+// UpdateItem - эндпоинт изменения записи: PUT /api/items/{type}/{id}. Версия проверяется так же,
+// как на старых эндпоинтах: If-Match или поле version.
+func (h *Handler) UpdateItem() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, uid, ok := itemParams(rw, r)
+		if !ok {
+			return
+		}
+		var d models.Item
+		if !h.readItem(rw, r, &d) {
+			return
+		}
+		d.Type, d.UID = itemType, uid
+		if !checkVersion(rw, r, &d.Version) {
+			return
+		}
+
+		statusCode, err := h.Storage.UpdateItem(&d, userID)
+		h.writeItem(rw, statusCode, err, &d, d.Version)
+	}
+}
+
+// DeleteItem - эндпоинт удаления записи в корзину: DELETE /api/items/{type}/{id} с версией в If-Match
+// или в поле version тела запроса.
+func (h *Handler) DeleteItem() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		itemType, uid, ok := itemParams(rw, r)
+		if !ok {
+			return
+		}
+		var d models.Item
+		if !h.readItem(rw, r, &d) {
+			return
+		}
+		d.Type, d.UID = itemType, uid
+		if !checkVersion(rw, r, &d.Version) {
+			return
+		}
+
+		statusCode, err := h.Storage.DeleteItem(&d, userID)
+		if statusCode == http.StatusOK {
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+		h.writeItem(rw, statusCode, err, &d, d.Version)
+	}
+}
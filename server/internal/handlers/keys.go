@@ -0,0 +1,123 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль хранит закрытый ключ пользователя, зашифрованный на клиенте, чтобы открыть данные на другом устройстве,
+// и меняет ключ вместе со всеми записями, перешифрованными на клиенте.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+)
+
+// maxSealedKeySize - максимальный размер зашифрованного ключа. Ключ RSA-4096 в хранилище занимает около 3,5 КБ.
+const maxSealedKeySize = 64 << 10
+
+// SaveKey - эндпоинт сохранения зашифрованного закрытого ключа. Сервер не проверяет содержимое, он не может его расшифровать.
+func (h *Handler) SaveKey() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var k models.SealedKey
+		content, err := io.ReadAll(io.LimitReader(r.Body, 2*maxSealedKeySize))
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &k); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if len(k.Key) == 0 || len(k.Key) > maxSealedKeySize {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("key is empty or too large"))
+			return
+		}
+
+		if err := h.Storage.SaveKey(userID, k.Key); err != nil {
+			h.logger.LogErr(err, "failed to save key")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetKey - эндпоинт получения зашифрованного закрытого ключа. Если ключ не сохранен, отправляет http.StatusNotFound.
+func (h *Handler) GetKey() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		statusCode, k, err := h.Storage.GetKey(userID)
+		switch statusCode {
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		kJSON, err := json.Marshal(k)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(kJSON)
+	}
+}
+
+// RotateItems - эндпоинт смены ключа: все записи пользователя и ключ заменяются одной транзакцией.
+// Если после получения записей клиентом их добавили или удалили, отправляет http.StatusConflict,
+// и клиент повторяет смену ключа заново.
+func (h *Handler) RotateItems() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		claims := r.Context().Value("claims").(*auth.Claims)
+		var b models.ItemBatch
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &b); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if len(b.Key) == 0 || len(b.Key) > maxSealedKeySize {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("key is empty or too large"))
+			return
+		}
+
+		statusCode, err := h.Storage.RotateItems(&b, userID, claims.SessionID)
+		switch statusCode {
+		case http.StatusConflict:
+			rw.WriteHeader(http.StatusConflict)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			h.logger.LogErr(err, "failed to rotate items")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
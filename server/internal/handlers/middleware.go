@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-
-	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
 )
 
 const (
@@ -14,10 +12,10 @@ const (
 )
 
 // userIdentity - перехватчик, который проверяет токены авторизации. Если есть токен, то пропускает дальше.
-// Если нет токена, то отправлет статус http.StatusUnauthorized.
+// Если нет токена, токен или его сессия отозваны, то отправлет статус http.StatusUnauthorized.
 func (h *Handler) userIdentity(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		ctx := context.Background()
+		ctx := r.Context()
 
 		header := r.Header.Get(authorizationHeader)
 		if header == "" {
@@ -31,13 +29,38 @@ func (h *Handler) userIdentity(next http.Handler) http.Handler {
 			http.Error(rw, "invalid auth header", http.StatusUnauthorized)
 			return
 		}
-		userID, err := auth.ParseToken(headerParts[1])
+		claims, err := h.tokens.ParseToken(headerParts[1])
 		if err != nil {
 			fmt.Println("invalid parse token")
 			http.Error(rw, "invalid parse token", http.StatusUnauthorized)
 			return
 		}
-		r = r.WithContext(context.WithValue(ctx, "user_id", userID))
+		//токены отозванные при выходе не принимаются до истечения их срока
+		revoked, err := h.Storage.IsTokenRevoked(claims.ID)
+		if err != nil {
+			h.logger.LogErr(err, "failed to check token")
+			http.Error(rw, "failed to check token", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			http.Error(rw, "token revoked", http.StatusUnauthorized)
+			return
+		}
+		if claims.SessionID != "" {
+			active, err := h.Storage.TouchSession(claims.SessionID)
+			if err != nil {
+				h.logger.LogErr(err, "failed to check session")
+				http.Error(rw, "failed to check session", http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				http.Error(rw, "session revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+		ctx = context.WithValue(ctx, "user_id", claims.UserID)
+		ctx = context.WithValue(ctx, "claims", claims)
+		r = r.WithContext(ctx)
 
 		next.ServeHTTP(rw, r)
 	})
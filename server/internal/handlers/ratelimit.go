@@ -0,0 +1,136 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль ограничивает частоту попыток входа и блокирует вход после нескольких неудачных попыток подряд.
+// Неверный пароль на эндпоинтах аккаунта считается такой же неудачной попыткой.
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// rateLimit - перехватчик, который ограничивает частоту запросов с одного IP и для одного логина из тела запроса.
+// При превышении отправляет статус http.StatusTooManyRequests с заголовком Retry-After.
+func (h *Handler) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if h.ipLimiter != nil {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			if ok, wait := h.ipLimiter.Allow(ip); !ok {
+				tooManyRequests(rw, wait)
+				return
+			}
+		}
+		if h.loginLimiter != nil && r.Body != nil {
+			content, err := io.ReadAll(r.Body)
+			if err != nil {
+				h.logger.LogErr(err, "")
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(content))
+			//тело разбирает сам обработчик, здесь нужен только логин
+			var u models.User
+			if json.Unmarshal(content, &u) == nil && u.Login != "" {
+				if ok, wait := h.loginLimiter.Allow(u.Login); !ok {
+					tooManyRequests(rw, wait)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// tooManyRequests - отправка статуса http.StatusTooManyRequests, повторить запрос можно через wait.
+func tooManyRequests(rw http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	rw.Header().Set("Retry-After", strconv.Itoa(seconds))
+	rw.WriteHeader(http.StatusTooManyRequests)
+	rw.Write([]byte("too many attempts, try again in " + strconv.Itoa(seconds) + "s"))
+}
+
+// loginLocked - проверка блокировки входа под логином login. Если вход заблокирован,
+// отправляет статус http.StatusTooManyRequests и возвращает true.
+func (h *Handler) loginLocked(rw http.ResponseWriter, login string) bool {
+	if h.cfg == nil || h.cfg.LoginMaxFailures <= 0 {
+		return false
+	}
+	lockedUntil, err := h.Storage.GetLoginLock(login)
+	if err != nil {
+		h.logger.LogErr(err, "failed to get login lock")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return true
+	}
+	if wait := time.Until(lockedUntil); wait > 0 {
+		tooManyRequests(rw, wait)
+		return true
+	}
+	return false
+}
+
+// accountLogin - логин пользователя id для учета попыток ввода пароля на эндпоинтах аккаунта. Токен доступа
+// не дает подбирать мастер-пароль в обход блокировки входа: попытки учитываются вместе с попытками входа.
+// Если вход заблокирован или пользователя нет, отправляет ответ и возвращает false.
+func (h *Handler) accountLogin(rw http.ResponseWriter, id string) (string, bool) {
+	if h.cfg == nil || h.cfg.LoginMaxFailures <= 0 {
+		return "", true
+	}
+	statusCode, login, err := h.Storage.GetLogin(id)
+	if err != nil {
+		h.accountStatus(rw, statusCode, err)
+		return "", false
+	}
+	return login, !h.loginLocked(rw, login)
+}
+
+// loginFailed - учет неудачной попытки входа под логином login. Первая ошибка прощается, после каждой следующей
+// вход блокируется на LoginDelay, удваиваясь с каждой попыткой, а после LoginMaxFailures подряд - на LoginLockout.
+func (h *Handler) loginFailed(login string) {
+	if h.cfg == nil || h.cfg.LoginMaxFailures <= 0 {
+		return
+	}
+	failures, err := h.Storage.RecordLoginFailure(login, time.Now().Add(-h.cfg.LoginLockout))
+	if err != nil {
+		h.logger.LogErr(err, "failed to record login failure")
+		return
+	}
+	var delay time.Duration
+	switch {
+	case failures >= h.cfg.LoginMaxFailures:
+		delay = h.cfg.LoginLockout
+	case failures > 1:
+		delay = h.cfg.LoginDelay << (failures - 2)
+		if delay <= 0 || delay > h.cfg.LoginLockout {
+			delay = h.cfg.LoginLockout
+		}
+	default:
+		return
+	}
+	if err = h.Storage.LockLogin(login, time.Now().Add(delay)); err != nil {
+		h.logger.LogErr(err, "failed to lock login")
+	}
+}
+
+// loginSucceeded - сброс неудачных попыток входа под логином login.
+func (h *Handler) loginSucceeded(login string) {
+	if h.cfg == nil || h.cfg.LoginMaxFailures <= 0 {
+		return
+	}
+	if err := h.Storage.ResetLoginFailures(login); err != nil {
+		h.logger.LogErr(err, "failed to reset login failures")
+	}
+}
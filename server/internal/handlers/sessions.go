@@ -0,0 +1,61 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль позволяет просматривать и отзывать сессии пользователя на разных устройствах.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+)
+
+// GetSessions - эндпоинт получения активных сессий пользователя. Текущая сессия помечается полем current.
+func (h *Handler) GetSessions() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		claims := r.Context().Value("claims").(*auth.Claims)
+
+		statusCode, data, err := h.Storage.GetSessions(userID)
+		if statusCode == http.StatusInternalServerError {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		for i := range data {
+			data[i].Current = data[i].ID == claims.SessionID
+		}
+		dJSON, err := json.Marshal(data)
+		if err != nil {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dJSON)
+	}
+}
+
+// RevokeSession - эндпоинт отзыва сессии. Токены отозванной сессии перестают приниматься сразу.
+func (h *Handler) RevokeSession() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		statusCode, err := h.Storage.RevokeSession(chi.URLParam(r, "id"), userID)
+		switch statusCode {
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,62 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль подписывает каждый ответ ключом сервера, чтобы клиент мог проверить, что ответ не подменен по дороге.
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/crypto"
+)
+
+// signedWriter - запись ответа в буфер, чтобы подписать его целиком перед отправкой.
+type signedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader - сохранение статуса ответа.
+func (w *signedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// Write - запись тела ответа в буфер.
+func (w *signedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// signResponse - перехватчик, который подписывает ответ и отправляет открытый ключ сервера.
+// Подписывается метод, путь запроса, значение заголовка crypto.HeaderNonce, статус и тело ответа.
+// Без ключа сервера ответ отправляется без подписи.
+func (h *Handler) signResponse(next http.Handler) http.Handler {
+	public, err := h.crypto.EncodedPublic()
+	if err != nil {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := &signedWriter{ResponseWriter: rw}
+		next.ServeHTTP(w, r)
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		msg := crypto.ResponseMessage(r.Method, r.URL.RequestURI(), r.Header.Get(crypto.HeaderNonce), w.status, w.body.Bytes())
+		sign, err := h.crypto.Sign(msg)
+		if err != nil {
+			h.logger.LogErr(err, "failed to sign response")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set(crypto.HeaderServerKey, public)
+		rw.Header().Set(crypto.HeaderSignature, base64.StdEncoding.EncodeToString(sign))
+		rw.WriteHeader(w.status)
+		rw.Write(w.body.Bytes())
+	})
+}
@@ -0,0 +1,47 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль отдает клиенту только изменения записей после его последней синхронизации.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Sync - эндпоинт синхронизации: GET /api/sync?since=<rev> возвращает записи всех видов, измененные после ревизии
+// since, и следы удаленных записей. Без since или с since=0 возвращаются все записи.
+func (h *Handler) Sync() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var since int64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				rw.Write([]byte("since must be a non-negative revision"))
+				return
+			}
+		}
+
+		statusCode, d, err := h.Storage.Sync(userID, since)
+		switch statusCode {
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		dJSON, err := json.Marshal(d)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dJSON)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
 )
 
+// CollectText - эндпоинт добавления текста. В ответе сохраненная запись с идентификатором и версией:
+// по идентификатору клиент находит запись, добавленную без связи с сервером.
 func (h *Handler) CollectText() http.HandlerFunc {
 	return func(rw http.ResponseWriter, r *http.Request) {
 		content, err := io.ReadAll(r.Body)
@@ -31,18 +33,7 @@ func (h *Handler) CollectText() http.HandlerFunc {
 		userID := r.Context().Value("user_id").(string)
 
 		statusCode, err := h.Storage.CollectText(&c, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusOK)
-			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
-			return
-		}
+		h.writeItem(rw, statusCode, err, &c, c.Version)
 	}
 }
 
@@ -96,19 +87,15 @@ func (h *Handler) DeleteText() http.HandlerFunc {
 		defer r.Body.Close()
 		userID := r.Context().Value("user_id").(string)
 
+		if !checkVersion(rw, r, &data.Version) {
+			return
+		}
 		statusCode, err := h.Storage.DeleteText(&data, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
+		if statusCode == http.StatusOK {
 			rw.WriteHeader(http.StatusOK)
 			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
-			return
 		}
+		h.writeItem(rw, statusCode, err, &data, data.Version)
 	}
 }
 
@@ -132,18 +119,10 @@ func (h *Handler) UpdateText() http.HandlerFunc {
 		defer r.Body.Close()
 		userID := r.Context().Value("user_id").(string)
 
-		statusCode, err := h.Storage.UpdateText(&c, userID)
-
-		switch statusCode {
-		case http.StatusOK:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusOK)
-			return
-		case http.StatusInternalServerError:
-			rw.Header().Set("Content-Type", "application/json")
-			rw.WriteHeader(http.StatusInternalServerError)
-			rw.Write([]byte(err.Error()))
+		if !checkVersion(rw, r, &c.Version) {
 			return
 		}
+		statusCode, err := h.Storage.UpdateText(&c, userID)
+		h.writeItem(rw, statusCode, err, &c, c.Version)
 	}
 }
@@ -0,0 +1,176 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль выдает, обновляет и отзывает токены авторизации.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/auth"
+)
+
+// maxDeviceLength - максимальная длина названия устройства.
+const maxDeviceLength = 200
+
+// newSession - создание сессии с устройства device и выдача токена доступа и токена обновления
+// после входа или регистрации. Семейство токенов обновления совпадает с идентификатором сессии.
+func (h *Handler) newSession(id, device string, r *http.Request) (models.KeyAndToken, error) {
+	var sender models.KeyAndToken
+	sessionID, err := auth.NewID()
+	if err != nil {
+		return sender, err
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if len([]rune(device)) > maxDeviceLength {
+		device = string([]rune(device)[:maxDeviceLength])
+	}
+	if err = h.Storage.CreateSession(&models.Session{
+		ID:        sessionID,
+		Device:    device,
+		UserAgent: r.UserAgent(),
+		IP:        ip,
+	}, id); err != nil {
+		return sender, err
+	}
+	refresh, hash, expiresAt, err := h.tokens.GenerateRefreshToken()
+	if err != nil {
+		return sender, err
+	}
+	if err = h.Storage.SaveRefreshToken(&models.RefreshToken{
+		Hash:      hash,
+		Family:    sessionID,
+		UserID:    id,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return sender, err
+	}
+	token, err := h.tokens.GenerateToken(id, sessionID)
+	if err != nil {
+		return sender, err
+	}
+	sender.Key = h.crypto.Public
+	sender.Token = token
+	sender.RefreshToken = refresh
+	return sender, nil
+}
+
+// RefreshToken - эндпоинт обновления токенов. Токен обновления одноразовый,
+// взамен выдается новая пара токенов того же семейства.
+func (h *Handler) RefreshToken() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req models.RefreshRequest
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if req.RefreshToken == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("refresh token is empty"))
+			return
+		}
+
+		refresh, hash, expiresAt, err := h.tokens.GenerateRefreshToken()
+		if err != nil {
+			h.logger.LogErr(err, "failed to generate refresh token")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		next := models.RefreshToken{Hash: hash, ExpiresAt: expiresAt}
+		err = h.Storage.RotateRefreshToken(auth.HashRefreshToken(req.RefreshToken), &next)
+		switch {
+		case errors.Is(err, storage.ErrTokenNotFound), errors.Is(err, storage.ErrTokenExpired),
+			errors.Is(err, storage.ErrTokenRevoked), errors.Is(err, storage.ErrTokenReused):
+			h.logger.LogErr(err, "wrong refresh token")
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(err.Error()))
+			return
+		case err != nil:
+			h.logger.LogErr(err, "failed to rotate refresh token")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		token, err := h.tokens.GenerateToken(next.UserID, next.Family)
+		if err != nil {
+			h.logger.LogErr(err, "error")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var sender models.KeyAndToken
+		sender.Key = h.crypto.Public
+		sender.Token = token
+		sender.RefreshToken = refresh
+
+		send, err := json.Marshal(sender)
+		if err != nil {
+			h.logger.LogErr(err, "failed to marshal tokens")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(send)
+	}
+}
+
+// Logout - эндпоинт выхода. Отзывает текущий токен доступа и текущую сессию вместе с ее токенами обновления.
+// Для токенов, выпущенных без сессии, отзывается семейство переданного токена обновления.
+func (h *Handler) Logout() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req models.RefreshRequest
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if len(content) > 0 {
+			if err := json.Unmarshal(content, &req); err != nil {
+				rw.WriteHeader(http.StatusInternalServerError)
+				rw.Write([]byte(err.Error()))
+				return
+			}
+		}
+		userID := r.Context().Value("user_id").(string)
+		claims := r.Context().Value("claims").(*auth.Claims)
+
+		if claims.SessionID != "" {
+			statusCode, err := h.Storage.RevokeSession(claims.SessionID, userID)
+			if statusCode == http.StatusInternalServerError {
+				h.logger.LogErr(err, "failed to revoke session")
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		} else if req.RefreshToken != "" {
+			err = h.Storage.RevokeRefreshToken(auth.HashRefreshToken(req.RefreshToken), userID)
+			if err != nil && !errors.Is(err, storage.ErrTokenNotFound) {
+				h.logger.LogErr(err, "failed to revoke refresh token")
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		if err = h.Storage.RevokeToken(claims.ID, userID, claims.ExpiresAt); err != nil {
+			h.logger.LogErr(err, "failed to revoke token")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,97 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль отдает корзину удаленных записей, возвращает записи из нее и очищает ее.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// GetTrash - эндпоинт корзины: GET /api/trash возвращает удаленные записи всех видов, удаленные последними первыми.
+// Записи зашифрованы так же, как до удаления.
+func (h *Handler) GetTrash() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		statusCode, data, err := h.Storage.GetTrash(userID)
+		if statusCode == http.StatusInternalServerError {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if data == nil {
+			data = []models.TrashEntry{}
+		}
+		dataJSON, err := json.Marshal(data)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(dataJSON)
+	}
+}
+
+// RestoreTrash - эндпоинт возврата записи из корзины: POST /api/trash/restore с видом и идентификатором записи.
+// Если записи нет в корзине, отправляется http.StatusNotFound.
+func (h *Handler) RestoreTrash() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var req models.TrashRestore
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if _, ok := models.LookupItemKind(req.Type); !ok {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("unknown item type"))
+			return
+		}
+		if req.UID <= 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("wrong item id"))
+			return
+		}
+
+		statusCode, err := h.Storage.RestoreTrash(userID, req.Type, req.UID)
+		switch statusCode {
+		case http.StatusNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			rw.Write([]byte(err.Error()))
+			return
+		case http.StatusInternalServerError:
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+// EmptyTrash - эндпоинт очистки корзины: DELETE /api/trash удаляет записи из корзины навсегда вместе с их историей.
+func (h *Handler) EmptyTrash() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		statusCode, err := h.Storage.EmptyTrash(userID)
+		if statusCode == http.StatusInternalServerError {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
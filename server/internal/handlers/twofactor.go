@@ -0,0 +1,251 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль подключает, проверяет и отключает двухфакторную аутентификацию (TOTP).
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/totp"
+)
+
+// requireSecondFactor - ответ на вход с верным паролем, когда у пользователя включен второй фактор.
+// Отправляет статус http.StatusUnauthorized с токеном, по которому код принимает /api/login/2fa.
+func (h *Handler) requireSecondFactor(rw http.ResponseWriter, id string) {
+	challenge, err := h.tokens.GenerateChallenge(id)
+	if err != nil {
+		h.logger.LogErr(err, "failed to generate challenge")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	send, err := json.Marshal(models.Challenge{Challenge: challenge})
+	if err != nil {
+		h.logger.LogErr(err, "failed to marshal challenge")
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusUnauthorized)
+	rw.Write(send)
+}
+
+// verifySecondFactor - проверка кода TOTP пользователя id с настройками t. Если recovery, то принимается
+// и код восстановления. Каждый код принимается только один раз.
+func (h *Handler) verifySecondFactor(id string, t *models.TOTP, code string, recovery bool) (bool, error) {
+	if t.Secret == "" {
+		return false, nil
+	}
+	if step, ok := totp.Validate(t.Secret, code, time.Now()); ok {
+		return h.Storage.UseTOTPStep(id, step)
+	}
+	if !recovery {
+		return false, nil
+	}
+	return h.Storage.UseRecoveryCode(id, totp.HashRecoveryCode(code))
+}
+
+// LoginTwoFactor - эндпоинт второго шага входа: токен из /api/login и код TOTP или код восстановления.
+func (h *Handler) LoginTwoFactor() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		var req models.TwoFactorRequest
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		if req.Challenge == "" || req.Code == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("challenge or code is empty"))
+			return
+		}
+		id, err := h.tokens.ParseChallenge(req.Challenge)
+		if err != nil {
+			h.logger.LogErr(err, "wrong challenge")
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte("login again"))
+			return
+		}
+		t, err := h.Storage.GetTOTP(id)
+		if err != nil {
+			h.logger.LogErr(err, "failed to get two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		//неверные коды считаются вместе с неверными паролями того же логина
+		if h.loginLocked(rw, t.Login) {
+			return
+		}
+		ok, err := h.verifySecondFactor(id, t, req.Code, true)
+		if err != nil {
+			h.logger.LogErr(err, "failed to verify code")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			h.loginFailed(t.Login)
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte("wrong code"))
+			return
+		}
+		h.loginSucceeded(t.Login)
+		sender, err := h.newSession(id, req.Device, r)
+		if err != nil {
+			h.logger.LogErr(err, "error")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		send, err := json.Marshal(sender)
+		if err != nil {
+			h.logger.LogErr(err, "failed to marshal tokens")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(send)
+	}
+}
+
+// TwoFactorEnroll - эндпоинт подключения второго фактора. Выдает ссылку otpauth:// и коды восстановления,
+// второй фактор начинает действовать после подтверждения кодом в /api/2fa/confirm.
+func (h *Handler) TwoFactorEnroll() http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+
+		t, err := h.Storage.GetTOTP(userID)
+		if err != nil {
+			h.logger.LogErr(err, "failed to get two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if t.Enabled {
+			rw.WriteHeader(http.StatusConflict)
+			rw.Write([]byte("two-factor authentication is already enabled"))
+			return
+		}
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			h.logger.LogErr(err, "failed to generate secret")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		codes, err := totp.GenerateRecoveryCodes()
+		if err != nil {
+			h.logger.LogErr(err, "failed to generate recovery codes")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		hashes := make([]string, len(codes))
+		for i, code := range codes {
+			hashes[i] = totp.HashRecoveryCode(code)
+		}
+		if err = h.Storage.SetTOTP(userID, secret, hashes); err != nil {
+			h.logger.LogErr(err, "failed to save two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		send, err := json.Marshal(models.TwoFactorSetup{
+			URI:           totp.URI(h.cfg.TOTPIssuer, t.Login, secret),
+			Secret:        secret,
+			RecoveryCodes: codes,
+		})
+		if err != nil {
+			h.logger.LogErr(err, "failed to marshal setup")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(send)
+	}
+}
+
+// TwoFactorConfirm - эндпоинт подтверждения второго фактора первым кодом из приложения-аутентификатора.
+func (h *Handler) TwoFactorConfirm() http.HandlerFunc {
+	return h.twoFactorChange(false)
+}
+
+// TwoFactorDisable - эндпоинт отключения второго фактора, требует действующий код или код восстановления.
+func (h *Handler) TwoFactorDisable() http.HandlerFunc {
+	return h.twoFactorChange(true)
+}
+
+// twoFactorChange - включение (disable = false) или отключение второго фактора после проверки кода.
+func (h *Handler) twoFactorChange(disable bool) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		var req models.TwoFactorRequest
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.logger.LogErr(err, "")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+		if err := json.Unmarshal(content, &req); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+
+		t, err := h.Storage.GetTOTP(userID)
+		if err != nil {
+			h.logger.LogErr(err, "failed to get two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case req.Code == "":
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("code is empty"))
+			return
+		case disable && !t.Enabled:
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("two-factor authentication is not enabled"))
+			return
+		case !disable && t.Secret == "":
+			rw.WriteHeader(http.StatusBadRequest)
+			rw.Write([]byte("two-factor authentication is not enrolled"))
+			return
+		case !disable && t.Enabled:
+			rw.WriteHeader(http.StatusConflict)
+			rw.Write([]byte("two-factor authentication is already enabled"))
+			return
+		}
+
+		ok, err := h.verifySecondFactor(userID, t, req.Code, disable)
+		if err != nil {
+			h.logger.LogErr(err, "failed to verify code")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			rw.WriteHeader(http.StatusForbidden)
+			rw.Write([]byte("wrong code"))
+			return
+		}
+		if disable {
+			err = h.Storage.DisableTOTP(userID)
+		} else {
+			err = h.Storage.EnableTOTP(userID)
+		}
+		if err != nil {
+			h.logger.LogErr(err, "failed to save two-factor settings")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,64 @@
+// Package handlers позволяет получать данные от клиентов, обрабатывать и отправлять в репозиторий для дальнейшей обработки.
+// Данный модуль проверяет версию записи при изменении и удалении, чтобы изменения с двух устройств не затирали друг друга.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// checkVersion - получение ожидаемой версии записи из заголовка If-Match ("3", W/"3" или 3) или, если заголовка нет,
+// из поля version тела запроса. If-Match: * изменяет запись без проверки версии. Если версии нет, отправляет
+// http.StatusPreconditionRequired, если заголовок неверный - http.StatusBadRequest, и возвращает false.
+func checkVersion(rw http.ResponseWriter, r *http.Request, version *int64) bool {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case v == "" && *version > 0:
+		return true
+	case v == "":
+		rw.WriteHeader(http.StatusPreconditionRequired)
+		rw.Write([]byte("item version is required in If-Match header or version field"))
+		return false
+	case v == "*":
+		*version = 0
+		return true
+	}
+	n, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(v, "W/"), `"`), 10, 64)
+	if err != nil || n <= 0 {
+		rw.WriteHeader(http.StatusBadRequest)
+		rw.Write([]byte("wrong If-Match header"))
+		return false
+	}
+	*version = n
+	return true
+}
+
+// writeItem - ответ на изменение записи: запись с новой версией, а при конфликте версий - текущая копия сервера,
+// чтобы клиент мог объединить изменения. Версия записи передается и в заголовке ETag. Неизвестная запись
+// и неверное содержимое записи отправляются статусом репозитория.
+func (h *Handler) writeItem(rw http.ResponseWriter, statusCode int, err error, item interface{}, version int64) {
+	switch statusCode {
+	case http.StatusOK, http.StatusConflict:
+	case http.StatusNotFound, http.StatusBadRequest:
+		rw.WriteHeader(statusCode)
+		rw.Write([]byte(err.Error()))
+		return
+	default:
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(err.Error()))
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("ETag", strconv.Quote(strconv.FormatInt(version, 10)))
+	rw.WriteHeader(statusCode)
+	rw.Write(itemJSON)
+}
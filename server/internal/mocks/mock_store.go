@@ -6,6 +6,7 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 
 	gomock "github.com/golang/mock/gomock"
@@ -308,4 +309,571 @@ func (m *MockStorage) DeleteBinary(arg0 *models.CryptoBinaryData, arg1 string) (
 func (mr *MockStorageMockRecorder) DeleteBinary(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBinary", reflect.TypeOf((*MockStorage)(nil).DeleteBinary), arg0)
-}
\ No newline at end of file
+}
+// SaveRefreshToken mocks base method.
+func (m *MockStorage) SaveRefreshToken(arg0 *models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRefreshToken", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRefreshToken indicates an expected call of SaveRefreshToken.
+func (mr *MockStorageMockRecorder) SaveRefreshToken(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefreshToken", reflect.TypeOf((*MockStorage)(nil).SaveRefreshToken), arg0)
+}
+
+// RotateRefreshToken mocks base method.
+func (m *MockStorage) RotateRefreshToken(arg0 string, arg1 *models.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateRefreshToken indicates an expected call of RotateRefreshToken.
+func (mr *MockStorageMockRecorder) RotateRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateRefreshToken", reflect.TypeOf((*MockStorage)(nil).RotateRefreshToken), arg0, arg1)
+}
+
+// RevokeRefreshToken mocks base method.
+func (m *MockStorage) RevokeRefreshToken(arg0 string, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshToken indicates an expected call of RevokeRefreshToken.
+func (mr *MockStorageMockRecorder) RevokeRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshToken", reflect.TypeOf((*MockStorage)(nil).RevokeRefreshToken), arg0, arg1)
+}
+
+// RevokeToken mocks base method.
+func (m *MockStorage) RevokeToken(arg0, arg1 string, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken.
+func (mr *MockStorageMockRecorder) RevokeToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockStorage)(nil).RevokeToken), arg0, arg1, arg2)
+}
+
+// IsTokenRevoked mocks base method.
+func (m *MockStorage) IsTokenRevoked(arg0 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsTokenRevoked", arg0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsTokenRevoked indicates an expected call of IsTokenRevoked.
+func (mr *MockStorageMockRecorder) IsTokenRevoked(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenRevoked", reflect.TypeOf((*MockStorage)(nil).IsTokenRevoked), arg0)
+}
+
+// CreateSession mocks base method.
+func (m *MockStorage) CreateSession(arg0 *models.Session, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockStorageMockRecorder) CreateSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockStorage)(nil).CreateSession), arg0, arg1)
+}
+
+// GetSessions mocks base method.
+func (m *MockStorage) GetSessions(arg0 string) (int, []models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessions", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]models.Session)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetSessions indicates an expected call of GetSessions.
+func (mr *MockStorageMockRecorder) GetSessions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessions", reflect.TypeOf((*MockStorage)(nil).GetSessions), arg0)
+}
+
+// RevokeSession mocks base method.
+func (m *MockStorage) RevokeSession(arg0 string, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockStorageMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockStorage)(nil).RevokeSession), arg0, arg1)
+}
+
+// TouchSession mocks base method.
+func (m *MockStorage) TouchSession(arg0 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchSession", arg0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TouchSession indicates an expected call of TouchSession.
+func (mr *MockStorageMockRecorder) TouchSession(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchSession", reflect.TypeOf((*MockStorage)(nil).TouchSession), arg0)
+}
+
+// SetTOTP mocks base method.
+func (m *MockStorage) SetTOTP(arg0 string, arg1 string, arg2 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTOTP", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTOTP indicates an expected call of SetTOTP.
+func (mr *MockStorageMockRecorder) SetTOTP(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTOTP", reflect.TypeOf((*MockStorage)(nil).SetTOTP), arg0, arg1, arg2)
+}
+
+// GetTOTP mocks base method.
+func (m *MockStorage) GetTOTP(arg0 string) (*models.TOTP, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTOTP", arg0)
+	ret0, _ := ret[0].(*models.TOTP)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTOTP indicates an expected call of GetTOTP.
+func (mr *MockStorageMockRecorder) GetTOTP(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTOTP", reflect.TypeOf((*MockStorage)(nil).GetTOTP), arg0)
+}
+
+// EnableTOTP mocks base method.
+func (m *MockStorage) EnableTOTP(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTOTP", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTOTP indicates an expected call of EnableTOTP.
+func (mr *MockStorageMockRecorder) EnableTOTP(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTOTP", reflect.TypeOf((*MockStorage)(nil).EnableTOTP), arg0)
+}
+
+// DisableTOTP mocks base method.
+func (m *MockStorage) DisableTOTP(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTOTP", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTOTP indicates an expected call of DisableTOTP.
+func (mr *MockStorageMockRecorder) DisableTOTP(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTOTP", reflect.TypeOf((*MockStorage)(nil).DisableTOTP), arg0)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockStorage) UseTOTPStep(arg0 string, arg1 int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockStorageMockRecorder) UseTOTPStep(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockStorage)(nil).UseTOTPStep), arg0, arg1)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockStorage) UseRecoveryCode(arg0 string, arg1 string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockStorageMockRecorder) UseRecoveryCode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockStorage)(nil).UseRecoveryCode), arg0, arg1)
+}
+
+// GetLogin mocks base method.
+func (m *MockStorage) GetLogin(arg0 string) (int, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLogin", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLogin indicates an expected call of GetLogin.
+func (mr *MockStorageMockRecorder) GetLogin(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLogin", reflect.TypeOf((*MockStorage)(nil).GetLogin), arg0)
+}
+
+// GetLoginLock mocks base method.
+func (m *MockStorage) GetLoginLock(arg0 string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginLock", arg0)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginLock indicates an expected call of GetLoginLock.
+func (mr *MockStorageMockRecorder) GetLoginLock(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginLock", reflect.TypeOf((*MockStorage)(nil).GetLoginLock), arg0)
+}
+
+// RecordLoginFailure mocks base method.
+func (m *MockStorage) RecordLoginFailure(arg0 string, arg1 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordLoginFailure", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordLoginFailure indicates an expected call of RecordLoginFailure.
+func (mr *MockStorageMockRecorder) RecordLoginFailure(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordLoginFailure", reflect.TypeOf((*MockStorage)(nil).RecordLoginFailure), arg0, arg1)
+}
+
+// LockLogin mocks base method.
+func (m *MockStorage) LockLogin(arg0 string, arg1 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockStorageMockRecorder) LockLogin(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockStorage)(nil).LockLogin), arg0, arg1)
+}
+
+// ResetLoginFailures mocks base method.
+func (m *MockStorage) ResetLoginFailures(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginFailures", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginFailures indicates an expected call of ResetLoginFailures.
+func (mr *MockStorageMockRecorder) ResetLoginFailures(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginFailures", reflect.TypeOf((*MockStorage)(nil).ResetLoginFailures), arg0)
+}
+
+// ChangePassword mocks base method.
+func (m *MockStorage) ChangePassword(arg0 string, arg1 string, arg2 string, arg3 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockStorageMockRecorder) ChangePassword(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockStorage)(nil).ChangePassword), arg0, arg1, arg2, arg3)
+}
+
+// DeleteAccount mocks base method.
+func (m *MockStorage) DeleteAccount(arg0 string, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAccount", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteAccount indicates an expected call of DeleteAccount.
+func (mr *MockStorageMockRecorder) DeleteAccount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccount", reflect.TypeOf((*MockStorage)(nil).DeleteAccount), arg0, arg1)
+}
+
+// SaveKey mocks base method.
+func (m *MockStorage) SaveKey(arg0 string, arg1 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveKey indicates an expected call of SaveKey.
+func (mr *MockStorageMockRecorder) SaveKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveKey", reflect.TypeOf((*MockStorage)(nil).SaveKey), arg0, arg1)
+}
+
+// GetKey mocks base method.
+func (m *MockStorage) GetKey(arg0 string) (int, *models.SealedKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetKey", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*models.SealedKey)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetKey indicates an expected call of GetKey.
+func (mr *MockStorageMockRecorder) GetKey(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetKey", reflect.TypeOf((*MockStorage)(nil).GetKey), arg0)
+}
+
+// RotateItems mocks base method.
+func (m *MockStorage) RotateItems(arg0 *models.ItemBatch, arg1 string, arg2 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateItems", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateItems indicates an expected call of RotateItems.
+func (mr *MockStorageMockRecorder) RotateItems(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateItems", reflect.TypeOf((*MockStorage)(nil).RotateItems), arg0, arg1, arg2)
+}
+
+// Sync mocks base method.
+func (m *MockStorage) Sync(arg0 string, arg1 int64) (int, *models.SyncDelta, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sync", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*models.SyncDelta)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Sync indicates an expected call of Sync.
+func (mr *MockStorageMockRecorder) Sync(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sync", reflect.TypeOf((*MockStorage)(nil).Sync), arg0, arg1)
+}
+
+// GetHistory mocks base method.
+func (m *MockStorage) GetHistory(arg0 string, arg1 string, arg2 int) (int, []models.HistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]models.HistoryEntry)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockStorageMockRecorder) GetHistory(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockStorage)(nil).GetHistory), arg0, arg1, arg2)
+}
+
+// RestoreItem mocks base method.
+func (m *MockStorage) RestoreItem(arg0 string, arg1 string, arg2 int, arg3 int64, arg4 int64) (int, *models.HistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreItem", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(*models.HistoryEntry)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RestoreItem indicates an expected call of RestoreItem.
+func (mr *MockStorageMockRecorder) RestoreItem(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreItem", reflect.TypeOf((*MockStorage)(nil).RestoreItem), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetHistoryDepth mocks base method.
+func (m *MockStorage) GetHistoryDepth(arg0 string) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistoryDepth", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetHistoryDepth indicates an expected call of GetHistoryDepth.
+func (mr *MockStorageMockRecorder) GetHistoryDepth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistoryDepth", reflect.TypeOf((*MockStorage)(nil).GetHistoryDepth), arg0)
+}
+
+// SetHistoryDepth mocks base method.
+func (m *MockStorage) SetHistoryDepth(arg0 string, arg1 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetHistoryDepth", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetHistoryDepth indicates an expected call of SetHistoryDepth.
+func (mr *MockStorageMockRecorder) SetHistoryDepth(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHistoryDepth", reflect.TypeOf((*MockStorage)(nil).SetHistoryDepth), arg0, arg1)
+}
+
+// GetTrash mocks base method.
+func (m *MockStorage) GetTrash(arg0 string) (int, []models.TrashEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTrash", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]models.TrashEntry)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetTrash indicates an expected call of GetTrash.
+func (mr *MockStorageMockRecorder) GetTrash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTrash", reflect.TypeOf((*MockStorage)(nil).GetTrash), arg0)
+}
+
+// RestoreTrash mocks base method.
+func (m *MockStorage) RestoreTrash(arg0 string, arg1 string, arg2 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreTrash", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreTrash indicates an expected call of RestoreTrash.
+func (mr *MockStorageMockRecorder) RestoreTrash(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreTrash", reflect.TypeOf((*MockStorage)(nil).RestoreTrash), arg0, arg1, arg2)
+}
+
+// EmptyTrash mocks base method.
+func (m *MockStorage) EmptyTrash(arg0 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EmptyTrash", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EmptyTrash indicates an expected call of EmptyTrash.
+func (mr *MockStorageMockRecorder) EmptyTrash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EmptyTrash", reflect.TypeOf((*MockStorage)(nil).EmptyTrash), arg0)
+}
+
+// PurgeTrash mocks base method.
+func (m *MockStorage) PurgeTrash(arg0 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeTrash", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeTrash indicates an expected call of PurgeTrash.
+func (mr *MockStorageMockRecorder) PurgeTrash(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeTrash", reflect.TypeOf((*MockStorage)(nil).PurgeTrash), arg0)
+}
+
+// GetItems mocks base method.
+func (m *MockStorage) GetItems(arg0 string, arg1 string) (int, []models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItems", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]models.Item)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetItems indicates an expected call of GetItems.
+func (mr *MockStorageMockRecorder) GetItems(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockStorage)(nil).GetItems), arg0, arg1)
+}
+
+// CollectItem mocks base method.
+func (m *MockStorage) CollectItem(arg0 *models.Item, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CollectItem", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CollectItem indicates an expected call of CollectItem.
+func (mr *MockStorageMockRecorder) CollectItem(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CollectItem", reflect.TypeOf((*MockStorage)(nil).CollectItem), arg0, arg1)
+}
+
+// UpdateItem mocks base method.
+func (m *MockStorage) UpdateItem(arg0 *models.Item, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateItem", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateItem indicates an expected call of UpdateItem.
+func (mr *MockStorageMockRecorder) UpdateItem(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItem", reflect.TypeOf((*MockStorage)(nil).UpdateItem), arg0, arg1)
+}
+
+// DeleteItem mocks base method.
+func (m *MockStorage) DeleteItem(arg0 *models.Item, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteItem", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteItem indicates an expected call of DeleteItem.
+func (mr *MockStorageMockRecorder) DeleteItem(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteItem", reflect.TypeOf((*MockStorage)(nil).DeleteItem), arg0, arg1)
+}
@@ -0,0 +1,100 @@
+// Package models package model позволяет использовать все структуры. Между сервером и клиентом,
+// т.к. на клиенте такие же структуры данных.
+// Данный модуль описывает запись любого вида и реестр видов записей.
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Item - зашифрованная запись любого вида: вид, содержимое и общие поля. Сервер не разбирает Payload,
+// поэтому новый вид секретов добавляется одной регистрацией вида (см. RegisterItemKind).
+// У встроенных видов Payload - JSON их зашифрованных полей (CardPayload, PasswordPayload, TextPayload, BinaryPayload).
+type Item struct {
+	Type     string `json:"type"`
+	UID      int    `json:"uid"`
+	Payload  []byte `json:"payload"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
+}
+
+// CardPayload - содержимое карты в Item.Payload.
+type CardPayload struct {
+	Name   []byte `json:"name"`
+	Number []byte `json:"number"`
+	CVC    []byte `json:"cvc"`
+}
+
+// PasswordPayload - содержимое пары логин/пароль в Item.Payload.
+type PasswordPayload struct {
+	Login []byte `json:"login"`
+	Pass  []byte `json:"pass"`
+}
+
+// TextPayload - содержимое текстовых данных в Item.Payload.
+type TextPayload struct {
+	Text []byte `json:"text"`
+}
+
+// BinaryPayload - содержимое бинарных данных в Item.Payload.
+type BinaryPayload struct {
+	Data []byte `json:"data"`
+}
+
+// ItemKind - вид записей. Записи встроенных видов хранятся в своих таблицах и доступны также по старым
+// эндпоинтам /api/data, записи остальных видов - в общей таблице items.
+type ItemKind struct {
+	Name    string `json:"name"`
+	Builtin bool   `json:"builtin"`
+}
+
+// kindName - допустимое имя вида: оно входит в путь API и хранится в колонке item_type длиной 20 символов.
+var kindName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+
+// реестр видов записей, встроенные виды зарегистрированы всегда
+var (
+	kindsMu   sync.RWMutex
+	itemKinds = map[string]ItemKind{
+		ItemCards:     {Name: ItemCards, Builtin: true},
+		ItemPasswords: {Name: ItemPasswords, Builtin: true},
+		ItemTexts:     {Name: ItemTexts, Builtin: true},
+		ItemBinaries:  {Name: ItemBinaries, Builtin: true},
+	}
+)
+
+// RegisterItemKind - регистрация нового вида записей name. Повторная регистрация вида не ошибка.
+func RegisterItemKind(name string) error {
+	if !kindName.MatchString(name) {
+		return fmt.Errorf("wrong item kind %q: use up to 20 lowercase letters, digits or _", name)
+	}
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	if _, ok := itemKinds[name]; !ok {
+		itemKinds[name] = ItemKind{Name: name}
+	}
+	return nil
+}
+
+// LookupItemKind - вид записей name, false если такой вид не зарегистрирован.
+func LookupItemKind(name string) (ItemKind, bool) {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kind, ok := itemKinds[name]
+	return kind, ok
+}
+
+// ItemKinds - все зарегистрированные виды записей по имени.
+func ItemKinds() []ItemKind {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	kinds := make([]ItemKind, 0, len(itemKinds))
+	for _, kind := range itemKinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i].Name < kinds[j].Name })
+	return kinds
+}
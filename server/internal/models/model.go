@@ -2,13 +2,20 @@
 // т.к. на клиенте такие же структуры данных.
 package models
 
-import "crypto/rsa"
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"time"
+)
 
-// User - структура пользователя.
+// User - структура пользователя. Клиент отправляет AuthKey - ключ аутентификации, полученный из мастер-пароля,
+// а сам пароль только один раз для перевода старого аккаунта на ключ аутентификации.
 type User struct {
 	UID      string `json:"uid"`
 	Login    string `json:"login"`
-	Password string `json:"password"`
+	Password string `json:"password,omitempty"`
+	AuthKey  string `json:"auth_key,omitempty"`
+	Device   string `json:"device,omitempty"`
 }
 
 // Card - структура карты.
@@ -48,35 +55,214 @@ type Data struct {
 
 // KeyAndToken - структура получения ключа шифрования и токена авторизации от сервера.
 type KeyAndToken struct {
-	Key   *rsa.PublicKey `json:"key"`
-	Token string         `json:"token"`
+	Key          *rsa.PublicKey `json:"key"`
+	Token        string         `json:"token"`
+	RefreshToken string         `json:"refresh_token"`
 }
 
-// CryptoPassword - структура зашифрованной пары логина/пароля
+// Session - структура сессии, одного входа пользователя с устройства.
+// Идентификатор сессии совпадает с семейством ее токенов обновления.
+type Session struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
+// TOTP - структура настроек двухфакторной аутентификации пользователя.
+type TOTP struct {
+	Login    string // Логин пользователя, подпись аккаунта в приложении-аутентификаторе.
+	Secret   string // Секрет TOTP, пустой если второй фактор не подключался.
+	Enabled  bool   // Второй фактор подтвержден и требуется при входе.
+	LastStep int64  // Последний принятый интервал, чтобы один код нельзя было использовать дважды.
+}
+
+// TwoFactorSetup - структура ответа на подключение двухфакторной аутентификации.
+type TwoFactorSetup struct {
+	URI           string   `json:"uri"`
+	Secret        string   `json:"secret"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactorRequest - структура кода второго фактора. Challenge и Device заполняются при входе.
+type TwoFactorRequest struct {
+	Challenge string `json:"challenge,omitempty"`
+	Code      string `json:"code"`
+	Device    string `json:"device,omitempty"`
+}
+
+// Challenge - структура ответа на вход, когда пароль верный, но нужен второй фактор.
+type Challenge struct {
+	Challenge string `json:"challenge"`
+}
+
+// ChangePassword - структура запроса смены мастер-пароля. Клиенты с ключом аутентификации
+// отправляют в полях текущий и новый ключи, а не пароли.
+type ChangePassword struct {
+	Password    string `json:"password"`
+	NewPassword string `json:"new_password"`
+}
+
+// SealedKey - закрытый ключ пользователя, зашифрованный на клиенте ключом из мастер-пароля.
+// Сервер хранит его как есть и не может расшифровать.
+type SealedKey struct {
+	Key       []byte    `json:"key"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// ItemBatch - все записи пользователя, перешифрованные новым ключом, и новый ключ, зашифрованный на клиенте.
+// Сервер заменяет записи и ключ одной транзакцией. Items - записи видов, зарегистрированных через RegisterItemKind.
+type ItemBatch struct {
+	Cards     []CryptoCard       `json:"cards"`
+	Passwords []CryptoPassword   `json:"passwords"`
+	Texts     []CryptoTextData   `json:"texts"`
+	Binaries  []CryptoBinaryData `json:"binaries"`
+	Items     []Item             `json:"items,omitempty"`
+	Key       []byte             `json:"key"`
+}
+
+// RefreshRequest - структура запроса обновления токенов и выхода.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken - структура токена обновления. Хранится только хэш токена.
+// Токены одного входа образуют семейство (Family): при обновлении старый токен помечается использованным,
+// а новый получает то же семейство.
+type RefreshToken struct {
+	Hash      string    `json:"hash"`
+	Family    string    `json:"family"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Used      bool      `json:"used"`
+	Revoked   bool      `json:"revoked"`
+}
+
+// Виды записей, совпадают с последней частью пути API.
+const (
+	ItemCards     = "cards"
+	ItemPasswords = "password"
+	ItemTexts     = "text"
+	ItemBinaries  = "binary"
+)
+
+// Tombstone - след удаленной записи: вид, идентификатор и ревизия удаления.
+type Tombstone struct {
+	Type     string `json:"type"`
+	UID      int    `json:"uid"`
+	Revision int64  `json:"revision"`
+}
+
+// SyncDelta - структура ответа синхронизации: записи, измененные после ревизии клиента, и удаленные записи.
+// Revision - текущая ревизия пользователя, клиент передает ее в следующий запрос. Full означает, что в ответе
+// все записи и локальную копию нужно заменить, а не дополнить. Items - записи видов, зарегистрированных
+// через RegisterItemKind.
+type SyncDelta struct {
+	Revision  int64              `json:"revision"`
+	Full      bool               `json:"full"`
+	Cards     []CryptoCard       `json:"cards"`
+	Passwords []CryptoPassword   `json:"passwords"`
+	Texts     []CryptoTextData   `json:"texts"`
+	Binaries  []CryptoBinaryData `json:"binaries"`
+	Items     []Item             `json:"items,omitempty"`
+	Deleted   []Tombstone        `json:"deleted"`
+}
+
+// HistoryEntry - прежняя версия записи: вид, идентификатор, номер версии, время, когда ее заменили,
+// и сама запись в том виде, в каком ее хранил сервер, то есть зашифрованной.
+type HistoryEntry struct {
+	Type      string          `json:"type"`
+	UID       int             `json:"uid"`
+	Version   int64           `json:"version"`
+	ChangedAt time.Time       `json:"changed_at"`
+	Item      json.RawMessage `json:"item"`
+}
+
+// Глубина истории записей: сколько прежних версий каждой записи хранится. Ноль отключает историю.
+const (
+	DefaultHistoryDepth = 10
+	MaxHistoryDepth     = 100
+)
+
+// HistorySettings - структура настроек истории пользователя.
+type HistorySettings struct {
+	Depth int `json:"depth"`
+}
+
+// RestoreRequest - структура запроса восстановления записи: From - версия из истории, Version - текущая версия
+// записи, как при изменении.
+type RestoreRequest struct {
+	From    int64 `json:"from"`
+	Version int64 `json:"version,omitempty"`
+}
+
+// TrashEntry - удаленная запись в корзине: вид, идентификатор, время удаления и сама запись, зашифрованная.
+type TrashEntry struct {
+	Type      string          `json:"type"`
+	UID       int             `json:"uid"`
+	DeletedAt time.Time       `json:"deleted_at"`
+	Item      json.RawMessage `json:"item"`
+}
+
+// TrashRestore - структура запроса восстановления записи из корзины.
+type TrashRestore struct {
+	Type string `json:"type"`
+	UID  int    `json:"uid"`
+}
+
+// ItemMeta - общие поля всех записей. Название, адрес сайта, заметка и метки приходят зашифрованными, как и сама
+// запись. Отметка избранного хранится открыто, а время создания и последнего изменения ставит сервер.
+type ItemMeta struct {
+	Title     []byte    `json:"title,omitempty"`
+	URL       []byte    `json:"url,omitempty"`
+	Notes     []byte    `json:"notes,omitempty"`
+	Tags      []byte    `json:"tags,omitempty"`
+	Favorite  bool      `json:"favorite,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CryptoPassword - структура зашифрованной пары логина/пароля. Revision - ревизия последнего изменения записи,
+// Version - версия записи, которую клиент передает при изменении, чтобы не затереть чужое изменение.
 type CryptoPassword struct {
-	UID   int    `json:"uid_pass"`
-	Login []byte `json:"data_pass"`
-	Pass  []byte `json:"pass"`
+	UID      int    `json:"uid_pass"`
+	Login    []byte `json:"data_pass"`
+	Pass     []byte `json:"pass"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 // CryptoBinaryData - структура зашифрованных бинарных данных.
 type CryptoBinaryData struct {
-	UID  int    `json:"uid_binary"`
-	Data []byte `json:"data"`
+	UID      int    `json:"uid_binary"`
+	Data     []byte `json:"data"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 // CryptoTextData - структура зашифрованных текстовых данных.
 type CryptoTextData struct {
-	UID  int    `json:"uid_text"`
-	Text []byte `json:"text"`
+	UID      int    `json:"uid_text"`
+	Text     []byte `json:"text"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 // CryptoCard - структура зашифрованных карт.
 type CryptoCard struct {
-	UID    int    `json:"UID"`
-	Name   []byte `json:"name"`
-	Number []byte `json:"number"`
-	CVC    []byte `json:"cvc"`
+	UID      int    `json:"UID"`
+	Name     []byte `json:"name"`
+	Number   []byte `json:"number"`
+	CVC      []byte `json:"cvc"`
+	Revision int64  `json:"revision,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+	ItemMeta
 }
 
 // CryptoData - общая структура всех зашифрованных данных.
@@ -0,0 +1,29 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль выбирает, что проверять при входе: ключ аутентификации или пароль аккаунтов, созданных до ключей.
+package repositories
+
+import (
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+)
+
+// userSecret - секрет нового пользователя, хэш которого хранится в базе. Клиенты с ключом аутентификации
+// не отправляют мастер-пароль, старые клиенты регистрируются по паролю.
+func userSecret(u *models.User) (string, bool) {
+	if u.AuthKey != "" {
+		return u.AuthKey, true
+	}
+	return u.Password, false
+}
+
+// loginSecret - секрет, который проверяется при входе. Аккаунт, созданный до ключей аутентификации, проверяется
+// по паролю, и если клиент прислал только ключ, возвращается storage.ErrAuthUpgrade.
+func loginSecret(u *models.User, authKey bool) (string, error) {
+	if authKey {
+		return u.AuthKey, nil
+	}
+	if u.Password == "" {
+		return "", storage.ErrAuthUpgrade
+	}
+	return u.Password, nil
+}
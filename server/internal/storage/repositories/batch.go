@@ -0,0 +1,96 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль проверяет пакет записей для смены ключа: в нем должны быть ровно все записи пользователя
+// в тех версиях, что хранятся на сервере.
+package repositories
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// batchIDs - идентификаторы записей пакета по таблицам. Идентификаторы в таблице items общие для всех видов,
+// поэтому записи всех видов, зарегистрированных через models.RegisterItemKind, проверяются вместе.
+func batchIDs(b *models.ItemBatch) map[string][]int {
+	ids := map[string][]int{tableCards: nil, tablePasswords: nil, tableTexts: nil, tableBinaries: nil, tableItems: nil}
+	for _, d := range b.Cards {
+		ids[tableCards] = append(ids[tableCards], d.UID)
+	}
+	for _, d := range b.Passwords {
+		ids[tablePasswords] = append(ids[tablePasswords], d.UID)
+	}
+	for _, d := range b.Texts {
+		ids[tableTexts] = append(ids[tableTexts], d.UID)
+	}
+	for _, d := range b.Binaries {
+		ids[tableBinaries] = append(ids[tableBinaries], d.UID)
+	}
+	for _, d := range b.Items {
+		ids[tableItems] = append(ids[tableItems], d.UID)
+	}
+	return ids
+}
+
+// checkBatchIDs - проверка, что в таблице table у пользователя ровно записи want. Если записи добавили или удалили
+// после того, как клиент их получил, часть данных осталась бы зашифрована старым ключом.
+func checkBatchIDs(table string, have, want []int) error {
+	have = append([]int(nil), have...)
+	want = append([]int(nil), want...)
+	sort.Ints(have)
+	sort.Ints(want)
+	if len(have) != len(want) {
+		return fmt.Errorf("%s changed: %d items stored, %d sent", table, len(have), len(want))
+	}
+	for i := range have {
+		if have[i] != want[i] {
+			return fmt.Errorf("%s changed: item %d was not sent", table, have[i])
+		}
+	}
+	return nil
+}
+
+// addVersion - сохранение версии записи uid таблицы table.
+func addVersion(versions map[string]map[int]int64, table string, uid int, version int64) {
+	if versions[table] == nil {
+		versions[table] = make(map[int]int64)
+	}
+	versions[table][uid] = version
+}
+
+// checkBatchVersions - проверка, что записи пакета не изменились после того, как клиент их получил: иначе смена
+// ключа затерла бы изменение с другого устройства. Записи без версии не проверяются.
+func checkBatchVersions(b *models.ItemBatch, versions map[string]map[int]int64) error {
+	check := func(table string, uid int, version int64) error {
+		if version != 0 && versions[table][uid] != version {
+			return fmt.Errorf("%s changed: item %d has version %d, %d sent", table, uid, versions[table][uid], version)
+		}
+		return nil
+	}
+	for _, d := range b.Cards {
+		if err := check(tableCards, d.UID, d.Version); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.Passwords {
+		if err := check(tablePasswords, d.UID, d.Version); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.Texts {
+		if err := check(tableTexts, d.UID, d.Version); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.Binaries {
+		if err := check(tableBinaries, d.UID, d.Version); err != nil {
+			return err
+		}
+	}
+	for _, d := range b.Items {
+		if err := check(tableItems, d.UID, d.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль хранит все данные в одном локальном файле bbolt и не требует PostgreSQL.
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// boltJournal - журнал MemStore, который хранит каждую запись таблицы в отдельном ключе бакета bbolt.
+type boltJournal struct {
+	db *bolt.DB
+}
+
+// NewFileStore - функция создания репозитория в одном файле cfg.StoragePath.
+// Все данные читаются в память при старте, каждое изменение записывается в файл одной транзакцией,
+// поэтому данные переживают перезапуск сервера.
+func NewFileStore(cfg *config.Config, logger *loggers.Logger) (*MemStore, error) {
+	db, err := bolt.Open(cfg.StoragePath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		logger.LogErr(err, "failed to open storage file")
+		return nil, err
+	}
+	j := &boltJournal{db: db}
+	s := NewMemStore(cfg, logger)
+	if err = j.load(s); err != nil {
+		logger.LogErr(err, "failed to load storage file")
+		db.Close()
+		return nil, err
+	}
+	s.journal = j
+	return s, nil
+}
+
+// commit - запись всех операций в файл одной транзакцией.
+func (j *boltJournal) commit(ops []journalOp) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		for _, op := range ops {
+			b, err := tx.CreateBucketIfNotExists([]byte(op.table))
+			if err != nil {
+				return err
+			}
+			if op.value == nil {
+				if err = b.Delete([]byte(op.key)); err != nil {
+					return err
+				}
+				continue
+			}
+			v, err := json.Marshal(op.value)
+			if err != nil {
+				return err
+			}
+			if err = b.Put([]byte(op.key), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (j *boltJournal) close() error {
+	return j.db.Close()
+}
+
+// load - чтение всех таблиц из файла в память репозитория.
+func (j *boltJournal) load(s *MemStore) error {
+	return j.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				return s.loadRecord(string(name), string(k), v)
+			})
+		})
+	})
+}
+
+// loadRecord - восстановление одной записи таблицы в памяти репозитория.
+func (s *MemStore) loadRecord(table, key string, v []byte) error {
+	var err error
+	switch table {
+	case tableSequences:
+		var n int
+		err = json.Unmarshal(v, &n)
+		s.lastID[key] = n
+	case tableUsers:
+		var u memUser
+		err = json.Unmarshal(v, &u)
+		s.users[u.ID] = u
+		s.logins[u.Login] = u.ID
+	case tableCards:
+		var c memCard
+		err = json.Unmarshal(v, &c)
+		c.Version = firstVersion(c.Version)
+		s.cards[c.UID] = c
+	case tablePasswords:
+		var p memPassword
+		err = json.Unmarshal(v, &p)
+		p.Version = firstVersion(p.Version)
+		s.passwords[p.UID] = p
+	case tableTexts:
+		var t memText
+		err = json.Unmarshal(v, &t)
+		t.Version = firstVersion(t.Version)
+		s.texts[t.UID] = t
+	case tableBinaries:
+		var b memBinary
+		err = json.Unmarshal(v, &b)
+		b.Version = firstVersion(b.Version)
+		s.binaries[b.UID] = b
+	case tableItems:
+		var it memItem
+		err = json.Unmarshal(v, &it)
+		s.items[it.UID] = it
+	case tableRefresh:
+		var t models.RefreshToken
+		err = json.Unmarshal(v, &t)
+		s.refresh[t.Hash] = t
+	case tableRevoked:
+		var t memRevokedToken
+		err = json.Unmarshal(v, &t)
+		s.revoked[t.JTI] = t
+	case tableSessions:
+		var ms memSession
+		err = json.Unmarshal(v, &ms)
+		s.sessions[ms.ID] = ms
+	case tableAttempts:
+		var a memLoginAttempts
+		err = json.Unmarshal(v, &a)
+		s.attempts[a.Login] = a
+	case tableKeys:
+		var k memKey
+		err = json.Unmarshal(v, &k)
+		s.keys[k.UserID] = k
+	case tableDeleted:
+		var t memTombstone
+		err = json.Unmarshal(v, &t)
+		s.deleted[t.key()] = t
+	case tableHistory:
+		var h memHistory
+		err = json.Unmarshal(v, &h)
+		s.history[h.key()] = h
+	default:
+		return fmt.Errorf("unknown table %s", table)
+	}
+	if err != nil {
+		return fmt.Errorf("table %s key %s: %w", table, key, err)
+	}
+	return nil
+}
+
+// firstVersion - версия записи, сохраненной до появления версий: такие записи считаются первой версией,
+// как и в миграции PostgreSQL.
+func firstVersion(version int64) int64 {
+	if version == 0 {
+		return 1
+	}
+	return version
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+func TestFileStore_Restart(t *testing.T) {
+	s, teardown := TestFileStore(t, CFG)
+	path := s.journal.(*boltJournal).db.Path()
+
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	_, err = s.CollectCard(&models.CryptoCard{Number: []byte("1"), Name: []byte("n"), CVC: []byte("c")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("login"), Pass: []byte("pass")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("first")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("second")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectBinary(&models.CryptoBinaryData{Data: []byte("data")}, uid)
+	assert.NoError(t, err)
+	_, txt, _ := s.GetText(uid)
+	_, err = s.DeleteText(&txt[0], uid)
+	assert.NoError(t, err)
+	_, err = s.UpdateText(&models.CryptoTextData{UID: txt[1].UID, Text: []byte("updated")}, uid)
+	assert.NoError(t, err)
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "1", Family: "f", UserID: uid, ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.NoError(t, s.RevokeToken("jti", uid, time.Now().Add(time.Hour)))
+	assert.NoError(t, s.SaveKey(uid, []byte("sealed")))
+	_, err = s.SetHistoryDepth(uid, 3)
+	assert.NoError(t, err)
+	assert.NoError(t, models.RegisterItemKind("note"))
+	_, err = s.CollectItem(&models.Item{Type: "note", Payload: []byte("note")}, uid)
+	assert.NoError(t, err)
+	teardown()
+
+	cfg := CFG
+	cfg.StoragePath = path
+	s, err = NewFileStore(&cfg, loggers.NewLogger())
+	assert.NoError(t, err)
+	defer s.Close()
+
+	id, err := s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	assert.Equal(t, uid, id)
+	_, err = s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.Error(t, err)
+
+	_, c, err := s.GetCards(uid)
+	assert.NoError(t, err)
+	assert.Len(t, c, 1)
+	status, err := s.CollectCard(&models.CryptoCard{Number: []byte("1")}, uid)
+	assert.Error(t, err)
+	assert.Equal(t, 500, status)
+
+	_, p, _ := s.GetPassword(uid)
+	assert.Len(t, p, 1)
+	_, b, _ := s.GetBinary(uid)
+	assert.Len(t, b, 1)
+	_, txt, _ = s.GetText(uid)
+	assert.Len(t, txt, 1)
+	assert.Equal(t, []byte("updated"), txt[0].Text)
+
+	_, k, err := s.GetKey(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("sealed"), k.Key)
+
+	revoked, err := s.IsTokenRevoked("jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	next := models.RefreshToken{Hash: "2", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, s.RotateRefreshToken("1", &next))
+	assert.Equal(t, uid, next.UserID)
+
+	//ревизии и следы удаления переживают перезапуск.
+	_, d, err := s.Sync(uid, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Tombstone{{Type: models.ItemTexts, UID: 1, Revision: 6}}, d.Deleted)
+	assert.Len(t, d.Texts, 1)
+
+	//история и ее глубина переживают перезапуск.
+	_, history, err := s.GetHistory(uid, models.ItemTexts, txt[0].UID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	_, depth, _ := s.GetHistoryDepth(uid)
+	assert.Equal(t, 3, depth)
+
+	//удаленная запись остается в корзине после перезапуска.
+	_, trash, err := s.GetTrash(uid)
+	assert.NoError(t, err)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, models.ItemTexts, trash[0].Type)
+
+	//записи остальных видов переживают перезапуск.
+	_, items, err := s.GetItems(uid, "note")
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, []byte("note"), items[0].Payload)
+
+	//идентификаторы продолжают нумерацию после перезапуска.
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("third")}, uid)
+	assert.NoError(t, err)
+	_, txt, _ = s.GetText(uid)
+	assert.Equal(t, 3, txt[1].UID)
+}
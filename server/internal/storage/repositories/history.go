@@ -0,0 +1,104 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль восстанавливает записи из истории одинаково для обоих репозиториев: восстановление - обычное
+// изменение записи, поэтому проверка версии работает как при изменении, а текущая версия тоже попадает в историю.
+package repositories
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// itemTables - таблица записей для каждого вида записи API.
+var itemTables = map[string]string{
+	models.ItemCards:     tableCards,
+	models.ItemPasswords: tablePasswords,
+	models.ItemTexts:     tableTexts,
+	models.ItemBinaries:  tableBinaries,
+}
+
+// restorer - репозиторий, в котором записи восстанавливаются из истории.
+type restorer interface {
+	historyItem(id, itemType string, uid int, version int64) (int, []byte, error)
+	UpdateCard(d *models.CryptoCard, id string) (int, error)
+	UpdatePassword(d *models.CryptoPassword, id string) (int, error)
+	UpdateText(d *models.CryptoTextData, id string) (int, error)
+	UpdateBinary(d *models.CryptoBinaryData, id string) (int, error)
+	UpdateItem(d *models.Item, id string) (int, error)
+}
+
+// restoreItem - замена записи uid вида itemType пользователя id ее версией from из истории. Текущая версия записи
+// должна совпадать с version, нулевая версия не проверяется. Возвращает запись с новой версией, а при конфликте
+// версий - текущую копию и 409. Время записи - время изменения, которое сохранил репозиторий. Если такой версии
+// в истории нет, возвращается 404.
+func restoreItem(s restorer, id, itemType string, uid int, from, version int64) (int, *models.HistoryEntry, error) {
+	status, data, err := s.historyItem(id, itemType, uid, from)
+	if err != nil {
+		return status, nil, err
+	}
+	var item interface{}
+	var current int64
+	var changedAt time.Time
+	switch itemType {
+	case models.ItemCards:
+		var d models.CryptoCard
+		if err = json.Unmarshal(data, &d); err != nil {
+			return 500, nil, err
+		}
+		d.UID, d.Version = uid, version
+		status, err = s.UpdateCard(&d, id)
+		item, current, changedAt = d, d.Version, d.UpdatedAt
+	case models.ItemPasswords:
+		var d models.CryptoPassword
+		if err = json.Unmarshal(data, &d); err != nil {
+			return 500, nil, err
+		}
+		d.UID, d.Version = uid, version
+		status, err = s.UpdatePassword(&d, id)
+		item, current, changedAt = d, d.Version, d.UpdatedAt
+	case models.ItemTexts:
+		var d models.CryptoTextData
+		if err = json.Unmarshal(data, &d); err != nil {
+			return 500, nil, err
+		}
+		d.UID, d.Version = uid, version
+		status, err = s.UpdateText(&d, id)
+		item, current, changedAt = d, d.Version, d.UpdatedAt
+	case models.ItemBinaries:
+		var d models.CryptoBinaryData
+		if err = json.Unmarshal(data, &d); err != nil {
+			return 500, nil, err
+		}
+		d.UID, d.Version = uid, version
+		status, err = s.UpdateBinary(&d, id)
+		item, current, changedAt = d, d.Version, d.UpdatedAt
+	default:
+		var d models.Item
+		if err = json.Unmarshal(data, &d); err != nil {
+			return 500, nil, err
+		}
+		d.Type, d.UID, d.Version = itemType, uid, version
+		status, err = s.UpdateItem(&d, id)
+		item, current, changedAt = d, d.Version, d.UpdatedAt
+	}
+	if status != 200 && status != 409 {
+		return status, nil, err
+	}
+	raw, mErr := json.Marshal(item)
+	if mErr != nil {
+		return 500, nil, mErr
+	}
+	return status, &models.HistoryEntry{Type: itemType, UID: uid, Version: current, ChangedAt: changedAt, Item: raw}, err
+}
+
+// overDepth - версии, которые не помещаются в историю глубины depth: все, кроме depth самых новых.
+func overDepth(versions []int64, depth int) []int64 {
+	if len(versions) <= depth {
+		return nil
+	}
+	sorted := append([]int64(nil), versions...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	return sorted[depth:]
+}
@@ -0,0 +1,176 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль дает доступ к записям любого вида одинаково для обоих репозиториев: записи встроенных видов
+// переводятся в структуры вида и обрабатываются методами вида, а записи остальных видов хранятся в общей таблице items.
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+)
+
+// itemKind - вид записей itemType. Для незарегистрированного вида возвращает 404.
+func itemKind(itemType string) (models.ItemKind, int, error) {
+	kind, ok := models.LookupItemKind(itemType)
+	if !ok {
+		return kind, 404, storage.ErrUnknownKind
+	}
+	return kind, 200, nil
+}
+
+// itemTable - таблица записей вида itemType: у встроенных видов своя таблица, остальные хранятся в таблице items.
+func itemTable(itemType string) string {
+	if table, ok := itemTables[itemType]; ok {
+		return table
+	}
+	return tableItems
+}
+
+// typedLister - репозиторий со списками записей встроенных видов.
+type typedLister interface {
+	GetCards(id string) (int, []models.CryptoCard, error)
+	GetPassword(id string) (int, []models.CryptoPassword, error)
+	GetText(id string) (int, []models.CryptoTextData, error)
+	GetBinary(id string) (int, []models.CryptoBinaryData, error)
+}
+
+// builtinItems - записи встроенного вида itemType пользователя id.
+func builtinItems(s typedLister, id, itemType string) (int, []models.Item, error) {
+	var data []models.Item
+	switch itemType {
+	case models.ItemCards:
+		status, cards, err := s.GetCards(id)
+		if status != 200 {
+			return status, nil, err
+		}
+		for _, d := range cards {
+			data = append(data, cardItem(d))
+		}
+	case models.ItemPasswords:
+		status, passwords, err := s.GetPassword(id)
+		if status != 200 {
+			return status, nil, err
+		}
+		for _, d := range passwords {
+			data = append(data, passwordItem(d))
+		}
+	case models.ItemTexts:
+		status, texts, err := s.GetText(id)
+		if status != 200 {
+			return status, nil, err
+		}
+		for _, d := range texts {
+			data = append(data, textItem(d))
+		}
+	case models.ItemBinaries:
+		status, binaries, err := s.GetBinary(id)
+		if status != 200 {
+			return status, nil, err
+		}
+		for _, d := range binaries {
+			data = append(data, binaryItem(d))
+		}
+	default:
+		return 404, nil, storage.ErrUnknownKind
+	}
+	return 200, data, nil
+}
+
+// builtinChange - методы одного изменения записей встроенных видов: добавления, изменения или удаления.
+type builtinChange struct {
+	card     func(d *models.CryptoCard, id string) (int, error)
+	password func(d *models.CryptoPassword, id string) (int, error)
+	text     func(d *models.CryptoTextData, id string) (int, error)
+	binary   func(d *models.CryptoBinaryData, id string) (int, error)
+}
+
+// changeBuiltinItem - изменение записи d встроенного вида методом вида из change. Запись переводится в структуру
+// вида и обратно, поэтому после изменения, как и при конфликте версий, в d оказывается копия сервера.
+// Если Payload не разбирается, возвращается 400.
+func changeBuiltinItem(d *models.Item, id string, change builtinChange) (int, error) {
+	switch d.Type {
+	case models.ItemCards:
+		var p models.CardPayload
+		if err := parsePayload(d, &p); err != nil {
+			return 400, err
+		}
+		c := models.CryptoCard{UID: d.UID, Name: p.Name, Number: p.Number, CVC: p.CVC, Version: d.Version, ItemMeta: d.ItemMeta}
+		status, err := change.card(&c, id)
+		return changedItem(d, status, err, cardItem(c))
+	case models.ItemPasswords:
+		var p models.PasswordPayload
+		if err := parsePayload(d, &p); err != nil {
+			return 400, err
+		}
+		c := models.CryptoPassword{UID: d.UID, Login: p.Login, Pass: p.Pass, Version: d.Version, ItemMeta: d.ItemMeta}
+		status, err := change.password(&c, id)
+		return changedItem(d, status, err, passwordItem(c))
+	case models.ItemTexts:
+		var p models.TextPayload
+		if err := parsePayload(d, &p); err != nil {
+			return 400, err
+		}
+		c := models.CryptoTextData{UID: d.UID, Text: p.Text, Version: d.Version, ItemMeta: d.ItemMeta}
+		status, err := change.text(&c, id)
+		return changedItem(d, status, err, textItem(c))
+	case models.ItemBinaries:
+		var p models.BinaryPayload
+		if err := parsePayload(d, &p); err != nil {
+			return 400, err
+		}
+		c := models.CryptoBinaryData{UID: d.UID, Data: p.Data, Version: d.Version, ItemMeta: d.ItemMeta}
+		status, err := change.binary(&c, id)
+		return changedItem(d, status, err, binaryItem(c))
+	}
+	return 404, storage.ErrUnknownKind
+}
+
+// parsePayload - разбор Payload записи встроенного вида в p. Пустое содержимое допустимо: для удаления
+// достаточно идентификатора и версии.
+func parsePayload(d *models.Item, p interface{}) error {
+	if len(d.Payload) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(d.Payload, p); err != nil {
+		return fmt.Errorf("wrong %s payload: %w", d.Type, err)
+	}
+	return nil
+}
+
+// changedItem - результат изменения записи встроенного вида: после изменения и при конфликте версий в d
+// записывается копия сервера item.
+func changedItem(d *models.Item, status int, err error, item models.Item) (int, error) {
+	if status == 200 || status == 409 {
+		*d = item
+	}
+	return status, err
+}
+
+// newItem - запись вида itemType с содержимым payload. Содержимое встроенных видов - структуры из []byte,
+// поэтому ошибки сериализации быть не может.
+func newItem(itemType string, uid int, payload interface{}, revision, version int64, meta models.ItemMeta) models.Item {
+	data, _ := json.Marshal(payload)
+	return models.Item{Type: itemType, UID: uid, Payload: data, Revision: revision, Version: version, ItemMeta: meta}
+}
+
+// cardItem - карта в виде записи Item.
+func cardItem(d models.CryptoCard) models.Item {
+	return newItem(models.ItemCards, d.UID, models.CardPayload{Name: d.Name, Number: d.Number, CVC: d.CVC}, d.Revision, d.Version, d.ItemMeta)
+}
+
+// passwordItem - пара логин/пароль в виде записи Item.
+func passwordItem(d models.CryptoPassword) models.Item {
+	return newItem(models.ItemPasswords, d.UID, models.PasswordPayload{Login: d.Login, Pass: d.Pass}, d.Revision, d.Version, d.ItemMeta)
+}
+
+// textItem - текстовые данные в виде записи Item.
+func textItem(d models.CryptoTextData) models.Item {
+	return newItem(models.ItemTexts, d.UID, models.TextPayload{Text: d.Text}, d.Revision, d.Version, d.ItemMeta)
+}
+
+// binaryItem - бинарные данные в виде записи Item.
+func binaryItem(d models.CryptoBinaryData) models.Item {
+	return newItem(models.ItemBinaries, d.UID, models.BinaryPayload{Data: d.Data}, d.Revision, d.Version, d.ItemMeta)
+}
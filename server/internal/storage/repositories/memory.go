@@ -0,0 +1,2065 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль хранит все данные в памяти процесса и не требует PostgreSQL.
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/hasher"
+)
+
+// MemStore - структура репозитория, который хранит данные в памяти.
+// Безопасен для конкурентного использования. Без журнала данные теряются при остановке сервера,
+// с журналом (см. NewFileStore) каждое изменение сначала записывается на диск.
+type MemStore struct {
+	mu        sync.RWMutex
+	logger    *loggers.Logger
+	hasher    hasher.Hasher
+	journal   journal
+	lastID    map[string]int
+	users     map[string]memUser
+	logins    map[string]string
+	cards     map[int]memCard
+	passwords map[int]memPassword
+	texts     map[int]memText
+	binaries  map[int]memBinary
+	items     map[int]memItem
+	refresh   map[string]models.RefreshToken
+	revoked   map[string]memRevokedToken
+	sessions  map[string]memSession
+	attempts  map[string]memLoginAttempts
+	keys      map[string]memKey
+	deleted   map[string]memTombstone
+	history   map[string]memHistory
+}
+
+// Имена таблиц, совпадают с таблицами PostgreSQL и используются как имена бакетов журнала.
+const (
+	tableSequences = "sequences"
+	tableUsers     = "users"
+	tableCards     = "cards"
+	tablePasswords = "passwords"
+	tableTexts     = "text_table"
+	tableBinaries  = "binary_table"
+	tableItems     = "items"
+	tableRefresh   = "refresh_tokens"
+	tableRevoked   = "revoked_tokens"
+	tableSessions  = "sessions"
+	tableAttempts  = "login_attempts"
+	tableKeys      = "user_keys"
+	tableDeleted   = "tombstones"
+	tableHistory   = "item_history"
+)
+
+// itemTypes - вид записи API для каждой таблицы записей.
+var itemTypes = map[string]string{
+	tableCards:     models.ItemCards,
+	tablePasswords: models.ItemPasswords,
+	tableTexts:     models.ItemTexts,
+	tableBinaries:  models.ItemBinaries,
+}
+
+// sessionTouchInterval - как часто обновляется время активности сессии, чтобы не писать журнал на каждый запрос.
+const sessionTouchInterval = time.Minute
+
+// memUser - пользователь в памяти, аналог строки таблицы users.
+type memUser struct {
+	ID             string   `json:"id"`
+	Login          string   `json:"login"`
+	HashedPassword string   `json:"hashed_password"`
+	AuthKey        bool     `json:"auth_key,omitempty"`
+	Revision       int64    `json:"revision,omitempty"`
+	HistoryDepth   *int     `json:"history_depth,omitempty"`
+	TOTPSecret     string   `json:"totp_secret,omitempty"`
+	TOTPEnabled    bool     `json:"totp_enabled,omitempty"`
+	TOTPLastStep   int64    `json:"totp_last_step,omitempty"`
+	RecoveryCodes  []string `json:"recovery_codes,omitempty"`
+}
+
+// historyDepth - глубина истории записей пользователя. Пока пользователь ее не менял, действует глубина по умолчанию.
+func (u memUser) historyDepth() int {
+	if u.HistoryDepth == nil {
+		return models.DefaultHistoryDepth
+	}
+	return *u.HistoryDepth
+}
+
+// memCard - карта в памяти, аналог строки таблицы cards. DeletedAt во всех записях - время перемещения в корзину,
+// у записей вне корзины nil.
+type memCard struct {
+	UserID    string     `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	models.CryptoCard
+}
+
+// memPassword - пара логин/пароль в памяти, аналог строки таблицы passwords.
+type memPassword struct {
+	UserID    string     `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	models.CryptoPassword
+}
+
+// memText - текстовые данные в памяти, аналог строки таблицы text_table.
+type memText struct {
+	UserID    string     `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	models.CryptoTextData
+}
+
+// memBinary - бинарные данные в памяти, аналог строки таблицы binary_table.
+type memBinary struct {
+	UserID    string     `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	models.CryptoBinaryData
+}
+
+// memItem - запись вида, зарегистрированного через models.RegisterItemKind, в памяти, аналог строки таблицы items.
+// Идентификаторы записей общие для всех таких видов.
+type memItem struct {
+	UserID    string     `json:"user_id"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	models.Item
+}
+
+// memRevokedToken - отозванный токен доступа в памяти, аналог строки таблицы revoked_tokens.
+type memRevokedToken struct {
+	JTI       string    `json:"jti"`
+	UserID    string    `json:"user_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// memSession - сессия в памяти, аналог строки таблицы sessions.
+type memSession struct {
+	UserID  string `json:"user_id"`
+	Revoked bool   `json:"revoked"`
+	models.Session
+}
+
+// memLoginAttempts - неудачные попытки входа в памяти, аналог строки таблицы login_attempts.
+type memLoginAttempts struct {
+	Login       string    `json:"login"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// memKey - зашифрованный закрытый ключ в памяти, аналог строки таблицы user_keys.
+type memKey struct {
+	UserID string `json:"user_id"`
+	models.SealedKey
+}
+
+// memTombstone - след удаленной записи в памяти, аналог строки таблицы tombstones.
+type memTombstone struct {
+	UserID string `json:"user_id"`
+	models.Tombstone
+}
+
+// key - ключ следа.
+func (t memTombstone) key() string {
+	return itemKey(t.Type, t.UID)
+}
+
+// memHistory - прежняя версия записи в памяти, аналог строки таблицы item_history.
+type memHistory struct {
+	UserID string `json:"user_id"`
+	models.HistoryEntry
+}
+
+// key - ключ версии в истории.
+func (h memHistory) key() string {
+	return historyKey(h.Type, h.UID, h.Version)
+}
+
+// historyKey - ключ версии version записи uid вида itemType.
+func historyKey(itemType string, uid int, version int64) string {
+	return itemKey(itemType, uid) + "/" + strconv.FormatInt(version, 10)
+}
+
+// itemKey - ключ записи uid вида itemType: идентификаторы записей уникальны только внутри вида.
+func itemKey(itemType string, uid int) string {
+	return itemType + "/" + strconv.Itoa(uid)
+}
+
+// historyChange - изменение истории записей: новые версии и ключи удаляемых версий.
+type historyChange struct {
+	put  []memHistory
+	drop []string
+}
+
+// ops - операции журнала изменения истории.
+func (c historyChange) ops() []journalOp {
+	var ops []journalOp
+	for _, h := range c.put {
+		ops = append(ops, putOp(tableHistory, h.key(), h))
+	}
+	for _, key := range c.drop {
+		ops = append(ops, deleteOp(tableHistory, key))
+	}
+	return ops
+}
+
+// NewMemStore - функция создания нового репозитория в памяти.
+func NewMemStore(cfg *config.Config, logger *loggers.Logger) *MemStore {
+	return &MemStore{
+		logger:    logger,
+		hasher:    hasher.NewPasswordHasher(cfg),
+		lastID:    make(map[string]int),
+		users:     make(map[string]memUser),
+		logins:    make(map[string]string),
+		cards:     make(map[int]memCard),
+		passwords: make(map[int]memPassword),
+		texts:     make(map[int]memText),
+		binaries:  make(map[int]memBinary),
+		items:     make(map[int]memItem),
+		refresh:   make(map[string]models.RefreshToken),
+		revoked:   make(map[string]memRevokedToken),
+		sessions:  make(map[string]memSession),
+		attempts:  make(map[string]memLoginAttempts),
+		keys:      make(map[string]memKey),
+		deleted:   make(map[string]memTombstone),
+		history:   make(map[string]memHistory),
+	}
+}
+
+// journal - интерфейс журнала, в который MemStore записывает изменения перед применением их в памяти.
+type journal interface {
+	commit(ops []journalOp) error
+	close() error
+}
+
+// journalOp - одно изменение записи таблицы. Пустое value означает удаление записи.
+type journalOp struct {
+	table string
+	key   string
+	value interface{}
+}
+
+// putOp - операция сохранения записи.
+func putOp(table string, key, value interface{}) journalOp {
+	return journalOp{table: table, key: fmt.Sprint(key), value: value}
+}
+
+// deleteOp - операция удаления записи.
+func deleteOp(table string, key interface{}) journalOp {
+	return journalOp{table: table, key: fmt.Sprint(key)}
+}
+
+// persist - запись изменений в журнал, если он есть. Вызывается под блокировкой на запись.
+func (s *MemStore) persist(ops ...journalOp) error {
+	if s.journal == nil {
+		return nil
+	}
+	if err := s.journal.commit(ops); err != nil {
+		s.logger.LogErr(err, "failed to write journal")
+		return err
+	}
+	return nil
+}
+
+// Close - закрытие журнала репозитория.
+func (s *MemStore) Close() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.close()
+}
+
+// nextID - выдача следующего идентификатора для таблицы, аналог generated always as identity.
+// Возвращает также операцию сохранения счетчика. Вызывается под блокировкой на запись.
+func (s *MemStore) nextID(table string) (int, journalOp) {
+	s.lastID[table]++
+	return s.lastID[table], putOp(tableSequences, table, s.lastID[table])
+}
+
+// nextRevision - выдача следующей ревизии пользователя id. Возвращает также операцию сохранения пользователя.
+// Вызывается под блокировкой на запись.
+func (s *MemStore) nextRevision(id string) (int64, journalOp, error) {
+	u, ok := s.users[id]
+	if !ok {
+		return 0, journalOp{}, fmt.Errorf("user %s not found", id)
+	}
+	u.Revision++
+	s.users[id] = u
+	return u.Revision, putOp(tableUsers, id, u), nil
+}
+
+// tombstone - след удаления записи uid из таблицы table с ревизией rev.
+func tombstone(table string, uid int, id string, rev int64) memTombstone {
+	return memTombstone{UserID: id, Tombstone: models.Tombstone{Type: itemTypes[table], UID: uid, Revision: rev}}
+}
+
+func (s *MemStore) Register(u *models.User) (string, error) {
+	secret, authKey := userSecret(u)
+	//хэширование пароля до блокировки, оно намеренно медленное
+	hashedPassword, err := s.hasher.Hash(secret)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.logins[u.Login]; ok {
+		err := fmt.Errorf("login %s is already registered", u.Login)
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return "", err
+	}
+	uid, seq := s.nextID(tableUsers)
+	user := memUser{
+		ID:             strconv.Itoa(uid),
+		Login:          u.Login,
+		HashedPassword: hashedPassword,
+		AuthKey:        authKey,
+	}
+	if err := s.persist(seq, putOp(tableUsers, user.ID, user)); err != nil {
+		return "", err
+	}
+	s.users[user.ID] = user
+	s.logins[user.Login] = user.ID
+	u.UID = user.ID
+	return u.UID, nil
+}
+
+func (s *MemStore) Login(u *models.User) (string, error) {
+	s.mu.RLock()
+	user, ok := s.users[s.logins[u.Login]]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("wrong login %s", u.Login)
+	}
+	secret, err := loginSecret(u, user.AuthKey)
+	if err != nil {
+		return "", err
+	}
+	//сравнение полученного пароля и хэш пароля из памяти
+	ok, err = s.hasher.Verify(secret, user.HashedPassword)
+	if err != nil {
+		s.logger.LogErr(err, "failed to verify password")
+	}
+	if !ok {
+		return "", fmt.Errorf("wrong password to %s", u.Login)
+	}
+	switch {
+	case !user.AuthKey && u.AuthKey != "":
+		//пароль проверен, дальше аккаунт входит только по ключу аутентификации
+		s.rehashPassword(user, u.AuthKey, true)
+	case s.hasher.NeedsRehash(user.HashedPassword):
+		//старые хэши и хэши с устаревшими параметрами заменяются при успешном входе
+		s.rehashPassword(user, secret, user.AuthKey)
+	}
+	u.UID = user.ID
+	return u.UID, nil
+}
+
+// rehashPassword - замена хэша пароля пользователя на хэш secret текущим алгоритмом,
+// если хэш не изменился с момента проверки.
+func (s *MemStore) rehashPassword(user memUser, secret string, authKey bool) {
+	hashedPassword, err := s.hasher.Hash(secret)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[user.ID]
+	if !ok || current.HashedPassword != user.HashedPassword {
+		return
+	}
+	current.HashedPassword, current.AuthKey = hashedPassword, authKey
+	if err = s.persist(putOp(tableUsers, current.ID, current)); err != nil {
+		return
+	}
+	s.users[current.ID] = current
+}
+
+// checkPassword - проверка текущего пароля пользователя id.
+func (s *MemStore) checkPassword(id, password string) (int, memUser, error) {
+	s.mu.RLock()
+	user, ok := s.users[id]
+	s.mu.RUnlock()
+	if !ok {
+		return 404, user, fmt.Errorf("user %s not found", id)
+	}
+	ok, err := s.hasher.Verify(password, user.HashedPassword)
+	if err != nil {
+		s.logger.LogErr(err, "failed to verify password")
+	}
+	if !ok {
+		return 403, user, fmt.Errorf("wrong password")
+	}
+	return 200, user, nil
+}
+
+// ChangePassword - смена пароля пользователя id после проверки текущего пароля.
+// Все сессии, кроме sessionID, отзываются вместе с токенами обновления.
+func (s *MemStore) ChangePassword(id, password, newPassword, sessionID string) (int, error) {
+	status, user, err := s.checkPassword(id, password)
+	if err != nil {
+		return status, err
+	}
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return 500, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	//пароль мог смениться параллельно после проверки
+	current, ok := s.users[id]
+	if !ok || current.HashedPassword != user.HashedPassword {
+		return 403, fmt.Errorf("wrong password")
+	}
+	current.HashedPassword = hashedPassword
+	ops := []journalOp{putOp(tableUsers, current.ID, current)}
+	var sessions []memSession
+	for _, ms := range s.sessions {
+		if ms.UserID == id && ms.ID != sessionID && !ms.Revoked {
+			ms.Revoked = true
+			sessions = append(sessions, ms)
+			ops = append(ops, putOp(tableSessions, ms.ID, ms))
+		}
+	}
+	var tokens []models.RefreshToken
+	for _, t := range s.refresh {
+		if t.UserID == id && t.Family != sessionID && !t.Revoked {
+			t.Revoked = true
+			tokens = append(tokens, t)
+			ops = append(ops, putOp(tableRefresh, t.Hash, t))
+		}
+	}
+	if err := s.persist(ops...); err != nil {
+		return 500, err
+	}
+	s.users[current.ID] = current
+	for _, ms := range sessions {
+		s.sessions[ms.ID] = ms
+	}
+	for _, t := range tokens {
+		s.refresh[t.Hash] = t
+	}
+	return 200, nil
+}
+
+// DeleteAccount - удаление пользователя id после проверки пароля вместе со всеми его данными одной записью журнала.
+func (s *MemStore) DeleteAccount(id, password string) (int, error) {
+	status, user, err := s.checkPassword(id, password)
+	if err != nil {
+		return status, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return 404, fmt.Errorf("user %s not found", id)
+	}
+	var cards, passwords, texts, binaries, items []int
+	var tokens, revoked, sessions []string
+	ops := []journalOp{deleteOp(tableUsers, id)}
+	for uid, d := range s.cards {
+		if d.UserID == id {
+			cards = append(cards, uid)
+			ops = append(ops, deleteOp(tableCards, uid))
+		}
+	}
+	for uid, d := range s.passwords {
+		if d.UserID == id {
+			passwords = append(passwords, uid)
+			ops = append(ops, deleteOp(tablePasswords, uid))
+		}
+	}
+	for uid, d := range s.texts {
+		if d.UserID == id {
+			texts = append(texts, uid)
+			ops = append(ops, deleteOp(tableTexts, uid))
+		}
+	}
+	for uid, d := range s.binaries {
+		if d.UserID == id {
+			binaries = append(binaries, uid)
+			ops = append(ops, deleteOp(tableBinaries, uid))
+		}
+	}
+	for uid, d := range s.items {
+		if d.UserID == id {
+			items = append(items, uid)
+			ops = append(ops, deleteOp(tableItems, uid))
+		}
+	}
+	for hash, t := range s.refresh {
+		if t.UserID == id {
+			tokens = append(tokens, hash)
+			ops = append(ops, deleteOp(tableRefresh, hash))
+		}
+	}
+	for jti, t := range s.revoked {
+		if t.UserID == id {
+			revoked = append(revoked, jti)
+			ops = append(ops, deleteOp(tableRevoked, jti))
+		}
+	}
+	for sid, ms := range s.sessions {
+		if ms.UserID == id {
+			sessions = append(sessions, sid)
+			ops = append(ops, deleteOp(tableSessions, sid))
+		}
+	}
+	//попытки входа хранятся по логину, который после удаления может занять другой пользователь
+	if _, ok := s.attempts[user.Login]; ok {
+		ops = append(ops, deleteOp(tableAttempts, user.Login))
+	}
+	if _, ok := s.keys[id]; ok {
+		ops = append(ops, deleteOp(tableKeys, id))
+	}
+	var deleted []string
+	for key, t := range s.deleted {
+		if t.UserID == id {
+			deleted = append(deleted, key)
+			ops = append(ops, deleteOp(tableDeleted, key))
+		}
+	}
+	hist := s.dropHistory(func(h memHistory) bool { return h.UserID == id })
+	ops = append(ops, hist.ops()...)
+	if err := s.persist(ops...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	for _, uid := range cards {
+		delete(s.cards, uid)
+	}
+	for _, uid := range passwords {
+		delete(s.passwords, uid)
+	}
+	for _, uid := range texts {
+		delete(s.texts, uid)
+	}
+	for _, uid := range binaries {
+		delete(s.binaries, uid)
+	}
+	for _, uid := range items {
+		delete(s.items, uid)
+	}
+	for _, hash := range tokens {
+		delete(s.refresh, hash)
+	}
+	for _, jti := range revoked {
+		delete(s.revoked, jti)
+	}
+	for _, sid := range sessions {
+		delete(s.sessions, sid)
+	}
+	for _, key := range deleted {
+		delete(s.deleted, key)
+	}
+	delete(s.attempts, user.Login)
+	delete(s.keys, id)
+	delete(s.users, id)
+	delete(s.logins, user.Login)
+	return 200, nil
+}
+
+func (s *MemStore) CollectCard(d *models.CryptoCard, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkCardNumber(d, id); err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	c := memCard{UserID: id, CryptoCard: *d}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	var seq journalOp
+	c.UID, seq = s.nextID(tableCards)
+	c.Revision, c.Version = rev, 1
+	c.ItemMeta = newMeta(c.ItemMeta, time.Now())
+	if err := s.persist(seq, user, putOp(tableCards, c.UID, c)); err != nil {
+		return 500, err
+	}
+	s.cards[c.UID] = c
+	*d = c.CryptoCard
+	//возвращаем 200 — новые данные успешно загружены.
+	return 200, nil
+}
+
+func (s *MemStore) CollectPassword(d *models.CryptoPassword, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := memPassword{UserID: id, CryptoPassword: *d}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	var seq journalOp
+	p.UID, seq = s.nextID(tablePasswords)
+	p.Revision, p.Version = rev, 1
+	p.ItemMeta = newMeta(p.ItemMeta, time.Now())
+	if err := s.persist(seq, user, putOp(tablePasswords, p.UID, p)); err != nil {
+		return 500, err
+	}
+	s.passwords[p.UID] = p
+	*d = p.CryptoPassword
+	return 200, nil
+}
+
+func (s *MemStore) CollectText(d *models.CryptoTextData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := memText{UserID: id, CryptoTextData: *d}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	var seq journalOp
+	t.UID, seq = s.nextID(tableTexts)
+	t.Revision, t.Version = rev, 1
+	t.ItemMeta = newMeta(t.ItemMeta, time.Now())
+	if err := s.persist(seq, user, putOp(tableTexts, t.UID, t)); err != nil {
+		return 500, err
+	}
+	s.texts[t.UID] = t
+	*d = t.CryptoTextData
+	return 200, nil
+}
+
+func (s *MemStore) CollectBinary(d *models.CryptoBinaryData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := memBinary{UserID: id, CryptoBinaryData: *d}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	var seq journalOp
+	b.UID, seq = s.nextID(tableBinaries)
+	b.Revision, b.Version = rev, 1
+	b.ItemMeta = newMeta(b.ItemMeta, time.Now())
+	if err := s.persist(seq, user, putOp(tableBinaries, b.UID, b)); err != nil {
+		return 500, err
+	}
+	s.binaries[b.UID] = b
+	*d = b.CryptoBinaryData
+	return 200, nil
+}
+
+func (s *MemStore) GetCards(id string) (int, []models.CryptoCard, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.CryptoCard
+	for _, c := range s.cards {
+		if c.UserID == id && c.DeletedAt == nil {
+			data = append(data, c.CryptoCard)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return 200, data, nil
+}
+
+func (s *MemStore) GetPassword(id string) (int, []models.CryptoPassword, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.CryptoPassword
+	for _, p := range s.passwords {
+		if p.UserID == id && p.DeletedAt == nil {
+			data = append(data, p.CryptoPassword)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return 200, data, nil
+}
+
+func (s *MemStore) GetText(id string) (int, []models.CryptoTextData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.CryptoTextData
+	for _, t := range s.texts {
+		if t.UserID == id && t.DeletedAt == nil {
+			data = append(data, t.CryptoTextData)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return 200, data, nil
+}
+
+func (s *MemStore) GetBinary(id string) (int, []models.CryptoBinaryData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.CryptoBinaryData
+	for _, b := range s.binaries {
+		if b.UserID == id && b.DeletedAt == nil {
+			data = append(data, b.CryptoBinaryData)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return 200, data, nil
+}
+
+// Удаление и изменение чужих или несуществующих записей возвращают 404. Если версия записи не совпадает
+// с ожидаемой data.Version, возвращается 409, а в data записывается текущая копия. Нулевая версия не проверяется.
+
+func (s *MemStore) DeleteCard(data *models.CryptoCard, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cards[data.UID]
+	if !ok || c.UserID != id || c.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != c.Version {
+		*data = c.CryptoCard
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	ts := tombstone(tableCards, data.UID, id, rev)
+	now := time.Now()
+	c.DeletedAt, c.Revision = &now, rev
+	if err = s.persist(user, putOp(tableCards, data.UID, c), putOp(tableDeleted, ts.key(), ts)); err != nil {
+		return 500, err
+	}
+	s.cards[data.UID] = c
+	s.deleted[ts.key()] = ts
+	return 200, nil
+}
+
+func (s *MemStore) DeleteText(data *models.CryptoTextData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.texts[data.UID]
+	if !ok || t.UserID != id || t.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != t.Version {
+		*data = t.CryptoTextData
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	ts := tombstone(tableTexts, data.UID, id, rev)
+	now := time.Now()
+	t.DeletedAt, t.Revision = &now, rev
+	if err = s.persist(user, putOp(tableTexts, data.UID, t), putOp(tableDeleted, ts.key(), ts)); err != nil {
+		return 500, err
+	}
+	s.texts[data.UID] = t
+	s.deleted[ts.key()] = ts
+	return 200, nil
+}
+
+func (s *MemStore) DeletePassword(data *models.CryptoPassword, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.passwords[data.UID]
+	if !ok || p.UserID != id || p.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != p.Version {
+		*data = p.CryptoPassword
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	ts := tombstone(tablePasswords, data.UID, id, rev)
+	now := time.Now()
+	p.DeletedAt, p.Revision = &now, rev
+	if err = s.persist(user, putOp(tablePasswords, data.UID, p), putOp(tableDeleted, ts.key(), ts)); err != nil {
+		return 500, err
+	}
+	s.passwords[data.UID] = p
+	s.deleted[ts.key()] = ts
+	return 200, nil
+}
+
+func (s *MemStore) DeleteBinary(data *models.CryptoBinaryData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.binaries[data.UID]
+	if !ok || b.UserID != id || b.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != b.Version {
+		*data = b.CryptoBinaryData
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	ts := tombstone(tableBinaries, data.UID, id, rev)
+	now := time.Now()
+	b.DeletedAt, b.Revision = &now, rev
+	if err = s.persist(user, putOp(tableBinaries, data.UID, b), putOp(tableDeleted, ts.key(), ts)); err != nil {
+		return 500, err
+	}
+	s.binaries[data.UID] = b
+	s.deleted[ts.key()] = ts
+	return 200, nil
+}
+
+func (s *MemStore) UpdateCard(data *models.CryptoCard, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cards[data.UID]
+	if !ok || c.UserID != id || c.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != c.Version {
+		*data = c.CryptoCard
+		return 409, storage.ErrVersionConflict
+	}
+	if err := s.checkCardNumber(data, id); err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	hist, err := s.keepVersion(models.ItemCards, data.UID, c.Version, id, c.CryptoCard)
+	if err != nil {
+		return 500, err
+	}
+	c.Number, c.Name, c.CVC, c.Revision = data.Number, data.Name, data.CVC, rev
+	c.ItemMeta = updatedMeta(c.ItemMeta, data.ItemMeta, time.Now())
+	c.Version++
+	if err = s.persist(append([]journalOp{user, putOp(tableCards, data.UID, c)}, hist.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	s.cards[data.UID] = c
+	*data = c.CryptoCard
+	return 200, nil
+}
+
+func (s *MemStore) UpdatePassword(data *models.CryptoPassword, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.passwords[data.UID]
+	if !ok || p.UserID != id || p.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != p.Version {
+		*data = p.CryptoPassword
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	hist, err := s.keepVersion(models.ItemPasswords, data.UID, p.Version, id, p.CryptoPassword)
+	if err != nil {
+		return 500, err
+	}
+	p.Login, p.Pass, p.Revision = data.Login, data.Pass, rev
+	p.ItemMeta = updatedMeta(p.ItemMeta, data.ItemMeta, time.Now())
+	p.Version++
+	if err = s.persist(append([]journalOp{user, putOp(tablePasswords, data.UID, p)}, hist.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	s.passwords[data.UID] = p
+	*data = p.CryptoPassword
+	return 200, nil
+}
+
+func (s *MemStore) UpdateText(data *models.CryptoTextData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.texts[data.UID]
+	if !ok || t.UserID != id || t.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != t.Version {
+		*data = t.CryptoTextData
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	hist, err := s.keepVersion(models.ItemTexts, data.UID, t.Version, id, t.CryptoTextData)
+	if err != nil {
+		return 500, err
+	}
+	t.Text, t.Revision = data.Text, rev
+	t.ItemMeta = updatedMeta(t.ItemMeta, data.ItemMeta, time.Now())
+	t.Version++
+	if err = s.persist(append([]journalOp{user, putOp(tableTexts, data.UID, t)}, hist.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	s.texts[data.UID] = t
+	*data = t.CryptoTextData
+	return 200, nil
+}
+
+func (s *MemStore) UpdateBinary(data *models.CryptoBinaryData, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.binaries[data.UID]
+	if !ok || b.UserID != id || b.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != b.Version {
+		*data = b.CryptoBinaryData
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	hist, err := s.keepVersion(models.ItemBinaries, data.UID, b.Version, id, b.CryptoBinaryData)
+	if err != nil {
+		return 500, err
+	}
+	b.Data, b.Revision = data.Data, rev
+	b.ItemMeta = updatedMeta(b.ItemMeta, data.ItemMeta, time.Now())
+	b.Version++
+	if err = s.persist(append([]journalOp{user, putOp(tableBinaries, data.UID, b)}, hist.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	s.binaries[data.UID] = b
+	*data = b.CryptoBinaryData
+	return 200, nil
+}
+
+// GetItems - записи вида itemType пользователя id. Записи встроенных видов берутся методами вида.
+func (s *MemStore) GetItems(id, itemType string) (int, []models.Item, error) {
+	kind, status, err := itemKind(itemType)
+	switch {
+	case err != nil:
+		return status, nil, err
+	case kind.Builtin:
+		return builtinItems(s, id, itemType)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.Item
+	for _, it := range s.items {
+		if it.UserID == id && it.Type == itemType && it.DeletedAt == nil {
+			data = append(data, it.Item)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].UID < data[j].UID })
+	return 200, data, nil
+}
+
+// CollectItem - добавление записи d вида d.Type пользователю id. В d записывается сохраненная запись
+// с идентификатором, версией и временем создания.
+func (s *MemStore) CollectItem(d *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(d.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(d, id, builtinChange{s.CollectCard, s.CollectPassword, s.CollectText, s.CollectBinary})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it := memItem{UserID: id, Item: *d}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	var seq journalOp
+	it.UID, seq = s.nextID(tableItems)
+	it.Revision, it.Version = rev, 1
+	it.ItemMeta = newMeta(it.ItemMeta, time.Now())
+	if err := s.persist(seq, user, putOp(tableItems, it.UID, it)); err != nil {
+		return 500, err
+	}
+	s.items[it.UID] = it
+	*d = it.Item
+	return 200, nil
+}
+
+// UpdateItem - изменение записи data.UID вида data.Type пользователя id, как и изменение записей встроенных видов.
+func (s *MemStore) UpdateItem(data *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(data.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(data, id, builtinChange{s.UpdateCard, s.UpdatePassword, s.UpdateText, s.UpdateBinary})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[data.UID]
+	if !ok || it.UserID != id || it.Type != data.Type || it.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != it.Version {
+		*data = it.Item
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	hist, err := s.keepVersion(it.Type, data.UID, it.Version, id, it.Item)
+	if err != nil {
+		return 500, err
+	}
+	it.Payload, it.Revision = data.Payload, rev
+	it.ItemMeta = updatedMeta(it.ItemMeta, data.ItemMeta, time.Now())
+	it.Version++
+	if err = s.persist(append([]journalOp{user, putOp(tableItems, data.UID, it)}, hist.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.applyHistory(hist)
+	s.items[data.UID] = it
+	*data = it.Item
+	return 200, nil
+}
+
+// DeleteItem - перемещение записи data.UID вида data.Type пользователя id в корзину, как и удаление записей встроенных видов.
+func (s *MemStore) DeleteItem(data *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(data.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(data, id, builtinChange{s.DeleteCard, s.DeletePassword, s.DeleteText, s.DeleteBinary})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	it, ok := s.items[data.UID]
+	if !ok || it.UserID != id || it.Type != data.Type || it.DeletedAt != nil {
+		return 404, storage.ErrItemNotFound
+	}
+	if data.Version != 0 && data.Version != it.Version {
+		*data = it.Item
+		return 409, storage.ErrVersionConflict
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	ts := memTombstone{UserID: id, Tombstone: models.Tombstone{Type: it.Type, UID: data.UID, Revision: rev}}
+	now := time.Now()
+	it.DeletedAt, it.Revision = &now, rev
+	if err = s.persist(user, putOp(tableItems, data.UID, it), putOp(tableDeleted, ts.key(), ts)); err != nil {
+		return 500, err
+	}
+	s.items[data.UID] = it
+	s.deleted[ts.key()] = ts
+	return 200, nil
+}
+
+// SaveRefreshToken - сохранение нового токена обновления. Просроченные токены пользователя удаляются.
+func (s *MemStore) SaveRefreshToken(t *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []string
+	ops := []journalOp{putOp(tableRefresh, t.Hash, *t)}
+	for hash, old := range s.refresh {
+		if old.UserID == t.UserID && time.Now().After(old.ExpiresAt) {
+			expired = append(expired, hash)
+			ops = append(ops, deleteOp(tableRefresh, hash))
+		}
+	}
+	if err := s.persist(ops...); err != nil {
+		return err
+	}
+	for _, hash := range expired {
+		delete(s.refresh, hash)
+	}
+	s.refresh[t.Hash] = *t
+	return nil
+}
+
+// RotateRefreshToken - замена токена обновления hash на next.
+// Семейство и пользователь next берутся из старого токена. Повторное использование токена
+// означает, что он украден, поэтому отзывается все семейство.
+func (s *MemStore) RotateRefreshToken(hash string, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refresh[hash]
+	switch {
+	case !ok:
+		return storage.ErrTokenNotFound
+	case t.Revoked:
+		return storage.ErrTokenRevoked
+	case t.Used:
+		if err := s.revokeFamily(t.Family); err != nil {
+			return err
+		}
+		return storage.ErrTokenReused
+	case time.Now().After(t.ExpiresAt):
+		return storage.ErrTokenExpired
+	}
+	t.Used = true
+	next.Family, next.UserID = t.Family, t.UserID
+	if err := s.persist(putOp(tableRefresh, t.Hash, t), putOp(tableRefresh, next.Hash, *next)); err != nil {
+		return err
+	}
+	s.refresh[t.Hash] = t
+	s.refresh[next.Hash] = *next
+	return nil
+}
+
+// RevokeRefreshToken - отзыв всего семейства токена обновления hash, принадлежащего пользователю id.
+func (s *MemStore) RevokeRefreshToken(hash, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refresh[hash]
+	if !ok || t.UserID != id {
+		return storage.ErrTokenNotFound
+	}
+	return s.revokeFamily(t.Family)
+}
+
+// revokeFamily - отзыв всех токенов обновления семейства. Операции extra записываются в журнал вместе с отзывом.
+// Вызывается под блокировкой на запись.
+func (s *MemStore) revokeFamily(family string, extra ...journalOp) error {
+	var tokens []models.RefreshToken
+	ops := extra
+	for _, t := range s.refresh {
+		if t.Family == family && !t.Revoked {
+			t.Revoked = true
+			tokens = append(tokens, t)
+			ops = append(ops, putOp(tableRefresh, t.Hash, t))
+		}
+	}
+	if err := s.persist(ops...); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		s.refresh[t.Hash] = t
+	}
+	return nil
+}
+
+// RevokeToken - добавление токена доступа jti пользователя id в список отозванных до истечения его срока.
+// Записи с истекшим сроком больше не нужны и удаляются.
+func (s *MemStore) RevokeToken(jti, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []string
+	t := memRevokedToken{JTI: jti, UserID: id, ExpiresAt: expiresAt}
+	ops := []journalOp{putOp(tableRevoked, jti, t)}
+	for old, r := range s.revoked {
+		if time.Now().After(r.ExpiresAt) {
+			expired = append(expired, old)
+			ops = append(ops, deleteOp(tableRevoked, old))
+		}
+	}
+	if err := s.persist(ops...); err != nil {
+		return err
+	}
+	for _, old := range expired {
+		delete(s.revoked, old)
+	}
+	s.revoked[jti] = t
+	return nil
+}
+
+// IsTokenRevoked - проверка, что токен доступа jti отозван.
+func (s *MemStore) IsTokenRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+// CreateSession - сохранение новой сессии пользователя id.
+func (s *MemStore) CreateSession(session *models.Session, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	session.LastSeen = session.CreatedAt
+	ms := memSession{UserID: id, Session: *session}
+	if err := s.persist(putOp(tableSessions, ms.ID, ms)); err != nil {
+		return err
+	}
+	s.sessions[ms.ID] = ms
+	return nil
+}
+
+// GetSessions - все не отозванные сессии пользователя, последние активные первыми.
+func (s *MemStore) GetSessions(id string) (int, []models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.Session
+	for _, ms := range s.sessions {
+		if ms.UserID == id && !ms.Revoked {
+			data = append(data, ms.Session)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].LastSeen.After(data[j].LastSeen) })
+	return 200, data, nil
+}
+
+// RevokeSession - отзыв сессии sessionID пользователя id вместе с ее токенами обновления.
+func (s *MemStore) RevokeSession(sessionID, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, ok := s.sessions[sessionID]
+	if !ok || ms.UserID != id || ms.Revoked {
+		return 404, fmt.Errorf("session %s not found", sessionID)
+	}
+	ms.Revoked = true
+	if err := s.revokeFamily(sessionID, putOp(tableSessions, ms.ID, ms)); err != nil {
+		return 500, err
+	}
+	s.sessions[ms.ID] = ms
+	return 200, nil
+}
+
+// TouchSession - обновление времени последней активности сессии. Возвращает false, если сессия отозвана.
+func (s *MemStore) TouchSession(sessionID string) (bool, error) {
+	s.mu.RLock()
+	ms, ok := s.sessions[sessionID]
+	s.mu.RUnlock()
+	if !ok || ms.Revoked {
+		return false, nil
+	}
+	if time.Since(ms.LastSeen) < sessionTouchInterval {
+		return true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms, ok = s.sessions[sessionID]
+	if !ok || ms.Revoked {
+		return false, nil
+	}
+	ms.LastSeen = time.Now()
+	if err := s.persist(putOp(tableSessions, ms.ID, ms)); err != nil {
+		return false, err
+	}
+	s.sessions[ms.ID] = ms
+	return true, nil
+}
+
+// SetTOTP - сохранение нового секрета TOTP и хэшей кодов восстановления пользователя id.
+// Второй фактор остается выключенным до подтверждения кодом.
+func (s *MemStore) SetTOTP(id, secret string, recoveryCodes []string) error {
+	return s.updateUser(id, func(u *memUser) bool {
+		u.TOTPSecret, u.TOTPEnabled, u.TOTPLastStep = secret, false, 0
+		u.RecoveryCodes = append([]string(nil), recoveryCodes...)
+		return true
+	})
+}
+
+// GetTOTP - настройки второго фактора пользователя id.
+func (s *MemStore) GetTOTP(id string) (*models.TOTP, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %s not found", id)
+	}
+	return &models.TOTP{Login: u.Login, Secret: u.TOTPSecret, Enabled: u.TOTPEnabled, LastStep: u.TOTPLastStep}, nil
+}
+
+// EnableTOTP - включение второго фактора после подтверждения кодом.
+func (s *MemStore) EnableTOTP(id string) error {
+	return s.updateUser(id, func(u *memUser) bool {
+		if u.TOTPSecret == "" {
+			return false
+		}
+		u.TOTPEnabled = true
+		return true
+	})
+}
+
+// DisableTOTP - выключение второго фактора, секрет и коды восстановления удаляются.
+func (s *MemStore) DisableTOTP(id string) error {
+	return s.SetTOTP(id, "", nil)
+}
+
+// UseTOTPStep - отметка интервала step использованным. Возвращает false, если код этого
+// или более позднего интервала уже принимался.
+func (s *MemStore) UseTOTPStep(id string, step int64) (bool, error) {
+	var used bool
+	err := s.updateUser(id, func(u *memUser) bool {
+		if u.TOTPLastStep >= step {
+			return false
+		}
+		u.TOTPLastStep, used = step, true
+		return true
+	})
+	return used, err
+}
+
+// UseRecoveryCode - использование кода восстановления с хэшем hash. Каждый код действует один раз.
+func (s *MemStore) UseRecoveryCode(id, hash string) (bool, error) {
+	var used bool
+	err := s.updateUser(id, func(u *memUser) bool {
+		for i, code := range u.RecoveryCodes {
+			if code == hash {
+				u.RecoveryCodes = append(u.RecoveryCodes[:i:i], u.RecoveryCodes[i+1:]...)
+				used = true
+				return true
+			}
+		}
+		return false
+	})
+	return used, err
+}
+
+// GetLogin - логин пользователя id.
+func (s *MemStore) GetLogin(id string) (int, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return 404, "", fmt.Errorf("user %s not found", id)
+	}
+	return 200, user.Login, nil
+}
+
+// GetLoginLock - время, до которого вход под логином login запрещен. Нулевое время, если вход не заблокирован.
+func (s *MemStore) GetLoginLock(login string) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.attempts[login].LockedUntil, nil
+}
+
+// RecordLoginFailure - учет неудачной попытки входа под логином login. Возвращает число неудачных попыток подряд,
+// попытки раньше since забываются. Заодно удаляются устаревшие записи других логинов.
+func (s *MemStore) RecordLoginFailure(login string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var stale []string
+	var ops []journalOp
+	for key, a := range s.attempts {
+		if a.LastFailure.Before(since) && a.LockedUntil.Before(now) {
+			stale = append(stale, key)
+			ops = append(ops, deleteOp(tableAttempts, key))
+		}
+	}
+	a := s.attempts[login]
+	if a.LastFailure.Before(since) && a.LockedUntil.Before(now) {
+		a = memLoginAttempts{Login: login}
+	}
+	a.Failures++
+	a.LastFailure = now
+	ops = append(ops, putOp(tableAttempts, login, a))
+	if err := s.persist(ops...); err != nil {
+		return 0, err
+	}
+	for _, key := range stale {
+		delete(s.attempts, key)
+	}
+	s.attempts[login] = a
+	return a.Failures, nil
+}
+
+// LockLogin - запрет входа под логином login до until.
+func (s *MemStore) LockLogin(login string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[login]
+	if !ok {
+		return nil
+	}
+	a.LockedUntil = until
+	if err := s.persist(putOp(tableAttempts, login, a)); err != nil {
+		return err
+	}
+	s.attempts[login] = a
+	return nil
+}
+
+// ResetLoginFailures - сброс неудачных попыток входа после успешного входа под логином login.
+func (s *MemStore) ResetLoginFailures(login string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attempts[login]; !ok {
+		return nil
+	}
+	if err := s.persist(deleteOp(tableAttempts, login)); err != nil {
+		return err
+	}
+	delete(s.attempts, login)
+	return nil
+}
+
+// SaveKey - сохранение зашифрованного закрытого ключа пользователя id. Старый ключ заменяется.
+func (s *MemStore) SaveKey(id string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return fmt.Errorf("user %s not found", id)
+	}
+	k := memKey{UserID: id, SealedKey: models.SealedKey{Key: append([]byte(nil), key...), UpdatedAt: time.Now()}}
+	if err := s.persist(putOp(tableKeys, id, k)); err != nil {
+		return err
+	}
+	s.keys[id] = k
+	return nil
+}
+
+// GetKey - получение зашифрованного закрытого ключа пользователя id.
+func (s *MemStore) GetKey(id string) (int, *models.SealedKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return 404, nil, fmt.Errorf("key of user %s not found", id)
+	}
+	key := k.SealedKey
+	key.Key = append([]byte(nil), k.Key...)
+	return 200, &key, nil
+}
+
+// RotateItems - замена всех записей пользователя id записями, перешифрованными новым ключом, и сохранение
+// нового ключа одной записью журнала. Если набор записей изменился, возвращается 409. Сессии, кроме sessionID,
+// отзываются: их клиенты держат старый ключ.
+func (s *MemStore) RotateItems(b *models.ItemBatch, id, sessionID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return 404, fmt.Errorf("user %s not found", id)
+	}
+	have := make(map[string][]int)
+	for uid, d := range s.cards {
+		if d.UserID == id && d.DeletedAt == nil {
+			have[tableCards] = append(have[tableCards], uid)
+		}
+	}
+	for uid, d := range s.passwords {
+		if d.UserID == id && d.DeletedAt == nil {
+			have[tablePasswords] = append(have[tablePasswords], uid)
+		}
+	}
+	for uid, d := range s.texts {
+		if d.UserID == id && d.DeletedAt == nil {
+			have[tableTexts] = append(have[tableTexts], uid)
+		}
+	}
+	for uid, d := range s.binaries {
+		if d.UserID == id && d.DeletedAt == nil {
+			have[tableBinaries] = append(have[tableBinaries], uid)
+		}
+	}
+	for uid, d := range s.items {
+		if d.UserID == id && d.DeletedAt == nil {
+			have[tableItems] = append(have[tableItems], uid)
+		}
+	}
+	for table, want := range batchIDs(b) {
+		if err := checkBatchIDs(table, have[table], want); err != nil {
+			return 409, err
+		}
+	}
+	versions := make(map[string]map[int]int64)
+	for uid, d := range s.cards {
+		if d.UserID == id && d.DeletedAt == nil {
+			addVersion(versions, tableCards, uid, d.Version)
+		}
+	}
+	for uid, d := range s.passwords {
+		if d.UserID == id && d.DeletedAt == nil {
+			addVersion(versions, tablePasswords, uid, d.Version)
+		}
+	}
+	for uid, d := range s.texts {
+		if d.UserID == id && d.DeletedAt == nil {
+			addVersion(versions, tableTexts, uid, d.Version)
+		}
+	}
+	for uid, d := range s.binaries {
+		if d.UserID == id && d.DeletedAt == nil {
+			addVersion(versions, tableBinaries, uid, d.Version)
+		}
+	}
+	for uid, d := range s.items {
+		if d.UserID == id && d.DeletedAt == nil {
+			addVersion(versions, tableItems, uid, d.Version)
+		}
+	}
+	if err := checkBatchVersions(b, versions); err != nil {
+		return 409, err
+	}
+
+	//все записи перешифрованы, поэтому все получают одну новую ревизию
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 404, err
+	}
+	ops := []journalOp{user}
+	cards := make([]memCard, len(b.Cards))
+	for i, d := range b.Cards {
+		d.Revision, d.Version = rev, versions[tableCards][d.UID]+1
+		d.ItemMeta = rotatedMeta(s.cards[d.UID].ItemMeta, d.ItemMeta)
+		cards[i] = memCard{UserID: id, CryptoCard: d}
+		ops = append(ops, putOp(tableCards, d.UID, cards[i]))
+	}
+	passwords := make([]memPassword, len(b.Passwords))
+	for i, d := range b.Passwords {
+		d.Revision, d.Version = rev, versions[tablePasswords][d.UID]+1
+		d.ItemMeta = rotatedMeta(s.passwords[d.UID].ItemMeta, d.ItemMeta)
+		passwords[i] = memPassword{UserID: id, CryptoPassword: d}
+		ops = append(ops, putOp(tablePasswords, d.UID, passwords[i]))
+	}
+	texts := make([]memText, len(b.Texts))
+	for i, d := range b.Texts {
+		d.Revision, d.Version = rev, versions[tableTexts][d.UID]+1
+		d.ItemMeta = rotatedMeta(s.texts[d.UID].ItemMeta, d.ItemMeta)
+		texts[i] = memText{UserID: id, CryptoTextData: d}
+		ops = append(ops, putOp(tableTexts, d.UID, texts[i]))
+	}
+	binaries := make([]memBinary, len(b.Binaries))
+	for i, d := range b.Binaries {
+		d.Revision, d.Version = rev, versions[tableBinaries][d.UID]+1
+		d.ItemMeta = rotatedMeta(s.binaries[d.UID].ItemMeta, d.ItemMeta)
+		binaries[i] = memBinary{UserID: id, CryptoBinaryData: d}
+		ops = append(ops, putOp(tableBinaries, d.UID, binaries[i]))
+	}
+	items := make([]memItem, len(b.Items))
+	for i, d := range b.Items {
+		//вид записи при смене ключа не меняется
+		d.Type, d.Revision, d.Version = s.items[d.UID].Type, rev, versions[tableItems][d.UID]+1
+		d.ItemMeta = rotatedMeta(s.items[d.UID].ItemMeta, d.ItemMeta)
+		items[i] = memItem{UserID: id, Item: d}
+		ops = append(ops, putOp(tableItems, d.UID, items[i]))
+	}
+	key := memKey{UserID: id, SealedKey: models.SealedKey{Key: append([]byte(nil), b.Key...), UpdatedAt: time.Now()}}
+	ops = append(ops, putOp(tableKeys, id, key))
+	//прежние версии и записи в корзине зашифрованы старым ключом, который больше не должен ничего открывать
+	trash := s.trashed(func(t memTrashed) bool { return t.userID == id })
+	for _, t := range trash {
+		ops = append(ops, deleteOp(t.table, t.uid))
+	}
+	hist := s.dropHistory(func(h memHistory) bool { return h.UserID == id })
+	ops = append(ops, hist.ops()...)
+	var sessions []memSession
+	for _, ms := range s.sessions {
+		if ms.UserID == id && ms.ID != sessionID && !ms.Revoked {
+			ms.Revoked = true
+			sessions = append(sessions, ms)
+			ops = append(ops, putOp(tableSessions, ms.ID, ms))
+		}
+	}
+	var tokens []models.RefreshToken
+	for _, t := range s.refresh {
+		if t.UserID == id && t.Family != sessionID && !t.Revoked {
+			t.Revoked = true
+			tokens = append(tokens, t)
+			ops = append(ops, putOp(tableRefresh, t.Hash, t))
+		}
+	}
+	if err := s.persist(ops...); err != nil {
+		return 500, err
+	}
+	for _, c := range cards {
+		s.cards[c.UID] = c
+	}
+	for _, p := range passwords {
+		s.passwords[p.UID] = p
+	}
+	for _, t := range texts {
+		s.texts[t.UID] = t
+	}
+	for _, bin := range binaries {
+		s.binaries[bin.UID] = bin
+	}
+	for _, it := range items {
+		s.items[it.UID] = it
+	}
+	s.keys[id] = key
+	s.dropTrashed(trash, hist)
+	for _, ms := range sessions {
+		s.sessions[ms.ID] = ms
+	}
+	for _, t := range tokens {
+		s.refresh[t.Hash] = t
+	}
+	return 200, nil
+}
+
+// Sync - записи пользователя id, измененные после ревизии since, и следы удаленных после нее записей.
+// Если since новее ревизии пользователя, например после восстановления сервера из копии, возвращаются все записи.
+func (s *MemStore) Sync(id string, since int64) (int, *models.SyncDelta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 404, nil, fmt.Errorf("user %s not found", id)
+	}
+	d := &models.SyncDelta{Revision: u.Revision}
+	if since <= 0 || since > u.Revision {
+		since, d.Full = 0, true
+	}
+	for _, c := range s.cards {
+		if c.UserID == id && c.DeletedAt == nil && c.Revision > since {
+			d.Cards = append(d.Cards, c.CryptoCard)
+		}
+	}
+	for _, p := range s.passwords {
+		if p.UserID == id && p.DeletedAt == nil && p.Revision > since {
+			d.Passwords = append(d.Passwords, p.CryptoPassword)
+		}
+	}
+	for _, t := range s.texts {
+		if t.UserID == id && t.DeletedAt == nil && t.Revision > since {
+			d.Texts = append(d.Texts, t.CryptoTextData)
+		}
+	}
+	for _, b := range s.binaries {
+		if b.UserID == id && b.DeletedAt == nil && b.Revision > since {
+			d.Binaries = append(d.Binaries, b.CryptoBinaryData)
+		}
+	}
+	for _, it := range s.items {
+		if it.UserID == id && it.DeletedAt == nil && it.Revision > since {
+			d.Items = append(d.Items, it.Item)
+		}
+	}
+	//полному ответу следы не нужны: удаленных записей в нем и так нет
+	if !d.Full {
+		for _, t := range s.deleted {
+			if t.UserID == id && t.Revision > since {
+				d.Deleted = append(d.Deleted, t.Tombstone)
+			}
+		}
+	}
+	sort.Slice(d.Cards, func(i, j int) bool { return d.Cards[i].UID < d.Cards[j].UID })
+	sort.Slice(d.Passwords, func(i, j int) bool { return d.Passwords[i].UID < d.Passwords[j].UID })
+	sort.Slice(d.Texts, func(i, j int) bool { return d.Texts[i].UID < d.Texts[j].UID })
+	sort.Slice(d.Binaries, func(i, j int) bool { return d.Binaries[i].UID < d.Binaries[j].UID })
+	sort.Slice(d.Items, func(i, j int) bool { return d.Items[i].UID < d.Items[j].UID })
+	sort.Slice(d.Deleted, func(i, j int) bool { return d.Deleted[i].Revision < d.Deleted[j].Revision })
+	return 200, d, nil
+}
+
+// keepVersion - сохранение прежней версии item записи uid вида itemType в историю пользователя id. Версии сверх
+// глубины истории удаляются, самые старые первыми. Изменения в памяти применяет applyHistory после записи журнала.
+// Вызывается под блокировкой на запись.
+func (s *MemStore) keepVersion(itemType string, uid int, version int64, id string, item interface{}) (historyChange, error) {
+	var change historyChange
+	depth := s.users[id].historyDepth()
+	if depth == 0 {
+		return change, nil
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return change, err
+	}
+	h := memHistory{UserID: id, HistoryEntry: models.HistoryEntry{
+		Type: itemType, UID: uid, Version: version, ChangedAt: time.Now(), Item: data,
+	}}
+	change.put = append(change.put, h)
+	versions := []int64{version}
+	for _, e := range s.history {
+		if e.Type == h.Type && e.UID == uid {
+			versions = append(versions, e.Version)
+		}
+	}
+	for _, v := range overDepth(versions, depth) {
+		change.drop = append(change.drop, historyKey(h.Type, uid, v))
+	}
+	return change, nil
+}
+
+// dropHistory - удаление всех версий из истории, для которых match возвращает true. Вызывается под блокировкой.
+func (s *MemStore) dropHistory(match func(h memHistory) bool) historyChange {
+	var change historyChange
+	for key, h := range s.history {
+		if match(h) {
+			change.drop = append(change.drop, key)
+		}
+	}
+	return change
+}
+
+// applyHistory - применение изменения истории в памяти после записи журнала. Вызывается под блокировкой на запись.
+func (s *MemStore) applyHistory(change historyChange) {
+	for _, h := range change.put {
+		s.history[h.key()] = h
+	}
+	for _, key := range change.drop {
+		delete(s.history, key)
+	}
+}
+
+// GetHistory - прежние версии записи uid вида itemType пользователя id, новые первыми.
+// Если записи нет или она чужая, возвращается 404.
+func (s *MemStore) GetHistory(id, itemType string, uid int) (int, []models.HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.hasItem(itemType, uid, id) {
+		return 404, nil, storage.ErrItemNotFound
+	}
+	var data []models.HistoryEntry
+	for _, h := range s.history {
+		if h.UserID == id && h.Type == itemType && h.UID == uid {
+			data = append(data, h.HistoryEntry)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].Version > data[j].Version })
+	return 200, data, nil
+}
+
+// hasItem - проверка, что запись uid вида itemType есть, не в корзине и принадлежит пользователю id.
+// Вызывается под блокировкой.
+func (s *MemStore) hasItem(itemType string, uid int, id string) bool {
+	owner, deletedAt := s.itemState(itemType, uid)
+	return owner != "" && owner == id && deletedAt == nil
+}
+
+// itemState - владелец записи uid вида itemType и время ее перемещения в корзину. Вызывается под блокировкой.
+func (s *MemStore) itemState(itemType string, uid int) (string, *time.Time) {
+	switch itemType {
+	case models.ItemCards:
+		return s.cards[uid].UserID, s.cards[uid].DeletedAt
+	case models.ItemPasswords:
+		return s.passwords[uid].UserID, s.passwords[uid].DeletedAt
+	case models.ItemTexts:
+		return s.texts[uid].UserID, s.texts[uid].DeletedAt
+	case models.ItemBinaries:
+		return s.binaries[uid].UserID, s.binaries[uid].DeletedAt
+	}
+	if it, ok := s.items[uid]; ok && it.Type == itemType {
+		return it.UserID, it.DeletedAt
+	}
+	return "", nil
+}
+
+// historyItem - запись версии version из истории записи uid вида itemType пользователя id.
+func (s *MemStore) historyItem(id, itemType string, uid int, version int64) (int, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	h, ok := s.history[historyKey(itemType, uid, version)]
+	if !ok || h.UserID != id {
+		return 404, nil, storage.ErrHistoryNotFound
+	}
+	return 200, h.Item, nil
+}
+
+// RestoreItem - восстановление записи uid вида itemType из версии from ее истории (см. restoreItem).
+func (s *MemStore) RestoreItem(id, itemType string, uid int, from, version int64) (int, *models.HistoryEntry, error) {
+	return restoreItem(s, id, itemType, uid, from, version)
+}
+
+// GetHistoryDepth - глубина истории записей пользователя id.
+func (s *MemStore) GetHistoryDepth(id string) (int, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 404, 0, fmt.Errorf("user %s not found", id)
+	}
+	return 200, u.historyDepth(), nil
+}
+
+// SetHistoryDepth - изменение глубины истории записей пользователя id. Версии сверх новой глубины удаляются сразу.
+func (s *MemStore) SetHistoryDepth(id string, depth int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return 404, fmt.Errorf("user %s not found", id)
+	}
+	u.HistoryDepth = &depth
+	items := make(map[string][]int64)
+	for _, h := range s.history {
+		if h.UserID == id {
+			items[itemKey(h.Type, h.UID)] = append(items[itemKey(h.Type, h.UID)], h.Version)
+		}
+	}
+	var change historyChange
+	for item, versions := range items {
+		for _, v := range overDepth(versions, depth) {
+			change.drop = append(change.drop, item+"/"+strconv.FormatInt(v, 10))
+		}
+	}
+	if err := s.persist(append([]journalOp{putOp(tableUsers, id, u)}, change.ops()...)...); err != nil {
+		return 500, err
+	}
+	s.users[id] = u
+	s.applyHistory(change)
+	return 200, nil
+}
+
+// memTrashed - запись в корзине: таблица, вид, идентификатор, владелец, время удаления и сама запись.
+type memTrashed struct {
+	table     string
+	itemType  string
+	uid       int
+	userID    string
+	deletedAt time.Time
+	item      interface{}
+}
+
+// trashed - записи в корзине, для которых match возвращает true. Вызывается под блокировкой.
+func (s *MemStore) trashed(match func(t memTrashed) bool) []memTrashed {
+	var items []memTrashed
+	add := func(t memTrashed) {
+		if match(t) {
+			items = append(items, t)
+		}
+	}
+	for uid, c := range s.cards {
+		if c.DeletedAt != nil {
+			add(memTrashed{table: tableCards, itemType: itemTypes[tableCards], uid: uid, userID: c.UserID, deletedAt: *c.DeletedAt, item: c.CryptoCard})
+		}
+	}
+	for uid, p := range s.passwords {
+		if p.DeletedAt != nil {
+			add(memTrashed{table: tablePasswords, itemType: itemTypes[tablePasswords], uid: uid, userID: p.UserID, deletedAt: *p.DeletedAt, item: p.CryptoPassword})
+		}
+	}
+	for uid, t := range s.texts {
+		if t.DeletedAt != nil {
+			add(memTrashed{table: tableTexts, itemType: itemTypes[tableTexts], uid: uid, userID: t.UserID, deletedAt: *t.DeletedAt, item: t.CryptoTextData})
+		}
+	}
+	for uid, b := range s.binaries {
+		if b.DeletedAt != nil {
+			add(memTrashed{table: tableBinaries, itemType: itemTypes[tableBinaries], uid: uid, userID: b.UserID, deletedAt: *b.DeletedAt, item: b.CryptoBinaryData})
+		}
+	}
+	for uid, it := range s.items {
+		if it.DeletedAt != nil {
+			add(memTrashed{table: tableItems, itemType: it.Type, uid: uid, userID: it.UserID, deletedAt: *it.DeletedAt, item: it.Item})
+		}
+	}
+	return items
+}
+
+// purgeOps - операции журнала окончательного удаления записей из корзины вместе с их историей.
+// Вызывается под блокировкой на запись.
+func (s *MemStore) purgeOps(items []memTrashed) ([]journalOp, historyChange) {
+	var ops []journalOp
+	keys := make(map[string]bool)
+	for _, t := range items {
+		ops = append(ops, deleteOp(t.table, t.uid))
+		keys[itemKey(t.itemType, t.uid)] = true
+	}
+	hist := s.dropHistory(func(h memHistory) bool { return keys[itemKey(h.Type, h.UID)] })
+	return append(ops, hist.ops()...), hist
+}
+
+// dropTrashed - удаление записей из корзины и изменение истории в памяти после записи журнала.
+func (s *MemStore) dropTrashed(items []memTrashed, hist historyChange) {
+	for _, t := range items {
+		switch t.table {
+		case tableCards:
+			delete(s.cards, t.uid)
+		case tablePasswords:
+			delete(s.passwords, t.uid)
+		case tableTexts:
+			delete(s.texts, t.uid)
+		case tableBinaries:
+			delete(s.binaries, t.uid)
+		case tableItems:
+			delete(s.items, t.uid)
+		}
+	}
+	s.applyHistory(hist)
+}
+
+// GetTrash - записи пользователя id в корзине, удаленные последними первыми.
+func (s *MemStore) GetTrash(id string) (int, []models.TrashEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var data []models.TrashEntry
+	for _, t := range s.trashed(func(t memTrashed) bool { return t.userID == id }) {
+		item, err := json.Marshal(t.item)
+		if err != nil {
+			return 500, nil, err
+		}
+		data = append(data, models.TrashEntry{Type: t.itemType, UID: t.uid, DeletedAt: t.deletedAt, Item: item})
+	}
+	sortTrash(data)
+	return 200, data, nil
+}
+
+// RestoreTrash - возврат записи uid вида itemType из корзины пользователя id. Запись получает новую ревизию,
+// а след удаления убирается, чтобы клиенты получили ее при синхронизации.
+func (s *MemStore) RestoreTrash(id, itemType string, uid int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table := itemTable(itemType)
+	owner, deletedAt := s.itemState(itemType, uid)
+	if owner != id || deletedAt == nil {
+		return 404, storage.ErrItemNotFound
+	}
+	rev, user, err := s.nextRevision(id)
+	if err != nil {
+		return 500, err
+	}
+	key := itemKey(itemType, uid)
+	ops := []journalOp{user, deleteOp(tableDeleted, key)}
+	c, p, t, b, it := s.cards[uid], s.passwords[uid], s.texts[uid], s.binaries[uid], s.items[uid]
+	switch table {
+	case tableCards:
+		c.DeletedAt, c.Revision = nil, rev
+		ops = append(ops, putOp(table, uid, c))
+	case tablePasswords:
+		p.DeletedAt, p.Revision = nil, rev
+		ops = append(ops, putOp(table, uid, p))
+	case tableTexts:
+		t.DeletedAt, t.Revision = nil, rev
+		ops = append(ops, putOp(table, uid, t))
+	case tableBinaries:
+		b.DeletedAt, b.Revision = nil, rev
+		ops = append(ops, putOp(table, uid, b))
+	case tableItems:
+		it.DeletedAt, it.Revision = nil, rev
+		ops = append(ops, putOp(table, uid, it))
+	}
+	if err = s.persist(ops...); err != nil {
+		return 500, err
+	}
+	switch table {
+	case tableCards:
+		s.cards[uid] = c
+	case tablePasswords:
+		s.passwords[uid] = p
+	case tableTexts:
+		s.texts[uid] = t
+	case tableBinaries:
+		s.binaries[uid] = b
+	case tableItems:
+		s.items[uid] = it
+	}
+	delete(s.deleted, key)
+	return 200, nil
+}
+
+// EmptyTrash - окончательное удаление всех записей из корзины пользователя id.
+func (s *MemStore) EmptyTrash(id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.trashed(func(t memTrashed) bool { return t.userID == id })
+	if len(items) == 0 {
+		return 200, nil
+	}
+	ops, hist := s.purgeOps(items)
+	if err := s.persist(ops...); err != nil {
+		return 500, err
+	}
+	s.dropTrashed(items, hist)
+	return 200, nil
+}
+
+// PurgeTrash - окончательное удаление записей всех пользователей, которые попали в корзину раньше before.
+// Возвращает число удаленных записей.
+func (s *MemStore) PurgeTrash(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.trashed(func(t memTrashed) bool { return t.deletedAt.Before(before) })
+	if len(items) == 0 {
+		return 0, nil
+	}
+	ops, hist := s.purgeOps(items)
+	if err := s.persist(ops...); err != nil {
+		return 0, err
+	}
+	s.dropTrashed(items, hist)
+	return len(items), nil
+}
+
+// updateUser - изменение пользователя id функцией update под блокировкой.
+// Если update возвращает false, пользователь не изменился и журнал не пишется.
+func (s *MemStore) updateUser(id string, update func(u *memUser) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return fmt.Errorf("user %s not found", id)
+	}
+	if !update(&u) {
+		return nil
+	}
+	if err := s.persist(putOp(tableUsers, u.ID, u)); err != nil {
+		return err
+	}
+	s.users[u.ID] = u
+	return nil
+}
+
+// checkCardNumber - проверка уникальности номера карты у пользователя, аналог cards_card_number_uindex.
+// Вызывается под блокировкой.
+func (s *MemStore) checkCardNumber(d *models.CryptoCard, id string) error {
+	if len(d.Number) == 0 {
+		return nil
+	}
+	for _, c := range s.cards {
+		if c.UserID == id && c.UID != d.UID && bytes.Equal(c.Number, d.Number) {
+			return fmt.Errorf("card number already exists")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1131 @@
+package repositories
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
+)
+
+func newTestMemStore() *MemStore {
+	return NewMemStore(&CFG, loggers.NewLogger())
+}
+
+func TestMemStore_Register(t *testing.T) {
+	s := newTestMemStore()
+
+	tests := []struct {
+		name        string
+		user        models.User
+		expectedUID string
+	}{
+		{
+			name: "ok",
+			user: models.User{
+				Login:    "Login",
+				Password: "Password",
+			},
+			expectedUID: "1",
+		},
+		{
+			name: "false",
+			user: models.User{
+				Login:    "Login",
+				Password: "Password",
+			},
+			expectedUID: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uid, _ := s.Register(&tt.user)
+			assert.Equal(t, tt.expectedUID, uid)
+		})
+	}
+}
+
+func TestMemStore_Login(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{
+		Login:    "test",
+		Password: "testPass",
+	})
+	assert.NoError(t, err)
+	tests := []struct {
+		name        string
+		user        models.User
+		expectedUID string
+	}{
+		{
+			name: "ok",
+			user: models.User{
+				Login:    "test",
+				Password: "testPass",
+			},
+			expectedUID: uid,
+		},
+		{
+			name: "wrong login",
+			user: models.User{
+				Login:    "Login",
+				Password: "Password",
+			},
+			expectedUID: "",
+		},
+		{
+			name: "wrong pass",
+			user: models.User{
+				Login:    "test",
+				Password: "Password",
+			},
+			expectedUID: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, _ := s.Login(&tt.user)
+			assert.Equal(t, tt.expectedUID, id)
+		})
+	}
+}
+
+func TestMemStore_Cards(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", Password: "testPass"})
+	assert.NoError(t, err)
+
+	status, err := s.CollectCard(&models.CryptoCard{Number: []byte("1"), Name: []byte("n"), CVC: []byte("c")}, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+
+	//повторный номер карты у того же пользователя запрещен, у другого — разрешен.
+	status, err = s.CollectCard(&models.CryptoCard{Number: []byte("1")}, uid)
+	assert.Error(t, err)
+	assert.Equal(t, 500, status)
+	status, err = s.CollectCard(&models.CryptoCard{Number: []byte("1")}, other)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+
+	status, c, err := s.GetCards(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Len(t, c, 1)
+
+	//чужой пользователь не может изменить или удалить карту.
+	status, err = s.UpdateCard(&models.CryptoCard{UID: c[0].UID, Number: []byte("2")}, other)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, err = s.DeleteCard(&c[0], other)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	_, c, _ = s.GetCards(uid)
+	assert.Equal(t, []byte("1"), c[0].Number)
+
+	status, err = s.UpdateCard(&models.CryptoCard{UID: c[0].UID, Number: []byte("2"), Name: []byte("n2")}, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, c, _ = s.GetCards(uid)
+	assert.Equal(t, []byte("2"), c[0].Number)
+	assert.Equal(t, []byte("n2"), c[0].Name)
+
+	status, err = s.DeleteCard(&c[0], uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, c, _ = s.GetCards(uid)
+	assert.Empty(t, c)
+}
+
+func TestMemStore_Data(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("login"), Pass: []byte("pass")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("text")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectBinary(&models.CryptoBinaryData{Data: []byte("data")}, uid)
+	assert.NoError(t, err)
+
+	_, p, err := s.GetPassword(uid)
+	assert.NoError(t, err)
+	assert.Len(t, p, 1)
+	_, txt, err := s.GetText(uid)
+	assert.NoError(t, err)
+	assert.Len(t, txt, 1)
+	_, b, err := s.GetBinary(uid)
+	assert.NoError(t, err)
+	assert.Len(t, b, 1)
+
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: p[0].UID, Login: []byte("l2"), Pass: []byte("p2")}, uid)
+	assert.NoError(t, err)
+	_, err = s.UpdateText(&models.CryptoTextData{UID: txt[0].UID, Text: []byte("t2")}, uid)
+	assert.NoError(t, err)
+	_, err = s.UpdateBinary(&models.CryptoBinaryData{UID: b[0].UID, Data: []byte("d2")}, uid)
+	assert.NoError(t, err)
+
+	_, p, _ = s.GetPassword(uid)
+	assert.Equal(t, []byte("p2"), p[0].Pass)
+	_, txt, _ = s.GetText(uid)
+	assert.Equal(t, []byte("t2"), txt[0].Text)
+	_, b, _ = s.GetBinary(uid)
+	assert.Equal(t, []byte("d2"), b[0].Data)
+
+	_, err = s.DeletePassword(&p[0], uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteText(&txt[0], uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteBinary(&b[0], uid)
+	assert.NoError(t, err)
+
+	_, p, _ = s.GetPassword(uid)
+	assert.Empty(t, p)
+	_, txt, _ = s.GetText(uid)
+	assert.Empty(t, txt)
+	_, b, _ = s.GetBinary(uid)
+	assert.Empty(t, b)
+}
+
+func TestMemStore_Concurrent(t *testing.T) {
+	s := newTestMemStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uid, err := s.Register(&models.User{Login: "user" + strconv.Itoa(i), Password: "pass"})
+			assert.NoError(t, err)
+			_, err = s.CollectText(&models.CryptoTextData{Text: []byte("text")}, uid)
+			assert.NoError(t, err)
+			_, _, err = s.GetText(uid)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, s.users, 50)
+	assert.Len(t, s.texts, 50)
+}
+
+func TestMemStore_LoginRehash(t *testing.T) {
+	s := newTestMemStore()
+	//пользователь со старым хэшем HMAC-SHA256
+	h := hmac.New(sha256.New, []byte("password"))
+	h.Write([]byte("testPass"))
+	legacy := fmt.Sprintf("%x", h.Sum(nil))
+	s.users["1"] = memUser{ID: "1", Login: "test", HashedPassword: legacy}
+	s.logins["test"] = "1"
+
+	_, err := s.Login(&models.User{Login: "test", Password: "wrong"})
+	assert.Error(t, err)
+	assert.Equal(t, legacy, s.users["1"].HashedPassword)
+
+	id, err := s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+	assert.True(t, strings.HasPrefix(s.users["1"].HashedPassword, "$argon2id$"))
+
+	id, err = s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", id)
+}
+
+func TestMemStore_LoginAuthKey(t *testing.T) {
+	s := newTestMemStore()
+	//аккаунт старого клиента, зарегистрированный по паролю
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	assert.False(t, s.users[uid].AuthKey)
+
+	_, err = s.Login(&models.User{Login: "test", AuthKey: "key"})
+	assert.ErrorIs(t, err, storage.ErrAuthUpgrade)
+
+	_, err = s.Login(&models.User{Login: "test", Password: "wrong", AuthKey: "key"})
+	assert.Error(t, err)
+	assert.False(t, s.users[uid].AuthKey)
+
+	id, err := s.Login(&models.User{Login: "test", Password: "testPass", AuthKey: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, uid, id)
+	assert.True(t, s.users[uid].AuthKey)
+
+	//после перевода пароль больше не подходит
+	_, err = s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.Error(t, err)
+	id, err = s.Login(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	assert.Equal(t, uid, id)
+
+	//новый клиент регистрируется сразу по ключу
+	uid, err = s.Register(&models.User{Login: "new", AuthKey: "newKey"})
+	assert.NoError(t, err)
+	assert.True(t, s.users[uid].AuthKey)
+	id, err = s.Login(&models.User{Login: "new", AuthKey: "newKey"})
+	assert.NoError(t, err)
+	assert.Equal(t, uid, id)
+}
+
+func TestMemStore_RefreshTokens(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "1", Family: "f", UserID: uid, ExpiresAt: expiresAt}))
+	next := models.RefreshToken{Hash: "2", ExpiresAt: expiresAt}
+	assert.NoError(t, s.RotateRefreshToken("1", &next))
+	assert.Equal(t, "f", next.Family)
+	assert.Equal(t, uid, next.UserID)
+
+	//повторное использование отзывает семейство
+	assert.ErrorIs(t, s.RotateRefreshToken("1", &models.RefreshToken{Hash: "3", ExpiresAt: expiresAt}), storage.ErrTokenReused)
+	assert.ErrorIs(t, s.RotateRefreshToken("2", &models.RefreshToken{Hash: "3", ExpiresAt: expiresAt}), storage.ErrTokenRevoked)
+	assert.ErrorIs(t, s.RotateRefreshToken("unknown", &models.RefreshToken{Hash: "3"}), storage.ErrTokenNotFound)
+
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "old", Family: "g", UserID: uid, ExpiresAt: time.Now().Add(-time.Hour)}))
+	assert.ErrorIs(t, s.RotateRefreshToken("old", &models.RefreshToken{Hash: "4"}), storage.ErrTokenExpired)
+
+	//чужой пользователь не может отозвать семейство
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "5", Family: "h", UserID: uid, ExpiresAt: expiresAt}))
+	assert.ErrorIs(t, s.RevokeRefreshToken("5", "other"), storage.ErrTokenNotFound)
+	assert.NoError(t, s.RevokeRefreshToken("5", uid))
+	assert.ErrorIs(t, s.RotateRefreshToken("5", &models.RefreshToken{Hash: "6", ExpiresAt: expiresAt}), storage.ErrTokenRevoked)
+
+	revoked, err := s.IsTokenRevoked("jti")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	assert.NoError(t, s.RevokeToken("jti", uid, expiresAt))
+	revoked, err = s.IsTokenRevoked("jti")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestMemStore_Sessions(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", Password: "testPass"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "s1", Device: "laptop"}, uid))
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "s2", Device: "phone"}, uid))
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "1", Family: "s2", UserID: uid, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	status, sessions, err := s.GetSessions(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Len(t, sessions, 2)
+	_, sessions, _ = s.GetSessions(other)
+	assert.Empty(t, sessions)
+
+	active, err := s.TouchSession("s2")
+	assert.NoError(t, err)
+	assert.True(t, active)
+
+	//чужой пользователь не может отозвать сессию
+	status, err = s.RevokeSession("s2", other)
+	assert.Error(t, err)
+	assert.Equal(t, 404, status)
+	status, err = s.RevokeSession("s2", uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+
+	active, err = s.TouchSession("s2")
+	assert.NoError(t, err)
+	assert.False(t, active)
+	assert.ErrorIs(t, s.RotateRefreshToken("1", &models.RefreshToken{Hash: "2"}), storage.ErrTokenRevoked)
+	_, sessions, _ = s.GetSessions(uid)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "laptop", sessions[0].Device)
+}
+
+func TestMemStore_TOTP(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+
+	codes := []string{"a", "b"}
+	assert.NoError(t, s.SetTOTP(uid, "secret", codes))
+	codes[0] = "changed"
+	totp, err := s.GetTOTP(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.TOTP{Login: "test", Secret: "secret"}, totp)
+
+	assert.NoError(t, s.EnableTOTP(uid))
+	totp, _ = s.GetTOTP(uid)
+	assert.True(t, totp.Enabled)
+
+	//один интервал и один код восстановления принимаются только раз
+	ok, err := s.UseTOTPStep(uid, 10)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = s.UseTOTPStep(uid, 10)
+	assert.False(t, ok)
+	ok, _ = s.UseTOTPStep(uid, 9)
+	assert.False(t, ok)
+	ok, err = s.UseRecoveryCode(uid, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, _ = s.UseRecoveryCode(uid, "a")
+	assert.False(t, ok)
+	ok, _ = s.UseRecoveryCode(uid, "b")
+	assert.True(t, ok)
+
+	assert.NoError(t, s.DisableTOTP(uid))
+	totp, _ = s.GetTOTP(uid)
+	assert.Equal(t, &models.TOTP{Login: "test"}, totp)
+	_, err = s.GetTOTP("unknown")
+	assert.Error(t, err)
+}
+
+func TestMemStore_LoginAttempts(t *testing.T) {
+	s := newTestMemStore()
+
+	lock, err := s.GetLoginLock("test")
+	assert.NoError(t, err)
+	assert.True(t, lock.IsZero())
+
+	since := time.Now().Add(-time.Hour)
+	for i := 1; i <= 3; i++ {
+		failures, err := s.RecordLoginFailure("test", since)
+		assert.NoError(t, err)
+		assert.Equal(t, i, failures)
+	}
+	until := time.Now().Add(time.Minute)
+	assert.NoError(t, s.LockLogin("test", until))
+	lock, _ = s.GetLoginLock("test")
+	assert.Equal(t, until, lock)
+	//попытки других логинов считаются отдельно
+	failures, _ := s.RecordLoginFailure("other", since)
+	assert.Equal(t, 1, failures)
+
+	//старые попытки забываются, но не раньше окончания блокировки
+	failures, _ = s.RecordLoginFailure("test", time.Now().Add(time.Second))
+	assert.Equal(t, 4, failures)
+	assert.NoError(t, s.LockLogin("test", time.Now().Add(-time.Second)))
+	failures, _ = s.RecordLoginFailure("test", time.Now().Add(time.Second))
+	assert.Equal(t, 1, failures)
+	assert.NotContains(t, s.attempts, "other")
+
+	assert.NoError(t, s.ResetLoginFailures("test"))
+	lock, _ = s.GetLoginLock("test")
+	assert.True(t, lock.IsZero())
+	failures, _ = s.RecordLoginFailure("test", since)
+	assert.Equal(t, 1, failures)
+}
+
+func TestMemStore_ChangePassword(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "s1"}, uid))
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "s2"}, uid))
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "1", Family: "s1", UserID: uid, ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.NoError(t, s.SaveRefreshToken(&models.RefreshToken{Hash: "2", Family: "s2", UserID: uid, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	status, err := s.ChangePassword(uid, "wrong", "newPass", "s1")
+	assert.Error(t, err)
+	assert.Equal(t, 403, status)
+	status, err = s.ChangePassword("unknown", "testPass", "newPass", "s1")
+	assert.Error(t, err)
+	assert.Equal(t, 404, status)
+
+	status, err = s.ChangePassword(uid, "testPass", "newPass", "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, err = s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.Error(t, err)
+	_, err = s.Login(&models.User{Login: "test", Password: "newPass"})
+	assert.NoError(t, err)
+
+	//текущая сессия остается, остальные отозваны
+	_, sessions, _ := s.GetSessions(uid)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "s1", sessions[0].ID)
+	assert.NoError(t, s.RotateRefreshToken("1", &models.RefreshToken{Hash: "3"}))
+	assert.ErrorIs(t, s.RotateRefreshToken("2", &models.RefreshToken{Hash: "4"}), storage.ErrTokenRevoked)
+}
+
+func TestMemStore_DeleteAccount(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", Password: "testPass"})
+	assert.NoError(t, err)
+	for _, id := range []string{uid, other} {
+		_, err = s.CollectCard(&models.CryptoCard{Number: []byte(id)}, id)
+		assert.NoError(t, err)
+		_, err = s.CollectPassword(&models.CryptoPassword{}, id)
+		assert.NoError(t, err)
+		_, err = s.CollectText(&models.CryptoTextData{}, id)
+		assert.NoError(t, err)
+		_, err = s.CollectBinary(&models.CryptoBinaryData{}, id)
+		assert.NoError(t, err)
+		assert.NoError(t, s.CreateSession(&models.Session{ID: "s" + id}, id))
+		assert.NoError(t, s.RevokeToken("jti"+id, id, time.Now().Add(time.Hour)))
+	}
+	_, err = s.RecordLoginFailure("test", time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, s.LockLogin("test", time.Now().Add(time.Hour)))
+
+	status, login, err := s.GetLogin(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "test", login)
+	status, err = s.DeleteAccount(uid, "wrong")
+	assert.Error(t, err)
+	assert.Equal(t, 403, status)
+	status, err = s.DeleteAccount(uid, "testPass")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	status, _, err = s.GetLogin(uid)
+	assert.Error(t, err)
+	assert.Equal(t, 404, status)
+
+	_, err = s.Login(&models.User{Login: "test", Password: "testPass"})
+	assert.Error(t, err)
+	active, _ := s.TouchSession("s" + uid)
+	assert.False(t, active)
+	_, cards, _ := s.GetCards(uid)
+	assert.Empty(t, cards)
+	assert.Len(t, s.cards, 1)
+	assert.Len(t, s.passwords, 1)
+	assert.Len(t, s.texts, 1)
+	assert.Len(t, s.binaries, 1)
+	//отозванные токены и попытки входа удаленного пользователя не остаются в хранилище
+	assert.Len(t, s.revoked, 1)
+	assert.NotContains(t, s.revoked, "jti"+uid)
+	assert.Empty(t, s.attempts)
+	//данные другого пользователя не затронуты
+	_, cards, _ = s.GetCards(other)
+	assert.Len(t, cards, 1)
+	//логин снова свободен
+	_, err = s.Register(&models.User{Login: "test", Password: "testPass"})
+	assert.NoError(t, err)
+}
+
+func TestMemStore_Keys(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+
+	status, _, err := s.GetKey(uid)
+	assert.Error(t, err)
+	assert.Equal(t, 404, status)
+	assert.Error(t, s.SaveKey("100", []byte("sealed")))
+
+	assert.NoError(t, s.SaveKey(uid, []byte("sealed")))
+	assert.NoError(t, s.SaveKey(uid, []byte("resealed")))
+	status, k, err := s.GetKey(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []byte("resealed"), k.Key)
+
+	status, err = s.DeleteAccount(uid, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	status, _, _ = s.GetKey(uid)
+	assert.Equal(t, 404, status)
+}
+
+func TestMemStore_RotateItems(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", AuthKey: "key"})
+	assert.NoError(t, err)
+	_, err = s.CollectCard(&models.CryptoCard{Number: []byte("1"), Name: []byte("n"), CVC: []byte("c")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("text")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("other")}, other)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "current"}, uid))
+	assert.NoError(t, s.CreateSession(&models.Session{ID: "phone"}, uid))
+	_, cards, _ := s.GetCards(uid)
+	_, texts, _ := s.GetText(uid)
+
+	//запись не отправлена - ничего не меняется
+	status, err := s.RotateItems(&models.ItemBatch{Cards: cards, Key: []byte("new")}, uid, "current")
+	assert.Error(t, err)
+	assert.Equal(t, 409, status)
+	_, _, err = s.GetKey(uid)
+	assert.Error(t, err)
+
+	cards[0].Number = []byte("2")
+	texts[0].Text = []byte("rotated")
+	status, err = s.RotateItems(&models.ItemBatch{Cards: cards, Texts: texts, Key: []byte("new")}, uid, "current")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, cards, _ = s.GetCards(uid)
+	assert.Equal(t, []byte("2"), cards[0].Number)
+	_, texts, _ = s.GetText(uid)
+	assert.Equal(t, []byte("rotated"), texts[0].Text)
+	_, k, err := s.GetKey(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), k.Key)
+	ok, err := s.TouchSession("phone")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = s.TouchSession("current")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	//чужую запись подменить нельзя
+	_, otherTexts, _ := s.GetText(other)
+	status, err = s.RotateItems(&models.ItemBatch{Cards: cards, Texts: append(texts, otherTexts...), Key: []byte("new")}, uid, "current")
+	assert.Error(t, err)
+	assert.Equal(t, 409, status)
+}
+
+func TestMemStore_Sync(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", AuthKey: "key"})
+	assert.NoError(t, err)
+	_, err = s.CollectCard(&models.CryptoCard{Number: []byte("1")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("first")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("second")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("other")}, other)
+	assert.NoError(t, err)
+
+	status, d, err := s.Sync(uid, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.True(t, d.Full)
+	assert.Equal(t, int64(3), d.Revision)
+	assert.Len(t, d.Cards, 1)
+	assert.Len(t, d.Texts, 2)
+	assert.Empty(t, d.Passwords)
+	since := d.Revision
+
+	//изменение, удаление и чужая запись после ревизии клиента
+	_, err = s.UpdateText(&models.CryptoTextData{UID: d.Texts[1].UID, Text: []byte("updated")}, uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteCard(&d.Cards[0], uid)
+	assert.NoError(t, err)
+	_, err = s.UpdateText(&models.CryptoTextData{UID: d.Texts[0].UID, Text: []byte("stolen")}, other)
+	assert.Error(t, err)
+	_, err = s.DeleteText(&models.CryptoTextData{UID: 100}, uid)
+	assert.Error(t, err)
+
+	status, d, err = s.Sync(uid, since)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.False(t, d.Full)
+	assert.Equal(t, int64(5), d.Revision)
+	assert.Empty(t, d.Cards)
+	assert.Len(t, d.Texts, 1)
+	assert.Equal(t, []byte("updated"), d.Texts[0].Text)
+	assert.Equal(t, int64(4), d.Texts[0].Revision)
+	assert.Equal(t, []models.Tombstone{{Type: models.ItemCards, UID: 1, Revision: 5}}, d.Deleted)
+
+	//нечего синхронизировать
+	_, d, _ = s.Sync(uid, d.Revision)
+	assert.False(t, d.Full)
+	assert.Empty(t, d.Texts)
+	assert.Empty(t, d.Deleted)
+
+	//ревизия клиента новее серверной - клиент получает все записи заново
+	_, d, _ = s.Sync(uid, 100)
+	assert.True(t, d.Full)
+	assert.Len(t, d.Texts, 2)
+	assert.Empty(t, d.Deleted)
+
+	status, _, err = s.Sync("100", 0)
+	assert.Error(t, err)
+	assert.Equal(t, 404, status)
+
+	//смена ключа меняет все записи одной ревизией
+	_, texts, _ := s.GetText(uid)
+	status, err = s.RotateItems(&models.ItemBatch{Texts: texts, Key: []byte("new")}, uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, d, _ = s.Sync(uid, 5)
+	assert.Len(t, d.Texts, 2)
+	assert.Equal(t, int64(6), d.Texts[0].Revision)
+	assert.Equal(t, int64(6), d.Texts[1].Revision)
+
+	_, err = s.DeleteAccount(uid, "key")
+	assert.NoError(t, err)
+	assert.Empty(t, s.deleted)
+}
+
+func TestMemStore_Versions(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("first")}, uid)
+	assert.NoError(t, err)
+	_, texts, _ := s.GetText(uid)
+	assert.Equal(t, int64(1), texts[0].Version)
+
+	//первое устройство меняет запись, версия растет
+	laptop := models.CryptoTextData{UID: texts[0].UID, Text: []byte("laptop"), Version: 1}
+	status, err := s.UpdateText(&laptop, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, int64(2), laptop.Version)
+
+	//второе устройство меняет ту же версию - изменение не применяется, в ответе копия сервера
+	phone := models.CryptoTextData{UID: texts[0].UID, Text: []byte("phone"), Version: 1}
+	status, err = s.UpdateText(&phone, uid)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, []byte("laptop"), phone.Text)
+	assert.Equal(t, int64(2), phone.Version)
+	status, err = s.DeleteText(&models.CryptoTextData{UID: texts[0].UID, Version: 1}, uid)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.Equal(t, 409, status)
+	_, texts, _ = s.GetText(uid)
+	assert.Equal(t, []byte("laptop"), texts[0].Text)
+
+	//после объединения изменение отправляется с версией сервера
+	phone.Text = []byte("merged")
+	status, err = s.UpdateText(&phone, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, int64(3), phone.Version)
+
+	//смена ключа не затирает изменение, сделанное после получения записей
+	stale := append([]models.CryptoTextData(nil), texts...)
+	status, err = s.RotateItems(&models.ItemBatch{Texts: stale, Key: []byte("new")}, uid, "")
+	assert.Error(t, err)
+	assert.Equal(t, 409, status)
+	_, texts, _ = s.GetText(uid)
+	status, err = s.RotateItems(&models.ItemBatch{Texts: texts, Key: []byte("new")}, uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, texts, _ = s.GetText(uid)
+	assert.Equal(t, int64(4), texts[0].Version)
+
+	status, err = s.DeleteText(&models.CryptoTextData{UID: texts[0].UID, Version: 4}, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	status, err = s.DeleteText(&models.CryptoTextData{UID: texts[0].UID, Version: 4}, uid)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+}
+
+func TestMemStore_History(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", AuthKey: "key"})
+	assert.NoError(t, err)
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("site"), Pass: []byte("v1")}, uid)
+	assert.NoError(t, err)
+	_, passwords, _ := s.GetPassword(uid)
+	id := passwords[0].UID
+
+	status, history, err := s.GetHistory(uid, models.ItemPasswords, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Empty(t, history)
+	for _, pass := range []string{"v2", "v3"} {
+		_, err = s.UpdatePassword(&models.CryptoPassword{UID: id, Login: []byte("site"), Pass: []byte(pass)}, uid)
+		assert.NoError(t, err)
+	}
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Len(t, history, 2)
+	assert.Equal(t, int64(2), history[0].Version)
+	assert.Equal(t, int64(1), history[1].Version)
+	var first models.CryptoPassword
+	assert.NoError(t, json.Unmarshal(history[1].Item, &first))
+	assert.Equal(t, []byte("v1"), first.Pass)
+
+	//чужую историю не видно и не восстановить
+	status, _, err = s.GetHistory(other, models.ItemPasswords, id)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, _, err = s.RestoreItem(other, models.ItemPasswords, id, 1, 0)
+	assert.ErrorIs(t, err, storage.ErrHistoryNotFound)
+	assert.Equal(t, 404, status)
+	status, _, err = s.RestoreItem(uid, models.ItemPasswords, id, 7, 0)
+	assert.ErrorIs(t, err, storage.ErrHistoryNotFound)
+	assert.Equal(t, 404, status)
+
+	//восстановление проверяет текущую версию, а текущая версия остается в истории
+	status, entry, err := s.RestoreItem(uid, models.ItemPasswords, id, 1, 2)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, int64(3), entry.Version)
+	_, passwords, _ = s.GetPassword(uid)
+	assert.True(t, passwords[0].UpdatedAt.Equal(entry.ChangedAt))
+	status, entry, err = s.RestoreItem(uid, models.ItemPasswords, id, 1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, int64(4), entry.Version)
+	_, passwords, _ = s.GetPassword(uid)
+	assert.Equal(t, []byte("v1"), passwords[0].Pass)
+	//время восстановленной записи - время, которое сохранил сервер
+	assert.True(t, passwords[0].UpdatedAt.Equal(entry.ChangedAt))
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Len(t, history, 3)
+	assert.Equal(t, int64(3), history[0].Version)
+
+	//глубина истории ограничивает число версий
+	status, depth, err := s.GetHistoryDepth(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, models.DefaultHistoryDepth, depth)
+	status, err = s.SetHistoryDepth(uid, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Len(t, history, 1)
+	assert.Equal(t, int64(3), history[0].Version)
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: id, Login: []byte("site"), Pass: []byte("v5")}, uid)
+	assert.NoError(t, err)
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Len(t, history, 1)
+	assert.Equal(t, int64(4), history[0].Version)
+	_, err = s.SetHistoryDepth(uid, 0)
+	assert.NoError(t, err)
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: id, Login: []byte("site"), Pass: []byte("v6")}, uid)
+	assert.NoError(t, err)
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Empty(t, history)
+
+	//история удаляется при смене ключа и вместе с записью, когда та уходит из корзины
+	_, err = s.SetHistoryDepth(uid, 5)
+	assert.NoError(t, err)
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: id, Login: []byte("site"), Pass: []byte("v7")}, uid)
+	assert.NoError(t, err)
+	_, passwords, _ = s.GetPassword(uid)
+	_, err = s.RotateItems(&models.ItemBatch{Passwords: passwords, Key: []byte("new")}, uid, "")
+	assert.NoError(t, err)
+	_, history, _ = s.GetHistory(uid, models.ItemPasswords, id)
+	assert.Empty(t, history)
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: id, Login: []byte("site"), Pass: []byte("v8")}, uid)
+	assert.NoError(t, err)
+	_, err = s.DeletePassword(&models.CryptoPassword{UID: id}, uid)
+	assert.NoError(t, err)
+	assert.Len(t, s.history, 1)
+	_, err = s.EmptyTrash(uid)
+	assert.NoError(t, err)
+	assert.Empty(t, s.history)
+}
+
+func TestMemStore_Trash(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", AuthKey: "key"})
+	assert.NoError(t, err)
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("site"), Pass: []byte("old")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("note")}, uid)
+	assert.NoError(t, err)
+	_, err = s.UpdatePassword(&models.CryptoPassword{UID: 1, Login: []byte("site"), Pass: []byte("new")}, uid)
+	assert.NoError(t, err)
+	_, d, _ := s.Sync(uid, 0)
+	since := d.Revision
+
+	//удаленная запись уходит в корзину и пропадает из остальных запросов
+	_, err = s.DeletePassword(&models.CryptoPassword{UID: 1}, uid)
+	assert.NoError(t, err)
+	_, passwords, _ := s.GetPassword(uid)
+	assert.Empty(t, passwords)
+	status, trash, err := s.GetTrash(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, models.ItemPasswords, trash[0].Type)
+	assert.Equal(t, 1, trash[0].UID)
+	var p models.CryptoPassword
+	assert.NoError(t, json.Unmarshal(trash[0].Item, &p))
+	assert.Equal(t, []byte("new"), p.Pass)
+	_, d, _ = s.Sync(uid, since)
+	assert.Empty(t, d.Passwords)
+	assert.Equal(t, []models.Tombstone{{Type: models.ItemPasswords, UID: 1, Revision: since + 1}}, d.Deleted)
+	status, err = s.UpdatePassword(&models.CryptoPassword{UID: 1, Pass: []byte("x")}, uid)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, err = s.DeletePassword(&models.CryptoPassword{UID: 1}, uid)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, _, err = s.GetHistory(uid, models.ItemPasswords, 1)
+	assert.Equal(t, 404, status)
+	_, trash, _ = s.GetTrash(other)
+	assert.Empty(t, trash)
+
+	//возврат из корзины: чужую запись не вернуть, возвращенная запись приходит при синхронизации вместе с историей
+	status, err = s.RestoreTrash(other, models.ItemPasswords, 1)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, err = s.RestoreTrash(uid, models.ItemTexts, 1)
+	assert.Equal(t, 404, status)
+	status, err = s.RestoreTrash(uid, models.ItemPasswords, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, passwords, _ = s.GetPassword(uid)
+	assert.Len(t, passwords, 1)
+	_, d, _ = s.Sync(uid, since)
+	assert.Len(t, d.Passwords, 1)
+	assert.Empty(t, d.Deleted)
+	_, history, _ := s.GetHistory(uid, models.ItemPasswords, 1)
+	assert.Len(t, history, 1)
+	_, trash, _ = s.GetTrash(uid)
+	assert.Empty(t, trash)
+
+	//записи старше срока удаляются окончательно вместе с историей
+	_, err = s.DeletePassword(&models.CryptoPassword{UID: 1}, uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteText(&models.CryptoTextData{UID: 1}, uid)
+	assert.NoError(t, err)
+	n, err := s.PurgeTrash(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = s.PurgeTrash(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	_, trash, _ = s.GetTrash(uid)
+	assert.Empty(t, trash)
+	assert.Empty(t, s.passwords)
+	assert.Empty(t, s.history)
+	status, err = s.RestoreTrash(uid, models.ItemPasswords, 1)
+	assert.Equal(t, 404, status)
+
+	//очистка корзины и смена ключа удаляют только записи в корзине
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("first")}, uid)
+	assert.NoError(t, err)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("second")}, uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteText(&models.CryptoTextData{UID: 2}, uid)
+	assert.NoError(t, err)
+	status, err = s.EmptyTrash(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, trash, _ = s.GetTrash(uid)
+	assert.Empty(t, trash)
+	_, texts, _ := s.GetText(uid)
+	assert.Len(t, texts, 1)
+	_, err = s.CollectText(&models.CryptoTextData{Text: []byte("third")}, uid)
+	assert.NoError(t, err)
+	_, err = s.DeleteText(&models.CryptoTextData{UID: 4}, uid)
+	assert.NoError(t, err)
+	status, err = s.RotateItems(&models.ItemBatch{Texts: texts, Key: []byte("new")}, uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, trash, _ = s.GetTrash(uid)
+	assert.Empty(t, trash)
+	assert.Len(t, s.texts, 1)
+}
+
+func TestMemStore_Meta(t *testing.T) {
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+
+	//время создания и изменения ставит сервер, присланное клиентом не сохраняется
+	before := time.Now()
+	sent := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	meta := models.ItemMeta{Title: []byte("bank"), URL: []byte("url"), Notes: []byte("notes"), Tags: []byte("work"),
+		Favorite: true, CreatedAt: sent, UpdatedAt: sent}
+	_, err = s.CollectPassword(&models.CryptoPassword{Login: []byte("site"), Pass: []byte("pass"), ItemMeta: meta}, uid)
+	assert.NoError(t, err)
+	_, passwords, _ := s.GetPassword(uid)
+	assert.Len(t, passwords, 1)
+	created := passwords[0]
+	assert.Equal(t, []byte("bank"), created.Title)
+	assert.Equal(t, []byte("url"), created.URL)
+	assert.Equal(t, []byte("notes"), created.Notes)
+	assert.Equal(t, []byte("work"), created.Tags)
+	assert.True(t, created.Favorite)
+	assert.False(t, created.CreatedAt.Before(before))
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	//изменение заменяет общие поля, но не время создания
+	changed := models.CryptoPassword{UID: 1, Login: []byte("site"), Pass: []byte("new"), Version: created.Version,
+		ItemMeta: models.ItemMeta{Title: []byte("bank 2"), CreatedAt: sent}}
+	status, err := s.UpdatePassword(&changed, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []byte("bank 2"), changed.Title)
+	assert.Nil(t, changed.URL)
+	assert.False(t, changed.Favorite)
+	assert.Equal(t, created.CreatedAt, changed.CreatedAt)
+	assert.False(t, changed.UpdatedAt.Before(created.UpdatedAt))
+	_, history, _ := s.GetHistory(uid, models.ItemPasswords, 1)
+	assert.Len(t, history, 1)
+	var old models.CryptoPassword
+	assert.NoError(t, json.Unmarshal(history[0].Item, &old))
+	assert.Equal(t, []byte("bank"), old.Title)
+	assert.True(t, old.Favorite)
+
+	//смена ключа перешифровывает только зашифрованные поля
+	_, passwords, _ = s.GetPassword(uid)
+	rotated := passwords[0]
+	rotated.Title, rotated.Favorite, rotated.UpdatedAt = []byte("rotated"), true, sent
+	status, err = s.RotateItems(&models.ItemBatch{Passwords: []models.CryptoPassword{rotated}, Key: []byte("key")}, uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, passwords, _ = s.GetPassword(uid)
+	assert.Equal(t, []byte("rotated"), passwords[0].Title)
+	assert.False(t, passwords[0].Favorite)
+	assert.Equal(t, changed.UpdatedAt, passwords[0].UpdatedAt)
+	assert.Equal(t, created.CreatedAt, passwords[0].CreatedAt)
+}
+
+func TestMemStore_Items(t *testing.T) {
+	assert.NoError(t, models.RegisterItemKind("note"))
+	assert.NoError(t, models.RegisterItemKind("ssh_key"))
+	s := newTestMemStore()
+	uid, err := s.Register(&models.User{Login: "test", AuthKey: "key"})
+	assert.NoError(t, err)
+	other, err := s.Register(&models.User{Login: "other", AuthKey: "key"})
+	assert.NoError(t, err)
+
+	//незарегистрированный вид не найден
+	status, _, err := s.GetItems(uid, "unknown")
+	assert.ErrorIs(t, err, storage.ErrUnknownKind)
+	assert.Equal(t, 404, status)
+	status, err = s.CollectItem(&models.Item{Type: "unknown"}, uid)
+	assert.ErrorIs(t, err, storage.ErrUnknownKind)
+	assert.Equal(t, 404, status)
+
+	//записи встроенных видов сохраняются в своих таблицах
+	p, _ := json.Marshal(models.PasswordPayload{Login: []byte("site"), Pass: []byte("pass")})
+	d := models.Item{Type: models.ItemPasswords, Payload: p, ItemMeta: models.ItemMeta{Title: []byte("bank")}}
+	status, err = s.CollectItem(&d, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 1, d.UID)
+	assert.Equal(t, int64(1), d.Version)
+	_, passwords, _ := s.GetPassword(uid)
+	assert.Len(t, passwords, 1)
+	assert.Equal(t, []byte("pass"), passwords[0].Pass)
+	assert.Equal(t, []byte("bank"), passwords[0].Title)
+	_, items, _ := s.GetItems(uid, models.ItemPasswords)
+	assert.Equal(t, []models.Item{d}, items)
+	status, err = s.CollectItem(&models.Item{Type: models.ItemTexts, Payload: []byte("{")}, uid)
+	assert.Error(t, err)
+	assert.Equal(t, 400, status)
+
+	//записи остальных видов хранятся вместе, но списки у каждого вида свои
+	before := time.Now()
+	key := models.Item{Type: "ssh_key", Payload: []byte("secret"), ItemMeta: models.ItemMeta{Title: []byte("server")}}
+	status, err = s.CollectItem(&key, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 1, key.UID)
+	assert.Equal(t, int64(1), key.Version)
+	assert.False(t, key.CreatedAt.Before(before))
+	note := models.Item{Type: "note", Payload: []byte("text")}
+	_, err = s.CollectItem(&note, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, note.UID)
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	assert.Equal(t, []models.Item{key}, items)
+	_, items, _ = s.GetItems(other, "ssh_key")
+	assert.Empty(t, items)
+	_, d2, _ := s.Sync(uid, 0)
+	assert.Len(t, d2.Items, 2)
+	since := d2.Revision
+
+	//изменение проверяет вид, владельца и версию
+	status, err = s.UpdateItem(&models.Item{Type: "note", UID: key.UID, Payload: []byte("x")}, uid)
+	assert.ErrorIs(t, err, storage.ErrItemNotFound)
+	assert.Equal(t, 404, status)
+	status, err = s.UpdateItem(&models.Item{Type: "ssh_key", UID: key.UID, Payload: []byte("x")}, other)
+	assert.Equal(t, 404, status)
+	stale := models.Item{Type: "ssh_key", UID: key.UID, Payload: []byte("x"), Version: 5}
+	status, err = s.UpdateItem(&stale, uid)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.Equal(t, 409, status)
+	assert.Equal(t, key, stale)
+	changed := models.Item{Type: "ssh_key", UID: key.UID, Payload: []byte("new"), Version: key.Version}
+	status, err = s.UpdateItem(&changed, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, int64(2), changed.Version)
+	assert.Equal(t, []byte("new"), changed.Payload)
+	assert.Equal(t, key.CreatedAt, changed.CreatedAt)
+	_, d2, _ = s.Sync(uid, since)
+	assert.Equal(t, []models.Item{changed}, d2.Items)
+
+	//прежнее содержимое попадает в историю и восстанавливается
+	_, history, err := s.GetHistory(uid, "ssh_key", key.UID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	var old models.Item
+	assert.NoError(t, json.Unmarshal(history[0].Item, &old))
+	assert.Equal(t, []byte("secret"), old.Payload)
+	status, _, err = s.GetHistory(uid, "note", key.UID)
+	assert.Equal(t, 404, status)
+	status, _, err = s.RestoreItem(uid, "ssh_key", key.UID, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	assert.Equal(t, []byte("secret"), items[0].Payload)
+	assert.Equal(t, int64(3), items[0].Version)
+
+	//удаленная запись уходит в корзину, возвращается из нее и удаляется навсегда при очистке
+	_, d2, _ = s.Sync(uid, 0)
+	since = d2.Revision
+	status, err = s.DeleteItem(&models.Item{Type: "ssh_key", UID: key.UID, Version: 1}, uid)
+	assert.ErrorIs(t, err, storage.ErrVersionConflict)
+	assert.Equal(t, 409, status)
+	status, err = s.DeleteItem(&models.Item{Type: "ssh_key", UID: key.UID, Version: 3}, uid)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	assert.Empty(t, items)
+	_, d2, _ = s.Sync(uid, since)
+	assert.Equal(t, []models.Tombstone{{Type: "ssh_key", UID: key.UID, Revision: since + 1}}, d2.Deleted)
+	_, trash, _ := s.GetTrash(uid)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, "ssh_key", trash[0].Type)
+	status, err = s.RestoreTrash(uid, "note", key.UID)
+	assert.Equal(t, 404, status)
+	status, err = s.RestoreTrash(uid, "ssh_key", key.UID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	assert.Len(t, items, 1)
+	_, err = s.DeleteItem(&models.Item{Type: "note", UID: note.UID}, uid)
+	assert.NoError(t, err)
+	purged, err := s.PurgeTrash(time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, trash, _ = s.GetTrash(uid)
+	assert.Empty(t, trash)
+	_, history, _ = s.GetHistory(uid, "note", note.UID)
+	assert.Empty(t, history)
+
+	//смена ключа перешифровывает и записи остальных видов
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	_, passwords, _ = s.GetPassword(uid)
+	status, err = s.RotateItems(&models.ItemBatch{Passwords: passwords, Key: []byte("new")}, uid, "")
+	assert.Error(t, err)
+	assert.Equal(t, 409, status)
+	items[0].Payload = []byte("rotated")
+	status, err = s.RotateItems(&models.ItemBatch{Passwords: passwords, Items: items, Key: []byte("new")}, uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, status)
+	_, items, _ = s.GetItems(uid, "ssh_key")
+	assert.Equal(t, []byte("rotated"), items[0].Payload)
+	assert.Equal(t, "ssh_key", items[0].Type)
+
+	//удаление аккаунта удаляет записи всех видов
+	_, err = s.DeleteAccount(uid, "key")
+	assert.NoError(t, err)
+	assert.Empty(t, s.items)
+}
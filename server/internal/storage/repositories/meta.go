@@ -0,0 +1,43 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль обрабатывает общие поля записей (название, адрес сайта, заметку, метки, избранное и время)
+// одинаково для обоих репозиториев: время создания и изменения ставит только сервер.
+package repositories
+
+import (
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// metaColumns - колонки общих полей записи в таблицах записей, в порядке metaFields.
+const metaColumns = `title, url, notes, tags, favorite, created_at, updated_at`
+
+// metaFields - общие поля записи для Scan, в порядке metaColumns.
+func metaFields(m *models.ItemMeta) []interface{} {
+	return []interface{}{&m.Title, &m.URL, &m.Notes, &m.Tags, &m.Favorite, &m.CreatedAt, &m.UpdatedAt}
+}
+
+// scanFields - поля записи fields и ее общие поля m для Scan.
+func scanFields(m *models.ItemMeta, fields ...interface{}) []interface{} {
+	return append(fields, metaFields(m)...)
+}
+
+// newMeta - общие поля новой записи: время, присланное клиентом, заменяется временем now.
+func newMeta(m models.ItemMeta, now time.Time) models.ItemMeta {
+	m.CreatedAt, m.UpdatedAt = now, now
+	return m
+}
+
+// updatedMeta - общие поля измененной записи: все из изменения changed, кроме времени создания, а время
+// изменения - now.
+func updatedMeta(old, changed models.ItemMeta, now time.Time) models.ItemMeta {
+	changed.CreatedAt, changed.UpdatedAt = old.CreatedAt, now
+	return changed
+}
+
+// rotatedMeta - общие поля записи, перешифрованной при смене ключа: новые только зашифрованные поля. Смена ключа
+// не изменение записи пользователем, поэтому избранное и время изменения остаются прежними.
+func rotatedMeta(old, rotated models.ItemMeta) models.ItemMeta {
+	old.Title, old.URL, old.Notes, old.Tags = rotated.Title, rotated.URL, rotated.Notes, rotated.Tags
+	return old
+}
@@ -0,0 +1,243 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль применяет и откатывает версионированные миграции схемы PostgreSQL.
+package repositories
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/client/postgres"
+)
+
+// migrationFiles - файлы миграций вида NNNN_name.up.sql и NNNN_name.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock - ключ advisory lock, чтобы миграции не применялись одновременно с двух серверов.
+const migrationLock = 7_450_117
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration - одна версия схемы.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// Migrator - структура для применения миграций к базе.
+type Migrator struct {
+	client     postgres.Client
+	logger     *loggers.Logger
+	migrations []migration
+}
+
+// NewMigrator - функция создания нового мигратора со встроенными миграциями.
+func NewMigrator(client postgres.Client, logger *loggers.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		logger.LogErr(err, "failed to load migrations")
+		return nil, err
+	}
+	return &Migrator{
+		client:     client,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// loadMigrations - чтение миграций из каталога migrations, отсортированных по версии.
+// У каждой версии должны быть и up, и down файлы, версии не должны повторяться.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, file := range files {
+		parts := migrationName.FindStringSubmatch(path.Base(file))
+		if parts == nil {
+			return nil, fmt.Errorf("wrong migration file name %s", file)
+		}
+		version, _ := strconv.Atoi(parts[1])
+		if version == 0 {
+			return nil, fmt.Errorf("migration version must be positive: %s", file)
+		}
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.name != parts[2] {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, m.name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have up and down files", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+// Latest - последняя версия схемы, известная серверу.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// createVersionTable - создание таблицы schema_migrations, если ее еще нет.
+func (m *Migrator) createVersionTable(ctx context.Context) error {
+	q := `CREATE TABLE if not exists schema_migrations (
+    		version BIGINT PRIMARY KEY,
+    		name VARCHAR(200) NOT NULL,
+    		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`
+	if _, err := m.client.Exec(ctx, q); err != nil {
+		m.logger.LogErr(err, "failed to create schema_migrations")
+		return err
+	}
+	return nil
+}
+
+// Version - текущая версия схемы в базе, 0 если миграции еще не применялись.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return 0, err
+	}
+	var version int
+	q := `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	if err := m.client.QueryRow(ctx, q).Scan(&version); err != nil {
+		m.logger.LogErr(err, "failed to select schema version")
+		return 0, err
+	}
+	return version, nil
+}
+
+// Check - проверка, что схема в базе не новее, чем известна серверу.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version > m.Latest() {
+		return fmt.Errorf("database schema version %d is newer than supported %d, update the server", version, m.Latest())
+	}
+	return nil
+}
+
+// Up - применение всех миграций до версии target включительно. Если target <= 0, то до последней.
+func (m *Migrator) Up(ctx context.Context, target int) error {
+	if err := m.Check(ctx); err != nil {
+		return err
+	}
+	if target <= 0 {
+		target = m.Latest()
+	}
+	for _, mg := range m.migrations {
+		if mg.version > target {
+			break
+		}
+		if _, err := m.apply(ctx, mg, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Down - откат последних steps примененных миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if err := m.Check(ctx); err != nil {
+		return err
+	}
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		changed, err := m.apply(ctx, m.migrations[i], false)
+		if err != nil {
+			return err
+		}
+		if changed {
+			steps--
+		}
+	}
+	return nil
+}
+
+// apply - применение (up) или откат (down) одной миграции в отдельной транзакции.
+// Уже примененные миграции при up и не примененные при down пропускаются, тогда возвращается false.
+func (m *Migrator) apply(ctx context.Context, mg migration, up bool) (bool, error) {
+	tx, err := m.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		m.logger.LogErr(err, "failed to begin transaction")
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		m.logger.LogErr(err, "failed to lock migrations")
+		return false, err
+	}
+	var applied bool
+	q := `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = $1)`
+	if err = tx.QueryRow(ctx, q, mg.version).Scan(&applied); err != nil {
+		m.logger.LogErr(err, "failed to select schema version")
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, mg.up)
+	} else {
+		_, err = tx.Exec(ctx, mg.down)
+	}
+	if err != nil {
+		m.logger.LogErr(err, fmt.Sprintf("failed to migrate %04d_%s", mg.version, mg.name))
+		return false, fmt.Errorf("migration %04d_%s: %w", mg.version, mg.name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mg.version, mg.name)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mg.version)
+	}
+	if err != nil {
+		m.logger.LogErr(err, "failed to update schema_migrations")
+		return false, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		m.logger.LogErr(err, "failed to commit migration")
+		return false, err
+	}
+	if up {
+		m.logger.LogInfo("migration", fmt.Sprintf("%04d_%s", mg.version, mg.name), "applied")
+	} else {
+		m.logger.LogInfo("migration", fmt.Sprintf("%04d_%s", mg.version, mg.name), "rolled back")
+	}
+	return true, nil
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	assert.Equal(t, 1, migrations[0].version)
+	assert.Equal(t, "init", migrations[0].name)
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(t, migrations[i-1].version, migrations[i].version)
+	}
+
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			files: fstest.MapFS{
+				"migrations/0002_second.up.sql":   {Data: []byte("up2")},
+				"migrations/0002_second.down.sql": {Data: []byte("down2")},
+				"migrations/0001_first.up.sql":    {Data: []byte("up1")},
+				"migrations/0001_first.down.sql":  {Data: []byte("down1")},
+			},
+		},
+		{
+			name: "no down",
+			files: fstest.MapFS{
+				"migrations/0001_first.up.sql": {Data: []byte("up1")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"migrations/0001_first.up.sql":    {Data: []byte("up1")},
+				"migrations/0001_first.down.sql":  {Data: []byte("down1")},
+				"migrations/0001_second.up.sql":   {Data: []byte("up2")},
+				"migrations/0001_second.down.sql": {Data: []byte("down2")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong name",
+			files: fstest.MapFS{
+				"migrations/first.sql": {Data: []byte("up1")},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := loadMigrations(tt.files)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []migration{
+				{version: 1, name: "first", up: "up1", down: "down1"},
+				{version: 2, name: "second", up: "up2", down: "down2"},
+			}, m)
+		})
+	}
+}
+
+func TestMigrator_UpDown(t *testing.T) {
+	s, teardown := TestPGStore(t, CFG)
+	defer teardown("users", "cards", "binary_table", "text_table", "passwords", "schema_migrations")
+	ctx := context.Background()
+
+	m, err := NewMigrator(s.client, loggers.NewLogger())
+	assert.NoError(t, err)
+	version, err := m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	assert.NoError(t, m.Down(ctx, m.Latest()))
+	version, err = m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	assert.NoError(t, m.Up(ctx, 0))
+	version, err = m.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	//схема новее, чем известно серверу.
+	_, err = s.client.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, 'future')`, m.Latest()+1)
+	assert.NoError(t, err)
+	assert.Error(t, m.Check(ctx))
+}
@@ -0,0 +1,5 @@
+DROP TABLE if exists cards;
+DROP TABLE if exists passwords;
+DROP TABLE if exists binary_table;
+DROP TABLE if exists text_table;
+DROP TABLE if exists users;
@@ -0,0 +1,34 @@
+CREATE TABLE if not exists users (
+    id BIGINT PRIMARY KEY generated always as identity,
+    login VARCHAR(200) NOT NULL unique,
+    hashed_password VARCHAR(200) NOT NULL
+);
+CREATE UNIQUE INDEX if not exists users_login_uindex on users (login);
+CREATE TABLE if not exists text_table (
+    user_id BIGINT,
+    id BIGINT PRIMARY KEY generated always as identity,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    text bytea
+);
+CREATE TABLE if not exists binary_table (
+    user_id BIGINT,
+    id BIGINT PRIMARY KEY generated always as identity,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    binary_data bytea
+);
+CREATE TABLE if not exists passwords (
+    user_id BIGINT,
+    id BIGINT PRIMARY KEY generated always as identity,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    login bytea,
+    password bytea
+);
+CREATE TABLE if not exists cards (
+    user_id BIGINT,
+    id BIGINT PRIMARY KEY generated always as identity,
+    card_number bytea,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    card_holder bytea,
+    cvc bytea
+);
+CREATE UNIQUE INDEX if not exists cards_card_number_uindex on cards (card_number);
@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN hashed_password TYPE VARCHAR(200);
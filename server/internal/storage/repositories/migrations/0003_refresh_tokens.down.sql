@@ -0,0 +1,2 @@
+DROP TABLE if exists revoked_tokens;
+DROP TABLE if exists refresh_tokens;
@@ -0,0 +1,15 @@
+CREATE TABLE if not exists refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    family VARCHAR(64) NOT NULL,
+    user_id BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT false,
+    revoked BOOLEAN NOT NULL DEFAULT false
+);
+CREATE INDEX if not exists refresh_tokens_family_index on refresh_tokens (family);
+CREATE INDEX if not exists refresh_tokens_user_id_index on refresh_tokens (user_id);
+CREATE TABLE if not exists revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
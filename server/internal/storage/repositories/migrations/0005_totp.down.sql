@@ -0,0 +1,4 @@
+DROP TABLE if exists recovery_codes;
+ALTER TABLE users DROP COLUMN if exists totp_last_step;
+ALTER TABLE users DROP COLUMN if exists totp_enabled;
+ALTER TABLE users DROP COLUMN if exists totp_secret;
@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN if not exists totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN if not exists totp_enabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN if not exists totp_last_step BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE if not exists recovery_codes (
+    user_id BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    code_hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
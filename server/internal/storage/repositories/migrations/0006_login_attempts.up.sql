@@ -0,0 +1,7 @@
+CREATE TABLE if not exists login_attempts (
+    login VARCHAR(200) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ
+);
+CREATE INDEX if not exists login_attempts_last_failure_index on login_attempts (last_failure);
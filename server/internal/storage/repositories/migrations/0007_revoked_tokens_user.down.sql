@@ -0,0 +1 @@
+ALTER TABLE revoked_tokens DROP COLUMN if exists user_id;
@@ -0,0 +1,2 @@
+ALTER TABLE revoked_tokens ADD COLUMN if not exists user_id BIGINT REFERENCES users(id);
+CREATE INDEX if not exists revoked_tokens_user_id_index on revoked_tokens (user_id);
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN if not exists auth_key BOOLEAN NOT NULL DEFAULT false;
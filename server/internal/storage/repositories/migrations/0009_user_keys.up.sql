@@ -0,0 +1,6 @@
+CREATE TABLE if not exists user_keys (
+    user_id BIGINT PRIMARY KEY,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    sealed_key bytea NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+DROP TABLE if exists tombstones;
+DROP INDEX if exists binary_table_user_id_revision_index;
+DROP INDEX if exists text_table_user_id_revision_index;
+DROP INDEX if exists passwords_user_id_revision_index;
+DROP INDEX if exists cards_user_id_revision_index;
+ALTER TABLE binary_table DROP COLUMN if exists revision;
+ALTER TABLE text_table DROP COLUMN if exists revision;
+ALTER TABLE passwords DROP COLUMN if exists revision;
+ALTER TABLE cards DROP COLUMN if exists revision;
+ALTER TABLE users DROP COLUMN if exists revision;
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN if not exists revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE cards ADD COLUMN if not exists revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE passwords ADD COLUMN if not exists revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE text_table ADD COLUMN if not exists revision BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE binary_table ADD COLUMN if not exists revision BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX if not exists cards_user_id_revision_index on cards (user_id, revision);
+CREATE INDEX if not exists passwords_user_id_revision_index on passwords (user_id, revision);
+CREATE INDEX if not exists text_table_user_id_revision_index on text_table (user_id, revision);
+CREATE INDEX if not exists binary_table_user_id_revision_index on binary_table (user_id, revision);
+CREATE TABLE if not exists tombstones (
+    user_id BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    item_type VARCHAR(20) NOT NULL,
+    item_id BIGINT NOT NULL,
+    revision BIGINT NOT NULL,
+    PRIMARY KEY (item_type, item_id)
+);
+CREATE INDEX if not exists tombstones_user_id_revision_index on tombstones (user_id, revision);
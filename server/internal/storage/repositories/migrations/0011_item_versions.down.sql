@@ -0,0 +1,4 @@
+ALTER TABLE binary_table DROP COLUMN if exists version;
+ALTER TABLE text_table DROP COLUMN if exists version;
+ALTER TABLE passwords DROP COLUMN if exists version;
+ALTER TABLE cards DROP COLUMN if exists version;
@@ -0,0 +1,4 @@
+ALTER TABLE cards ADD COLUMN if not exists version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE passwords ADD COLUMN if not exists version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE text_table ADD COLUMN if not exists version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE binary_table ADD COLUMN if not exists version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+DROP TABLE if exists item_history;
+ALTER TABLE users DROP COLUMN if exists history_depth;
@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN if not exists history_depth INT NOT NULL DEFAULT 10;
+CREATE TABLE if not exists item_history (
+    user_id BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    item_type VARCHAR(20) NOT NULL,
+    item_id BIGINT NOT NULL,
+    version BIGINT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    item BYTEA NOT NULL,
+    PRIMARY KEY (item_type, item_id, version)
+);
+CREATE INDEX if not exists item_history_user_id_index on item_history (user_id);
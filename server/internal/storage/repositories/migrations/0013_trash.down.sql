@@ -0,0 +1,14 @@
+DELETE FROM item_history h WHERE EXISTS (
+    SELECT 1 FROM cards WHERE h.item_type = 'cards' AND id = h.item_id AND deleted_at IS NOT NULL
+    UNION ALL SELECT 1 FROM passwords WHERE h.item_type = 'password' AND id = h.item_id AND deleted_at IS NOT NULL
+    UNION ALL SELECT 1 FROM text_table WHERE h.item_type = 'text' AND id = h.item_id AND deleted_at IS NOT NULL
+    UNION ALL SELECT 1 FROM binary_table WHERE h.item_type = 'binary' AND id = h.item_id AND deleted_at IS NOT NULL
+);
+DELETE FROM binary_table WHERE deleted_at IS NOT NULL;
+DELETE FROM text_table WHERE deleted_at IS NOT NULL;
+DELETE FROM passwords WHERE deleted_at IS NOT NULL;
+DELETE FROM cards WHERE deleted_at IS NOT NULL;
+ALTER TABLE binary_table DROP COLUMN if exists deleted_at;
+ALTER TABLE text_table DROP COLUMN if exists deleted_at;
+ALTER TABLE passwords DROP COLUMN if exists deleted_at;
+ALTER TABLE cards DROP COLUMN if exists deleted_at;
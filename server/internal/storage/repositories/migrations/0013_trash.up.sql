@@ -0,0 +1,8 @@
+ALTER TABLE cards ADD COLUMN if not exists deleted_at TIMESTAMPTZ;
+ALTER TABLE passwords ADD COLUMN if not exists deleted_at TIMESTAMPTZ;
+ALTER TABLE text_table ADD COLUMN if not exists deleted_at TIMESTAMPTZ;
+ALTER TABLE binary_table ADD COLUMN if not exists deleted_at TIMESTAMPTZ;
+CREATE INDEX if not exists cards_deleted_at_index on cards (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX if not exists passwords_deleted_at_index on passwords (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX if not exists text_table_deleted_at_index on text_table (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX if not exists binary_table_deleted_at_index on binary_table (deleted_at) WHERE deleted_at IS NOT NULL;
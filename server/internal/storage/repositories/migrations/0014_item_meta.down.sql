@@ -0,0 +1,28 @@
+ALTER TABLE binary_table DROP COLUMN if exists updated_at,
+    DROP COLUMN if exists created_at,
+    DROP COLUMN if exists favorite,
+    DROP COLUMN if exists tags,
+    DROP COLUMN if exists notes,
+    DROP COLUMN if exists url,
+    DROP COLUMN if exists title;
+ALTER TABLE text_table DROP COLUMN if exists updated_at,
+    DROP COLUMN if exists created_at,
+    DROP COLUMN if exists favorite,
+    DROP COLUMN if exists tags,
+    DROP COLUMN if exists notes,
+    DROP COLUMN if exists url,
+    DROP COLUMN if exists title;
+ALTER TABLE passwords DROP COLUMN if exists updated_at,
+    DROP COLUMN if exists created_at,
+    DROP COLUMN if exists favorite,
+    DROP COLUMN if exists tags,
+    DROP COLUMN if exists notes,
+    DROP COLUMN if exists url,
+    DROP COLUMN if exists title;
+ALTER TABLE cards DROP COLUMN if exists updated_at,
+    DROP COLUMN if exists created_at,
+    DROP COLUMN if exists favorite,
+    DROP COLUMN if exists tags,
+    DROP COLUMN if exists notes,
+    DROP COLUMN if exists url,
+    DROP COLUMN if exists title;
@@ -0,0 +1,28 @@
+ALTER TABLE cards ADD COLUMN if not exists title BYTEA,
+    ADD COLUMN if not exists url BYTEA,
+    ADD COLUMN if not exists notes BYTEA,
+    ADD COLUMN if not exists tags BYTEA,
+    ADD COLUMN if not exists favorite BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN if not exists created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN if not exists updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE passwords ADD COLUMN if not exists title BYTEA,
+    ADD COLUMN if not exists url BYTEA,
+    ADD COLUMN if not exists notes BYTEA,
+    ADD COLUMN if not exists tags BYTEA,
+    ADD COLUMN if not exists favorite BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN if not exists created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN if not exists updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE text_table ADD COLUMN if not exists title BYTEA,
+    ADD COLUMN if not exists url BYTEA,
+    ADD COLUMN if not exists notes BYTEA,
+    ADD COLUMN if not exists tags BYTEA,
+    ADD COLUMN if not exists favorite BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN if not exists created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN if not exists updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE binary_table ADD COLUMN if not exists title BYTEA,
+    ADD COLUMN if not exists url BYTEA,
+    ADD COLUMN if not exists notes BYTEA,
+    ADD COLUMN if not exists tags BYTEA,
+    ADD COLUMN if not exists favorite BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN if not exists created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN if not exists updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,3 @@
+DELETE FROM item_history WHERE item_type NOT IN ('cards', 'password', 'text', 'binary');
+DELETE FROM tombstones WHERE item_type NOT IN ('cards', 'password', 'text', 'binary');
+DROP TABLE if exists items;
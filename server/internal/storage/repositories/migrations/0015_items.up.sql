@@ -0,0 +1,20 @@
+CREATE TABLE if not exists items (
+    user_id BIGINT NOT NULL,
+    id BIGINT PRIMARY KEY generated always as identity,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    item_type VARCHAR(20) NOT NULL,
+    payload BYTEA,
+    revision BIGINT NOT NULL DEFAULT 0,
+    version BIGINT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ,
+    title BYTEA,
+    url BYTEA,
+    notes BYTEA,
+    tags BYTEA,
+    favorite BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX if not exists items_user_id_item_type_index on items (user_id, item_type);
+CREATE INDEX if not exists items_user_id_revision_index on items (user_id, revision);
+CREATE INDEX if not exists items_deleted_at_index on items (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -3,20 +3,22 @@ package repositories
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
 
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
 	"github.com/CyrilSbrodov/passManager.git/server/cmd/loggers"
 	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+	"github.com/CyrilSbrodov/passManager.git/server/internal/storage"
 	"github.com/CyrilSbrodov/passManager.git/server/pkg/client/postgres"
+	"github.com/CyrilSbrodov/passManager.git/server/pkg/hasher"
 )
 
 // Store - структура репозитория.
@@ -24,81 +26,47 @@ type Store struct {
 	client postgres.Client
 	Hash   string
 	logger loggers.Logger
-}
-
-// createTable - функция создания новых таблиц в БД.
-func createTable(ctx context.Context, client postgres.Client, logger *loggers.Logger) error {
-	tx, err := client.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		logger.LogErr(err, "failed to begin transaction")
-		return err
-	}
-	defer tx.Rollback(ctx)
-
-	//создание таблиц
-	q := `CREATE TABLE if not exists users (
-    		id BIGINT PRIMARY KEY generated always as identity,
-    		login VARCHAR(200) NOT NULL unique,
-    		hashed_password VARCHAR(200) NOT NULL
-		);
-		CREATE UNIQUE INDEX if not exists users_login_uindex on users (login);
-		CREATE TABLE if not exists text_table (
-    		user_id BIGINT,
-    		id BIGINT PRIMARY KEY generated always as identity,
-    		FOREIGN KEY (user_id) REFERENCES users(id),
-    		text bytea                         
-		);
-		CREATE TABLE if not exists binary_table (
-    		user_id BIGINT,
-    		id BIGINT PRIMARY KEY generated always as identity,
-    		FOREIGN KEY (user_id) REFERENCES users(id),
-    		binary_data bytea                          
-		);
-		CREATE TABLE if not exists passwords (
-    		user_id BIGINT,
-    		id BIGINT PRIMARY KEY generated always as identity,
-    		FOREIGN KEY (user_id) REFERENCES users(id),
-    		login bytea,
-		    password bytea
-		);
-		CREATE TABLE if not exists cards (
-    		user_id BIGINT,
-    		id BIGINT PRIMARY KEY generated always as identity,
-    		card_number bytea,
-    		FOREIGN KEY (user_id) REFERENCES users(id),
-    		card_holder bytea,
-    		cvc bytea                            
-		);
-		CREATE UNIQUE INDEX if not exists cards_card_number_uindex on cards (card_number);`
-
-	_, err = tx.Exec(ctx, q)
-	if err != nil {
-		logger.LogErr(err, "failed to create table")
-		return err
-	}
-	return tx.Commit(ctx)
+	hasher hasher.Hasher
 }
 
 // NewStore - функция создания нового репозитория.
 func NewStore(client postgres.Client, cfg *config.Config, logger *loggers.Logger) (*Store, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	if err := createTable(ctx, client, logger); err != nil {
-		logger.LogErr(err, "failed to create table")
+	migrator, err := NewMigrator(client, logger)
+	if err != nil {
+		return nil, err
+	}
+	//сервер не запускается на схеме, которая новее известных ему миграций.
+	if err = migrator.Check(ctx); err != nil {
+		logger.LogErr(err, "failed to check schema version")
 		return nil, err
 	}
+	if cfg.AutoMigrate {
+		if err = migrator.Up(ctx, 0); err != nil {
+			logger.LogErr(err, "failed to migrate")
+			return nil, err
+		}
+	}
 	return &Store{
 		client: client,
+		logger: *logger,
+		hasher: hasher.NewPasswordHasher(cfg),
 	}, nil
 }
 
 func (s *Store) Register(u *models.User) (string, error) {
+	secret, authKey := userSecret(u)
 	//хэширование пароля
-	hashPassword := s.hashPassword(u.Password)
+	hashedPassword, err := s.hasher.Hash(secret)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return "", err
+	}
 	//добавление пользователя в базу
-	q := `INSERT INTO users (login, hashed_password)
-	   						VALUES ($1, $2) RETURNING id`
-	if err := s.client.QueryRow(context.Background(), q, u.Login, hashPassword).Scan(&u.UID); err != nil {
+	q := `INSERT INTO users (login, hashed_password, auth_key)
+	   						VALUES ($1, $2, $3) RETURNING id`
+	if err := s.client.QueryRow(context.Background(), q, u.Login, hashedPassword, authKey).Scan(&u.UID); err != nil {
 		s.logger.LogErr(err, "Failure to insert object into table")
 		return "", err
 	}
@@ -107,72 +75,215 @@ func (s *Store) Register(u *models.User) (string, error) {
 
 func (s *Store) Login(u *models.User) (string, error) {
 	var password string
-	//хэширование полученного пароля
-	hashPassword := s.hashPassword(u.Password)
+	var authKey bool
 	//получение хэш пароля, хранящегося в базе
-	q := `SELECT hashed_password, id FROM users WHERE login = $1`
-	if err := s.client.QueryRow(context.Background(), q, u.Login).Scan(&password, &u.UID); err != nil {
+	q := `SELECT hashed_password, id, auth_key FROM users WHERE login = $1`
+	if err := s.client.QueryRow(context.Background(), q, u.Login).Scan(&password, &u.UID, &authKey); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			s.logger.LogErr(err, "Failure to select object from table")
 			return "", fmt.Errorf("wrong login %s", u.Login)
 		}
-		fmt.Println(err)
 		s.logger.LogErr(err, "Wrong login")
 		return "", fmt.Errorf("wrong login %s", u.Login)
 	}
-	//сравнение хэш пароля полученного и хэш пароля из базы
-	if hashPassword != password {
+	secret, err := loginSecret(u, authKey)
+	if err != nil {
+		return "", err
+	}
+	//сравнение полученного пароля и хэш пароля из базы
+	ok, err := s.hasher.Verify(secret, password)
+	if err != nil {
+		s.logger.LogErr(err, "failed to verify password")
+	}
+	if !ok {
 		return "", fmt.Errorf("wrong password to %s", u.Login)
 	}
+	switch {
+	case !authKey && u.AuthKey != "":
+		//пароль проверен, дальше аккаунт входит только по ключу аутентификации
+		s.rehashPassword(u.UID, u.AuthKey, password, true)
+	case s.hasher.NeedsRehash(password):
+		//старые хэши и хэши с устаревшими параметрами заменяются при успешном входе
+		s.rehashPassword(u.UID, secret, password, authKey)
+	}
 	return u.UID, nil
 }
 
-func (s *Store) CollectPassword(d *models.CryptoPassword, id string) (int, error) {
-	q := `INSERT INTO passwords (user_id, login, password) VALUES ($1, $2, $3)`
-	if _, err := s.client.Exec(context.Background(), q, id, d.Login, d.Pass); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+// rehashPassword - замена хэша пароля пользователя id на хэш secret текущим алгоритмом.
+// Ошибка не мешает входу, хэш будет заменен при следующем входе.
+func (s *Store) rehashPassword(id, secret, old string, authKey bool) {
+	hashedPassword, err := s.hasher.Hash(secret)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return
+	}
+	q := `UPDATE users SET hashed_password = $1, auth_key = $2 WHERE id = $3 AND hashed_password = $4`
+	if _, err = s.client.Exec(context.Background(), q, hashedPassword, authKey, id, old); err != nil {
+		s.logger.LogErr(err, "failed to rehash password")
 	}
-	//возвращаем 200 — новые данные успешно загружены в базу.
-	return 200, nil
 }
 
-func (s *Store) CollectCard(d *models.CryptoCard, id string) (int, error) {
-	q := `INSERT INTO cards (user_id, card_number, card_holder, cvc) VALUES ($1, $2, $3, $4)`
-	if _, err := s.client.Exec(context.Background(), q, id, d.Number, d.Name, d.CVC); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+// checkPassword - проверка текущего пароля пользователя id. Возвращает хэш пароля из базы.
+func (s *Store) checkPassword(id, password string) (int, string, error) {
+	var hashedPassword string
+	q := `SELECT hashed_password FROM users WHERE id = $1`
+	if err := s.client.QueryRow(context.Background(), q, id).Scan(&hashedPassword); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, "", fmt.Errorf("user %s not found", id)
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, "", err
 	}
-	//возвращаем 200 — новые данные успешно загружены в базу.
-	return 200, nil
+	ok, err := s.hasher.Verify(password, hashedPassword)
+	if err != nil {
+		s.logger.LogErr(err, "failed to verify password")
+	}
+	if !ok {
+		return 403, "", fmt.Errorf("wrong password")
+	}
+	return 200, hashedPassword, nil
 }
 
-func (s *Store) CollectText(d *models.CryptoTextData, id string) (int, error) {
-	q := `INSERT INTO text_table (user_id, text) VALUES ($1, $2)`
-	if _, err := s.client.Exec(context.Background(), q, id, d.Text); err != nil {
-		fmt.Println(err)
-		s.logger.LogErr(err, "Failure to insert object into table")
+// ChangePassword - смена пароля пользователя id после проверки текущего пароля.
+// Все сессии, кроме sessionID, отзываются вместе с токенами обновления.
+func (s *Store) ChangePassword(id, password, newPassword, sessionID string) (int, error) {
+	status, old, err := s.checkPassword(id, password)
+	if err != nil {
+		return status, err
+	}
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		s.logger.LogErr(err, "failed to hash password")
+		return 500, err
+	}
+
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	//пароль мог смениться параллельно после проверки
+	q := `UPDATE users SET hashed_password = $1 WHERE id = $2 AND hashed_password = $3`
+	tag, err := tx.Exec(ctx, q, hashedPassword, id, old)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 403, fmt.Errorf("wrong password")
+	}
+	q = `UPDATE sessions SET revoked = true WHERE user_id = $1 AND id <> $2 AND NOT revoked`
+	if _, err = tx.Exec(ctx, q, id, sessionID); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	q = `UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND family <> $2`
+	if _, err = tx.Exec(ctx, q, id, sessionID); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
 		return 500, err
 	}
-	//возвращаем 200 — новые данные успешно загружены в базу.
 	return 200, nil
 }
 
-func (s *Store) CollectBinary(d *models.CryptoBinaryData, id string) (int, error) {
-	q := `INSERT INTO binary_table (user_id, binary_data) VALUES ($1, $2)`
-	if _, err := s.client.Exec(context.Background(), q, id, d.Data); err != nil {
-		fmt.Println(err)
-		s.logger.LogErr(err, "Failure to insert object into table")
+// DeleteAccount - удаление пользователя id после проверки пароля вместе со всеми его данными одной транзакцией.
+func (s *Store) DeleteAccount(id, password string) (int, error) {
+	status, _, err := s.checkPassword(id, password)
+	if err != nil {
+		return status, err
+	}
+
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, table := range []string{"cards", "passwords", "text_table", "binary_table", "items", "refresh_tokens", "revoked_tokens", "sessions", "recovery_codes", "user_keys", "tombstones", "item_history"} {
+		q := `DELETE FROM ` + table + ` WHERE user_id = $1`
+		if _, err = tx.Exec(ctx, q, id); err != nil {
+			s.logger.LogErr(err, "Failure to delete object from table")
+			return 500, err
+		}
+	}
+	//попытки входа хранятся по логину, который после удаления может занять другой пользователь
+	q := `DELETE FROM login_attempts WHERE login = (SELECT login FROM users WHERE id = $1)`
+	if _, err = tx.Exec(ctx, q, id); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 500, err
+	}
+	q = `DELETE FROM users WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, id); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
 		return 500, err
 	}
-	//возвращаем 200 — новые данные успешно загружены в базу.
 	return 200, nil
 }
 
+func (s *Store) CollectPassword(d *models.CryptoPassword, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		q := `INSERT INTO passwords (user_id, login, password, revision, title, url, notes, tags, favorite)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, revision, version, created_at, updated_at`
+		err := tx.QueryRow(ctx, q, id, d.Login, d.Pass, rev, d.Title, d.URL, d.Notes, d.Tags, d.Favorite).Scan(&d.UID, &d.Revision, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) CollectCard(d *models.CryptoCard, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		q := `INSERT INTO cards (user_id, card_number, card_holder, cvc, revision, title, url, notes, tags, favorite)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, revision, version, created_at, updated_at`
+		err := tx.QueryRow(ctx, q, id, d.Number, d.Name, d.CVC, rev, d.Title, d.URL, d.Notes, d.Tags, d.Favorite).Scan(&d.UID, &d.Revision, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) CollectText(d *models.CryptoTextData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		q := `INSERT INTO text_table (user_id, text, revision, title, url, notes, tags, favorite)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, revision, version, created_at, updated_at`
+		err := tx.QueryRow(ctx, q, id, d.Text, rev, d.Title, d.URL, d.Notes, d.Tags, d.Favorite).Scan(&d.UID, &d.Revision, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) CollectBinary(d *models.CryptoBinaryData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		q := `INSERT INTO binary_table (user_id, binary_data, revision, title, url, notes, tags, favorite)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, revision, version, created_at, updated_at`
+		err := tx.QueryRow(ctx, q, id, d.Data, rev, d.Title, d.URL, d.Notes, d.Tags, d.Favorite).Scan(&d.UID, &d.Revision, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
 func (s *Store) GetCards(id string) (int, []models.CryptoCard, error) {
 	var data []models.CryptoCard
 
-	q := `SELECT id, card_number, card_holder, cvc	FROM cards WHERE user_id = $1`
+	q := `SELECT id, card_number, card_holder, cvc, revision, version, ` + metaColumns + ` FROM cards WHERE user_id = $1 AND deleted_at IS NULL`
 	rows, err := s.client.Query(context.Background(), q, id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -186,7 +297,7 @@ func (s *Store) GetCards(id string) (int, []models.CryptoCard, error) {
 	for rows.Next() {
 		var c models.CryptoCard
 
-		err = rows.Scan(&c.UID, &c.Number, &c.Name, &c.CVC)
+		err = rows.Scan(scanFields(&c.ItemMeta, &c.UID, &c.Number, &c.Name, &c.CVC, &c.Revision, &c.Version)...)
 		if err != nil && err != pgx.ErrNoRows {
 			s.logger.LogErr(err, "Failure to scan object from table")
 			return 500, data, err
@@ -200,7 +311,7 @@ func (s *Store) GetCards(id string) (int, []models.CryptoCard, error) {
 func (s *Store) GetPassword(id string) (int, []models.CryptoPassword, error) {
 	var data []models.CryptoPassword
 
-	q := `SELECT id, login, password FROM passwords WHERE user_id = $1`
+	q := `SELECT id, login, password, revision, version, ` + metaColumns + ` FROM passwords WHERE user_id = $1 AND deleted_at IS NULL`
 	rows, err := s.client.Query(context.Background(), q, id)
 	if err != nil {
 		fmt.Println(err)
@@ -215,7 +326,7 @@ func (s *Store) GetPassword(id string) (int, []models.CryptoPassword, error) {
 	for rows.Next() {
 		var p models.CryptoPassword
 
-		err = rows.Scan(&p.UID, &p.Login, &p.Pass)
+		err = rows.Scan(scanFields(&p.ItemMeta, &p.UID, &p.Login, &p.Pass, &p.Revision, &p.Version)...)
 		if err != nil && err != pgx.ErrNoRows {
 			s.logger.LogErr(err, "Failure to scan object from table")
 			return 500, data, err
@@ -229,7 +340,7 @@ func (s *Store) GetPassword(id string) (int, []models.CryptoPassword, error) {
 func (s *Store) GetText(id string) (int, []models.CryptoTextData, error) {
 	var data []models.CryptoTextData
 
-	q := `SELECT id, text FROM text_table WHERE user_id = $1`
+	q := `SELECT id, text, revision, version, ` + metaColumns + ` FROM text_table WHERE user_id = $1 AND deleted_at IS NULL`
 	rows, err := s.client.Query(context.Background(), q, id)
 	if err != nil {
 		fmt.Println(err)
@@ -244,7 +355,7 @@ func (s *Store) GetText(id string) (int, []models.CryptoTextData, error) {
 	for rows.Next() {
 		var t models.CryptoTextData
 
-		err = rows.Scan(&t.UID, &t.Text)
+		err = rows.Scan(scanFields(&t.ItemMeta, &t.UID, &t.Text, &t.Revision, &t.Version)...)
 		if err != nil && err != pgx.ErrNoRows {
 			s.logger.LogErr(err, "Failure to scan object from table")
 			return 500, data, err
@@ -258,7 +369,7 @@ func (s *Store) GetText(id string) (int, []models.CryptoTextData, error) {
 func (s *Store) GetBinary(id string) (int, []models.CryptoBinaryData, error) {
 	var data []models.CryptoBinaryData
 
-	q := `SELECT id, binary_data FROM binary_table WHERE user_id = $1`
+	q := `SELECT id, binary_data, revision, version, ` + metaColumns + ` FROM binary_table WHERE user_id = $1 AND deleted_at IS NULL`
 	rows, err := s.client.Query(context.Background(), q, id)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -272,7 +383,7 @@ func (s *Store) GetBinary(id string) (int, []models.CryptoBinaryData, error) {
 	for rows.Next() {
 		var b models.CryptoBinaryData
 
-		err = rows.Scan(&b.UID, &b.Data)
+		err = rows.Scan(scanFields(&b.ItemMeta, &b.UID, &b.Data, &b.Revision, &b.Version)...)
 		if err != nil && err != pgx.ErrNoRows {
 			s.logger.LogErr(err, "Failure to scan object from table")
 			return 500, data, err
@@ -283,84 +394,1347 @@ func (s *Store) GetBinary(id string) (int, []models.CryptoBinaryData, error) {
 	return 200, data, nil
 }
 
-func (s *Store) hashPassword(pass string) string {
-	h := hmac.New(sha256.New, []byte("password"))
-	h.Write([]byte(pass))
-	return fmt.Sprintf("%x", h.Sum(nil))
+func (s *Store) DeleteCard(data *models.CryptoCard, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		deleted, err := s.deleteItem(ctx, tx, models.ItemCards, data.UID, data.Version, id, rev)
+		if err != nil {
+			return 500, err
+		}
+		if !deleted {
+			return s.currentCard(ctx, tx, data, id)
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) DeleteText(data *models.CryptoTextData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		deleted, err := s.deleteItem(ctx, tx, models.ItemTexts, data.UID, data.Version, id, rev)
+		if err != nil {
+			return 500, err
+		}
+		if !deleted {
+			return s.currentText(ctx, tx, data, id)
+		}
+		return 200, nil
+	})
 }
 
-func (s *Store) DeleteCard(data *models.CryptoCard, id string) (int, error) {
-	q := `DELETE FROM cards WHERE id = $1 and user_id = $2`
-	if _, err := s.client.Exec(context.Background(), q, data.UID, id); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+func (s *Store) DeletePassword(data *models.CryptoPassword, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		deleted, err := s.deleteItem(ctx, tx, models.ItemPasswords, data.UID, data.Version, id, rev)
+		if err != nil {
+			return 500, err
+		}
+		if !deleted {
+			return s.currentPassword(ctx, tx, data, id)
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) DeleteBinary(data *models.CryptoBinaryData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		deleted, err := s.deleteItem(ctx, tx, models.ItemBinaries, data.UID, data.Version, id, rev)
+		if err != nil {
+			return 500, err
+		}
+		if !deleted {
+			return s.currentBinary(ctx, tx, data, id)
+		}
+		return 200, nil
+	})
+}
+
+// Изменение и удаление чужих или несуществующих записей возвращают 404. Если версия записи не совпадает
+// с ожидаемой data.Version, возвращается 409, а в data записывается текущая копия. Нулевая версия не проверяется.
+
+func (s *Store) UpdateCard(data *models.CryptoCard, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		old := models.CryptoCard{UID: data.UID}
+		q := `SELECT card_number, card_holder, cvc, revision, version, ` + metaColumns + ` FROM cards
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3) FOR UPDATE`
+		err := tx.QueryRow(ctx, q, data.UID, id, data.Version).Scan(scanFields(&old.ItemMeta, &old.Number, &old.Name, &old.CVC, &old.Revision, &old.Version)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.currentCard(ctx, tx, data, id)
+		}
+		if err != nil {
+			return 500, err
+		}
+		if err = s.keepVersion(ctx, tx, models.ItemCards, data.UID, old.Version, id, old); err != nil {
+			return 500, err
+		}
+		q = `UPDATE cards SET card_number = $1, card_holder = $2, cvc = $3, revision = $4, version = version + 1,
+				title = $7, url = $8, notes = $9, tags = $10, favorite = $11, updated_at = now()
+				WHERE id = $5 AND user_id = $6 RETURNING revision, version, created_at, updated_at`
+		err = tx.QueryRow(ctx, q, data.Number, data.Name, data.CVC, rev, data.UID, id,
+			data.Title, data.URL, data.Notes, data.Tags, data.Favorite).Scan(&data.Revision, &data.Version, &data.CreatedAt, &data.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) UpdatePassword(data *models.CryptoPassword, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		old := models.CryptoPassword{UID: data.UID}
+		q := `SELECT login, password, revision, version, ` + metaColumns + ` FROM passwords
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3) FOR UPDATE`
+		err := tx.QueryRow(ctx, q, data.UID, id, data.Version).Scan(scanFields(&old.ItemMeta, &old.Login, &old.Pass, &old.Revision, &old.Version)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.currentPassword(ctx, tx, data, id)
+		}
+		if err != nil {
+			return 500, err
+		}
+		if err = s.keepVersion(ctx, tx, models.ItemPasswords, data.UID, old.Version, id, old); err != nil {
+			return 500, err
+		}
+		q = `UPDATE passwords SET login = $1, password = $2, revision = $3, version = version + 1,
+				title = $6, url = $7, notes = $8, tags = $9, favorite = $10, updated_at = now()
+				WHERE id = $4 AND user_id = $5 RETURNING revision, version, created_at, updated_at`
+		err = tx.QueryRow(ctx, q, data.Login, data.Pass, rev, data.UID, id,
+			data.Title, data.URL, data.Notes, data.Tags, data.Favorite).Scan(&data.Revision, &data.Version, &data.CreatedAt, &data.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) UpdateText(data *models.CryptoTextData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		old := models.CryptoTextData{UID: data.UID}
+		q := `SELECT text, revision, version, ` + metaColumns + ` FROM text_table
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3) FOR UPDATE`
+		err := tx.QueryRow(ctx, q, data.UID, id, data.Version).Scan(scanFields(&old.ItemMeta, &old.Text, &old.Revision, &old.Version)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.currentText(ctx, tx, data, id)
+		}
+		if err != nil {
+			return 500, err
+		}
+		if err = s.keepVersion(ctx, tx, models.ItemTexts, data.UID, old.Version, id, old); err != nil {
+			return 500, err
+		}
+		q = `UPDATE text_table SET text = $1, revision = $2, version = version + 1,
+				title = $5, url = $6, notes = $7, tags = $8, favorite = $9, updated_at = now()
+				WHERE id = $3 AND user_id = $4 RETURNING revision, version, created_at, updated_at`
+		err = tx.QueryRow(ctx, q, data.Text, rev, data.UID, id,
+			data.Title, data.URL, data.Notes, data.Tags, data.Favorite).Scan(&data.Revision, &data.Version, &data.CreatedAt, &data.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+func (s *Store) UpdateBinary(data *models.CryptoBinaryData, id string) (int, error) {
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		old := models.CryptoBinaryData{UID: data.UID}
+		q := `SELECT binary_data, revision, version, ` + metaColumns + ` FROM binary_table
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3) FOR UPDATE`
+		err := tx.QueryRow(ctx, q, data.UID, id, data.Version).Scan(scanFields(&old.ItemMeta, &old.Data, &old.Revision, &old.Version)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.currentBinary(ctx, tx, data, id)
+		}
+		if err != nil {
+			return 500, err
+		}
+		if err = s.keepVersion(ctx, tx, models.ItemBinaries, data.UID, old.Version, id, old); err != nil {
+			return 500, err
+		}
+		q = `UPDATE binary_table SET binary_data = $1, revision = $2, version = version + 1,
+				title = $5, url = $6, notes = $7, tags = $8, favorite = $9, updated_at = now()
+				WHERE id = $3 AND user_id = $4 RETURNING revision, version, created_at, updated_at`
+		err = tx.QueryRow(ctx, q, data.Data, rev, data.UID, id,
+			data.Title, data.URL, data.Notes, data.Tags, data.Favorite).Scan(&data.Revision, &data.Version, &data.CreatedAt, &data.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+// currentCard - текущая копия карты data.UID, когда изменение не применилось: 404, если карты нет,
+// иначе 409 и копия в data.
+func (s *Store) currentCard(ctx context.Context, tx pgx.Tx, data *models.CryptoCard, id string) (int, error) {
+	q := `SELECT card_number, card_holder, cvc, revision, version, ` + metaColumns + ` FROM cards WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	return notChanged(tx.QueryRow(ctx, q, data.UID, id).Scan(scanFields(&data.ItemMeta, &data.Number, &data.Name, &data.CVC, &data.Revision, &data.Version)...))
+}
+
+// currentPassword - текущая копия пары логин/пароль data.UID, когда изменение не применилось.
+func (s *Store) currentPassword(ctx context.Context, tx pgx.Tx, data *models.CryptoPassword, id string) (int, error) {
+	q := `SELECT login, password, revision, version, ` + metaColumns + ` FROM passwords WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	return notChanged(tx.QueryRow(ctx, q, data.UID, id).Scan(scanFields(&data.ItemMeta, &data.Login, &data.Pass, &data.Revision, &data.Version)...))
+}
+
+// currentText - текущая копия текстовых данных data.UID, когда изменение не применилось.
+func (s *Store) currentText(ctx context.Context, tx pgx.Tx, data *models.CryptoTextData, id string) (int, error) {
+	q := `SELECT text, revision, version, ` + metaColumns + ` FROM text_table WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	return notChanged(tx.QueryRow(ctx, q, data.UID, id).Scan(scanFields(&data.ItemMeta, &data.Text, &data.Revision, &data.Version)...))
+}
+
+// currentBinary - текущая копия бинарных данных data.UID, когда изменение не применилось.
+func (s *Store) currentBinary(ctx context.Context, tx pgx.Tx, data *models.CryptoBinaryData, id string) (int, error) {
+	q := `SELECT binary_data, revision, version, ` + metaColumns + ` FROM binary_table WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	return notChanged(tx.QueryRow(ctx, q, data.UID, id).Scan(scanFields(&data.ItemMeta, &data.Data, &data.Revision, &data.Version)...))
+}
+
+// GetItems - записи вида itemType пользователя id. Записи встроенных видов берутся методами вида.
+func (s *Store) GetItems(id, itemType string) (int, []models.Item, error) {
+	kind, status, err := itemKind(itemType)
+	switch {
+	case err != nil:
+		return status, nil, err
+	case kind.Builtin:
+		return builtinItems(s, id, itemType)
 	}
-	return 200, nil
+	q := `SELECT id, payload, revision, version, ` + metaColumns + ` FROM items
+			WHERE user_id = $1 AND item_type = $2 AND deleted_at IS NULL ORDER BY id`
+	rows, err := s.client.Query(context.Background(), q, id, itemType)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var data []models.Item
+	for rows.Next() {
+		it := models.Item{Type: itemType}
+		if err = rows.Scan(scanFields(&it.ItemMeta, &it.UID, &it.Payload, &it.Revision, &it.Version)...); err != nil {
+			s.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		data = append(data, it)
+	}
+	if err = rows.Err(); err != nil {
+		return 500, nil, err
+	}
+	return 200, data, nil
 }
 
-func (s *Store) DeleteText(data *models.CryptoTextData, id string) (int, error) {
-	q := `DELETE FROM text_table WHERE id = $1 and user_id = $2`
-	if _, err := s.client.Exec(context.Background(), q, data.UID, id); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+// CollectItem - добавление записи d вида d.Type пользователю id. В d записывается сохраненная запись
+// с идентификатором, версией и временем создания.
+func (s *Store) CollectItem(d *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(d.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(d, id, builtinChange{s.CollectCard, s.CollectPassword, s.CollectText, s.CollectBinary})
 	}
-	return 200, nil
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		q := `INSERT INTO items (user_id, item_type, payload, revision, title, url, notes, tags, favorite)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, revision, version, created_at, updated_at`
+		err := tx.QueryRow(ctx, q, id, d.Type, d.Payload, rev, d.Title, d.URL, d.Notes, d.Tags, d.Favorite).Scan(&d.UID, &d.Revision, &d.Version, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
 }
 
-func (s *Store) DeletePassword(data *models.CryptoPassword, id string) (int, error) {
-	q := `DELETE FROM passwords WHERE id = $1 and user_id = $2`
-	if _, err := s.client.Exec(context.Background(), q, data.UID, id); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+// UpdateItem - изменение записи data.UID вида data.Type пользователя id, как и изменение записей встроенных видов.
+func (s *Store) UpdateItem(data *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(data.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(data, id, builtinChange{s.UpdateCard, s.UpdatePassword, s.UpdateText, s.UpdateBinary})
 	}
-	return 200, nil
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		old := models.Item{Type: data.Type, UID: data.UID}
+		q := `SELECT payload, revision, version, ` + metaColumns + ` FROM items
+				WHERE id = $1 AND user_id = $2 AND item_type = $3 AND deleted_at IS NULL AND ($4::bigint = 0 OR version = $4) FOR UPDATE`
+		err := tx.QueryRow(ctx, q, data.UID, id, data.Type, data.Version).Scan(scanFields(&old.ItemMeta, &old.Payload, &old.Revision, &old.Version)...)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return s.currentItem(ctx, tx, data, id)
+		}
+		if err != nil {
+			return 500, err
+		}
+		if err = s.keepVersion(ctx, tx, data.Type, data.UID, old.Version, id, old); err != nil {
+			return 500, err
+		}
+		q = `UPDATE items SET payload = $1, revision = $2, version = version + 1,
+				title = $5, url = $6, notes = $7, tags = $8, favorite = $9, updated_at = now()
+				WHERE id = $3 AND user_id = $4 RETURNING revision, version, created_at, updated_at`
+		err = tx.QueryRow(ctx, q, data.Payload, rev, data.UID, id,
+			data.Title, data.URL, data.Notes, data.Tags, data.Favorite).Scan(&data.Revision, &data.Version, &data.CreatedAt, &data.UpdatedAt)
+		if err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
 }
 
-func (s *Store) DeleteBinary(data *models.CryptoBinaryData, id string) (int, error) {
-	q := `DELETE FROM binary_table WHERE id = $1 and user_id = $2`
-	if _, err := s.client.Exec(context.Background(), q, data.UID, id); err != nil {
-		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+// DeleteItem - перемещение записи data.UID вида data.Type пользователя id в корзину, как и удаление записей встроенных видов.
+func (s *Store) DeleteItem(data *models.Item, id string) (int, error) {
+	kind, status, err := itemKind(data.Type)
+	switch {
+	case err != nil:
+		return status, err
+	case kind.Builtin:
+		return changeBuiltinItem(data, id, builtinChange{s.DeleteCard, s.DeletePassword, s.DeleteText, s.DeleteBinary})
 	}
-	return 200, nil
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		deleted, err := s.deleteItem(ctx, tx, data.Type, data.UID, data.Version, id, rev)
+		if err != nil {
+			return 500, err
+		}
+		if !deleted {
+			return s.currentItem(ctx, tx, data, id)
+		}
+		return 200, nil
+	})
 }
 
-func (s *Store) UpdateCard(data *models.CryptoCard, id string) (int, error) {
-	q := `UPDATE cards SET card_number = $1, card_holder = $2, cvc = $3 WHERE id = $4 AND user_id = $5`
-	if _, err := s.client.Exec(context.Background(), q, data.Number, data.Name, data.CVC, data.UID, id); err != nil {
-		fmt.Println(err)
-		s.logger.LogErr(err, "Failure to insert object into table")
+// currentItem - текущая копия записи data.UID вида data.Type, когда изменение не применилось.
+func (s *Store) currentItem(ctx context.Context, tx pgx.Tx, data *models.Item, id string) (int, error) {
+	q := `SELECT payload, revision, version, ` + metaColumns + ` FROM items WHERE id = $1 AND user_id = $2 AND item_type = $3 AND deleted_at IS NULL`
+	return notChanged(tx.QueryRow(ctx, q, data.UID, id, data.Type).Scan(scanFields(&data.ItemMeta, &data.Payload, &data.Revision, &data.Version)...))
+}
+
+// notChanged - статус изменения, которое не применилось, по результату чтения текущей копии записи.
+func notChanged(err error) (int, error) {
+	switch {
+	case err == nil:
+		return 409, storage.ErrVersionConflict
+	case errors.Is(err, pgx.ErrNoRows):
+		return 404, storage.ErrItemNotFound
+	}
+	return 500, err
+}
+
+// withRevision - изменение записей пользователя id в транзакции с новой ревизией rev. Строка пользователя
+// заблокирована до конца транзакции, поэтому ревизии одного пользователя фиксируются по порядку и клиент,
+// получивший ревизию N, уже не увидит новых изменений с ревизией меньше N. Если change вернул не 200,
+// транзакция откатывается и ревизия не растет.
+func (s *Store) withRevision(id string, change func(ctx context.Context, tx pgx.Tx, rev int64) (int, error)) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	rev, err := s.nextRevision(ctx, tx, id)
+	if err != nil {
+		return 500, err
+	}
+	status, err := change(ctx, tx, rev)
+	if status == 500 {
+		s.logger.LogErr(err, "Failure to change object in table")
+	}
+	if status != 200 {
+		return status, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
 		return 500, err
 	}
+	//возвращаем 200 — данные успешно изменены.
 	return 200, nil
 }
 
-func (s *Store) UpdatePassword(data *models.CryptoPassword, id string) (int, error) {
-	q := `UPDATE passwords SET login = $1, password = $2 WHERE id = $3 AND user_id = $4`
-	if _, err := s.client.Exec(context.Background(), q, data.Login, data.Pass, data.UID, id); err != nil {
-		fmt.Println(err)
+// nextRevision - следующая ревизия пользователя id внутри транзакции tx.
+func (s *Store) nextRevision(ctx context.Context, tx pgx.Tx, id string) (int64, error) {
+	var rev int64
+	q := `UPDATE users SET revision = revision + 1 WHERE id = $1 RETURNING revision`
+	if err := tx.QueryRow(ctx, q, id).Scan(&rev); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 0, err
+	}
+	return rev, nil
+}
+
+// deleteItem - перемещение записи uid вида itemType версии version пользователя id в корзину
+// и сохранение следа удаления с ревизией rev. Возвращает false, если такой записи нет.
+func (s *Store) deleteItem(ctx context.Context, tx pgx.Tx, itemType string, uid int, version int64, id string, rev int64) (bool, error) {
+	table := itemTable(itemType)
+	cond, args := kindCond(table, itemType, uid, id, version, rev)
+	q := `UPDATE ` + table + ` SET deleted_at = now(), revision = $4
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3::bigint = 0 OR version = $3)` + cond
+	tag, err := tx.Exec(ctx, q, args...)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	q = `INSERT INTO tombstones (user_id, item_type, item_id, revision) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (item_type, item_id) DO UPDATE SET revision = EXCLUDED.revision`
+	_, err = tx.Exec(ctx, q, id, itemType, uid, rev)
+	return err == nil, err
+}
+
+// kindCond - условие на вид записи itemType для запроса к таблице table с аргументами args и аргументы вместе
+// с видом. Идентификаторы таблицы items общие для всех видов, поэтому запись другого вида не должна находиться
+// по идентификатору. В таблицах встроенных видов условие пустое.
+func kindCond(table, itemType string, args ...interface{}) (string, []interface{}) {
+	if table != tableItems {
+		return "", args
+	}
+	return fmt.Sprintf(` AND item_type = $%d`, len(args)+1), append(args, itemType)
+}
+
+// SaveRefreshToken - сохранение нового токена обновления. Просроченные токены пользователя удаляются.
+func (s *Store) SaveRefreshToken(t *models.RefreshToken) error {
+	q := `DELETE FROM refresh_tokens WHERE user_id = $1 AND expires_at < now()`
+	if _, err := s.client.Exec(context.Background(), q, t.UserID); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return err
+	}
+	q = `INSERT INTO refresh_tokens (token_hash, family, user_id, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := s.client.Exec(context.Background(), q, t.Hash, t.Family, t.UserID, t.ExpiresAt); err != nil {
 		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+		return err
 	}
-	return 200, nil
+	return nil
 }
 
-func (s *Store) UpdateText(data *models.CryptoTextData, id string) (int, error) {
-	q := `UPDATE text_table SET text = $1 WHERE id = $2 AND user_id = $3`
-	if _, err := s.client.Exec(context.Background(), q, data.Text, data.UID, id); err != nil {
-		fmt.Println(err)
+// RotateRefreshToken - замена токена обновления hash на next в одной транзакции.
+// Семейство и пользователь next берутся из старого токена. Повторное использование токена
+// означает, что он украден, поэтому отзывается все семейство.
+func (s *Store) RotateRefreshToken(hash string, next *models.RefreshToken) error {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var t models.RefreshToken
+	q := `SELECT family, user_id, expires_at, used, revoked FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, hash).Scan(&t.Family, &t.UserID, &t.ExpiresAt, &t.Used, &t.Revoked); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrTokenNotFound
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return err
+	}
+	switch {
+	case t.Revoked:
+		return storage.ErrTokenRevoked
+	case t.Used:
+		q = `UPDATE refresh_tokens SET revoked = true WHERE family = $1`
+		if _, err = tx.Exec(ctx, q, t.Family); err != nil {
+			s.logger.LogErr(err, "Failure to update object in table")
+			return err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			s.logger.LogErr(err, "failed to commit transaction")
+			return err
+		}
+		return storage.ErrTokenReused
+	case time.Now().After(t.ExpiresAt):
+		return storage.ErrTokenExpired
+	}
+
+	q = `UPDATE refresh_tokens SET used = true WHERE token_hash = $1`
+	if _, err = tx.Exec(ctx, q, hash); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	next.Family, next.UserID = t.Family, t.UserID
+	q = `INSERT INTO refresh_tokens (token_hash, family, user_id, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, q, next.Hash, next.Family, next.UserID, next.ExpiresAt); err != nil {
 		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+		return err
 	}
-	return 200, nil
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return err
+	}
+	return nil
 }
 
-func (s *Store) UpdateBinary(data *models.CryptoBinaryData, id string) (int, error) {
-	q := `UPDATE binary_table SET binary_data = $1 WHERE id = $2 AND user_id = $3`
-	if _, err := s.client.Exec(context.Background(), q, data.Data, data.UID, id); err != nil {
-		fmt.Println(err)
+// RevokeRefreshToken - отзыв всего семейства токена обновления hash, принадлежащего пользователю id.
+func (s *Store) RevokeRefreshToken(hash, id string) error {
+	q := `UPDATE refresh_tokens SET revoked = true
+			WHERE family = (SELECT family FROM refresh_tokens WHERE token_hash = $1 AND user_id = $2)`
+	tag, err := s.client.Exec(context.Background(), q, hash, id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrTokenNotFound
+	}
+	return nil
+}
+
+// RevokeToken - добавление токена доступа jti пользователя id в список отозванных до истечения его срока.
+// Записи с истекшим сроком больше не нужны и удаляются.
+func (s *Store) RevokeToken(jti, id string, expiresAt time.Time) error {
+	q := `DELETE FROM revoked_tokens WHERE expires_at < now()`
+	if _, err := s.client.Exec(context.Background(), q); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return err
+	}
+	q = `INSERT INTO revoked_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`
+	if _, err := s.client.Exec(context.Background(), q, jti, id, expiresAt); err != nil {
 		s.logger.LogErr(err, "Failure to insert object into table")
-		return 500, err
+		return err
 	}
-	return 200, nil
+	return nil
+}
+
+// IsTokenRevoked - проверка, что токен доступа jti отозван.
+func (s *Store) IsTokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	q := `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+	if err := s.client.QueryRow(context.Background(), q, jti).Scan(&revoked); err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return false, err
+	}
+	return revoked, nil
+}
+
+// CreateSession - сохранение новой сессии пользователя id.
+func (s *Store) CreateSession(session *models.Session, id string) error {
+	q := `INSERT INTO sessions (id, user_id, device, user_agent, ip) VALUES ($1, $2, $3, $4, $5)
+			RETURNING created_at, last_seen`
+	err := s.client.QueryRow(context.Background(), q, session.ID, id, session.Device, session.UserAgent, session.IP).
+		Scan(&session.CreatedAt, &session.LastSeen)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return err
+	}
+	return nil
+}
+
+// GetSessions - все не отозванные сессии пользователя, последние активные первыми.
+func (s *Store) GetSessions(id string) (int, []models.Session, error) {
+	var data []models.Session
+
+	q := `SELECT id, device, user_agent, ip, created_at, last_seen FROM sessions
+			WHERE user_id = $1 AND NOT revoked ORDER BY last_seen DESC`
+	rows, err := s.client.Query(context.Background(), q, id)
+	if err != nil {
+		s.logger.LogErr(err, "")
+		return 500, data, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var session models.Session
+		if err = rows.Scan(&session.ID, &session.Device, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeen); err != nil {
+			s.logger.LogErr(err, "Failure to scan object from table")
+			return 500, data, err
+		}
+		data = append(data, session)
+	}
+	return 200, data, nil
+}
+
+// RevokeSession - отзыв сессии sessionID пользователя id вместе с ее токенами обновления.
+func (s *Store) RevokeSession(sessionID, id string) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `UPDATE sessions SET revoked = true WHERE id = $1 AND user_id = $2 AND NOT revoked`
+	tag, err := tx.Exec(ctx, q, sessionID, id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 404, fmt.Errorf("session %s not found", sessionID)
+	}
+	q = `UPDATE refresh_tokens SET revoked = true WHERE family = $1`
+	if _, err = tx.Exec(ctx, q, sessionID); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// TouchSession - обновление времени последней активности сессии. Возвращает false, если сессия отозвана.
+func (s *Store) TouchSession(sessionID string) (bool, error) {
+	q := `UPDATE sessions SET last_seen = now() WHERE id = $1 AND NOT revoked`
+	tag, err := s.client.Exec(context.Background(), q, sessionID)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetTOTP - сохранение нового секрета TOTP и хэшей кодов восстановления пользователя id.
+// Второй фактор остается выключенным до подтверждения кодом.
+func (s *Store) SetTOTP(id, secret string, recoveryCodes []string) error {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `UPDATE users SET totp_secret = $1, totp_enabled = false, totp_last_step = 0 WHERE id = $2`
+	if _, err = tx.Exec(ctx, q, secret, id); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, id); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return err
+	}
+	for _, code := range recoveryCodes {
+		q = `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err = tx.Exec(ctx, q, id, code); err != nil {
+			s.logger.LogErr(err, "Failure to insert object into table")
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return err
+	}
+	return nil
+}
+
+// GetTOTP - настройки второго фактора пользователя id.
+func (s *Store) GetTOTP(id string) (*models.TOTP, error) {
+	var t models.TOTP
+	q := `SELECT login, totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1`
+	if err := s.client.QueryRow(context.Background(), q, id).Scan(&t.Login, &t.Secret, &t.Enabled, &t.LastStep); err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EnableTOTP - включение второго фактора после подтверждения кодом.
+func (s *Store) EnableTOTP(id string) error {
+	q := `UPDATE users SET totp_enabled = true WHERE id = $1 AND totp_secret <> ''`
+	if _, err := s.client.Exec(context.Background(), q, id); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
+
+// DisableTOTP - выключение второго фактора, секрет и коды восстановления удаляются.
+func (s *Store) DisableTOTP(id string) error {
+	return s.SetTOTP(id, "", nil)
+}
+
+// UseTOTPStep - отметка интервала step использованным. Возвращает false, если код этого
+// или более позднего интервала уже принимался.
+func (s *Store) UseTOTPStep(id string, step int64) (bool, error) {
+	q := `UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`
+	tag, err := s.client.Exec(context.Background(), q, step, id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UseRecoveryCode - использование кода восстановления с хэшем hash. Каждый код действует один раз.
+func (s *Store) UseRecoveryCode(id, hash string) (bool, error) {
+	q := `DELETE FROM recovery_codes WHERE user_id = $1 AND code_hash = $2`
+	tag, err := s.client.Exec(context.Background(), q, id, hash)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetLogin - логин пользователя id, по нему учитываются неудачные попытки ввода пароля.
+func (s *Store) GetLogin(id string) (int, string, error) {
+	var login string
+	q := `SELECT login FROM users WHERE id = $1`
+	if err := s.client.QueryRow(context.Background(), q, id).Scan(&login); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, "", fmt.Errorf("user %s not found", id)
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, "", err
+	}
+	return 200, login, nil
+}
+
+// GetLoginLock - время, до которого вход под логином login запрещен. Нулевое время, если вход не заблокирован.
+func (s *Store) GetLoginLock(login string) (time.Time, error) {
+	var lockedUntil *time.Time
+	q := `SELECT locked_until FROM login_attempts WHERE login = $1`
+	err := s.client.QueryRow(context.Background(), q, login).Scan(&lockedUntil)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return time.Time{}, err
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+// RecordLoginFailure - учет неудачной попытки входа под логином login. Возвращает число неудачных попыток подряд,
+// попытки раньше since забываются. Заодно удаляются устаревшие записи других логинов.
+func (s *Store) RecordLoginFailure(login string, since time.Time) (int, error) {
+	q := `DELETE FROM login_attempts WHERE last_failure < $1 AND (locked_until IS NULL OR locked_until < now())`
+	if _, err := s.client.Exec(context.Background(), q, since); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 0, err
+	}
+	var failures int
+	q = `INSERT INTO login_attempts (login, failures, last_failure) VALUES ($1, 1, now())
+		ON CONFLICT (login) DO UPDATE SET failures = login_attempts.failures + 1, last_failure = now()
+		RETURNING failures`
+	if err := s.client.QueryRow(context.Background(), q, login).Scan(&failures); err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 0, err
+	}
+	return failures, nil
+}
+
+// LockLogin - запрет входа под логином login до until.
+func (s *Store) LockLogin(login string, until time.Time) error {
+	q := `UPDATE login_attempts SET locked_until = $2 WHERE login = $1`
+	if _, err := s.client.Exec(context.Background(), q, login, until); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return err
+	}
+	return nil
+}
+
+// ResetLoginFailures - сброс неудачных попыток входа после успешного входа под логином login.
+func (s *Store) ResetLoginFailures(login string) error {
+	q := `DELETE FROM login_attempts WHERE login = $1`
+	if _, err := s.client.Exec(context.Background(), q, login); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return err
+	}
+	return nil
+}
+
+// SaveKey - сохранение зашифрованного закрытого ключа пользователя id. Старый ключ заменяется.
+func (s *Store) SaveKey(id string, key []byte) error {
+	q := `INSERT INTO user_keys (user_id, sealed_key) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET sealed_key = EXCLUDED.sealed_key, updated_at = now()`
+	if _, err := s.client.Exec(context.Background(), q, id, key); err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return err
+	}
+	return nil
+}
+
+// GetKey - получение зашифрованного закрытого ключа пользователя id.
+func (s *Store) GetKey(id string) (int, *models.SealedKey, error) {
+	var k models.SealedKey
+	q := `SELECT sealed_key, updated_at FROM user_keys WHERE user_id = $1`
+	if err := s.client.QueryRow(context.Background(), q, id).Scan(&k.Key, &k.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, fmt.Errorf("key of user %s not found", id)
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	return 200, &k, nil
+}
+
+// RotateItems - замена всех записей пользователя id записями, перешифрованными новым ключом, и сохранение
+// нового ключа одной транзакцией. Если набор записей изменился, возвращается 409. Сессии, кроме sessionID,
+// отзываются: их клиенты держат старый ключ.
+func (s *Store) RotateItems(b *models.ItemBatch, id, sessionID string) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	//параллельные смены ключа одного пользователя выполняются по очереди
+	q := `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+	if err = tx.QueryRow(ctx, q, id).Scan(new(string)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, fmt.Errorf("user %s not found", id)
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, err
+	}
+	for table, want := range batchIDs(b) {
+		have, err := s.userIDs(ctx, tx, table, id)
+		if err != nil {
+			return 500, err
+		}
+		if err = checkBatchIDs(table, have, want); err != nil {
+			return 409, err
+		}
+	}
+	//все записи перешифрованы, поэтому все получают одну новую ревизию
+	rev, err := s.nextRevision(ctx, tx, id)
+	if err != nil {
+		return 500, err
+	}
+
+	//запись, измененная после того, как клиент ее получил, не обновляется, и смена ключа отменяется
+	for _, d := range b.Cards {
+		q = `UPDATE cards SET card_number = $1, card_holder = $2, cvc = $3, revision = $4, version = version + 1,
+				title = $8, url = $9, notes = $10, tags = $11
+				WHERE id = $5 AND user_id = $6 AND deleted_at IS NULL AND ($7::bigint = 0 OR version = $7)`
+		tag, err := tx.Exec(ctx, q, d.Number, d.Name, d.CVC, rev, d.UID, id, d.Version, d.Title, d.URL, d.Notes, d.Tags)
+		if status, err := s.rotated(tag, err, tableCards, d.UID); err != nil {
+			return status, err
+		}
+	}
+	for _, d := range b.Passwords {
+		q = `UPDATE passwords SET login = $1, password = $2, revision = $3, version = version + 1,
+				title = $7, url = $8, notes = $9, tags = $10
+				WHERE id = $4 AND user_id = $5 AND deleted_at IS NULL AND ($6::bigint = 0 OR version = $6)`
+		tag, err := tx.Exec(ctx, q, d.Login, d.Pass, rev, d.UID, id, d.Version, d.Title, d.URL, d.Notes, d.Tags)
+		if status, err := s.rotated(tag, err, tablePasswords, d.UID); err != nil {
+			return status, err
+		}
+	}
+	for _, d := range b.Texts {
+		q = `UPDATE text_table SET text = $1, revision = $2, version = version + 1,
+				title = $6, url = $7, notes = $8, tags = $9
+				WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5)`
+		tag, err := tx.Exec(ctx, q, d.Text, rev, d.UID, id, d.Version, d.Title, d.URL, d.Notes, d.Tags)
+		if status, err := s.rotated(tag, err, tableTexts, d.UID); err != nil {
+			return status, err
+		}
+	}
+	for _, d := range b.Binaries {
+		q = `UPDATE binary_table SET binary_data = $1, revision = $2, version = version + 1,
+				title = $6, url = $7, notes = $8, tags = $9
+				WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5)`
+		tag, err := tx.Exec(ctx, q, d.Data, rev, d.UID, id, d.Version, d.Title, d.URL, d.Notes, d.Tags)
+		if status, err := s.rotated(tag, err, tableBinaries, d.UID); err != nil {
+			return status, err
+		}
+	}
+	//вид записи при смене ключа не меняется
+	for _, d := range b.Items {
+		q = `UPDATE items SET payload = $1, revision = $2, version = version + 1,
+				title = $6, url = $7, notes = $8, tags = $9
+				WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL AND ($5::bigint = 0 OR version = $5)`
+		tag, err := tx.Exec(ctx, q, d.Payload, rev, d.UID, id, d.Version, d.Title, d.URL, d.Notes, d.Tags)
+		if status, err := s.rotated(tag, err, tableItems, d.UID); err != nil {
+			return status, err
+		}
+	}
+	q = `INSERT INTO user_keys (user_id, sealed_key) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET sealed_key = EXCLUDED.sealed_key, updated_at = now()`
+	if _, err = tx.Exec(ctx, q, id, b.Key); err != nil {
+		s.logger.LogErr(err, "Failure to insert object into table")
+		return 500, err
+	}
+	//прежние версии и записи в корзине зашифрованы старым ключом, который больше не должен ничего открывать
+	q = `DELETE FROM item_history WHERE user_id = $1`
+	if _, err = tx.Exec(ctx, q, id); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 500, err
+	}
+	if _, err = s.purge(ctx, tx, `user_id = $1`, id); err != nil {
+		return 500, err
+	}
+	q = `UPDATE sessions SET revoked = true WHERE user_id = $1 AND id <> $2 AND NOT revoked`
+	if _, err = tx.Exec(ctx, q, id, sessionID); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	q = `UPDATE refresh_tokens SET revoked = true WHERE user_id = $1 AND family <> $2`
+	if _, err = tx.Exec(ctx, q, id, sessionID); err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// rotated - проверка результата перешифровки записи uid таблицы table. Если запись не обновилась, ее версия
+// изменилась и возвращается 409.
+func (s *Store) rotated(tag pgconn.CommandTag, err error, table string, uid int) (int, error) {
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 409, fmt.Errorf("%s changed: item %d was updated", table, uid)
+	}
+	return 200, nil
+}
+
+// userIDs - идентификаторы записей пользователя id вне корзины в таблице table внутри транзакции tx.
+func (s *Store) userIDs(ctx context.Context, tx pgx.Tx, table, id string) ([]int, error) {
+	rows, err := tx.Query(ctx, `SELECT id FROM `+table+` WHERE user_id = $1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var uid int
+		if err = rows.Scan(&uid); err != nil {
+			s.logger.LogErr(err, "Failure to scan object from table")
+			return nil, err
+		}
+		ids = append(ids, uid)
+	}
+	return ids, rows.Err()
+}
+
+// Sync - записи пользователя id, измененные после ревизии since, и следы удаленных после нее записей.
+// Все чтения идут в одном снимке базы, поэтому ответ согласован с возвращаемой ревизией.
+// Если since новее ревизии пользователя, например после восстановления базы из копии, возвращаются все записи.
+func (s *Store) Sync(id string, since int64) (int, *models.SyncDelta, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	d := &models.SyncDelta{}
+	q := `SELECT revision FROM users WHERE id = $1`
+	if err = tx.QueryRow(ctx, q, id).Scan(&d.Revision); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 404, nil, fmt.Errorf("user %s not found", id)
+		}
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if since <= 0 || since > d.Revision {
+		since, d.Full = 0, true
+	}
+
+	q = `SELECT id, card_number, card_holder, cvc, revision, version, ` + metaColumns + ` FROM cards
+			WHERE user_id = $1 AND deleted_at IS NULL AND revision > $2 ORDER BY id`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var c models.CryptoCard
+		if err := rows.Scan(scanFields(&c.ItemMeta, &c.UID, &c.Number, &c.Name, &c.CVC, &c.Revision, &c.Version)...); err != nil {
+			return err
+		}
+		d.Cards = append(d.Cards, c)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, login, password, revision, version, ` + metaColumns + ` FROM passwords
+			WHERE user_id = $1 AND deleted_at IS NULL AND revision > $2 ORDER BY id`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var p models.CryptoPassword
+		if err := rows.Scan(scanFields(&p.ItemMeta, &p.UID, &p.Login, &p.Pass, &p.Revision, &p.Version)...); err != nil {
+			return err
+		}
+		d.Passwords = append(d.Passwords, p)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, text, revision, version, ` + metaColumns + ` FROM text_table
+			WHERE user_id = $1 AND deleted_at IS NULL AND revision > $2 ORDER BY id`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var t models.CryptoTextData
+		if err := rows.Scan(scanFields(&t.ItemMeta, &t.UID, &t.Text, &t.Revision, &t.Version)...); err != nil {
+			return err
+		}
+		d.Texts = append(d.Texts, t)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, binary_data, revision, version, ` + metaColumns + ` FROM binary_table
+			WHERE user_id = $1 AND deleted_at IS NULL AND revision > $2 ORDER BY id`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var b models.CryptoBinaryData
+		if err := rows.Scan(scanFields(&b.ItemMeta, &b.UID, &b.Data, &b.Revision, &b.Version)...); err != nil {
+			return err
+		}
+		d.Binaries = append(d.Binaries, b)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, item_type, payload, revision, version, ` + metaColumns + ` FROM items
+			WHERE user_id = $1 AND deleted_at IS NULL AND revision > $2 ORDER BY id`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var it models.Item
+		if err := rows.Scan(scanFields(&it.ItemMeta, &it.UID, &it.Type, &it.Payload, &it.Revision, &it.Version)...); err != nil {
+			return err
+		}
+		d.Items = append(d.Items, it)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	//полному ответу следы не нужны: удаленных записей в нем и так нет
+	if d.Full {
+		return 200, d, nil
+	}
+	q = `SELECT item_type, item_id, revision FROM tombstones WHERE user_id = $1 AND revision > $2 ORDER BY revision`
+	err = s.scanRows(ctx, tx, q, []interface{}{id, since}, func(rows pgx.Rows) error {
+		var t models.Tombstone
+		if err := rows.Scan(&t.Type, &t.UID, &t.Revision); err != nil {
+			return err
+		}
+		d.Deleted = append(d.Deleted, t)
+		return nil
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	return 200, d, nil
+}
+
+// keepVersion - сохранение прежней версии item записи uid вида itemType в историю пользователя id внутри транзакции tx.
+// Версии сверх глубины истории пользователя удаляются, самые старые первыми.
+func (s *Store) keepVersion(ctx context.Context, tx pgx.Tx, itemType string, uid int, version int64, id string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	q := `INSERT INTO item_history (user_id, item_type, item_id, version, item)
+			SELECT id, $2, $3, $4, $5 FROM users WHERE id = $1 AND history_depth > 0`
+	if _, err = tx.Exec(ctx, q, id, itemType, uid, version, data); err != nil {
+		return err
+	}
+	q = `DELETE FROM item_history WHERE item_type = $1 AND item_id = $2 AND version NOT IN (
+			SELECT version FROM item_history WHERE item_type = $1 AND item_id = $2
+			ORDER BY version DESC LIMIT (SELECT history_depth FROM users WHERE id = $3))`
+	_, err = tx.Exec(ctx, q, itemType, uid, id)
+	return err
+}
+
+// GetHistory - прежние версии записи uid вида itemType пользователя id, новые первыми.
+// Если записи нет или она чужая, возвращается 404.
+func (s *Store) GetHistory(id, itemType string, uid int) (int, []models.HistoryEntry, error) {
+	if _, ok := models.LookupItemKind(itemType); !ok {
+		return 404, nil, storage.ErrItemNotFound
+	}
+	table := itemTable(itemType)
+	cond, args := kindCond(table, itemType, uid, id)
+	ctx := context.Background()
+	q := `SELECT EXISTS (SELECT 1 FROM ` + table + ` WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL` + cond + `)`
+	var exists bool
+	if err := s.client.QueryRow(ctx, q, args...).Scan(&exists); err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	if !exists {
+		return 404, nil, storage.ErrItemNotFound
+	}
+	q = `SELECT version, changed_at, item FROM item_history
+			WHERE user_id = $1 AND item_type = $2 AND item_id = $3 ORDER BY version DESC`
+	rows, err := s.client.Query(ctx, q, id, itemType, uid)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	defer rows.Close()
+	var data []models.HistoryEntry
+	for rows.Next() {
+		h := models.HistoryEntry{Type: itemType, UID: uid}
+		if err = rows.Scan(&h.Version, &h.ChangedAt, &h.Item); err != nil {
+			s.logger.LogErr(err, "Failure to scan object from table")
+			return 500, nil, err
+		}
+		data = append(data, h)
+	}
+	if err = rows.Err(); err != nil {
+		return 500, nil, err
+	}
+	return 200, data, nil
+}
+
+// historyItem - запись версии version из истории записи uid вида itemType пользователя id.
+func (s *Store) historyItem(id, itemType string, uid int, version int64) (int, []byte, error) {
+	var data []byte
+	q := `SELECT item FROM item_history WHERE user_id = $1 AND item_type = $2 AND item_id = $3 AND version = $4`
+	err := s.client.QueryRow(context.Background(), q, id, itemType, uid, version).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 404, nil, storage.ErrHistoryNotFound
+	}
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, nil, err
+	}
+	return 200, data, nil
+}
+
+// RestoreItem - восстановление записи uid вида itemType из версии from ее истории (см. restoreItem).
+func (s *Store) RestoreItem(id, itemType string, uid int, from, version int64) (int, *models.HistoryEntry, error) {
+	return restoreItem(s, id, itemType, uid, from, version)
+}
+
+// GetHistoryDepth - глубина истории записей пользователя id.
+func (s *Store) GetHistoryDepth(id string) (int, int, error) {
+	var depth int
+	q := `SELECT history_depth FROM users WHERE id = $1`
+	err := s.client.QueryRow(context.Background(), q, id).Scan(&depth)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 404, 0, fmt.Errorf("user %s not found", id)
+	}
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return 500, 0, err
+	}
+	return 200, depth, nil
+}
+
+// SetHistoryDepth - изменение глубины истории записей пользователя id. Версии сверх новой глубины удаляются сразу.
+func (s *Store) SetHistoryDepth(id string, depth int) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	q := `UPDATE users SET history_depth = $1 WHERE id = $2`
+	tag, err := tx.Exec(ctx, q, depth, id)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to update object in table")
+		return 500, err
+	}
+	if tag.RowsAffected() == 0 {
+		return 404, fmt.Errorf("user %s not found", id)
+	}
+	q = `DELETE FROM item_history h WHERE h.user_id = $1 AND (
+			SELECT count(*) FROM item_history n
+			WHERE n.item_type = h.item_type AND n.item_id = h.item_id AND n.version > h.version) >= $2`
+	if _, err = tx.Exec(ctx, q, id, depth); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// GetTrash - записи пользователя id в корзине, удаленные последними первыми.
+func (s *Store) GetTrash(id string) (int, []models.TrashEntry, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var data []models.TrashEntry
+	add := func(itemType string, uid int, deletedAt time.Time, item interface{}) error {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		data = append(data, models.TrashEntry{Type: itemType, UID: uid, DeletedAt: deletedAt, Item: raw})
+		return nil
+	}
+	q := `SELECT id, card_number, card_holder, cvc, revision, version, deleted_at, ` + metaColumns + ` FROM cards
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	err = s.scanRows(ctx, tx, q, []interface{}{id}, func(rows pgx.Rows) error {
+		var c models.CryptoCard
+		var deletedAt time.Time
+		if err := rows.Scan(scanFields(&c.ItemMeta, &c.UID, &c.Number, &c.Name, &c.CVC, &c.Revision, &c.Version, &deletedAt)...); err != nil {
+			return err
+		}
+		return add(models.ItemCards, c.UID, deletedAt, c)
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, login, password, revision, version, deleted_at, ` + metaColumns + ` FROM passwords
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	err = s.scanRows(ctx, tx, q, []interface{}{id}, func(rows pgx.Rows) error {
+		var p models.CryptoPassword
+		var deletedAt time.Time
+		if err := rows.Scan(scanFields(&p.ItemMeta, &p.UID, &p.Login, &p.Pass, &p.Revision, &p.Version, &deletedAt)...); err != nil {
+			return err
+		}
+		return add(models.ItemPasswords, p.UID, deletedAt, p)
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, text, revision, version, deleted_at, ` + metaColumns + ` FROM text_table
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	err = s.scanRows(ctx, tx, q, []interface{}{id}, func(rows pgx.Rows) error {
+		var t models.CryptoTextData
+		var deletedAt time.Time
+		if err := rows.Scan(scanFields(&t.ItemMeta, &t.UID, &t.Text, &t.Revision, &t.Version, &deletedAt)...); err != nil {
+			return err
+		}
+		return add(models.ItemTexts, t.UID, deletedAt, t)
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, binary_data, revision, version, deleted_at, ` + metaColumns + ` FROM binary_table
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	err = s.scanRows(ctx, tx, q, []interface{}{id}, func(rows pgx.Rows) error {
+		var b models.CryptoBinaryData
+		var deletedAt time.Time
+		if err := rows.Scan(scanFields(&b.ItemMeta, &b.UID, &b.Data, &b.Revision, &b.Version, &deletedAt)...); err != nil {
+			return err
+		}
+		return add(models.ItemBinaries, b.UID, deletedAt, b)
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	q = `SELECT id, item_type, payload, revision, version, deleted_at, ` + metaColumns + ` FROM items
+			WHERE user_id = $1 AND deleted_at IS NOT NULL`
+	err = s.scanRows(ctx, tx, q, []interface{}{id}, func(rows pgx.Rows) error {
+		var it models.Item
+		var deletedAt time.Time
+		if err := rows.Scan(scanFields(&it.ItemMeta, &it.UID, &it.Type, &it.Payload, &it.Revision, &it.Version, &deletedAt)...); err != nil {
+			return err
+		}
+		return add(it.Type, it.UID, deletedAt, it)
+	})
+	if err != nil {
+		return 500, nil, err
+	}
+	sortTrash(data)
+	return 200, data, nil
+}
+
+// RestoreTrash - возврат записи uid вида itemType из корзины пользователя id. Запись получает новую ревизию,
+// а след удаления убирается, чтобы клиенты получили ее при синхронизации.
+func (s *Store) RestoreTrash(id, itemType string, uid int) (int, error) {
+	if _, ok := models.LookupItemKind(itemType); !ok {
+		return 404, storage.ErrItemNotFound
+	}
+	table := itemTable(itemType)
+	return s.withRevision(id, func(ctx context.Context, tx pgx.Tx, rev int64) (int, error) {
+		cond, args := kindCond(table, itemType, uid, id, rev)
+		q := `UPDATE ` + table + ` SET deleted_at = NULL, revision = $3
+				WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL` + cond
+		tag, err := tx.Exec(ctx, q, args...)
+		if err != nil {
+			return 500, err
+		}
+		if tag.RowsAffected() == 0 {
+			return 404, storage.ErrItemNotFound
+		}
+		q = `DELETE FROM tombstones WHERE item_type = $1 AND item_id = $2`
+		if _, err = tx.Exec(ctx, q, itemType, uid); err != nil {
+			return 500, err
+		}
+		return 200, nil
+	})
+}
+
+// EmptyTrash - окончательное удаление всех записей из корзины пользователя id.
+func (s *Store) EmptyTrash(id string) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 500, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = s.purge(ctx, tx, `user_id = $1`, id); err != nil {
+		return 500, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return 500, err
+	}
+	return 200, nil
+}
+
+// PurgeTrash - окончательное удаление записей всех пользователей, которые попали в корзину раньше before.
+// Возвращает число удаленных записей.
+func (s *Store) PurgeTrash(before time.Time) (int, error) {
+	ctx := context.Background()
+	tx, err := s.client.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		s.logger.LogErr(err, "failed to begin transaction")
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	n, err := s.purge(ctx, tx, `deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		s.logger.LogErr(err, "failed to commit transaction")
+		return 0, err
+	}
+	return n, nil
+}
+
+// purge - окончательное удаление записей корзины, подходящих под условие cond с параметром arg, вместе с их
+// историей внутри транзакции tx. Возвращает число удаленных записей.
+func (s *Store) purge(ctx context.Context, tx pgx.Tx, cond string, arg interface{}) (int, error) {
+	n := 0
+	for _, table := range []string{tableCards, tablePasswords, tableTexts, tableBinaries} {
+		q := `DELETE FROM item_history WHERE item_type = $2 AND item_id IN (
+				SELECT id FROM ` + table + ` WHERE deleted_at IS NOT NULL AND ` + cond + `)`
+		if _, err := tx.Exec(ctx, q, arg, itemTypes[table]); err != nil {
+			s.logger.LogErr(err, "Failure to delete object from table")
+			return 0, err
+		}
+		q = `DELETE FROM ` + table + ` WHERE deleted_at IS NOT NULL AND ` + cond
+		tag, err := tx.Exec(ctx, q, arg)
+		if err != nil {
+			s.logger.LogErr(err, "Failure to delete object from table")
+			return 0, err
+		}
+		n += int(tag.RowsAffected())
+	}
+	//в таблице items вид записи хранится в каждой строке
+	q := `DELETE FROM item_history WHERE (item_type, item_id) IN (
+			SELECT item_type, id FROM items WHERE deleted_at IS NOT NULL AND ` + cond + `)`
+	if _, err := tx.Exec(ctx, q, arg); err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 0, err
+	}
+	q = `DELETE FROM items WHERE deleted_at IS NOT NULL AND ` + cond
+	tag, err := tx.Exec(ctx, q, arg)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to delete object from table")
+		return 0, err
+	}
+	return n + int(tag.RowsAffected()), nil
+}
+
+// scanRows - выполнение запроса q внутри транзакции tx и чтение каждой строки функцией scan.
+func (s *Store) scanRows(ctx context.Context, tx pgx.Tx, q string, args []interface{}, scan func(rows pgx.Rows) error) error {
+	rows, err := tx.Query(ctx, q, args...)
+	if err != nil {
+		s.logger.LogErr(err, "Failure to select object from table")
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = scan(rows); err != nil {
+			s.logger.LogErr(err, "Failure to scan object from table")
+			return err
+		}
+	}
+	return rows.Err()
 }
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -39,3 +40,19 @@ func TestPGStore(t *testing.T, cfg config.Config) (*Store, func(...string)) {
 		}
 	}
 }
+
+func TestFileStore(t *testing.T, cfg config.Config) (*MemStore, func()) {
+	t.Helper()
+
+	cfg.StoragePath = filepath.Join(t.TempDir(), "passmanager.db")
+	s, err := NewFileStore(&cfg, loggers.NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, func() {
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Package repositories позволяет сохранять и обрабатывать данные в базе данных. Так же отдавать их клиенту по запросу.
+// Данный модуль содержит общее для корзины обоих репозиториев. Удаление записи перемещает ее в корзину: запись
+// остается в своей таблице с временем удаления, клиенты получают след удаления, а история записи сохраняется
+// до окончательного удаления.
+package repositories
+
+import (
+	"sort"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// sortTrash - порядок записей корзины: удаленные последними первыми.
+func sortTrash(data []models.TrashEntry) {
+	sort.Slice(data, func(i, j int) bool {
+		if !data[i].DeletedAt.Equal(data[j].DeletedAt) {
+			return data[i].DeletedAt.After(data[j].DeletedAt)
+		}
+		if data[i].Type != data[j].Type {
+			return data[i].Type < data[j].Type
+		}
+		return data[i].UID < data[j].UID
+	})
+}
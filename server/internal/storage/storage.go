@@ -1,11 +1,37 @@
 package storage
 
-import "github.com/CyrilSbrodov/passManager.git/server/internal/models"
+import (
+	"errors"
+	"time"
+
+	"github.com/CyrilSbrodov/passManager.git/server/internal/models"
+)
+
+// Ошибки токенов обновления.
+var (
+	ErrTokenNotFound = errors.New("refresh token not found")
+	ErrTokenExpired  = errors.New("refresh token expired")
+	ErrTokenRevoked  = errors.New("refresh token revoked")
+	ErrTokenReused   = errors.New("refresh token reused, token family revoked")
+)
+
+// ErrAuthUpgrade - аккаунт еще входит по паролю, для перевода на ключ аутентификации нужно один раз отправить пароль вместе с ключом.
+var ErrAuthUpgrade = errors.New("account uses password authentication, send the password with the auth key to upgrade")
+
+// Ошибки изменения записей.
+var (
+	ErrItemNotFound    = errors.New("item not found")
+	ErrVersionConflict = errors.New("item was changed on another device")
+	ErrHistoryNotFound = errors.New("item version not found in history")
+	ErrUnknownKind     = errors.New("unknown item type")
+)
 
 // Storage - интерфейс репозитория.
 type Storage interface {
 	Register(u *models.User) (string, error)
 	Login(u *models.User) (string, error)
+	ChangePassword(id, password, newPassword, sessionID string) (int, error)
+	DeleteAccount(id, password string) (int, error)
 	CollectCard(d *models.CryptoCard, login string) (int, error)
 	CollectPassword(d *models.CryptoPassword, login string) (int, error)
 	CollectText(d *models.CryptoTextData, login string) (int, error)
@@ -22,4 +48,40 @@ type Storage interface {
 	UpdatePassword(d *models.CryptoPassword, id string) (int, error)
 	UpdateText(d *models.CryptoTextData, id string) (int, error)
 	UpdateBinary(d *models.CryptoBinaryData, id string) (int, error)
+	GetItems(id, itemType string) (int, []models.Item, error)
+	CollectItem(d *models.Item, id string) (int, error)
+	UpdateItem(d *models.Item, id string) (int, error)
+	DeleteItem(d *models.Item, id string) (int, error)
+	SaveRefreshToken(t *models.RefreshToken) error
+	RotateRefreshToken(hash string, next *models.RefreshToken) error
+	RevokeRefreshToken(hash, id string) error
+	RevokeToken(jti, id string, expiresAt time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+	CreateSession(s *models.Session, id string) error
+	GetSessions(id string) (int, []models.Session, error)
+	RevokeSession(sessionID, id string) (int, error)
+	TouchSession(sessionID string) (bool, error)
+	SetTOTP(id, secret string, recoveryCodes []string) error
+	GetTOTP(id string) (*models.TOTP, error)
+	EnableTOTP(id string) error
+	DisableTOTP(id string) error
+	UseTOTPStep(id string, step int64) (bool, error)
+	UseRecoveryCode(id, hash string) (bool, error)
+	GetLogin(id string) (int, string, error)
+	GetLoginLock(login string) (time.Time, error)
+	RecordLoginFailure(login string, since time.Time) (int, error)
+	LockLogin(login string, until time.Time) error
+	ResetLoginFailures(login string) error
+	SaveKey(id string, key []byte) error
+	GetKey(id string) (int, *models.SealedKey, error)
+	RotateItems(b *models.ItemBatch, id, sessionID string) (int, error)
+	Sync(id string, since int64) (int, *models.SyncDelta, error)
+	GetHistory(id, itemType string, uid int) (int, []models.HistoryEntry, error)
+	RestoreItem(id, itemType string, uid int, from, version int64) (int, *models.HistoryEntry, error)
+	GetHistoryDepth(id string) (int, int, error)
+	SetHistoryDepth(id string, depth int) (int, error)
+	GetTrash(id string) (int, []models.TrashEntry, error)
+	RestoreTrash(id, itemType string, uid int) (int, error)
+	EmptyTrash(id string) (int, error)
+	PurgeTrash(before time.Time) (int, error)
 }
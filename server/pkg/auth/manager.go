@@ -1,48 +1,388 @@
 // Package auth пакет предоставляет возможность создания и проверки токенов авторизации.
+// Токены подписываются активным ключом из конфига и содержат его идентификатор (kid),
+// поэтому старые ключи можно оставить только для проверки и менять ключи без разлогина пользователей.
 package auth
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
 )
 
+// Время жизни токенов, если в конфиге не задано другое.
 const (
-	salt      = "fsdfsdfsdfsdf"
-	signinKey = "gsdfgdfg$564gdf"
-	tokenTTL  = 12 * time.Hour
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// minSecretSize - минимальная длина секрета HS256 в байтах, не меньше размера подписи SHA-256.
+const minSecretSize = 32
+
+// Токен входа со вторым фактором выдается после проверки пароля и годится только для ввода кода.
+const (
+	challengeTTL      = 5 * time.Minute
+	challengeAudience = "2fa"
 )
 
 type tokenClaims struct {
 	jwt.StandardClaims
-	Login string `json:"login"`
+	Login   string `json:"login"`
+	Session string `json:"sid,omitempty"`
+}
+
+// Claims - данные проверенного токена доступа.
+type Claims struct {
+	UserID    string    // Идентификатор пользователя.
+	ID        string    // Идентификатор токена (jti), по нему токен отзывается.
+	SessionID string    // Идентификатор сессии (sid), в которой выпущен токен.
+	ExpiresAt time.Time // Время, после которого токен недействителен.
+}
+
+// verifyKey - ключ проверки подписи вместе с алгоритмом, которым он подписывает.
+type verifyKey struct {
+	method jwt.SigningMethod
+	key    interface{}
+}
+
+// Manager - структура выпуска и проверки токенов.
+type Manager struct {
+	method     jwt.SigningMethod
+	kid        string
+	signKey    interface{}
+	verifyKeys map[string]verifyKey
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// JWK - открытый ключ проверки токенов в формате JSON Web Key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// NewManager - функция создания менеджера токенов по конфигу.
+// HS256 подписывает секретом SessionKey, RS256 и EdDSA - закрытым ключом из файла JWTPrivateKey.
+// Пустой, короткий или известный секрет не принимается: любой, кто его знает, может подделать токены.
+// Ключи из JWTOldSecrets и JWTOldPublicKeys ("kid:значение" через запятую) используются только для проверки.
+func NewManager(cfg *config.Config) (*Manager, error) {
+	m := &Manager{
+		kid:        cfg.JWTKeyID,
+		verifyKeys: make(map[string]verifyKey),
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+	}
+	if m.accessTTL <= 0 {
+		m.accessTTL = accessTokenTTL
+	}
+	if m.refreshTTL <= 0 {
+		m.refreshTTL = refreshTokenTTL
+	}
+	switch cfg.JWTAlgorithm {
+	case jwt.SigningMethodHS256.Alg():
+		if err := checkSecret(cfg.SessionKey); err != nil {
+			return nil, err
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(cfg.SessionKey)
+		m.verifyKeys[m.kid] = verifyKey{method: m.method, key: m.signKey}
+	case jwt.SigningMethodRS256.Alg(), SigningMethodEdDSA.Alg():
+		private, err := loadPrivateKey(cfg.JWTPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		m.method, m.signKey = jwt.GetSigningMethod(cfg.JWTAlgorithm), private
+		public, method, err := publicKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		if method != m.method {
+			return nil, fmt.Errorf("key %s is not a %s key", cfg.JWTPrivateKey, cfg.JWTAlgorithm)
+		}
+		m.verifyKeys[m.kid] = verifyKey{method: m.method, key: public}
+	default:
+		return nil, fmt.Errorf("unknown jwt algorithm %s", cfg.JWTAlgorithm)
+	}
+
+	old, err := splitKeys(cfg.JWTOldSecrets)
+	if err != nil {
+		return nil, err
+	}
+	for kid, secret := range old {
+		if err = m.addVerifyKey(kid, verifyKey{method: jwt.SigningMethodHS256, key: []byte(secret)}); err != nil {
+			return nil, err
+		}
+	}
+	old, err = splitKeys(cfg.JWTOldPublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	for kid, path := range old {
+		key, method, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.addVerifyKey(kid, verifyKey{method: method, key: key}); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// checkSecret - проверка, что секретом HS256 нельзя подписать токен, не зная конфига сервера.
+func checkSecret(secret string) error {
+	switch {
+	case secret == "":
+		return errors.New("empty session key, set it with -k or SESSION_KEY")
+	case secret == "secret":
+		return errors.New("session key is the well-known default \"secret\", set a random key with -k or SESSION_KEY")
+	case len(secret) < minSecretSize:
+		return fmt.Errorf("session key is shorter than %d bytes", minSecretSize)
+	}
+	return nil
+}
+
+func (m *Manager) addVerifyKey(kid string, key verifyKey) error {
+	if _, ok := m.verifyKeys[kid]; ok {
+		return fmt.Errorf("duplicate jwt key id %s", kid)
+	}
+	m.verifyKeys[kid] = key
+	return nil
+}
+
+// GenerateToken - выпуск короткоживущего токена доступа со случайным идентификатором (jti) для сессии sessionID.
+func (m *Manager) GenerateToken(id, sessionID string) (string, error) {
+	jti, err := NewID()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(m.method, &tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			ExpiresAt: time.Now().Add(m.accessTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+		Login:   id,
+		Session: sessionID,
+	})
+	token.Header["kid"] = m.kid
+	return token.SignedString(m.signKey)
+}
+
+// ParseToken - проверка подписи и срока действия токена доступа.
+func (m *Manager) ParseToken(accessToken string) (*Claims, error) {
+	claims, err := m.parse(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	//токен входа со вторым фактором не дает доступа к данным
+	if claims.Audience != "" {
+		return nil, errors.New("not an access token")
+	}
+	return &Claims{
+		UserID:    claims.Login,
+		ID:        claims.Id,
+		SessionID: claims.Session,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
 }
 
-func GenerateToken(id string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
+// GenerateChallenge - выпуск токена входа со вторым фактором для пользователя id, который уже ввел верный пароль.
+func (m *Manager) GenerateChallenge(id string) (string, error) {
+	token := jwt.NewWithClaims(m.method, &tokenClaims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
+			Audience:  challengeAudience,
+			ExpiresAt: time.Now().Add(challengeTTL).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 		Login: id,
 	})
-	return token.SignedString([]byte(signinKey))
+	token.Header["kid"] = m.kid
+	return token.SignedString(m.signKey)
 }
 
-func ParseToken(accessToken string) (string, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// ParseChallenge - проверка токена входа со вторым фактором, возвращает идентификатор пользователя.
+func (m *Manager) ParseChallenge(challenge string) (string, error) {
+	claims, err := m.parse(challenge)
+	if err != nil {
+		return "", err
+	}
+	if claims.Audience != challengeAudience {
+		return "", errors.New("not a challenge token")
+	}
+	return claims.Login, nil
+}
+
+// parse - проверка подписи и срока действия любого токена сервера.
+func (m *Manager) parse(tokenString string) (*tokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = m.kid
+		}
+		key, ok := m.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %s", kid)
+		}
+		//алгоритм задается ключом, а не заголовком токена
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(signinKey), nil
+		return key.key, nil
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	claims, ok := token.Claims.(*tokenClaims)
 	if !ok {
-		return "", errors.New("token claims are not type *tokenClaims")
+		return nil, errors.New("token claims are not type *tokenClaims")
 	}
-	return claims.Login, nil
+	return claims, nil
+}
+
+// GenerateRefreshToken - выпуск случайного токена обновления. Возвращает сам токен, его хэш для хранения и срок действия.
+func (m *Manager) GenerateRefreshToken() (string, string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), time.Now().Add(m.refreshTTL), nil
+}
+
+// HashRefreshToken - хэш токена обновления. В хранилище попадает только хэш, сам токен знает лишь клиент.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID - случайный идентификатор токена или семейства токенов.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// PublicKeys - открытые ключи проверки токенов для других сервисов. Секреты HS256 не отдаются.
+func (m *Manager) PublicKeys() []JWK {
+	keys := make([]JWK, 0, len(m.verifyKeys))
+	for kid, k := range m.verifyKeys {
+		jwk := JWK{Kid: kid, Alg: k.method.Alg(), Use: "sig"}
+		switch key := k.key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(key)
+		default:
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
+
+// splitKeys - разбор строки вида "kid1:значение1,kid2:значение2".
+func splitKeys(s string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, value, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || value == "" {
+			return nil, fmt.Errorf("wrong jwt key %q, expected kid:value", pair)
+		}
+		keys[kid] = value
+	}
+	return keys, nil
+}
+
+// loadPrivateKey - чтение закрытого ключа RSA или Ed25519 из PEM файла (PKCS#8 или PKCS#1).
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key in %s", path)
+	}
+	return signer, nil
+}
+
+// loadPublicKey - чтение открытого ключа RSA или Ed25519 из PEM файла (PKIX или PKCS#1).
+func loadPublicKey(path string) (interface{}, jwt.SigningMethod, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return publicKey(key)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey(key)
+}
+
+// publicKey - определение алгоритма подписи по типу открытого ключа.
+func publicKey(key crypto.PublicKey) (interface{}, jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return k, jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return k, SigningMethodEdDSA, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
 }
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+)
+
+// Секреты HS256 для тестов, не короче minSecretSize.
+const (
+	testSecret = "test-secret-0123456789abcdef012345"
+	oldSecret  = "old-secret-0123456789abcdef0123456"
+)
+
+// writeKeys - запись закрытого (PKCS#8) и открытого (PKIX) ключей во временные PEM файлы.
+func writeKeys(t *testing.T, private interface{}, public interface{}) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	assert.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	assert.NoError(t, err)
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	assert.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	assert.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0600))
+	return privatePath, publicPath
+}
+
+func TestManager_HS256Rotation(t *testing.T) {
+	old, err := NewManager(&config.Config{JWTAlgorithm: "HS256", JWTKeyID: "1", SessionKey: oldSecret})
+	assert.NoError(t, err)
+	oldToken, err := old.GenerateToken("42", "")
+	assert.NoError(t, err)
+
+	m, err := NewManager(&config.Config{
+		JWTAlgorithm:  "HS256",
+		JWTKeyID:      "2",
+		SessionKey:    testSecret,
+		JWTOldSecrets: "1:" + oldSecret,
+	})
+	assert.NoError(t, err)
+	token, err := m.GenerateToken("7", "")
+	assert.NoError(t, err)
+
+	claims, err := m.ParseToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", claims.UserID)
+	//токен, подписанный старым ключом, продолжает работать
+	claims, err = m.ParseToken(oldToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", claims.UserID)
+	//старый ключ не знает нового
+	_, err = old.ParseToken(token)
+	assert.Error(t, err)
+	//секреты HS256 не публикуются
+	assert.Empty(t, m.PublicKeys())
+}
+
+func TestManager_Asymmetric(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	rsaPrivatePath, rsaPublicPath := writeKeys(t, rsaKey, &rsaKey.PublicKey)
+	edPrivatePath, _ := writeKeys(t, edPrivate, edPublic)
+
+	rs, err := NewManager(&config.Config{JWTAlgorithm: "RS256", JWTKeyID: "rsa", JWTPrivateKey: rsaPrivatePath})
+	assert.NoError(t, err)
+	rsToken, err := rs.GenerateToken("1", "")
+	assert.NoError(t, err)
+
+	ed, err := NewManager(&config.Config{
+		JWTAlgorithm:     "EdDSA",
+		JWTKeyID:         "ed",
+		JWTPrivateKey:    edPrivatePath,
+		JWTOldPublicKeys: "rsa:" + rsaPublicPath,
+	})
+	assert.NoError(t, err)
+	edToken, err := ed.GenerateToken("2", "")
+	assert.NoError(t, err)
+
+	claims, err := ed.ParseToken(edToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", claims.UserID)
+	claims, err = ed.ParseToken(rsToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", claims.UserID)
+
+	keys := ed.PublicKeys()
+	assert.Len(t, keys, 2)
+	assert.Equal(t, JWK{Kty: "OKP", Kid: "ed", Alg: "EdDSA", Use: "sig", Crv: "Ed25519", X: keys[0].X}, keys[0])
+	assert.Equal(t, "RSA", keys[1].Kty)
+	assert.Equal(t, "AQAB", keys[1].E)
+
+	//HS256 токен, подписанный открытым ключом как секретом, не принимается
+	publicPEM, err := os.ReadFile(rsaPublicPath)
+	assert.NoError(t, err)
+	forged, err := NewManager(&config.Config{JWTAlgorithm: "HS256", JWTKeyID: "rsa", SessionKey: string(publicPEM)})
+	assert.NoError(t, err)
+	forgedToken, err := forged.GenerateToken("1", "")
+	assert.NoError(t, err)
+	_, err = ed.ParseToken(forgedToken)
+	assert.Error(t, err)
+}
+
+func TestManager_Tokens(t *testing.T) {
+	m, err := NewManager(&config.Config{
+		JWTAlgorithm:    "HS256",
+		JWTKeyID:        "1",
+		SessionKey:      testSecret,
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+
+	first, err := m.GenerateToken("1", "s1")
+	assert.NoError(t, err)
+	second, err := m.GenerateToken("1", "")
+	assert.NoError(t, err)
+	a, err := m.ParseToken(first)
+	assert.NoError(t, err)
+	b, err := m.ParseToken(second)
+	assert.NoError(t, err)
+	//у каждого токена свой jti, чтобы отзывать их по одному
+	assert.NotEmpty(t, a.ID)
+	assert.NotEqual(t, a.ID, b.ID)
+	assert.Equal(t, "s1", a.SessionID)
+	assert.Empty(t, b.SessionID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), a.ExpiresAt, 2*time.Second)
+
+	refresh, hash, expiresAt, err := m.GenerateRefreshToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, refresh, hash)
+	assert.Equal(t, hash, HashRefreshToken(refresh))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, 2*time.Second)
+
+	//истекший токен не принимается
+	expired, err := NewManager(&config.Config{JWTAlgorithm: "HS256", JWTKeyID: "1", SessionKey: testSecret})
+	assert.NoError(t, err)
+	expired.accessTTL = -time.Minute
+	token, err := expired.GenerateToken("1", "")
+	assert.NoError(t, err)
+	_, err = m.ParseToken(token)
+	assert.Error(t, err)
+}
+
+func TestManager_Challenge(t *testing.T) {
+	m, err := NewManager(&config.Config{JWTAlgorithm: "HS256", JWTKeyID: "1", SessionKey: testSecret})
+	assert.NoError(t, err)
+
+	challenge, err := m.GenerateChallenge("7")
+	assert.NoError(t, err)
+	id, err := m.ParseChallenge(challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", id)
+	//токен входа нельзя использовать как токен доступа и наоборот
+	_, err = m.ParseToken(challenge)
+	assert.Error(t, err)
+	token, err := m.GenerateToken("7", "")
+	assert.NoError(t, err)
+	_, err = m.ParseChallenge(token)
+	assert.Error(t, err)
+}
+
+func TestNewManager_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{
+			name: "unknown algorithm",
+			cfg:  config.Config{JWTAlgorithm: "none", SessionKey: testSecret},
+		},
+		{
+			name: "empty secret",
+			cfg:  config.Config{JWTAlgorithm: "HS256"},
+		},
+		{
+			name: "default secret",
+			cfg:  config.Config{JWTAlgorithm: "HS256", SessionKey: "secret"},
+		},
+		{
+			name: "short secret",
+			cfg:  config.Config{JWTAlgorithm: "HS256", SessionKey: testSecret[:minSecretSize-1]},
+		},
+		{
+			name: "no private key",
+			cfg:  config.Config{JWTAlgorithm: "RS256", JWTPrivateKey: "not-exists.pem"},
+		},
+		{
+			name: "wrong old keys",
+			cfg:  config.Config{JWTAlgorithm: "HS256", SessionKey: testSecret, JWTOldSecrets: "secret"},
+		},
+		{
+			name: "duplicate kid",
+			cfg:  config.Config{JWTAlgorithm: "HS256", JWTKeyID: "1", SessionKey: testSecret, JWTOldSecrets: "1:old"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewManager(&tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
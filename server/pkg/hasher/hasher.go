@@ -0,0 +1,168 @@
+// Package hasher пакет предоставляет хэширование мастер-паролей пользователей.
+// Хэш хранится в одной строке вместе с алгоритмом, параметрами и солью (формат PHC),
+// поэтому параметры можно менять без потери старых хэшей.
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+)
+
+// Алгоритмы хэширования.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+	// legacyHMAC - старый хэш HMAC-SHA256 с постоянным ключом, только для проверки и перехэширования.
+	legacyHMAC = "hmac-sha256"
+)
+
+const (
+	saltLength   = 16
+	argon2KeyLen = 32
+)
+
+// Hasher - интерфейс хэширования паролей.
+type Hasher interface {
+	Hash(password string) (string, error)          // Хэширование пароля текущим алгоритмом.
+	Verify(password, encoded string) (bool, error) // Проверка пароля по хэшу любого поддерживаемого алгоритма.
+	NeedsRehash(encoded string) bool               // Хэш создан другим алгоритмом или с другими параметрами.
+}
+
+// PasswordHasher - структура хэширования паролей с параметрами из конфига.
+type PasswordHasher struct {
+	algorithm     string
+	argon2Time    uint32
+	argon2Memory  uint32
+	argon2Threads uint8
+	bcryptCost    int
+}
+
+// NewPasswordHasher - функция создания нового хэширования паролей.
+func NewPasswordHasher(cfg *config.Config) *PasswordHasher {
+	return &PasswordHasher{
+		algorithm:     cfg.HashAlgorithm,
+		argon2Time:    uint32(cfg.Argon2Time),
+		argon2Memory:  uint32(cfg.Argon2Memory),
+		argon2Threads: uint8(cfg.Argon2Threads),
+		bcryptCost:    cfg.BcryptCost,
+	}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.algorithm {
+	case Argon2id:
+		salt := make([]byte, saltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.argon2Time, h.argon2Memory, h.argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+			h.argon2Memory, h.argon2Time, h.argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %s", h.algorithm)
+	}
+}
+
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	switch algorithm(encoded) {
+	case Argon2id:
+		p, err := parseArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return subtle.ConstantTimeCompare([]byte(legacyHash(password)), []byte(encoded)) == 1, nil
+	}
+}
+
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	if algorithm(encoded) != h.algorithm {
+		return true
+	}
+	switch h.algorithm {
+	case Argon2id:
+		p, err := parseArgon2(encoded)
+		return err != nil || p.time != h.argon2Time || p.memory != h.argon2Memory || p.threads != h.argon2Threads
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost != h.bcryptCost
+	}
+	return false
+}
+
+// algorithm - определение алгоритма по строке хэша.
+func algorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$"+Argon2id+"$"):
+		return Argon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt
+	default:
+		return legacyHMAC
+	}
+}
+
+// argon2Params - разобранный хэш argon2id.
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2 - разбор строки вида $argon2id$v=19$m=65536,t=3,p=2$соль$хэш.
+func parseArgon2(encoded string) (*argon2Params, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("wrong argon2id hash format")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// legacyHash - старое хэширование пароля HMAC-SHA256, которым созданы хэши до перехода на argon2id.
+func legacyHash(pass string) string {
+	h := hmac.New(sha256.New, []byte("password"))
+	h.Write([]byte(pass))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/CyrilSbrodov/passManager.git/server/cmd/config"
+)
+
+func newTestConfig(algorithm string) *config.Config {
+	return &config.Config{
+		HashAlgorithm: algorithm,
+		Argon2Time:    1,
+		Argon2Memory:  64,
+		Argon2Threads: 1,
+		BcryptCost:    4,
+	}
+}
+
+func TestPasswordHasher_HashVerify(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		prefix    string
+	}{
+		{
+			name:      "argon2id",
+			algorithm: Argon2id,
+			prefix:    "$argon2id$v=19$m=64,t=1,p=1$",
+		},
+		{
+			name:      "bcrypt",
+			algorithm: Bcrypt,
+			prefix:    "$2a$04$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewPasswordHasher(newTestConfig(tt.algorithm))
+			hash, err := h.Hash("password")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.prefix), hash)
+
+			//соль делает хэши одинаковых паролей разными
+			other, err := h.Hash("password")
+			assert.NoError(t, err)
+			assert.NotEqual(t, hash, other)
+
+			ok, err := h.Verify("password", hash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = h.Verify("wrong", hash)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.False(t, h.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	argon := NewPasswordHasher(newTestConfig(Argon2id))
+	bcrypt := NewPasswordHasher(newTestConfig(Bcrypt))
+	argonHash, err := argon.Hash("password")
+	assert.NoError(t, err)
+	bcryptHash, err := bcrypt.Hash("password")
+	assert.NoError(t, err)
+
+	//старый хэш HMAC-SHA256 проверяется, но требует замены
+	ok, err := argon.Verify("password", legacyHash("password"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, argon.NeedsRehash(legacyHash("password")))
+
+	//хэш другого алгоритма проверяется, но требует замены
+	ok, err = argon.Verify("password", bcryptHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, argon.NeedsRehash(bcryptHash))
+	assert.True(t, bcrypt.NeedsRehash(argonHash))
+
+	//изменились параметры
+	cfg := newTestConfig(Argon2id)
+	cfg.Argon2Time = 2
+	assert.True(t, NewPasswordHasher(cfg).NeedsRehash(argonHash))
+	cfg = newTestConfig(Bcrypt)
+	cfg.BcryptCost = 5
+	assert.True(t, NewPasswordHasher(cfg).NeedsRehash(bcryptHash))
+}
+
+func TestPasswordHasher_UnknownAlgorithm(t *testing.T) {
+	_, err := NewPasswordHasher(newTestConfig("md5")).Hash("password")
+	assert.Error(t, err)
+}
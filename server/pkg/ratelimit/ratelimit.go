@@ -0,0 +1,110 @@
+// Package ratelimit пакет ограничивает частоту запросов алгоритмом корзины токенов (token bucket).
+// Состояние корзин хранится в Store: по умолчанию в памяти процесса, для нескольких серверов можно подключить общее хранилище.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket - состояние корзины токенов одного ключа.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Store - интерфейс хранилища корзин.
+type Store interface {
+	// Update - атомарное изменение корзины key функцией update. Новая корзина передается с нулевым Updated.
+	Update(key string, update func(b *Bucket))
+}
+
+// Limiter - структура ограничителя: burst запросов подряд, дальше rate запросов в секунду.
+type Limiter struct {
+	rate  float64
+	burst float64
+	store Store
+	now   func() time.Time
+}
+
+// New - функция создания нового ограничителя.
+func New(rate float64, burst int, store Store) *Limiter {
+	return &Limiter{
+		rate:  rate,
+		burst: float64(burst),
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// PerMinute - ограничитель на n запросов в минуту с корзиной на n запросов, корзины хранятся в памяти.
+func PerMinute(n int) *Limiter {
+	return New(float64(n)/60, n, NewMemoryStore(time.Duration(float64(time.Minute)*1.5)))
+}
+
+// Allow - забирает токен из корзины key. Если токенов нет, возвращает false и время до появления токена.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	var allowed bool
+	var wait time.Duration
+	now := l.now()
+	l.store.Update(key, func(b *Bucket) {
+		if b.Updated.IsZero() {
+			b.Tokens = l.burst
+		} else {
+			b.Tokens = math.Min(l.burst, b.Tokens+now.Sub(b.Updated).Seconds()*l.rate)
+		}
+		b.Updated = now
+		if b.Tokens >= 1 {
+			b.Tokens--
+			allowed = true
+			return
+		}
+		wait = time.Duration((1 - b.Tokens) / l.rate * float64(time.Second))
+	})
+	return allowed, wait
+}
+
+// MemoryStore - хранилище корзин в памяти процесса. Корзины, которые не менялись дольше idle, удаляются.
+type MemoryStore struct {
+	mu      sync.Mutex
+	idle    time.Duration
+	buckets map[string]*Bucket
+	cleaned time.Time
+}
+
+// NewMemoryStore - функция создания нового хранилища корзин в памяти.
+// idle должно быть не меньше времени полного наполнения корзины, иначе удаленная корзина вернется полной раньше срока.
+func NewMemoryStore(idle time.Duration) *MemoryStore {
+	return &MemoryStore{
+		idle:    idle,
+		buckets: make(map[string]*Bucket),
+		cleaned: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Update(key string, update func(b *Bucket)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &Bucket{}
+		s.buckets[key] = b
+	}
+	update(b)
+	s.cleanup(b.Updated)
+}
+
+// cleanup - удаление старых корзин не чаще раза в idle. Вызывается под блокировкой.
+func (s *MemoryStore) cleanup(now time.Time) {
+	if now.Sub(s.cleaned) < s.idle {
+		return
+	}
+	s.cleaned = now
+	for key, b := range s.buckets {
+		if now.Sub(b.Updated) > s.idle {
+			delete(s.buckets, key)
+		}
+	}
+}
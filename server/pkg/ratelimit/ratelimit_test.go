@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	l := New(1, 3, NewMemoryStore(time.Minute))
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, wait := l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+	//у другого ключа своя корзина
+	ok, _ = l.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, wait = l.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	assert.True(t, ok)
+
+	//корзина наполняется не больше burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = l.Allow("a")
+		assert.True(t, ok)
+	}
+	ok, _ = l.Allow("a")
+	assert.False(t, ok)
+}
+
+func TestMemoryStore_Cleanup(t *testing.T) {
+	s := NewMemoryStore(time.Minute)
+	now := time.Now()
+	s.Update("old", func(b *Bucket) { b.Updated = now })
+	s.Update("new", func(b *Bucket) { b.Updated = now.Add(2 * time.Minute) })
+	assert.Len(t, s.buckets, 1)
+	assert.Contains(t, s.buckets, "new")
+}
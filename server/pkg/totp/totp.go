@@ -0,0 +1,120 @@
+// Package totp пакет реализует одноразовые пароли по времени (TOTP, RFC 6238) для двухфакторной аутентификации
+// и одноразовые коды восстановления на случай потери устройства.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры кодов, совместимые с приложениями-аутентификаторами.
+const (
+	Digits     = 6
+	Period     = 30
+	secretSize = 20
+	// skew - сколько соседних интервалов принимается, чтобы пережить расхождение часов.
+	skew = 1
+)
+
+// Параметры кодов восстановления.
+const (
+	RecoveryCodes      = 10
+	recoveryCodeLength = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret - случайный секрет в base32, как его показывают приложения-аутентификаторы.
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// URI - ссылка otpauth:// для QR кода приложения-аутентификатора.
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(Period))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// Step - номер интервала для момента t.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code - код для интервала step (HOTP, RFC 4226).
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1_000_000), nil
+}
+
+// Validate - проверка кода на момент t с допуском в один интервал.
+// Возвращает интервал, которому соответствует код, чтобы не принимать один код дважды.
+func Validate(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for step := now - skew; step <= now+skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes - случайные коды восстановления вида xxxxx-xxxxx.
+func GenerateRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, RecoveryCodes)
+	for i := range codes {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:recoveryCodeLength/2]) + "-" + string(b[recoveryCodeLength/2:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode - хэш кода восстановления для хранения. Регистр, пробелы и дефисы не учитываются.
+func HashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
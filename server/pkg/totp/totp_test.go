@@ -0,0 +1,66 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCode_RFC6238(t *testing.T) {
+	//тестовые значения RFC 6238 для SHA1, последние 6 цифр
+	secret := encoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{time: 59, code: "287082"},
+		{time: 1111111109, code: "081804"},
+		{time: 1111111111, code: "050471"},
+		{time: 1234567890, code: "005924"},
+		{time: 2000000000, code: "279037"},
+		{time: 20000000000, code: "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code, err := Code(secret, Step(time.Unix(tt.time, 0)))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	assert.NoError(t, err)
+
+	step, ok := Validate(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+	//соседний интервал принимается, дальний нет
+	_, ok = Validate(secret, code, now.Add(Period*time.Second))
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(3*Period*time.Second))
+	assert.False(t, ok)
+	_, ok = Validate(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("PassManager", "user@example.com", "ABC")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/PassManager:user@example.com?"))
+	assert.Contains(t, uri, "secret=ABC")
+	assert.Contains(t, uri, "issuer=PassManager")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodes)
+	assert.NotEqual(t, codes[0], codes[1])
+	assert.Equal(t, HashRecoveryCode(codes[0]), HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}